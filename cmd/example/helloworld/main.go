@@ -68,9 +68,10 @@ func newCommand() *cobra.Command {
 
 func newControllerCommand() *cobra.Command {
 	o := cloudevents.NewCloudEventsOptions()
-	c := &addManagerConfig{cloudeventsOptions: o}
+	c := &addManagerConfig{cloudeventsOptions: o, readiness: addonmanager.NewReadiness()}
 	cmd := cmdfactory.
 		NewControllerCommandConfig("helloworld-addon-controller", version.Get(), c.runController).
+		WithReadyzChecks(c.readiness).
 		NewCommand()
 	cmd.Use = "controller"
 	cmd.Short = "Start the addon controller"
@@ -82,6 +83,7 @@ func newControllerCommand() *cobra.Command {
 // addManagerConfig holds cloudevents configuration for addon manager
 type addManagerConfig struct {
 	cloudeventsOptions *cloudevents.CloudEventsOptions
+	readiness          *addonmanager.Readiness
 }
 
 func (c *addManagerConfig) runController(ctx context.Context, kubeConfig *rest.Config) error {
@@ -92,12 +94,12 @@ func (c *addManagerConfig) runController(ctx context.Context, kubeConfig *rest.C
 
 	var mgr addonmanager.AddonManager
 	if c.cloudeventsOptions.WorkDriver == "kube" {
-		mgr, err = addonmanager.New(kubeConfig)
+		mgr, err = addonmanager.NewWithOptionFuncs(kubeConfig, addonmanager.WithReadiness(c.readiness))
 		if err != nil {
 			return err
 		}
 	} else {
-		mgr, err = cloudevents.New(kubeConfig, c.cloudeventsOptions)
+		mgr, err = cloudevents.New(kubeConfig, c.cloudeventsOptions, addonmanager.WithReadiness(c.readiness))
 		if err != nil {
 			return err
 		}
@@ -14,110 +14,35 @@ import (
 	corev1informers "k8s.io/client-go/informers/core/v1"
 	"k8s.io/client-go/kubernetes"
 	corev1lister "k8s.io/client-go/listers/core/v1"
-	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
-	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/klog/v2"
-	cmdfactory "open-cluster-management.io/addon-framework/pkg/cmd/factory"
-	"open-cluster-management.io/addon-framework/pkg/lease"
-	"open-cluster-management.io/addon-framework/pkg/version"
+	agentruntime "open-cluster-management.io/addon-framework/pkg/agent/runtime"
 	addonv1alpha1client "open-cluster-management.io/api/client/addon/clientset/versioned"
 	"open-cluster-management.io/sdk-go/pkg/basecontroller/factory"
 )
 
 func NewAgentCommand(addonName string) *cobra.Command {
-	o := NewAgentOptions(addonName)
-	cmd := cmdfactory.
-		NewControllerCommandConfig("helloworld-addon-agent", version.Get(), o.RunAgent).
+	return agentruntime.NewAgentConfig("helloworld-addon-agent", agentruntime.NewAgentOptions(addonName), RunAgent).
 		NewCommand()
-	cmd.Use = "agent"
-	cmd.Short = "Start the addon agent"
-
-	o.AddFlags(cmd)
-	return cmd
-}
-
-// AgentOptions defines the flags for workload agent
-type AgentOptions struct {
-	HubKubeconfigFile     string
-	ManagedKubeconfigFile string
-	SpokeClusterName      string
-	AddonName             string
-	AddonNamespace        string
-}
-
-// NewAgentOptions returns the flags with default value set
-func NewAgentOptions(addonName string) *AgentOptions {
-	return &AgentOptions{AddonName: addonName}
-}
-
-func (o *AgentOptions) AddFlags(cmd *cobra.Command) {
-	flags := cmd.Flags()
-	// This command only supports reading from config
-	flags.StringVar(&o.HubKubeconfigFile, "hub-kubeconfig", o.HubKubeconfigFile,
-		"Location of kubeconfig file to connect to hub cluster.")
-	flags.StringVar(&o.ManagedKubeconfigFile, "managed-kubeconfig", o.ManagedKubeconfigFile,
-		"Location of kubeconfig file to connect to the managed cluster.")
-	flags.StringVar(&o.SpokeClusterName, "cluster-name", o.SpokeClusterName, "Name of spoke cluster.")
-	flags.StringVar(&o.AddonNamespace, "addon-namespace", o.AddonNamespace, "Installation namespace of addon.")
-	flags.StringVar(&o.AddonName, "addon-name", o.AddonName, "name of the addon.")
 }
 
 // RunAgent starts the controllers on agent to process work from hub.
-func (o *AgentOptions) RunAgent(ctx context.Context, kubeconfig *rest.Config) error {
-	// build managementKubeClient of the local cluster
-	managementKubeClient, err := kubernetes.NewForConfig(kubeconfig)
-	if err != nil {
-		return err
-	}
-
-	spokeKubeClient := managementKubeClient
-	if len(o.ManagedKubeconfigFile) != 0 {
-		managedRestConfig, err := clientcmd.BuildConfigFromFlags("", /* leave masterurl as empty */
-			o.ManagedKubeconfigFile)
-		if err != nil {
-			return err
-		}
-		spokeKubeClient, err = kubernetes.NewForConfig(managedRestConfig)
-		if err != nil {
-			return err
-		}
-	}
-
-	// build kubeinformerfactory of hub cluster
-	hubRestConfig, err := clientcmd.BuildConfigFromFlags("" /* leave masterurl as empty */, o.HubKubeconfigFile)
-	if err != nil {
-		return err
-	}
-	hubKubeClient, err := kubernetes.NewForConfig(hubRestConfig)
-	if err != nil {
-		return err
-	}
-	addonClient, err := addonv1alpha1client.NewForConfig(hubRestConfig)
-	if err != nil {
-		return err
-	}
-	hubKubeInformerFactory := informers.NewSharedInformerFactoryWithOptions(hubKubeClient, 10*time.Minute, informers.WithNamespace(o.SpokeClusterName))
+func RunAgent(ctx context.Context, agentCtx *agentruntime.AgentContext) error {
+	hubKubeInformerFactory := informers.NewSharedInformerFactoryWithOptions(
+		agentCtx.HubKubeClient, 10*time.Minute, informers.WithNamespace(agentCtx.ClusterName))
 
 	// create an agent controller
 	agent := newAgentController(
-		spokeKubeClient,
-		addonClient,
+		agentCtx.ManagedKubeClient,
+		agentCtx.HubAddonClient,
 		hubKubeInformerFactory.Core().V1().ConfigMaps(),
-		o.SpokeClusterName,
-		o.AddonName,
-		o.AddonNamespace,
-	)
-	// create a lease updater
-	leaseUpdater := lease.NewLeaseUpdater(
-		managementKubeClient,
-		o.AddonName,
-		o.AddonNamespace,
+		agentCtx.ClusterName,
+		agentCtx.AddonName,
+		agentCtx.AddonNamespace,
 	)
 
 	go hubKubeInformerFactory.Start(ctx.Done())
 	go agent.Run(ctx, 1)
-	go leaseUpdater.Start(ctx)
 
 	<-ctx.Done()
 	return nil
@@ -0,0 +1,185 @@
+package addonfactory
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+)
+
+// The names of the customizedVariables in AddOnDeploymentConfig which are conventionally used to configure the
+// scheduling, security and scale of the addon agent workloads. The values of the structured variables are in json
+// format, for example:
+//
+//	customizedVariables:
+//	- name: priorityClassName
+//	  value: system-cluster-critical
+//	- name: replicas
+//	  value: "2"
+//	- name: topologySpreadConstraints
+//	  value: '[{"maxSkew":1,"topologyKey":"topology.kubernetes.io/zone","whenUnsatisfiable":"ScheduleAnyway"}]'
+const (
+	// AffinityVariableName is the variable of the pod affinity, the value is a json of corev1.Affinity.
+	AffinityVariableName = "affinity"
+	// TolerationsVariableName is the variable of the additional tolerations, the value is a json list of
+	// corev1.Toleration. They are merged with the tolerations in spec.nodePlacement.
+	TolerationsVariableName = "tolerations"
+	// TopologySpreadConstraintsVariableName is the variable of the pod topology spread constraints, the value is a
+	// json list of corev1.TopologySpreadConstraint.
+	TopologySpreadConstraintsVariableName = "topologySpreadConstraints"
+	// PriorityClassNameVariableName is the variable of the pod priority class name.
+	PriorityClassNameVariableName = "priorityClassName"
+	// PodSecurityContextVariableName is the variable of the pod security context, the value is a json of
+	// corev1.PodSecurityContext.
+	PodSecurityContextVariableName = "podSecurityContext"
+	// SecurityContextVariableName is the variable of the container security context, the value is a json of
+	// corev1.SecurityContext.
+	SecurityContextVariableName = "securityContext"
+	// ReplicasVariableName is the variable of the replica count of the agent deployments.
+	ReplicasVariableName = "replicas"
+)
+
+// AgentWorkloadConfig is the scheduling, security and scale settings of the addon agent workloads, which are
+// resolved from the spec.nodePlacement and the conventional customizedVariables of AddOnDeploymentConfig.
+type AgentWorkloadConfig struct {
+	NodeSelector              map[string]string                 `json:"nodeSelector,omitempty"`
+	Tolerations               []corev1.Toleration               `json:"tolerations,omitempty"`
+	Affinity                  *corev1.Affinity                  `json:"affinity,omitempty"`
+	TopologySpreadConstraints []corev1.TopologySpreadConstraint `json:"topologySpreadConstraints,omitempty"`
+	PriorityClassName         string                            `json:"priorityClassName,omitempty"`
+	PodSecurityContext        *corev1.PodSecurityContext        `json:"podSecurityContext,omitempty"`
+	SecurityContext           *corev1.SecurityContext           `json:"securityContext,omitempty"`
+	Replicas                  *int32                            `json:"replicas,omitempty"`
+}
+
+// GetAgentWorkloadConfig resolves the AgentWorkloadConfig from the AddOnDeploymentConfig, an error is returned if
+// a conventional customizedVariable has an invalid value.
+func GetAgentWorkloadConfig(config addonapiv1alpha1.AddOnDeploymentConfig) (*AgentWorkloadConfig, error) {
+	workload := &AgentWorkloadConfig{}
+	if config.Spec.NodePlacement != nil {
+		workload.NodeSelector = config.Spec.NodePlacement.NodeSelector
+		workload.Tolerations = append(workload.Tolerations, config.Spec.NodePlacement.Tolerations...)
+	}
+
+	for _, variable := range config.Spec.CustomizedVariables {
+		var err error
+		switch variable.Name {
+		case AffinityVariableName:
+			workload.Affinity = &corev1.Affinity{}
+			err = json.Unmarshal([]byte(variable.Value), workload.Affinity)
+		case TolerationsVariableName:
+			var tolerations []corev1.Toleration
+			err = json.Unmarshal([]byte(variable.Value), &tolerations)
+			workload.Tolerations = mergeTolerations(workload.Tolerations, tolerations)
+		case TopologySpreadConstraintsVariableName:
+			err = json.Unmarshal([]byte(variable.Value), &workload.TopologySpreadConstraints)
+		case PriorityClassNameVariableName:
+			workload.PriorityClassName = variable.Value
+		case PodSecurityContextVariableName:
+			workload.PodSecurityContext = &corev1.PodSecurityContext{}
+			err = json.Unmarshal([]byte(variable.Value), workload.PodSecurityContext)
+		case SecurityContextVariableName:
+			workload.SecurityContext = &corev1.SecurityContext{}
+			err = json.Unmarshal([]byte(variable.Value), workload.SecurityContext)
+		case ReplicasVariableName:
+			var replicas int64
+			replicas, err = strconv.ParseInt(variable.Value, 10, 32)
+			if err == nil && replicas < 0 {
+				err = fmt.Errorf("replicas must not be negative")
+			}
+			replicas32 := int32(replicas)
+			workload.Replicas = &replicas32
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid customized variable %s: %v", variable.Name, err)
+		}
+	}
+
+	return workload, nil
+}
+
+// ToAddOnAgentWorkloadValues transform the AgentWorkloadConfig of the AddOnDeploymentConfig into Values object that
+// has a specific for helm chart values, all the settings are put under the "global" key
+// for example: the spec of one AddOnDeploymentConfig is:
+//
+//	{
+//	 nodePlacement: {tolerations: [{"key": "a"}]},
+//	 customizedVariables: [{name: "priorityClassName", value: "high"}, {name: "tolerations", value: '[{"key":"b"}]'}],
+//	}
+//
+// after transformed, the Values will be:
+// map[global:map[priorityClassName:high tolerations:[map[key:a] map[key:b]]]]
+func ToAddOnAgentWorkloadValues(config addonapiv1alpha1.AddOnDeploymentConfig) (Values, error) {
+	workload, err := GetAgentWorkloadConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return JsonStructToValues(struct {
+		Global *AgentWorkloadConfig `json:"global"`
+	}{Global: workload})
+}
+
+// ToAddOnAgentWorkloadTemplateValues transform the AgentWorkloadConfig of the AddOnDeploymentConfig into Values
+// object for template addons, the keys begin with an uppercase letter.
+// for example: the spec of one AddOnDeploymentConfig is:
+//
+//	{
+//	 customizedVariables: [{name: "replicas", value: "2"}, {name: "affinity", value: '{"podAntiAffinity":{...}}'}],
+//	}
+//
+// after transformed, the key set of Values object will be: {"Replicas", "Affinity"}, the structured values can be
+// rendered in the templates with the "toJson" function, for example: `affinity: {{ toJson .Affinity }}`.
+func ToAddOnAgentWorkloadTemplateValues(config addonapiv1alpha1.AddOnDeploymentConfig) (Values, error) {
+	workload, err := GetAgentWorkloadConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	values := Values{}
+	if len(workload.NodeSelector) > 0 {
+		values["NodeSelector"] = workload.NodeSelector
+	}
+	if len(workload.Tolerations) > 0 {
+		values["Tolerations"] = workload.Tolerations
+	}
+	if workload.Affinity != nil {
+		values["Affinity"] = workload.Affinity
+	}
+	if len(workload.TopologySpreadConstraints) > 0 {
+		values["TopologySpreadConstraints"] = workload.TopologySpreadConstraints
+	}
+	if len(workload.PriorityClassName) > 0 {
+		values["PriorityClassName"] = workload.PriorityClassName
+	}
+	if workload.PodSecurityContext != nil {
+		values["PodSecurityContext"] = workload.PodSecurityContext
+	}
+	if workload.SecurityContext != nil {
+		values["SecurityContext"] = workload.SecurityContext
+	}
+	if workload.Replicas != nil {
+		values["Replicas"] = *workload.Replicas
+	}
+	return values, nil
+}
+
+// mergeTolerations appends the tolerations which do not exist in the existing ones.
+func mergeTolerations(existing, tolerations []corev1.Toleration) []corev1.Toleration {
+	for _, toleration := range tolerations {
+		found := false
+		for _, e := range existing {
+			if equality.Semantic.DeepEqual(e, toleration) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			existing = append(existing, toleration)
+		}
+	}
+	return existing
+}
@@ -0,0 +1,197 @@
+package addonfactory
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"open-cluster-management.io/addon-framework/pkg/addonmanager/addontesting"
+	"open-cluster-management.io/addon-framework/pkg/utils"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	fakeaddon "open-cluster-management.io/api/client/addon/clientset/versioned/fake"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+)
+
+func newWorkloadTestConfig(variables ...addonapiv1alpha1.CustomizedVariable) addonapiv1alpha1.AddOnDeploymentConfig {
+	return addonapiv1alpha1.AddOnDeploymentConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "config", Namespace: "cluster1"},
+		Spec: addonapiv1alpha1.AddOnDeploymentConfigSpec{
+			NodePlacement: &addonapiv1alpha1.NodePlacement{
+				NodeSelector: map[string]string{"host": "ssd"},
+				Tolerations:  []corev1.Toleration{{Key: "a", Operator: corev1.TolerationOpExists}},
+			},
+			CustomizedVariables: variables,
+		},
+	}
+}
+
+func TestGetAgentWorkloadConfig(t *testing.T) {
+	cases := []struct {
+		name        string
+		config      addonapiv1alpha1.AddOnDeploymentConfig
+		expected    *AgentWorkloadConfig
+		expectedErr bool
+	}{
+		{
+			name:   "node placement only",
+			config: newWorkloadTestConfig(),
+			expected: &AgentWorkloadConfig{
+				NodeSelector: map[string]string{"host": "ssd"},
+				Tolerations:  []corev1.Toleration{{Key: "a", Operator: corev1.TolerationOpExists}},
+			},
+		},
+		{
+			name: "all variables",
+			config: newWorkloadTestConfig(
+				addonapiv1alpha1.CustomizedVariable{Name: AffinityVariableName,
+					Value: `{"podAntiAffinity":{"preferredDuringSchedulingIgnoredDuringExecution":[{"weight":100,"podAffinityTerm":{"topologyKey":"kubernetes.io/hostname"}}]}}`},
+				addonapiv1alpha1.CustomizedVariable{Name: TolerationsVariableName,
+					Value: `[{"key":"a","operator":"Exists"},{"key":"b","operator":"Exists"}]`},
+				addonapiv1alpha1.CustomizedVariable{Name: TopologySpreadConstraintsVariableName,
+					Value: `[{"maxSkew":1,"topologyKey":"topology.kubernetes.io/zone","whenUnsatisfiable":"ScheduleAnyway"}]`},
+				addonapiv1alpha1.CustomizedVariable{Name: PriorityClassNameVariableName, Value: "system-cluster-critical"},
+				addonapiv1alpha1.CustomizedVariable{Name: PodSecurityContextVariableName, Value: `{"runAsNonRoot":true}`},
+				addonapiv1alpha1.CustomizedVariable{Name: SecurityContextVariableName, Value: `{"privileged":false}`},
+				addonapiv1alpha1.CustomizedVariable{Name: ReplicasVariableName, Value: "2"},
+				addonapiv1alpha1.CustomizedVariable{Name: "other", Value: "value"},
+			),
+			expected: &AgentWorkloadConfig{
+				NodeSelector: map[string]string{"host": "ssd"},
+				Tolerations: []corev1.Toleration{
+					{Key: "a", Operator: corev1.TolerationOpExists},
+					{Key: "b", Operator: corev1.TolerationOpExists},
+				},
+				Affinity: &corev1.Affinity{
+					PodAntiAffinity: &corev1.PodAntiAffinity{
+						PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{
+							{Weight: 100, PodAffinityTerm: corev1.PodAffinityTerm{TopologyKey: "kubernetes.io/hostname"}},
+						},
+					},
+				},
+				TopologySpreadConstraints: []corev1.TopologySpreadConstraint{
+					{MaxSkew: 1, TopologyKey: "topology.kubernetes.io/zone", WhenUnsatisfiable: corev1.ScheduleAnyway},
+				},
+				PriorityClassName:  "system-cluster-critical",
+				PodSecurityContext: &corev1.PodSecurityContext{RunAsNonRoot: boolPtr(true)},
+				SecurityContext:    &corev1.SecurityContext{Privileged: boolPtr(false)},
+				Replicas:           int32Ptr(2),
+			},
+		},
+		{
+			name:        "invalid affinity",
+			config:      newWorkloadTestConfig(addonapiv1alpha1.CustomizedVariable{Name: AffinityVariableName, Value: "invalid"}),
+			expectedErr: true,
+		},
+		{
+			name:        "negative replicas",
+			config:      newWorkloadTestConfig(addonapiv1alpha1.CustomizedVariable{Name: ReplicasVariableName, Value: "-1"}),
+			expectedErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			workload, err := GetAgentWorkloadConfig(c.config)
+			if c.expectedErr {
+				if err == nil {
+					t.Errorf("expected error, but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !equality.Semantic.DeepEqual(workload, c.expected) {
+				t.Errorf("expected %v, but got %v", c.expected, workload)
+			}
+		})
+	}
+}
+
+func TestToAddOnAgentWorkloadValues(t *testing.T) {
+	config := newWorkloadTestConfig(
+		addonapiv1alpha1.CustomizedVariable{Name: PriorityClassNameVariableName, Value: "high"},
+		addonapiv1alpha1.CustomizedVariable{Name: ReplicasVariableName, Value: "3"},
+	)
+
+	values, err := ToAddOnAgentWorkloadValues(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	global, ok := values["global"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected global values, but got %v", values)
+	}
+	if global["priorityClassName"] != "high" || global["replicas"] != float64(3) {
+		t.Errorf("unexpected helm values %v", global)
+	}
+	if _, ok := global["affinity"]; ok {
+		t.Errorf("unexpected affinity in helm values %v", global)
+	}
+
+	values, err = ToAddOnAgentWorkloadTemplateValues(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values["PriorityClassName"] != "high" || values["Replicas"] != int32(3) {
+		t.Errorf("unexpected template values %v", values)
+	}
+	if _, ok := values["Affinity"]; ok {
+		t.Errorf("unexpected affinity in template values %v", values)
+	}
+}
+
+func TestWithAgentWorkloadValues(t *testing.T) {
+	config := newWorkloadTestConfig(addonapiv1alpha1.CustomizedVariable{Name: ReplicasVariableName, Value: "2"})
+	getter := utils.NewAddOnDeploymentConfigGetter(fakeaddon.NewSimpleClientset(&config))
+
+	addon := addontesting.NewAddon("test", "cluster1")
+	addon.Status.ConfigReferences = []addonapiv1alpha1.ConfigReference{
+		{
+			ConfigGroupResource: addonapiv1alpha1.ConfigGroupResource{
+				Group:    utils.AddOnDeploymentConfigGVR.Group,
+				Resource: utils.AddOnDeploymentConfigGVR.Resource,
+			},
+			DesiredConfig: &addonapiv1alpha1.ConfigSpecHash{
+				ConfigReferent: addonapiv1alpha1.ConfigReferent{Namespace: "cluster1", Name: "config"},
+				SpecHash:       "dummy",
+			},
+		},
+	}
+
+	agentAddon, err := NewAgentAddonFactory("test", templateFS, "testmanifests/template").
+		WithConfigGVRs(utils.AddOnDeploymentConfigGVR).
+		WithAgentWorkloadValues(getter).
+		WithGetValuesFuncs(func(_ *clusterv1.ManagedCluster, _ *addonapiv1alpha1.ManagedClusterAddOn) (Values, error) {
+			return Values{"Replicas": int32(5)}, nil
+		}).
+		BuildTemplateAgentAddon()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if gvrs := agentAddon.GetAgentAddonOptions().SupportedConfigGVRs; len(gvrs) != 1 {
+		t.Errorf("expected the AddOnDeploymentConfig to be supported once, but got %v", gvrs)
+	}
+
+	values, err := agentAddon.(*TemplateAgentAddon).getValues(addontesting.NewManagedCluster("cluster1"), addon)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the values of getValuesFuncs override the workload values
+	if values["Replicas"] != int32(5) {
+		t.Errorf("expected replicas 5, but got %v", values["Replicas"])
+	}
+	if !equality.Semantic.DeepEqual(values["NodeSelector"], map[string]string{"host": "ssd"}) {
+		t.Errorf("unexpected node selector %v", values["NodeSelector"])
+	}
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+func int32Ptr(i int32) *int32 {
+	return &i
+}
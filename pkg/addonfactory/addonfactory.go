@@ -7,6 +7,7 @@ import (
 	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/klog/v2"
 	"open-cluster-management.io/addon-framework/pkg/addonmanager/constants"
@@ -15,6 +16,7 @@ import (
 	clusterv1 "open-cluster-management.io/api/cluster/v1"
 
 	"open-cluster-management.io/addon-framework/pkg/agent"
+	"open-cluster-management.io/addon-framework/pkg/utils"
 )
 
 const AddonDefaultInstallNamespace = "open-cluster-management-agent-addon"
@@ -41,6 +43,17 @@ type AgentAddonFactory struct {
 	clusterClient         clusterclientset.Interface
 	agentInstallNamespace func(addon *addonapiv1alpha1.ManagedClusterAddOn) (string, error)
 	helmEngineStrict      bool
+	// agentWorkloadConfigGetter is used to get the AddOnDeploymentConfig to resolve the agent workload values.
+	agentWorkloadConfigGetter utils.AddOnDeploymentConfigGetter
+	// hubPermissionConfig applies the hub permission manifests after the PermissionConfig of the registration
+	// option, hubPermissionErr is returned on build if the manifests cannot be loaded. hubPermissionCleanup deletes
+	// the cluster scoped objects of the manifests after the PermissionCleanup of the registration option.
+	hubPermissionConfig  agent.PermissionConfigFunc
+	hubPermissionCleanup agent.PermissionConfigFunc
+	hubPermissionErr     error
+	// specHasher computes the spec hash of the configs decoded by WithConfigValues, it is shared with the built
+	// agents which receive the SpecHashFunc of the addon manager.
+	specHasher *specHasher
 }
 
 // NewAgentAddonFactory builds an addonAgentFactory instance with addon name and fs.
@@ -64,6 +77,7 @@ func NewAgentAddonFactory(addonName string, fs embed.FS, dir string) *AgentAddon
 		trimCRDDescription: false,
 		scheme:             s,
 		helmEngineStrict:   false,
+		specHasher:         &specHasher{},
 	}
 }
 
@@ -85,6 +99,7 @@ func (f *AgentAddonFactory) WithGetValuesFuncs(getValuesFuncs ...GetValuesFunc)
 // WithAgentRegistrationOption defines how agent is registered to the hub cluster.
 func (f *AgentAddonFactory) WithAgentRegistrationOption(option *agent.RegistrationOption) *AgentAddonFactory {
 	f.agentAddonOptions.Registration = option
+	f.wrapHubPermissionConfig()
 	return f
 }
 
@@ -113,6 +128,12 @@ func (f *AgentAddonFactory) WithConfigCheckEnabledOption() *AgentAddonFactory {
 	return f
 }
 
+// WithEffectiveImagesEnabledOption will enable recording the images of the agent workloads in the addon status.
+func (f *AgentAddonFactory) WithEffectiveImagesEnabledOption() *AgentAddonFactory {
+	f.agentAddonOptions.EffectiveImagesEnabled = true
+	return f
+}
+
 // WithTrimCRDDescription is to enable trim the description of CRDs in manifestWork.
 func (f *AgentAddonFactory) WithTrimCRDDescription() *AgentAddonFactory {
 	f.trimCRDDescription = true
@@ -131,6 +152,22 @@ func (f *AgentAddonFactory) WithConfigGVRs(gvrs ...schema.GroupVersionResource)
 	return f
 }
 
+// WithAgentWorkloadValues enables the agent workload values resolved from the spec.nodePlacement and the
+// conventional customizedVariables of the AddOnDeploymentConfig, including the affinity, tolerations, topology
+// spread constraints, priority class, security contexts and replicas. The values are put under the "global" key
+// for helm addons, see ToAddOnAgentWorkloadValues, and are top level keys for template addons, see
+// ToAddOnAgentWorkloadTemplateValues. They can be overridden by the getValuesFuncs. The AddOnDeploymentConfig
+// is added to the supported configs if it is not.
+func (f *AgentAddonFactory) WithAgentWorkloadValues(getter utils.AddOnDeploymentConfigGetter) *AgentAddonFactory {
+	f.agentWorkloadConfigGetter = getter
+	for _, gvr := range f.agentAddonOptions.SupportedConfigGVRs {
+		if gvr == utils.AddOnDeploymentConfigGVR {
+			return f
+		}
+	}
+	return f.WithConfigGVRs(utils.AddOnDeploymentConfigGVR)
+}
+
 // WithHostingCluster defines the hosting cluster used in hosted mode. An AgentAddon may use this to provide
 // additional metadata.
 // Deprecated: use WithManagedClusterClient to set a cluster client that can get the hosting cluster.
@@ -179,18 +216,81 @@ func (f *AgentAddonFactory) WithAgentInstallNamespace(
 	return f
 }
 
+// WithHubPermissionManifests defines the rbac objects applied on the hub for the addon agent, they are the templates
+// in the dir of the fs rendered with ClusterName, AddonName, AddonInstallNamespace and the Subjects of the
+// kube-apiserver-client registration, see NewHubPermissionConfigFunc. The registration option is required, and its
+// PermissionConfig is called before the manifests are applied if set. The cluster scoped objects are deleted by the
+// PermissionCleanup of the registration option when the addon is deleted, see NewHubPermissionCleanupFunc.
+func (f *AgentAddonFactory) WithHubPermissionManifests(kubeClient kubernetes.Interface,
+	fs embed.FS, dir string) *AgentAddonFactory {
+	// the install namespace func may be set after this option
+	installNamespaceFunc := func(addon *addonapiv1alpha1.ManagedClusterAddOn) (string, error) {
+		if f.agentInstallNamespace == nil {
+			return "", nil
+		}
+		return f.agentInstallNamespace(addon)
+	}
+	f.hubPermissionConfig, f.hubPermissionErr = NewHubPermissionConfigFunc(kubeClient, fs, dir, installNamespaceFunc)
+	f.hubPermissionCleanup = NewHubPermissionCleanupFunc(kubeClient)
+	f.wrapHubPermissionConfig()
+	return f
+}
+
+// wrapHubPermissionConfig wraps the PermissionConfig and PermissionCleanup of the registration option to apply and
+// clean up the hub permission manifests, it is called once the registration option or the hub permission manifests
+// are set.
+func (f *AgentAddonFactory) wrapHubPermissionConfig() {
+	if f.hubPermissionConfig == nil || f.agentAddonOptions.Registration == nil {
+		return
+	}
+
+	hubPermissionConfig := f.hubPermissionConfig
+	permissionConfig := f.agentAddonOptions.Registration.PermissionConfig
+	f.agentAddonOptions.Registration.PermissionConfig = func(
+		cluster *clusterv1.ManagedCluster, addon *addonapiv1alpha1.ManagedClusterAddOn) error {
+		if permissionConfig != nil {
+			if err := permissionConfig(cluster, addon); err != nil {
+				return err
+			}
+		}
+		return hubPermissionConfig(cluster, addon)
+	}
+
+	hubPermissionCleanup := f.hubPermissionCleanup
+	permissionCleanup := f.agentAddonOptions.Registration.PermissionCleanup
+	f.agentAddonOptions.Registration.PermissionCleanup = func(
+		cluster *clusterv1.ManagedCluster, addon *addonapiv1alpha1.ManagedClusterAddOn) error {
+		if permissionCleanup != nil {
+			if err := permissionCleanup(cluster, addon); err != nil {
+				return err
+			}
+		}
+		return hubPermissionCleanup(cluster, addon)
+	}
+}
+
 // preBuildAddon sets the default values for the agentAddonOptions.
-func (f *AgentAddonFactory) preBuildAddon() {
+func (f *AgentAddonFactory) preBuildAddon() error {
 	if f.agentInstallNamespace != nil {
 		if f.agentAddonOptions.Registration != nil && f.agentAddonOptions.Registration.AgentInstallNamespace == nil {
 			f.agentAddonOptions.Registration.AgentInstallNamespace = f.agentInstallNamespace
 		}
 	}
+
+	if f.hubPermissionErr != nil {
+		return f.hubPermissionErr
+	}
+	if f.hubPermissionConfig != nil && f.agentAddonOptions.Registration == nil {
+		return fmt.Errorf("the registration option is required by the hub permission manifests")
+	}
+	return nil
 }
 
 // BuildHelmAgentAddon builds a helm agentAddon instance.
 func (f *AgentAddonFactory) BuildHelmAgentAddon() (agent.AgentAddon, error) {
-	f.preBuildAddon()
+	if err := f.preBuildAddon(); err != nil {
+		return nil, err
+	}
 
 	if err := validateSupportedConfigGVRs(f.agentAddonOptions.SupportedConfigGVRs); err != nil {
 		return nil, err
@@ -202,13 +302,20 @@ func (f *AgentAddonFactory) BuildHelmAgentAddon() (agent.AgentAddon, error) {
 	}
 
 	agentAddon := newHelmAgentAddon(f, userChart)
+	if f.agentWorkloadConfigGetter != nil {
+		agentAddon.getValuesFuncs = append([]GetValuesFunc{
+			GetAddOnDeploymentConfigValues(f.agentWorkloadConfigGetter, ToAddOnAgentWorkloadValues),
+		}, agentAddon.getValuesFuncs...)
+	}
 
 	return agentAddon, nil
 }
 
 // BuildTemplateAgentAddon builds a template agentAddon instance.
 func (f *AgentAddonFactory) BuildTemplateAgentAddon() (agent.AgentAddon, error) {
-	f.preBuildAddon()
+	if err := f.preBuildAddon(); err != nil {
+		return nil, err
+	}
 
 	if err := validateSupportedConfigGVRs(f.agentAddonOptions.SupportedConfigGVRs); err != nil {
 		return nil, err
@@ -224,6 +331,11 @@ func (f *AgentAddonFactory) BuildTemplateAgentAddon() (agent.AgentAddon, error)
 	}
 
 	agentAddon := newTemplateAgentAddon(f)
+	if f.agentWorkloadConfigGetter != nil {
+		agentAddon.getValuesFuncs = append([]GetValuesFunc{
+			GetAddOnDeploymentConfigValues(f.agentWorkloadConfigGetter, ToAddOnAgentWorkloadTemplateValues),
+		}, agentAddon.getValuesFuncs...)
+	}
 
 	for _, file := range templateFiles {
 		template, err := f.fs.ReadFile(file)
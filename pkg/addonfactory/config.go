@@ -0,0 +1,144 @@
+package addonfactory
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/lru"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+
+	"open-cluster-management.io/addon-framework/pkg/agent"
+	"open-cluster-management.io/addon-framework/pkg/utils"
+)
+
+// ConfigToValuesFunc transform a typed config object into Values object
+type ConfigToValuesFunc[T any] func(config T) (Values, error)
+
+// specHashCacheSize is the max number of the spec hashes cached by each GetValuesFunc of GetConfigValues, the least
+// recently used ones are evicted once it is exceeded.
+const specHashCacheSize = 256
+
+// cachedSpecHash is the spec hash of a config at the resourceVersion.
+type cachedSpecHash struct {
+	resourceVersion string
+	specHash        string
+}
+
+// GetConfigValues returns a GetValuesFunc which uses the ConfigGetter to get the desired config of the gvr in the
+// addon status configReferences, decodes it into the type T, then uses ConfigToValuesFunc to transform it to Values
+// object. If there are multiple ConfigToValuesFuncs, the values of the latter one override the former ones.
+//
+// The config is got on each call, so the getter should read from the dynamic informers, see
+// utils.NewInformerConfigGetter. The spec hashes of the configs are cached by the resourceVersion, so the spec hash
+// of a config is only computed again after it is changed, and at most specHashCacheSize spec hashes are cached. The
+// config is decoded into a new T on each call, so the ConfigToValuesFuncs are free to modify it. An error is
+// returned if the desired spec hash is not yet set in the addon status, or the spec hash of the config does not
+// match it, so the addon is rendered once the config is observed.
+//
+// The addon is only rendered again when the spec hash of the config is changed, so the Values must only depend on
+// the hashed fields of the config, e.g. not on the IgnoredPaths of the SpecHashOptions. The spec hash of the config
+// is computed without SpecHashOptions, use WithConfigValues if the SpecHashOptions of the gvr are set on the addon
+// manager.
+func GetConfigValues[T any](getter utils.ConfigGetter, gvr schema.GroupVersionResource,
+	toValuesFuncs ...ConfigToValuesFunc[T]) GetValuesFunc {
+	return getConfigValues[T](getter, gvr, utils.GetSpecHash, toValuesFuncs...)
+}
+
+func getConfigValues[T any](getter utils.ConfigGetter, gvr schema.GroupVersionResource,
+	specHashFunc func(config *unstructured.Unstructured) (string, error),
+	toValuesFuncs ...ConfigToValuesFunc[T]) GetValuesFunc {
+	cache := lru.New(specHashCacheSize)
+
+	return func(cluster *clusterv1.ManagedCluster, addon *addonapiv1alpha1.ManagedClusterAddOn) (Values, error) {
+		var lastValues = Values{}
+		ok, configRef := utils.GetAddOnConfigRef(addon.Status.ConfigReferences, gvr.Group, gvr.Resource)
+		if !ok {
+			return lastValues, nil
+		}
+
+		desiredConfig := configRef.DesiredConfig
+		if desiredConfig == nil || len(desiredConfig.SpecHash) == 0 {
+			klog.InfoS("Addon config spec hash is empty", "addonName", addon.Name, "resource", gvr.Resource)
+			return nil, fmt.Errorf("addon %s config %s desired spec hash is empty", addon.Name, gvr.Resource)
+		}
+
+		obj, err := getter.Get(context.TODO(), gvr, desiredConfig.Namespace, desiredConfig.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		key := fmt.Sprintf("%s/%s", desiredConfig.Namespace, desiredConfig.Name)
+		var cached cachedSpecHash
+		if value, ok := cache.Get(key); ok {
+			cached = value.(cachedSpecHash)
+		}
+		if len(obj.GetResourceVersion()) == 0 || cached.resourceVersion != obj.GetResourceVersion() {
+			specHash, err := specHashFunc(obj)
+			if err != nil {
+				return nil, err
+			}
+			cached = cachedSpecHash{resourceVersion: obj.GetResourceVersion(), specHash: specHash}
+			cache.Add(key, cached)
+		}
+		if cached.specHash != desiredConfig.SpecHash {
+			return nil, fmt.Errorf("config %s %s/%s spec hash %s is not equal to desired spec hash %s, the config is "+
+				"changed or its spec hash is not computed with the SpecHashOptions of the addon manager",
+				gvr.Resource, desiredConfig.Namespace, desiredConfig.Name, cached.specHash, desiredConfig.SpecHash)
+		}
+
+		// decode a copy of the config, so the decoded config shares nothing with the getter, e.g. the informer cache
+		var config T
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.DeepCopy().Object, &config); err != nil {
+			return nil, fmt.Errorf("failed to decode config %s %s/%s: %v",
+				gvr.Resource, desiredConfig.Namespace, desiredConfig.Name, err)
+		}
+
+		for _, toValuesFunc := range toValuesFuncs {
+			values, err := toValuesFunc(config)
+			if err != nil {
+				return nil, err
+			}
+			lastValues = MergeValues(lastValues, values)
+		}
+
+		return lastValues, nil
+	}
+}
+
+// WithConfigValues adds the gvr to the supported configs of the addon, and adds a GetValuesFunc transforming the
+// desired config of the gvr into Values. The spec hash of the config is computed with the SpecHashOptions of the gvr
+// set on the addon manager, which are passed to the built agent when it is added to the manager. It is a function
+// rather than a method of AgentAddonFactory since methods cannot have type parameters. The GetValuesFunc is appended
+// to the GetValuesFuncs of the factory, which are replaced by WithGetValuesFuncs, so it must be called after
+// WithGetValuesFuncs.
+func WithConfigValues[T any](f *AgentAddonFactory, getter utils.ConfigGetter, gvr schema.GroupVersionResource,
+	toValuesFuncs ...ConfigToValuesFunc[T]) *AgentAddonFactory {
+	specHashFunc := func(config *unstructured.Unstructured) (string, error) {
+		return f.specHasher.getSpecHash(gvr, config)
+	}
+	f.WithConfigGVRs(gvr)
+	f.getValuesFuncs = append(f.getValuesFuncs, getConfigValues[T](getter, gvr, specHashFunc, toValuesFuncs...))
+	return f
+}
+
+// specHasher computes the spec hashes of the configs with the SpecHashFunc set by the addon manager, or the default
+// spec hash before the agent is added to the manager. It implements agent.SpecHashAware for the built agents.
+type specHasher struct {
+	specHashFunc agent.SpecHashFunc
+}
+
+func (h *specHasher) SetSpecHashFunc(specHashFunc agent.SpecHashFunc) {
+	h.specHashFunc = specHashFunc
+}
+
+func (h *specHasher) getSpecHash(gvr schema.GroupVersionResource, config *unstructured.Unstructured) (string, error) {
+	if h.specHashFunc == nil {
+		return utils.GetSpecHash(config)
+	}
+	return h.specHashFunc(gvr.Group, gvr.Resource, config)
+}
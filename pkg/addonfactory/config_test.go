@@ -0,0 +1,245 @@
+package addonfactory
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"open-cluster-management.io/addon-framework/pkg/addonmanager/addontesting"
+	"open-cluster-management.io/addon-framework/pkg/agent"
+	"open-cluster-management.io/addon-framework/pkg/utils"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+)
+
+var testConfigGVR = schema.GroupVersionResource{Group: "config.test", Version: "v1", Resource: "testconfigs"}
+
+type testConfig struct {
+	Spec struct {
+		Image    string `json:"image"`
+		Replicas int64  `json:"replicas"`
+	} `json:"spec"`
+}
+
+type fakeConfigGetter struct {
+	config *unstructured.Unstructured
+}
+
+func (g *fakeConfigGetter) Get(_ context.Context, _ schema.GroupVersionResource, _, _ string) (*unstructured.Unstructured, error) {
+	// return the config rather than a copy, as the informer getter returns the object in the cache
+	return g.config, nil
+}
+
+func newTestConfigObject(image string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "config.test/v1",
+			"kind":       "TestConfig",
+			"metadata": map[string]interface{}{
+				"name":      "config",
+				"namespace": "cluster1",
+			},
+			"spec": map[string]interface{}{
+				"image":    image,
+				"replicas": int64(2),
+			},
+		},
+	}
+}
+
+func newAddonWithTestConfig(specHash string) *addonapiv1alpha1.ManagedClusterAddOn {
+	addon := addontesting.NewAddon("test", "cluster1")
+	addon.Status.ConfigReferences = []addonapiv1alpha1.ConfigReference{
+		{
+			ConfigGroupResource: addonapiv1alpha1.ConfigGroupResource{
+				Group:    testConfigGVR.Group,
+				Resource: testConfigGVR.Resource,
+			},
+			DesiredConfig: &addonapiv1alpha1.ConfigSpecHash{
+				ConfigReferent: addonapiv1alpha1.ConfigReferent{
+					Namespace: "cluster1",
+					Name:      "config",
+				},
+				SpecHash: specHash,
+			},
+		},
+	}
+	return addon
+}
+
+func TestGetConfigValues(t *testing.T) {
+	toValues := func(config testConfig) (Values, error) {
+		return Values{"Image": config.Spec.Image, "Replicas": config.Spec.Replicas}, nil
+	}
+
+	config := newTestConfigObject("quay.io/test:v1")
+	specHash, err := utils.GetSpecHash(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	getter := &fakeConfigGetter{config: config}
+	getValues := GetConfigValues[testConfig](getter, testConfigGVR, toValues)
+
+	// no config reference
+	values, err := getValues(nil, addontesting.NewAddon("test", "cluster1"))
+	if err != nil || len(values) != 0 {
+		t.Errorf("expected empty values without error, but got %v, %v", values, err)
+	}
+
+	// desired spec hash is not set
+	if _, err := getValues(nil, newAddonWithTestConfig("")); err == nil {
+		t.Errorf("expected error when the desired spec hash is empty")
+	}
+
+	// spec hash mismatch
+	if _, err := getValues(nil, newAddonWithTestConfig("stale")); err == nil {
+		t.Errorf("expected error when the spec hash mismatches")
+	}
+
+	values, err = getValues(nil, newAddonWithTestConfig(specHash))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values["Image"] != "quay.io/test:v1" || values["Replicas"] != int64(2) {
+		t.Errorf("unexpected values %v", values)
+	}
+
+	// the changed config is used once the desired spec hash is updated
+	getter.config = newTestConfigObject("quay.io/test:v2")
+	newSpecHash, err := utils.GetSpecHash(getter.config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, err = getValues(nil, newAddonWithTestConfig(newSpecHash))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values["Image"] != "quay.io/test:v2" {
+		t.Errorf("unexpected values %v", values)
+	}
+}
+
+func TestWithConfigValues(t *testing.T) {
+	f := NewAgentAddonFactory("test", templateFS, "testmanifests/template")
+	f = WithConfigValues[testConfig](f, &fakeConfigGetter{}, testConfigGVR)
+	if len(f.agentAddonOptions.SupportedConfigGVRs) != 1 || f.agentAddonOptions.SupportedConfigGVRs[0] != testConfigGVR {
+		t.Errorf("unexpected supported config GVRs %v", f.agentAddonOptions.SupportedConfigGVRs)
+	}
+	if len(f.getValuesFuncs) != 1 {
+		t.Errorf("expected 1 GetValuesFunc, but got %d", len(f.getValuesFuncs))
+	}
+}
+
+func TestWithConfigValuesSpecHashOptions(t *testing.T) {
+	toValues := func(config testConfig) (Values, error) {
+		return Values{"Image": config.Spec.Image}, nil
+	}
+
+	config := newTestConfigObject("quay.io/test:v1")
+	hashOptions := &utils.SpecHashOptions{IgnoredPaths: []string{"spec.replicas"}}
+	specHash, err := utils.GetSpecHashWithOptions(config, hashOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := NewAgentAddonFactory("test", templateFS, "testmanifests/template")
+	f = WithConfigValues[testConfig](f, &fakeConfigGetter{config: config}, testConfigGVR, toValues)
+
+	// the default spec hash does not match the desired spec hash computed with the hash options
+	if _, err := f.getValuesFuncs[0](nil, newAddonWithTestConfig(specHash)); err == nil {
+		t.Errorf("expected error when the spec hash options are not set")
+	}
+
+	// the spec hash func of the addon manager is set on the built agent
+	agentAddon, err := f.BuildTemplateAgentAddon()
+	if err != nil {
+		t.Fatal(err)
+	}
+	aware, ok := agentAddon.(agent.SpecHashAware)
+	if !ok {
+		t.Fatalf("expected the built agent to be spec hash aware")
+	}
+	aware.SetSpecHashFunc(utils.ConfigSpecHashOptions{testConfigGVR: hashOptions}.GetSpecHash)
+	values, err := f.getValuesFuncs[0](nil, newAddonWithTestConfig(specHash))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values["Image"] != "quay.io/test:v1" {
+		t.Errorf("unexpected values %v", values)
+	}
+}
+
+func TestGetConfigValuesCache(t *testing.T) {
+	config := newTestConfigObject("quay.io/test:v1")
+	config.SetResourceVersion("1")
+	hashOptions := &utils.SpecHashOptions{IgnoredPaths: []string{"spec.replicas"}}
+	specHash, err := utils.GetSpecHashWithOptions(config, hashOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	getter := &fakeConfigGetter{config: config}
+
+	hashCalls := 0
+	specHashFunc := func(config *unstructured.Unstructured) (string, error) {
+		hashCalls++
+		return utils.GetSpecHashWithOptions(config, hashOptions)
+	}
+
+	// the pointer config modified by the ConfigToValuesFunc does not affect the config of the getter
+	getValues := getConfigValues[*testConfig](getter, testConfigGVR, specHashFunc, func(config *testConfig) (Values, error) {
+		values := Values{"Image": config.Spec.Image, "Replicas": config.Spec.Replicas}
+		config.Spec.Image = "modified"
+		return values, nil
+	})
+	for i := 0; i < 2; i++ {
+		values, err := getValues(nil, newAddonWithTestConfig(specHash))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if values["Image"] != "quay.io/test:v1" {
+			t.Errorf("unexpected values %v", values)
+		}
+	}
+	if hashCalls != 1 {
+		t.Errorf("expected the spec hash to be computed once, but got %d", hashCalls)
+	}
+
+	// the config changed without changing the spec hash is not served from a stale cache
+	config = config.DeepCopy()
+	if err := unstructured.SetNestedField(config.Object, int64(3), "spec", "replicas"); err != nil {
+		t.Fatal(err)
+	}
+	config.SetResourceVersion("2")
+	getter.config = config
+	values, err := getValues(nil, newAddonWithTestConfig(specHash))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values["Replicas"] != int64(3) {
+		t.Errorf("expected the changed config, but got %v", values)
+	}
+	if hashCalls != 2 {
+		t.Errorf("expected the spec hash to be computed again, but got %d", hashCalls)
+	}
+
+	// the least recently used spec hash is evicted once the cache is full
+	addonWithConfigName := func(name string) *addonapiv1alpha1.ManagedClusterAddOn {
+		addon := newAddonWithTestConfig(specHash)
+		addon.Status.ConfigReferences[0].DesiredConfig.Name = name
+		return addon
+	}
+	for i := 0; i < specHashCacheSize; i++ {
+		if _, err := getValues(nil, addonWithConfigName(fmt.Sprintf("config%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hashCalls = 0
+	if _, err := getValues(nil, newAddonWithTestConfig(specHash)); err != nil {
+		t.Fatal(err)
+	}
+	if hashCalls != 1 {
+		t.Errorf("expected the evicted spec hash to be computed again, but got %d calls", hashCalls)
+	}
+}
@@ -57,6 +57,7 @@ type HelmAgentAddon struct {
 	clusterClient         clusterclientset.Interface
 	agentInstallNamespace func(addon *addonapiv1alpha1.ManagedClusterAddOn) (string, error)
 	helmEngineStrict      bool
+	*specHasher
 }
 
 func newHelmAgentAddon(factory *AgentAddonFactory, chart *chart.Chart) *HelmAgentAddon {
@@ -70,6 +71,7 @@ func newHelmAgentAddon(factory *AgentAddonFactory, chart *chart.Chart) *HelmAgen
 		clusterClient:         factory.clusterClient,
 		agentInstallNamespace: factory.agentInstallNamespace,
 		helmEngineStrict:      factory.helmEngineStrict,
+		specHasher:            factory.specHasher,
 	}
 }
 
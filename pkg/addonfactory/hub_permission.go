@@ -0,0 +1,337 @@
+package addonfactory
+
+import (
+	"context"
+	"embed"
+	"fmt"
+
+	certificatesv1 "k8s.io/api/certificates/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+
+	"open-cluster-management.io/addon-framework/pkg/agent"
+	"open-cluster-management.io/addon-framework/pkg/assets"
+	"open-cluster-management.io/addon-framework/pkg/utils"
+)
+
+// hubPermissionValues includes the values to render the hub permission manifests.
+type hubPermissionValues struct {
+	ClusterName           string
+	AddonName             string
+	AddonInstallNamespace string
+	// Subjects are the subjects of the kube-apiserver-client registration, it is empty before the agent reports
+	// them. It can be rendered into a binding with: subjects: {{ toJson .Subjects }}
+	Subjects []rbacv1.Subject
+}
+
+// NewHubPermissionConfigFunc returns a agent.PermissionConfigFunc that renders the rbac objects in the dir of the fs
+// with the hubPermissionValues, and applies them on the hub. The Roles and RoleBindings are applied in the cluster
+// namespace and owned by the addon, so they are deleted with the addon, the objects in other namespaces are rejected
+// since nothing would clean them up. The ClusterRoles and ClusterRoleBindings cannot be owned by the addon, they are
+// labeled with the addon and the cluster instead and deleted by the func of NewHubPermissionCleanupFunc, so their
+// names must be unique for each cluster, e.g. prefixed with the ClusterName.
+// The RoleBindings and ClusterRoleBindings of the addon which are no longer rendered are deleted. The bindings
+// without subjects are not applied, and the func returns the agent.SubjectNotReadyError until the agent reports the
+// registration subjects.
+//
+// installNamespaceFunc overrides the install namespace of the addon, it is optional.
+func NewHubPermissionConfigFunc(kubeClient kubernetes.Interface, fs embed.FS, dir string,
+	installNamespaceFunc func(addon *addonapiv1alpha1.ManagedClusterAddOn) (string, error),
+) (agent.PermissionConfigFunc, error) {
+	files, err := getTemplateFiles(fs, dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("there is no hub permission manifests in %s", dir)
+	}
+
+	var manifests []templateFile
+	for _, file := range files {
+		content, err := fs.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		manifests = append(manifests, templateFile{name: file, content: content})
+	}
+	decoder := serializer.NewCodecFactory(scheme.Scheme).UniversalDeserializer()
+
+	return func(cluster *clusterv1.ManagedCluster, addon *addonapiv1alpha1.ManagedClusterAddOn) error {
+		ctx := context.TODO()
+		values, err := getHubPermissionValues(cluster, addon, installNamespaceFunc)
+		if err != nil {
+			return err
+		}
+
+		var objects []runtime.Object
+		var objectFiles []string
+		var roleBindings []*rbacv1.RoleBinding
+		roleBindingNames := sets.New[string]()
+		clusterRoleBindingNames := sets.New[string]()
+		subjectNotReady := false
+		for _, file := range manifests {
+			if len(file.content) == 0 {
+				continue
+			}
+			asset, err := assets.CreateAssetFromTemplate(file.name, file.content, values)
+			if err != nil {
+				return fmt.Errorf("failed to render hub permission manifest %s: %v", file.name, err)
+			}
+			object, _, err := decoder.Decode(asset.Data, nil, nil)
+			if err != nil {
+				if runtime.IsMissingKind(err) {
+					klog.V(4).Infof("Skipping hub permission manifest %v, reason: %v", file.name, err)
+					continue
+				}
+				return fmt.Errorf("failed to decode hub permission manifest %s: %v", file.name, err)
+			}
+
+			switch obj := object.(type) {
+			case *rbacv1.Role:
+				err = setHubPermissionNamespace(&obj.ObjectMeta, cluster, addon)
+			case *rbacv1.RoleBinding:
+				if err = setHubPermissionNamespace(&obj.ObjectMeta, cluster, addon); err != nil {
+					break
+				}
+				roleBindingNames.Insert(obj.Name)
+				if len(obj.Subjects) == 0 {
+					subjectNotReady = true
+					continue
+				}
+				roleBindings = append(roleBindings, obj)
+			case *rbacv1.ClusterRole:
+				setHubPermissionClusterLabels(&obj.ObjectMeta, cluster, addon)
+			case *rbacv1.ClusterRoleBinding:
+				setHubPermissionClusterLabels(&obj.ObjectMeta, cluster, addon)
+				if len(obj.Subjects) == 0 {
+					subjectNotReady = true
+					continue
+				}
+				clusterRoleBindingNames.Insert(obj.Name)
+			default:
+				err = fmt.Errorf("kind %s is not supported, only the Roles, RoleBindings, ClusterRoles and "+
+					"ClusterRoleBindings are allowed", object.GetObjectKind().GroupVersionKind().Kind)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to apply hub permission manifest %s: %v", file.name, err)
+			}
+			objects = append(objects, object)
+			objectFiles = append(objectFiles, file.name)
+		}
+
+		// prune before applying, so the bindings no longer rendered are deleted even if the subject is not ready.
+		if err := utils.PruneRoleBindings(ctx, kubeClient, nil, cluster.Name, addon,
+			roleBindings, roleBindingNames); err != nil {
+			return fmt.Errorf("failed to prune hub permission role bindings: %v", err)
+		}
+		if err := pruneHubPermissionClusterRoleBindings(ctx, kubeClient, cluster, addon,
+			clusterRoleBindingNames); err != nil {
+			return fmt.Errorf("failed to prune hub permission cluster role bindings: %v", err)
+		}
+
+		for i, object := range objects {
+			if err := applyHubPermission(ctx, kubeClient, object); err != nil {
+				return fmt.Errorf("failed to apply hub permission manifest %s: %v", objectFiles[i], err)
+			}
+		}
+
+		if subjectNotReady {
+			return &agent.SubjectNotReadyError{}
+		}
+		return nil
+	}, nil
+}
+
+// NewHubPermissionCleanupFunc returns a agent.PermissionConfigFunc that deletes the ClusterRoles and
+// ClusterRoleBindings applied by the func of NewHubPermissionConfigFunc for the addon of the cluster. It is set as
+// the PermissionCleanup of the registration option.
+func NewHubPermissionCleanupFunc(kubeClient kubernetes.Interface) agent.PermissionConfigFunc {
+	return func(cluster *clusterv1.ManagedCluster, addon *addonapiv1alpha1.ManagedClusterAddOn) error {
+		ctx := context.TODO()
+		selector := hubPermissionClusterSelector(cluster, addon)
+
+		var errs []error
+		clusterRoleBindings, err := kubeClient.RbacV1().ClusterRoleBindings().List(ctx, metav1.ListOptions{LabelSelector: selector})
+		if err != nil {
+			return err
+		}
+		for _, binding := range clusterRoleBindings.Items {
+			err := kubeClient.RbacV1().ClusterRoleBindings().Delete(ctx, binding.Name, metav1.DeleteOptions{})
+			if err != nil && !apierrors.IsNotFound(err) {
+				errs = append(errs, err)
+			}
+		}
+
+		clusterRoles, err := kubeClient.RbacV1().ClusterRoles().List(ctx, metav1.ListOptions{LabelSelector: selector})
+		if err != nil {
+			return err
+		}
+		for _, role := range clusterRoles.Items {
+			err := kubeClient.RbacV1().ClusterRoles().Delete(ctx, role.Name, metav1.DeleteOptions{})
+			if err != nil && !apierrors.IsNotFound(err) {
+				errs = append(errs, err)
+			}
+		}
+		return utilerrors.NewAggregate(errs)
+	}
+}
+
+// applyHubPermission applies the rbac object. The existing cluster scoped objects must be labeled with the same addon
+// and cluster, so the objects of other clusters or not created for the addon are not overwritten.
+func applyHubPermission(ctx context.Context, kubeClient kubernetes.Interface, object runtime.Object) error {
+	switch obj := object.(type) {
+	case *rbacv1.Role:
+		_, _, err := utils.ApplyRole(ctx, kubeClient.RbacV1(), obj)
+		return err
+	case *rbacv1.RoleBinding:
+		_, _, err := utils.ApplyRoleBinding(ctx, kubeClient.RbacV1(), obj)
+		return err
+	case *rbacv1.ClusterRole:
+		existing, err := kubeClient.RbacV1().ClusterRoles().Get(ctx, obj.Name, metav1.GetOptions{})
+		switch {
+		case apierrors.IsNotFound(err):
+		case err != nil:
+			return err
+		default:
+			if err := checkHubPermissionClusterLabels(existing.ObjectMeta, obj.ObjectMeta); err != nil {
+				return err
+			}
+		}
+		_, _, err = utils.ApplyClusterRole(ctx, kubeClient.RbacV1(), obj)
+		return err
+	case *rbacv1.ClusterRoleBinding:
+		existing, err := kubeClient.RbacV1().ClusterRoleBindings().Get(ctx, obj.Name, metav1.GetOptions{})
+		switch {
+		case apierrors.IsNotFound(err):
+		case err != nil:
+			return err
+		default:
+			if err := checkHubPermissionClusterLabels(existing.ObjectMeta, obj.ObjectMeta); err != nil {
+				return err
+			}
+		}
+		_, _, err = utils.ApplyClusterRoleBinding(ctx, kubeClient.RbacV1(), obj)
+		return err
+	}
+	return nil
+}
+
+// pruneHubPermissionClusterRoleBindings deletes the ClusterRoleBindings of the addon of the cluster which are not in
+// the names.
+func pruneHubPermissionClusterRoleBindings(ctx context.Context, kubeClient kubernetes.Interface,
+	cluster *clusterv1.ManagedCluster, addon *addonapiv1alpha1.ManagedClusterAddOn, names sets.Set[string]) error {
+	clusterRoleBindings, err := kubeClient.RbacV1().ClusterRoleBindings().List(ctx, metav1.ListOptions{
+		LabelSelector: hubPermissionClusterSelector(cluster, addon),
+	})
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, binding := range clusterRoleBindings.Items {
+		if names.Has(binding.Name) {
+			continue
+		}
+		err := kubeClient.RbacV1().ClusterRoleBindings().Delete(ctx, binding.Name, metav1.DeleteOptions{})
+		switch {
+		case apierrors.IsNotFound(err):
+		case err != nil:
+			errs = append(errs, err)
+		default:
+			klog.Infof("Cluster role binding %s with subjects %v is deleted for addon %s of cluster %s",
+				binding.Name, binding.Subjects, addon.Name, cluster.Name)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// setHubPermissionNamespace defaults the namespace to the cluster namespace and sets the addon as the owner, so the
+// objects are deleted with the addon. The addon label is set so the bindings no longer rendered are pruned.
+func setHubPermissionNamespace(metadata *metav1.ObjectMeta, cluster *clusterv1.ManagedCluster,
+	addon *addonapiv1alpha1.ManagedClusterAddOn) error {
+	if len(metadata.Namespace) == 0 {
+		metadata.Namespace = cluster.Name
+	}
+	if metadata.Namespace != cluster.Name {
+		return fmt.Errorf("%s is in namespace %s, only the cluster namespace %s is allowed",
+			metadata.Name, metadata.Namespace, cluster.Name)
+	}
+	utils.MergeOwnerRefs(&metadata.OwnerReferences, metav1.OwnerReference{
+		APIVersion:         addonapiv1alpha1.GroupVersion.String(),
+		Kind:               "ManagedClusterAddOn",
+		Name:               addon.Name,
+		BlockOwnerDeletion: pointer.Bool(true),
+		UID:                addon.UID,
+	}, false)
+	if metadata.Labels == nil {
+		metadata.Labels = map[string]string{}
+	}
+	metadata.Labels[addonapiv1alpha1.AddonLabelKey] = addon.Name
+	return nil
+}
+
+// setHubPermissionClusterLabels labels the cluster scoped object with the addon and the cluster, so it is pruned and
+// cleaned up by the labels.
+func setHubPermissionClusterLabels(metadata *metav1.ObjectMeta, cluster *clusterv1.ManagedCluster,
+	addon *addonapiv1alpha1.ManagedClusterAddOn) {
+	if metadata.Labels == nil {
+		metadata.Labels = map[string]string{}
+	}
+	metadata.Labels[addonapiv1alpha1.AddonLabelKey] = addon.Name
+	metadata.Labels[clusterv1.ClusterNameLabelKey] = cluster.Name
+}
+
+func checkHubPermissionClusterLabels(existing, required metav1.ObjectMeta) error {
+	for _, key := range []string{addonapiv1alpha1.AddonLabelKey, clusterv1.ClusterNameLabelKey} {
+		if existing.Labels[key] != required.Labels[key] {
+			return fmt.Errorf("%s exists and is not created for addon %s of cluster %s, the names of the cluster "+
+				"scoped objects must be unique for each cluster", required.Name,
+				required.Labels[addonapiv1alpha1.AddonLabelKey], required.Labels[clusterv1.ClusterNameLabelKey])
+		}
+	}
+	return nil
+}
+
+func hubPermissionClusterSelector(cluster *clusterv1.ManagedCluster, addon *addonapiv1alpha1.ManagedClusterAddOn) string {
+	return labels.SelectorFromSet(labels.Set{
+		addonapiv1alpha1.AddonLabelKey: addon.Name,
+		clusterv1.ClusterNameLabelKey:  cluster.Name,
+	}).String()
+}
+
+func getHubPermissionValues(cluster *clusterv1.ManagedCluster, addon *addonapiv1alpha1.ManagedClusterAddOn,
+	installNamespaceFunc func(addon *addonapiv1alpha1.ManagedClusterAddOn) (string, error),
+) (*hubPermissionValues, error) {
+	installNamespace := addon.Spec.InstallNamespace
+	if len(installNamespace) == 0 {
+		installNamespace = AddonDefaultInstallNamespace
+	}
+	if installNamespaceFunc != nil {
+		ns, err := installNamespaceFunc(addon)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get agent install namespace for addon %s: %v", addon.Name, err)
+		}
+		if len(ns) > 0 {
+			installNamespace = ns
+		}
+	}
+
+	return &hubPermissionValues{
+		ClusterName:           cluster.Name,
+		AddonName:             addon.Name,
+		AddonInstallNamespace: installNamespace,
+		Subjects:              utils.BuildSubjectsFromRegistration(addon, certificatesv1.KubeAPIServerClientSignerName),
+	}, nil
+}
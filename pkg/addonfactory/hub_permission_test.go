@@ -0,0 +1,338 @@
+package addonfactory
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	certificatesv1 "k8s.io/api/certificates/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes/fake"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+
+	"open-cluster-management.io/addon-framework/pkg/agent"
+)
+
+func TestHubPermissionConfigFunc(t *testing.T) {
+	cluster := NewFakeManagedCluster("cluster1", "1.10.1")
+	subject := addonapiv1alpha1.Subject{
+		User:   "system:serviceaccount:cluster1:helloworld",
+		Groups: []string{"system:open-cluster-management:addon:helloworld"},
+	}
+
+	cases := []struct {
+		name                    string
+		subject                 addonapiv1alpha1.Subject
+		expectedSubjectNotReady bool
+	}{
+		{
+			name:                    "subject not reported",
+			expectedSubjectNotReady: true,
+		},
+		{
+			name:    "subject reported",
+			subject: subject,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			addon := NewFakeManagedClusterAddon("helloworld", "cluster1", "", "")
+			addon.UID = "addon-uid"
+			addon.Status.Registrations = []addonapiv1alpha1.RegistrationConfig{
+				{SignerName: certificatesv1.KubeAPIServerClientSignerName, Subject: c.subject},
+			}
+
+			kubeClient := fake.NewSimpleClientset()
+			permissionConfig, err := NewHubPermissionConfigFunc(kubeClient, templateFS, "testmanifests/hubpermission",
+				func(addon *addonapiv1alpha1.ManagedClusterAddOn) (string, error) {
+					return "helloworld-ns", nil
+				})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = permissionConfig(cluster, addon)
+			var subjectNotReadyErr *agent.SubjectNotReadyError
+			if errors.As(err, &subjectNotReadyErr) != c.expectedSubjectNotReady {
+				t.Fatalf("expected subject not ready %v, but got %v", c.expectedSubjectNotReady, err)
+			}
+			if !c.expectedSubjectNotReady && err != nil {
+				t.Fatal(err)
+			}
+
+			// the roles are applied before the subjects are reported
+			role, err := kubeClient.RbacV1().Roles("cluster1").Get(context.TODO(), "helloworld-agent", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(role.OwnerReferences) != 1 || role.OwnerReferences[0].UID != addon.UID {
+				t.Errorf("expected role owned by the addon, but got %v", role.OwnerReferences)
+			}
+			if names := role.Rules[0].ResourceNames; len(names) != 1 || names[0] != "helloworld-helloworld-ns" {
+				t.Errorf("unexpected resource names %v", names)
+			}
+
+			roleBindings, err := kubeClient.RbacV1().RoleBindings("cluster1").List(context.TODO(), metav1.ListOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.expectedSubjectNotReady {
+				if len(roleBindings.Items) != 0 {
+					t.Errorf("expected no bindings, but got %v", roleBindings.Items)
+				}
+				return
+			}
+
+			if len(roleBindings.Items) != 2 {
+				t.Fatalf("expected two role bindings, but got %v", roleBindings.Items)
+			}
+			for _, binding := range roleBindings.Items {
+				if len(binding.Subjects) != 2 || binding.Subjects[0].Name != subject.User {
+					t.Errorf("unexpected role binding subjects %v", binding.Subjects)
+				}
+				if len(binding.OwnerReferences) != 1 || binding.OwnerReferences[0].UID != addon.UID {
+					t.Errorf("expected role binding owned by the addon, but got %v", binding.OwnerReferences)
+				}
+			}
+		})
+	}
+}
+
+func TestHubPermissionConfigFunc_Pruning(t *testing.T) {
+	cluster := NewFakeManagedCluster("cluster1", "1.10.1")
+	addon := NewFakeManagedClusterAddon("helloworld", "cluster1", "", "")
+	addon.UID = "addon-uid"
+	addon.Status.Registrations = []addonapiv1alpha1.RegistrationConfig{
+		{
+			SignerName: certificatesv1.KubeAPIServerClientSignerName,
+			Subject:    addonapiv1alpha1.Subject{User: "system:serviceaccount:cluster1:helloworld"},
+		},
+	}
+	ownerRefs := []metav1.OwnerReference{{Kind: "ManagedClusterAddOn", Name: "helloworld", UID: "addon-uid"}}
+
+	kubeClient := fake.NewSimpleClientset(
+		// the binding no longer rendered
+		&rbacv1.RoleBinding{ObjectMeta: metav1.ObjectMeta{
+			Name: "helloworld-agent-edit", Namespace: "cluster1", OwnerReferences: ownerRefs,
+			Labels: map[string]string{addonapiv1alpha1.AddonLabelKey: "helloworld"},
+		}},
+		// the binding rendered before the pruning, which is not labeled
+		&rbacv1.RoleBinding{ObjectMeta: metav1.ObjectMeta{
+			Name: "helloworld-agent", Namespace: "cluster1", OwnerReferences: ownerRefs,
+		}},
+		// the binding not owned by the addon
+		&rbacv1.RoleBinding{ObjectMeta: metav1.ObjectMeta{
+			Name: "other", Namespace: "cluster1",
+			Labels: map[string]string{addonapiv1alpha1.AddonLabelKey: "helloworld"},
+		}},
+	)
+	permissionConfig, err := NewHubPermissionConfigFunc(kubeClient, templateFS, "testmanifests/hubpermission", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := permissionConfig(cluster, addon); err != nil {
+		t.Fatal(err)
+	}
+
+	roleBindings, err := kubeClient.RbacV1().RoleBindings("cluster1").List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := sets.New[string]()
+	for _, binding := range roleBindings.Items {
+		names.Insert(binding.Name)
+	}
+	if !names.Equal(sets.New[string]("helloworld-agent", "helloworld-agent-view", "other")) {
+		t.Errorf("unexpected role bindings %v", sets.List(names))
+	}
+
+	// the bindings are pruned once the subjects are removed
+	addon.Status.Registrations = nil
+	var subjectNotReadyErr *agent.SubjectNotReadyError
+	if err := permissionConfig(cluster, addon); !errors.As(err, &subjectNotReadyErr) {
+		t.Fatalf("expected subject not ready error, but got %v", err)
+	}
+	roleBindings, err = kubeClient.RbacV1().RoleBindings("cluster1").List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(roleBindings.Items) != 1 || roleBindings.Items[0].Name != "other" {
+		t.Errorf("expected the bindings of the addon pruned, but got %v", roleBindings.Items)
+	}
+}
+
+func TestHubPermissionConfigFunc_ClusterScoped(t *testing.T) {
+	name := "open-cluster-management:helloworld:cluster1:agent"
+	newAddon := func(user string) *addonapiv1alpha1.ManagedClusterAddOn {
+		addon := NewFakeManagedClusterAddon("helloworld", "cluster1", "", "")
+		if len(user) > 0 {
+			addon.Status.Registrations = []addonapiv1alpha1.RegistrationConfig{
+				{SignerName: certificatesv1.KubeAPIServerClientSignerName, Subject: addonapiv1alpha1.Subject{User: user}},
+			}
+		}
+		return addon
+	}
+	cluster := NewFakeManagedCluster("cluster1", "1.10.1")
+
+	kubeClient := fake.NewSimpleClientset(
+		// the objects of another cluster are not deleted
+		&rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{
+			Name: "open-cluster-management:helloworld:cluster2:agent",
+			Labels: map[string]string{
+				addonapiv1alpha1.AddonLabelKey: "helloworld", clusterv1.ClusterNameLabelKey: "cluster2",
+			},
+		}},
+	)
+	permissionConfig, err := NewHubPermissionConfigFunc(kubeClient, templateFS,
+		"testmanifests/clusterscoped-hubpermission", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := permissionConfig(cluster, newAddon("system:serviceaccount:cluster1:helloworld")); err != nil {
+		t.Fatal(err)
+	}
+
+	clusterRole, err := kubeClient.RbacV1().ClusterRoles().Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clusterRole.Labels[addonapiv1alpha1.AddonLabelKey] != "helloworld" ||
+		clusterRole.Labels[clusterv1.ClusterNameLabelKey] != "cluster1" {
+		t.Errorf("expected cluster role labeled with the addon and cluster, but got %v", clusterRole.Labels)
+	}
+	binding, err := kubeClient.RbacV1().ClusterRoleBindings().Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(binding.Subjects) != 1 || binding.Subjects[0].Name != "system:serviceaccount:cluster1:helloworld" {
+		t.Errorf("unexpected cluster role binding subjects %v", binding.Subjects)
+	}
+
+	// the binding is pruned once the subjects are removed
+	var subjectNotReadyErr *agent.SubjectNotReadyError
+	if err := permissionConfig(cluster, newAddon("")); !errors.As(err, &subjectNotReadyErr) {
+		t.Fatalf("expected subject not ready error, but got %v", err)
+	}
+	if _, err := kubeClient.RbacV1().ClusterRoleBindings().Get(
+		context.TODO(), name, metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Errorf("expected cluster role binding pruned, but got %v", err)
+	}
+
+	if err := NewHubPermissionCleanupFunc(kubeClient)(cluster, newAddon("")); err != nil {
+		t.Fatal(err)
+	}
+	clusterRoles, err := kubeClient.RbacV1().ClusterRoles().List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(clusterRoles.Items) != 1 || clusterRoles.Items[0].Name != "open-cluster-management:helloworld:cluster2:agent" {
+		t.Errorf("expected the cluster role of cluster1 deleted, but got %v", clusterRoles.Items)
+	}
+
+	// the existing object not created for the addon of the cluster is not overwritten
+	kubeClient = fake.NewSimpleClientset(&rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: name}})
+	permissionConfig, err = NewHubPermissionConfigFunc(kubeClient, templateFS,
+		"testmanifests/clusterscoped-hubpermission", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := permissionConfig(cluster, newAddon("system:serviceaccount:cluster1:helloworld")); err == nil {
+		t.Errorf("expected error of the existing cluster role, but got none")
+	}
+}
+
+func TestHubPermissionConfigFunc_UnsupportedKind(t *testing.T) {
+	// the unsupported kinds and the objects in other namespaces are rejected
+	for _, dir := range []string{
+		"testmanifests/template",
+		"testmanifests/othernamespace-hubpermission",
+	} {
+		kubeClient := fake.NewSimpleClientset()
+		permissionConfig, err := NewHubPermissionConfigFunc(kubeClient, templateFS, dir, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		addon := NewFakeManagedClusterAddon("helloworld", "cluster1", "", "")
+		addon.Status.Registrations = []addonapiv1alpha1.RegistrationConfig{
+			{
+				SignerName: certificatesv1.KubeAPIServerClientSignerName,
+				Subject:    addonapiv1alpha1.Subject{User: "system:serviceaccount:cluster1:helloworld"},
+			},
+		}
+		if err := permissionConfig(NewFakeManagedCluster("cluster1", "1.10.1"), addon); err == nil {
+			t.Errorf("expected error of %s, but got none", dir)
+		}
+		if actions := kubeClient.Actions(); len(actions) != 0 {
+			t.Errorf("expected no actions of %s, but got %v", dir, actions)
+		}
+	}
+
+	if _, err := NewHubPermissionConfigFunc(fake.NewSimpleClientset(), templateFS, "testmanifests/notexist", nil); err == nil {
+		t.Errorf("expected error, but got none")
+	}
+}
+
+func TestAgentAddonFactory_WithHubPermissionManifests(t *testing.T) {
+	kubeClient := fake.NewSimpleClientset()
+
+	_, err := NewAgentAddonFactory("helloworld", templateFS, "testmanifests/template").
+		WithHubPermissionManifests(kubeClient, templateFS, "testmanifests/hubpermission").
+		BuildTemplateAgentAddon()
+	if err == nil {
+		t.Errorf("expected error without the registration option, but got none")
+	}
+
+	_, err = NewAgentAddonFactory("helloworld", templateFS, "testmanifests/template").
+		WithAgentRegistrationOption(&agent.RegistrationOption{}).
+		WithHubPermissionManifests(kubeClient, templateFS, "testmanifests/notexist").
+		BuildTemplateAgentAddon()
+	if err == nil {
+		t.Errorf("expected error without the hub permission manifests, but got none")
+	}
+
+	called := 0
+	factory := NewAgentAddonFactory("helloworld", templateFS, "testmanifests/template").
+		// the registration option can be set after the hub permission manifests
+		WithHubPermissionManifests(kubeClient, templateFS, "testmanifests/hubpermission").
+		WithAgentRegistrationOption(&agent.RegistrationOption{
+			PermissionConfig: func(cluster *clusterv1.ManagedCluster, addon *addonapiv1alpha1.ManagedClusterAddOn) error {
+				called++
+				return nil
+			},
+		}).
+		WithAgentInstallNamespace(func(addon *addonapiv1alpha1.ManagedClusterAddOn) (string, error) {
+			return "helloworld-ns", nil
+		})
+	if _, err := factory.BuildTemplateAgentAddon(); err != nil {
+		t.Fatal(err)
+	}
+	// the permission config is wrapped once if the addon is built again
+	agentAddon, err := factory.BuildTemplateAgentAddon()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addon := NewFakeManagedClusterAddon("helloworld", "cluster1", "", "")
+	if agentAddon.GetAgentAddonOptions().Registration.PermissionCleanup == nil {
+		t.Errorf("expected the permission cleanup set")
+	}
+	permissionConfig := agentAddon.GetAgentAddonOptions().Registration.PermissionConfig
+	if err := permissionConfig(NewFakeManagedCluster("cluster1", "1.10.1"), addon); err == nil {
+		t.Errorf("expected subject not ready error, but got none")
+	}
+	if called != 1 {
+		t.Errorf("expected the permission config of the registration option to be called once, but got %d", called)
+	}
+	role, err := kubeClient.RbacV1().Roles("cluster1").Get(context.TODO(), "helloworld-agent", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := role.Rules[0].ResourceNames; len(names) != 1 || names[0] != "helloworld-helloworld-ns" {
+		t.Errorf("expected the install namespace set after the hub permission manifests, but got %v", names)
+	}
+}
@@ -0,0 +1,110 @@
+package addonfactory
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/klog/v2"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+
+	"open-cluster-management.io/addon-framework/pkg/utils"
+)
+
+// ImageRegistriesPrecedence defines which image registries take precedence if both the registries of the
+// AddOnDeploymentConfig and the image registries annotation of the ManagedCluster override an image.
+type ImageRegistriesPrecedence string
+
+const (
+	// AddOnDeploymentConfigPrecedence means the registries of the AddOnDeploymentConfig take precedence, it is the
+	// same as GetAgentImageValues.
+	AddOnDeploymentConfigPrecedence ImageRegistriesPrecedence = "AddOnDeploymentConfig"
+	// ManagedClusterPrecedence means the image registries annotation of the ManagedCluster takes precedence.
+	ManagedClusterPrecedence ImageRegistriesPrecedence = "ManagedCluster"
+)
+
+// ImageOverrideOptions configures how the agent image is overridden.
+type ImageOverrideOptions struct {
+	// Rules are the default override rules of the addon, they have lower precedence than the registries of the
+	// AddOnDeploymentConfig and the ManagedCluster annotation.
+	Rules []utils.ImageOverrideRule
+
+	// Precedence defines which of the AddOnDeploymentConfig and the ManagedCluster annotation takes precedence,
+	// defaults to AddOnDeploymentConfigPrecedence.
+	Precedence ImageRegistriesPrecedence
+
+	// DigestResolver pins the image to the digest resolved with the original image after the image is overridden.
+	// The image is not pinned if it is nil.
+	DigestResolver utils.ImageDigestResolver
+}
+
+// GetAgentImageValuesWithOptions return a func that overrides the image with the rules in options, the registries
+// of the AddOnDeploymentConfig and the image registries annotation of the ManagedCluster, then pins the image to
+// its digest, and returns the effective image with the key imageKey.
+//
+// The rules are applied in the order of precedence from low to high, and the one with the highest precedence wins
+// if multiple rules match the image:
+//  1. the rules in options
+//  2. the AddOnDeploymentConfig registries and the ManagedCluster annotation, in the order defined by
+//     options.Precedence
+//
+// Like GetAgentImageValues, the imageKey can support the nested key, for example: "global.imageOverrides.agentImage".
+//
+// Use WithEffectiveImagesEnabledOption of the factory to record the effective images in the addon status.
+func GetAgentImageValuesWithOptions(getter utils.AddOnDeploymentConfigGetter, imageKey, image string,
+	options ImageOverrideOptions) GetValuesFunc {
+	// the rules in options are compiled once, the registries are prefix rules which need no compiling.
+	overrider, overriderErr := utils.NewImageOverrider(options.Rules...)
+	return func(cluster *clusterv1.ManagedCluster, addon *addonapiv1alpha1.ManagedClusterAddOn) (Values, error) {
+		if len(image) == 0 {
+			return nil, fmt.Errorf("image is empty")
+		}
+		if overriderErr != nil {
+			return nil, overriderErr
+		}
+		effectiveImage, err := getEffectiveAgentImage(getter, image, overrider, options, cluster, addon)
+		if err != nil {
+			return nil, err
+		}
+		klog.V(4).Infof("Overrode image %v with %v", image, effectiveImage)
+
+		// the image is already overridden, build the values with no registries
+		values, _, err := overrideImageWithKeyValue(imageKey, effectiveImage,
+			func() ([]addonapiv1alpha1.ImageMirror, error) { return nil, nil })
+		return values, err
+	}
+}
+
+func getEffectiveAgentImage(getter utils.AddOnDeploymentConfigGetter, image string, overrider *utils.ImageOverrider,
+	options ImageOverrideOptions, cluster *clusterv1.ManagedCluster,
+	addon *addonapiv1alpha1.ManagedClusterAddOn) (string, error) {
+	addOnDeploymentConfig, err := utils.GetDesiredAddOnDeploymentConfig(addon, getter)
+	if err != nil {
+		return "", err
+	}
+	var configRules []utils.ImageOverrideRule
+	if addOnDeploymentConfig != nil {
+		configRules = utils.ImageMirrorsToRules(addOnDeploymentConfig.Spec.Registries)
+	}
+
+	clusterRegistries, err := getRegistriesFromClusterAnnotation(cluster)()
+	if err != nil {
+		return "", err
+	}
+	clusterRules := utils.ImageMirrorsToRules(clusterRegistries)
+
+	var rules []utils.ImageOverrideRule
+	if options.Precedence == ManagedClusterPrecedence {
+		rules = append(configRules, clusterRules...)
+	} else {
+		rules = append(clusterRules, configRules...)
+	}
+
+	overrider, err = overrider.Append(rules...)
+	if err != nil {
+		return "", err
+	}
+	effectiveImage := overrider.Override(image)
+
+	return utils.PinImageDigest(context.TODO(), options.DigestResolver, image, effectiveImage)
+}
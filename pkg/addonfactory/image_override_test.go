@@ -0,0 +1,124 @@
+package addonfactory
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	fakeaddon "open-cluster-management.io/api/client/addon/clientset/versioned/fake"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+
+	"open-cluster-management.io/addon-framework/pkg/addonmanager/addontesting"
+	"open-cluster-management.io/addon-framework/pkg/utils"
+)
+
+func TestGetAgentImageValuesWithOptions(t *testing.T) {
+	config := &addonapiv1alpha1.AddOnDeploymentConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "config", Namespace: "cluster1"},
+		Spec: addonapiv1alpha1.AddOnDeploymentConfigSpec{
+			Registries: []addonapiv1alpha1.ImageMirror{{Source: "quay.io/ocm", Mirror: "config.io/ocm"}},
+		},
+	}
+	getter := utils.NewAddOnDeploymentConfigGetter(fakeaddon.NewSimpleClientset(config))
+
+	addon := addontesting.NewAddon("test", "cluster1")
+	addon.Status.ConfigReferences = []addonapiv1alpha1.ConfigReference{
+		{
+			ConfigGroupResource: addonapiv1alpha1.ConfigGroupResource{
+				Group:    utils.AddOnDeploymentConfigGVR.Group,
+				Resource: utils.AddOnDeploymentConfigGVR.Resource,
+			},
+			DesiredConfig: &addonapiv1alpha1.ConfigSpecHash{
+				ConfigReferent: addonapiv1alpha1.ConfigReferent{Namespace: "cluster1", Name: "config"},
+				SpecHash:       "dummy",
+			},
+		},
+	}
+
+	cluster := addontesting.NewManagedCluster("cluster1")
+	cluster.Annotations = map[string]string{
+		clusterv1.ClusterImageRegistriesAnnotationKey: `{"registries":[{"mirror":"cluster.io/ocm","source":"quay.io/ocm"}]}`,
+	}
+
+	digest := "sha256:6c3c624b58dbbcd3c0dd82b4c53f04194d1247c6eebdaab7c610cf7d66709b3b"
+	cases := []struct {
+		name          string
+		image         string
+		addon         *addonapiv1alpha1.ManagedClusterAddOn
+		options       ImageOverrideOptions
+		expectedImage string
+		expectedError bool
+	}{
+		{
+			name:          "addon deployment config takes precedence by default",
+			image:         "quay.io/ocm/addon:v1",
+			addon:         addon,
+			expectedImage: "config.io/ocm/addon:v1",
+		},
+		{
+			name:          "managed cluster takes precedence",
+			image:         "quay.io/ocm/addon:v1",
+			addon:         addon,
+			options:       ImageOverrideOptions{Precedence: ManagedClusterPrecedence},
+			expectedImage: "cluster.io/ocm/addon:v1",
+		},
+		{
+			name:  "default rules have the lowest precedence",
+			image: "quay.io/ocm/addon:v1",
+			addon: addontesting.NewAddon("test", "cluster1"),
+			options: ImageOverrideOptions{
+				Rules: []utils.ImageOverrideRule{{ImageName: "quay.io/ocm/addon", Mirror: "rule.io/addon"}},
+			},
+			expectedImage: "cluster.io/ocm/addon:v1",
+		},
+		{
+			name:  "default rules for the other images",
+			image: "quay.io/other/addon:v1",
+			addon: addon,
+			options: ImageOverrideOptions{
+				Rules: []utils.ImageOverrideRule{{ImageRegex: `^quay\.io/other/(.*)$`, Mirror: "rule.io/${1}"}},
+			},
+			expectedImage: "rule.io/addon:v1",
+		},
+		{
+			name:  "pinned to digest",
+			image: "quay.io/ocm/addon:v1",
+			addon: addon,
+			options: ImageOverrideOptions{
+				DigestResolver: utils.ImageDigests{"quay.io/ocm/addon:v1": digest},
+			},
+			expectedImage: "config.io/ocm/addon@" + digest,
+		},
+		{
+			name:          "empty image",
+			addon:         addon,
+			expectedError: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			values, err := GetAgentImageValuesWithOptions(getter, "global.imageOverrides.agentImage", c.image,
+				c.options)(cluster, c.addon)
+			if c.expectedError {
+				if err == nil {
+					t.Errorf("expected error, but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expected := Values{
+				"global": map[string]interface{}{
+					"imageOverrides": map[string]interface{}{"agentImage": c.expectedImage},
+				},
+			}
+			if !equality.Semantic.DeepEqual(values, expected) {
+				t.Errorf("expected values %v, but got %v", expected, values)
+			}
+		})
+	}
+}
@@ -42,6 +42,7 @@ type TemplateAgentAddon struct {
 	agentAddonOptions     agent.AgentAddonOptions
 	trimCRDDescription    bool
 	agentInstallNamespace func(addon *addonapiv1alpha1.ManagedClusterAddOn) (string, error)
+	*specHasher
 }
 
 func newTemplateAgentAddon(factory *AgentAddonFactory) *TemplateAgentAddon {
@@ -51,6 +52,7 @@ func newTemplateAgentAddon(factory *AgentAddonFactory) *TemplateAgentAddon {
 		agentAddonOptions:     factory.agentAddonOptions,
 		trimCRDDescription:    factory.trimCRDDescription,
 		agentInstallNamespace: factory.agentInstallNamespace,
+		specHasher:            factory.specHasher,
 	}
 }
 
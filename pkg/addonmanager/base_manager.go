@@ -4,13 +4,19 @@ import (
 	"context"
 	"fmt"
 
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/dynamic/dynamicinformer"
 	kubeinformers "k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
 	addonv1alpha1client "open-cluster-management.io/api/client/addon/clientset/versioned"
 	addoninformers "open-cluster-management.io/api/client/addon/informers/externalversions"
+	addonlisterv1alpha1 "open-cluster-management.io/api/client/addon/listers/addon/v1alpha1"
 	clusterv1informers "open-cluster-management.io/api/client/cluster/informers/externalversions"
 	workclientset "open-cluster-management.io/api/client/work/clientset/versioned"
 	workv1informers "open-cluster-management.io/api/client/work/informers/externalversions/work/v1"
@@ -21,6 +27,7 @@ import (
 	"open-cluster-management.io/addon-framework/pkg/addonmanager/controllers/cmaconfig"
 	"open-cluster-management.io/addon-framework/pkg/addonmanager/controllers/cmamanagedby"
 	"open-cluster-management.io/addon-framework/pkg/addonmanager/controllers/registration"
+	"open-cluster-management.io/addon-framework/pkg/addonmanager/sharding"
 	"open-cluster-management.io/addon-framework/pkg/agent"
 	"open-cluster-management.io/addon-framework/pkg/utils"
 	"open-cluster-management.io/sdk-go/pkg/basecontroller/factory"
@@ -38,6 +45,24 @@ type Option struct {
 	// are fully ready, avoiding unnecessary errors and retries.
 	// See https://github.com/open-cluster-management-io/ocm/issues/1181 for more context.
 	TemplateBasedAddOn bool
+
+	// Readiness is the readyz checker tracking the informers and controllers of the manager, it allows the
+	// readyz endpoint to be registered before the manager is created.
+	Readiness *Readiness
+
+	// Sharder enables the sharding mode, in which multiple active replicas of the manager coordinate the
+	// ownership of the cluster namespaces, and each replica only reconciles the ManagedClusterAddOns in the
+	// clusters it owns. The leader election must be disabled in the sharding mode. The controllers of
+	// ClusterManagementAddOns and addon configs are not sharded.
+	Sharder *sharding.Sharder
+
+	// ConfigChangeOptions configures the debouncing and the fan-out rate limit of the reconciles triggered
+	// by the changes of addon configs. By default, the addons are enqueued immediately on each change.
+	ConfigChangeOptions addonconfig.ConfigChangeOptions
+
+	// SpecHashOptions configures how the spec hashes of the configs are computed for each config
+	// GroupVersionResource, the raw spec of a config is hashed if it has no options.
+	SpecHashOptions utils.ConfigSpecHashOptions
 }
 
 // OptionFunc is a function that modifies Option.
@@ -50,6 +75,39 @@ func WithTemplateMode(enabled bool) OptionFunc {
 	}
 }
 
+// WithReadiness returns an OptionFunc that sets the readyz checker of the manager.
+func WithReadiness(readiness *Readiness) OptionFunc {
+	return func(option *Option) {
+		option.Readiness = readiness
+	}
+}
+
+// WithConfigChangeOptions returns an OptionFunc that sets how the changes of addon configs are propagated
+// to the addons.
+func WithConfigChangeOptions(options addonconfig.ConfigChangeOptions) OptionFunc {
+	return func(option *Option) {
+		option.ConfigChangeOptions = options
+	}
+}
+
+// WithSpecHashOptions returns an OptionFunc that sets how the spec hash of the configs of the gvr is computed. The
+// options are also used by the agents implementing agent.SpecHashAware, e.g. the ones built by the addonfactory.
+func WithSpecHashOptions(gvr schema.GroupVersionResource, hashOptions *utils.SpecHashOptions) OptionFunc {
+	return func(option *Option) {
+		if option.SpecHashOptions == nil {
+			option.SpecHashOptions = utils.ConfigSpecHashOptions{}
+		}
+		option.SpecHashOptions[gvr] = hashOptions
+	}
+}
+
+// WithSharder returns an OptionFunc that enables the sharding mode with the sharder.
+func WithSharder(sharder *sharding.Sharder) OptionFunc {
+	return func(option *Option) {
+		option.Sharder = sharder
+	}
+}
+
 // WithOption returns an OptionFunc that applies the given Option struct.
 func WithOption(opt *Option) OptionFunc {
 	return func(option *Option) {
@@ -67,6 +125,10 @@ type BaseAddonManagerImpl struct {
 	config             *rest.Config
 	syncContexts       []factory.SyncContext
 	templateBasedAddOn bool
+	readiness          *Readiness
+	sharder            *sharding.Sharder
+	configChange       addonconfig.ConfigChangeOptions
+	specHashOptions    utils.ConfigSpecHashOptions
 }
 
 // NewBaseAddonManagerImpl creates a new BaseAddonManagerImpl instance with the given config.
@@ -76,6 +138,7 @@ func NewBaseAddonManagerImpl(config *rest.Config) *BaseAddonManagerImpl {
 		syncContexts: []factory.SyncContext{},
 		addonConfigs: map[schema.GroupVersionResource]bool{},
 		addonAgents:  map[string]agent.AgentAddon{},
+		readiness:    NewReadiness(),
 	}
 }
 
@@ -86,6 +149,17 @@ func (a *BaseAddonManagerImpl) ApplyOptionFuncs(optionFuncs ...OptionFunc) {
 		fn(option)
 	}
 	a.templateBasedAddOn = option.TemplateBasedAddOn
+	if option.Readiness != nil {
+		a.readiness = option.Readiness
+	}
+	a.sharder = option.Sharder
+	a.configChange = option.ConfigChangeOptions
+	a.specHashOptions = option.SpecHashOptions
+}
+
+// Readiness returns the readyz checker of the manager.
+func (a *BaseAddonManagerImpl) Readiness() *Readiness {
+	return a.readiness
 }
 
 func (a *BaseAddonManagerImpl) GetConfig() *rest.Config {
@@ -104,10 +178,27 @@ func (a *BaseAddonManagerImpl) AddAgent(addon agent.AgentAddon) error {
 	if _, ok := a.addonAgents[addonOption.AddonName]; ok {
 		return fmt.Errorf("an agent is added for the addon already")
 	}
+	if prober := addonOption.HealthProber; prober != nil && prober.Type == agent.HealthProberTypeComposite &&
+		prober.CompositeProber != nil {
+		for _, subProber := range prober.CompositeProber.Probers {
+			if err := agent.ValidateCompositeSubProber(subProber); err != nil {
+				return err
+			}
+		}
+	}
+	if aware, ok := addon.(agent.SpecHashAware); ok {
+		aware.SetSpecHashFunc(a.getSpecHash)
+	}
 	a.addonAgents[addonOption.AddonName] = addon
 	return nil
 }
 
+// getSpecHash computes the spec hash of the config with the SpecHashOptions of the manager, the options are read on
+// each call since they may be applied after the agents are added.
+func (a *BaseAddonManagerImpl) getSpecHash(group, resource string, config *unstructured.Unstructured) (string, error) {
+	return a.specHashOptions.GetSpecHash(group, resource, config)
+}
+
 func (a *BaseAddonManagerImpl) Trigger(clusterName, addonName string) {
 	for _, syncContex := range a.syncContexts {
 		syncContex.Queue().Add(fmt.Sprintf("%s/%s", clusterName, addonName))
@@ -127,6 +218,11 @@ func (a *BaseAddonManagerImpl) StartWithInformers(ctx context.Context,
 	if a.templateBasedAddOn {
 		mcaFilterFunc = utils.FilterTemplateBasedAddOns
 	}
+	if a.sharder != nil {
+		mcaFilterFunc = a.shardedFilterFunc(mcaFilterFunc)
+		a.sharder.OnMembershipChange(a.resyncOwnedAddOns(addonInformers.Addon().V1alpha1().ManagedClusterAddOns().Lister()))
+		go a.sharder.Start(ctx)
+	}
 
 	kubeClient, err := kubernetes.NewForConfig(a.config)
 	if err != nil {
@@ -155,6 +251,7 @@ func (a *BaseAddonManagerImpl) StartWithInformers(ctx context.Context,
 		clusterInformers.Cluster().V1().ManagedClusters(),
 		addonInformers.Addon().V1alpha1().ManagedClusterAddOns(),
 		workInformers,
+		kubeInformers.Coordination().V1().Leases(),
 		a.addonAgents,
 		mcaFilterFunc,
 	)
@@ -186,6 +283,11 @@ func (a *BaseAddonManagerImpl) StartWithInformers(ctx context.Context,
 		// to be applied.
 		// Consider moving the logic of setting managedclusteraddon.status.configReferences
 		// for addontemplates to the ocm addon-manager.
+		// The addons are still sharded by the cluster, since the config references are set per addon.
+		configMCAFilterFunc := utils.AllowAllAddOns
+		if a.sharder != nil {
+			configMCAFilterFunc = a.shardedFilterFunc(configMCAFilterFunc)
+		}
 		addonConfigController = addonconfig.NewAddonConfigController(
 			addonClient,
 			addonInformers.Addon().V1alpha1().ManagedClusterAddOns(),
@@ -193,6 +295,9 @@ func (a *BaseAddonManagerImpl) StartWithInformers(ctx context.Context,
 			dynamicInformers,
 			a.addonConfigs,
 			utils.FilterByAddonName(a.addonAgents),
+			configMCAFilterFunc,
+			a.configChange,
+			a.specHashOptions,
 		)
 		managementAddonConfigController = cmaconfig.NewCMAConfigController(
 			addonClient,
@@ -200,11 +305,14 @@ func (a *BaseAddonManagerImpl) StartWithInformers(ctx context.Context,
 			dynamicInformers,
 			a.addonConfigs,
 			utils.FilterByAddonName(a.addonAgents),
+			a.specHashOptions,
 		)
 	}
 
 	var csrApproveController factory.Controller
 	var csrSignController factory.Controller
+	var certificateExpiryController factory.Controller
+	var crlController factory.Controller
 	// Spawn the following controllers only if v1 CSR api is supported in the
 	// hub cluster. Under v1beta1 CSR api, all the CSR objects will be signed
 	// by the kube-controller-manager so custom CSR controller should be
@@ -216,6 +324,7 @@ func (a *BaseAddonManagerImpl) StartWithInformers(ctx context.Context,
 			kubeInformers.Certificates().V1().CertificateSigningRequests(),
 			nil,
 			addonInformers.Addon().V1alpha1().ManagedClusterAddOns(),
+			kubeInformers.Core().V1().ConfigMaps(),
 			a.addonAgents,
 			mcaFilterFunc,
 		)
@@ -224,6 +333,14 @@ func (a *BaseAddonManagerImpl) StartWithInformers(ctx context.Context,
 			clusterInformers.Cluster().V1().ManagedClusters(),
 			kubeInformers.Certificates().V1().CertificateSigningRequests(),
 			addonInformers.Addon().V1alpha1().ManagedClusterAddOns(),
+			kubeInformers.Core().V1().ConfigMaps(),
+			a.addonAgents,
+			mcaFilterFunc,
+		)
+		certificateExpiryController = certificate.NewCertificateExpiryController(
+			addonClient,
+			kubeInformers.Certificates().V1().CertificateSigningRequests(),
+			addonInformers.Addon().V1alpha1().ManagedClusterAddOns(),
 			a.addonAgents,
 			mcaFilterFunc,
 		)
@@ -234,29 +351,103 @@ func (a *BaseAddonManagerImpl) StartWithInformers(ctx context.Context,
 			nil,
 			kubeInformers.Certificates().V1beta1().CertificateSigningRequests(),
 			addonInformers.Addon().V1alpha1().ManagedClusterAddOns(),
+			kubeInformers.Core().V1().ConfigMaps(),
 			a.addonAgents,
 			mcaFilterFunc,
 		)
 	}
 
+	for _, agentImpl := range a.addonAgents {
+		registrationOption := agentImpl.GetAgentAddonOptions().Registration
+		if registrationOption != nil && registrationOption.CRLSign != nil {
+			crlController = certificate.NewCRLController(
+				kubeClient,
+				kubeInformers.Core().V1().ConfigMaps(),
+				a.addonAgents,
+			)
+			break
+		}
+	}
+
+	// the cache sync of the informers is tracked before the manager is started, so the manager is not ready until
+	// the informers, which are started by the caller after StartWithInformers returns, are synced.
+	a.readiness.TrackCacheSync(ctx, "work", workInformers.Informer().HasSynced)
+	a.readiness.TrackCacheSync(ctx, "addon",
+		addonInformers.Addon().V1alpha1().ManagedClusterAddOns().Informer().HasSynced,
+		addonInformers.Addon().V1alpha1().ClusterManagementAddOns().Informer().HasSynced)
+	a.readiness.TrackCacheSync(ctx, "cluster", clusterInformers.Cluster().V1().ManagedClusters().Informer().HasSynced)
+	kubeInformersSynced := []cache.InformerSynced{kubeInformers.Coordination().V1().Leases().Informer().HasSynced}
+	if v1CSRSupported {
+		kubeInformersSynced = append(kubeInformersSynced,
+			kubeInformers.Certificates().V1().CertificateSigningRequests().Informer().HasSynced)
+	} else if v1beta1Supported {
+		kubeInformersSynced = append(kubeInformersSynced,
+			kubeInformers.Certificates().V1beta1().CertificateSigningRequests().Informer().HasSynced)
+	}
+	if v1CSRSupported || v1beta1Supported || crlController != nil {
+		kubeInformersSynced = append(kubeInformersSynced, kubeInformers.Core().V1().ConfigMaps().Informer().HasSynced)
+	}
+	a.readiness.TrackCacheSync(ctx, "kube", kubeInformersSynced...)
+	var dynamicInformersSynced []cache.InformerSynced
+	for gvr := range a.addonConfigs {
+		dynamicInformersSynced = append(dynamicInformersSynced, dynamicInformers.ForResource(gvr).Informer().HasSynced)
+	}
+	a.readiness.TrackCacheSync(ctx, "dynamic", dynamicInformersSynced...)
+
 	a.syncContexts = append(a.syncContexts,
 		deployController.SyncContext(), registrationController.SyncContext())
 
-	go deployController.Run(ctx, 1)
-	go registrationController.Run(ctx, 1)
-	go managementAddonController.Run(ctx, 1)
+	a.readiness.startController(ctx, deployController, 1)
+	a.readiness.startController(ctx, registrationController, 1)
+	a.readiness.startController(ctx, managementAddonController, 1)
 
 	if addonConfigController != nil {
-		go addonConfigController.Run(ctx, 1)
+		a.readiness.startController(ctx, addonConfigController, 1)
 	}
 	if managementAddonConfigController != nil {
-		go managementAddonConfigController.Run(ctx, 1)
+		a.readiness.startController(ctx, managementAddonConfigController, 1)
 	}
 	if csrApproveController != nil {
-		go csrApproveController.Run(ctx, 1)
+		a.readiness.startController(ctx, csrApproveController, 1)
 	}
 	if csrSignController != nil {
-		go csrSignController.Run(ctx, 1)
+		a.readiness.startController(ctx, csrSignController, 1)
+	}
+	if certificateExpiryController != nil {
+		a.readiness.startController(ctx, certificateExpiryController, 1)
+	}
+	if crlController != nil {
+		a.readiness.startController(ctx, crlController, 1)
 	}
+
+	a.readiness.setStarted()
 	return nil
 }
+
+// shardedFilterFunc only allows the ManagedClusterAddOns in the clusters owned by this replica.
+func (a *BaseAddonManagerImpl) shardedFilterFunc(filterFunc utils.ManagedClusterAddOnFilterFunc) utils.ManagedClusterAddOnFilterFunc {
+	return func(mca *addonapiv1alpha1.ManagedClusterAddOn) bool {
+		if mca == nil || !a.sharder.Owns(mca.Namespace) {
+			return false
+		}
+		return filterFunc(mca)
+	}
+}
+
+// resyncOwnedAddOns returns the func to trigger the reconcile of the ManagedClusterAddOns owned by this replica
+// after the clusters are rebalanced.
+func (a *BaseAddonManagerImpl) resyncOwnedAddOns(addonLister addonlisterv1alpha1.ManagedClusterAddOnLister) func() {
+	return func() {
+		addons, err := addonLister.List(labels.Everything())
+		if err != nil {
+			klog.Errorf("Failed to list addons to resync: %v", err)
+			return
+		}
+		for _, addon := range addons {
+			if _, ok := a.addonAgents[addon.Name]; !ok || !a.sharder.Owns(addon.Namespace) {
+				continue
+			}
+			a.Trigger(addon.Namespace, addon.Name)
+		}
+	}
+}
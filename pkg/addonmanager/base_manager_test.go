@@ -0,0 +1,120 @@
+package addonmanager
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+
+	"open-cluster-management.io/addon-framework/pkg/agent"
+	"open-cluster-management.io/addon-framework/pkg/utils"
+)
+
+type testAgent struct {
+	name         string
+	healthProber *agent.HealthProber
+}
+
+func (a *testAgent) Manifests(_ *clusterv1.ManagedCluster,
+	_ *addonapiv1alpha1.ManagedClusterAddOn) ([]runtime.Object, error) {
+	return nil, nil
+}
+
+func (a *testAgent) GetAgentAddonOptions() agent.AgentAddonOptions {
+	return agent.AgentAddonOptions{AddonName: a.name, HealthProber: a.healthProber}
+}
+
+func TestAddAgent(t *testing.T) {
+	compositeProber := func(subProbers ...agent.CompositeSubProber) *agent.HealthProber {
+		return &agent.HealthProber{
+			Type:            agent.HealthProberTypeComposite,
+			CompositeProber: &agent.CompositeHealthProber{Probers: subProbers},
+		}
+	}
+
+	cases := []struct {
+		name         string
+		healthProber *agent.HealthProber
+		expectedErr  bool
+	}{
+		{
+			name:         "lease prober",
+			healthProber: &agent.HealthProber{Type: agent.HealthProberTypeLease},
+		},
+		{
+			name: "composite prober",
+			healthProber: compositeProber(
+				agent.CompositeSubProber{Name: "agent", Prober: &agent.HealthProber{Type: agent.HealthProberTypeWorkloadAvailability}},
+			),
+		},
+		{
+			name: "lease sub-prober",
+			healthProber: compositeProber(
+				agent.CompositeSubProber{Name: "lease", Prober: &agent.HealthProber{Type: agent.HealthProberTypeLease}},
+			),
+		},
+		{
+			name: "nested composite sub-prober",
+			healthProber: compositeProber(
+				agent.CompositeSubProber{Name: "nested", Prober: compositeProber()},
+			),
+			expectedErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			manager := NewBaseAddonManagerImpl(nil)
+			err := manager.AddAgent(&testAgent{name: "test", healthProber: c.healthProber})
+			if c.expectedErr && err == nil {
+				t.Errorf("expected error, but got none")
+			}
+			if !c.expectedErr && err != nil {
+				t.Errorf("unexpected error %v", err)
+			}
+		})
+	}
+}
+
+type specHashAwareAgent struct {
+	testAgent
+	specHashFunc agent.SpecHashFunc
+}
+
+func (a *specHashAwareAgent) SetSpecHashFunc(specHashFunc agent.SpecHashFunc) {
+	a.specHashFunc = specHashFunc
+}
+
+func TestAddAgentSpecHashFunc(t *testing.T) {
+	gvr := schema.GroupVersionResource{Group: "test.io", Version: "v1", Resource: "testconfigs"}
+	config := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{"image": "quay.io/test:v1", "replicas": int64(2)},
+	}}
+	hashOptions := &utils.SpecHashOptions{IgnoredPaths: []string{"spec.replicas"}}
+	expectedHash, err := utils.GetSpecHashWithOptions(config, hashOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manager := NewBaseAddonManagerImpl(nil)
+	testAgent := &specHashAwareAgent{testAgent: testAgent{name: "test"}}
+	if err := manager.AddAgent(testAgent); err != nil {
+		t.Fatal(err)
+	}
+	if testAgent.specHashFunc == nil {
+		t.Fatalf("expected the spec hash func set on the agent")
+	}
+
+	// the options applied after the agent is added are used
+	manager.ApplyOptionFuncs(WithSpecHashOptions(gvr, hashOptions))
+	specHash, err := testAgent.specHashFunc(gvr.Group, gvr.Resource, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if specHash != expectedHash {
+		t.Errorf("expected spec hash %s, but got %s", expectedHash, specHash)
+	}
+}
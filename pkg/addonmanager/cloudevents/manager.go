@@ -187,15 +187,17 @@ func (a *cloudeventsAddonManager) Start(ctx context.Context) error {
 	addonInformers.Start(ctx.Done())
 	clusterInformers.Start(ctx.Done())
 	dynamicInformers.Start(ctx.Done())
+
 	return nil
 }
 
 // New returns a new addon manager with the given config and optional options
-func New(config *rest.Config, opts *CloudEventsOptions) (addonmanager.AddonManager, error) {
+func New(config *rest.Config, opts *CloudEventsOptions, optionFuncs ...addonmanager.OptionFunc) (addonmanager.AddonManager, error) {
 	cloudeventsAddonManager := &cloudeventsAddonManager{
 		BaseAddonManagerImpl: addonmanager.NewBaseAddonManagerImpl(config),
 		options:              opts,
 	}
+	cloudeventsAddonManager.ApplyOptionFuncs(optionFuncs...)
 
 	return cloudeventsAddonManager, nil
 }
@@ -2,6 +2,9 @@ package constants
 
 import (
 	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	addonv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
 	clusterv1 "open-cluster-management.io/api/cluster/v1"
@@ -68,3 +71,91 @@ func GetHostedManifestLocation(labels, annotations map[string]string) (string, b
 		return "", true, fmt.Errorf("not supported manifest location: %s", manifestLocation)
 	}
 }
+
+const (
+	// AddonAvailableReasonProbeDegraded is the reason of condition Available indicating some of the sub-probers
+	// of a composite health prober are unavailable, but the addon is still available.
+	AddonAvailableReasonProbeDegraded = "ProbeDegraded"
+
+	// AddonAvailableReasonEndpointUnreachable is the reason of condition Available indicating the health endpoint
+	// of the addon agent cannot be reached from the hub.
+	AddonAvailableReasonEndpointUnreachable = "HealthEndpointUnreachable"
+
+	// AddonAvailableReasonHealthCheckFailed is the reason of condition Available indicating a health check of the
+	// addon agent published on the addon lease on the hub fails.
+	AddonAvailableReasonHealthCheckFailed = "HealthCheckFailed"
+)
+
+const (
+	// AddonConditionConfigValid is the condition type of ManagedClusterAddOn and ClusterManagementAddOn indicating
+	// whether all the configs referenced by the addon exist and are supported by the addon manager.
+	AddonConditionConfigValid = "ConfigValid"
+
+	// ConfigValidReasonValid is the reason of condition ConfigValid indicating all the referenced configs are valid.
+	ConfigValidReasonValid = "ConfigsValid"
+
+	// ConfigValidReasonInvalid is the reason of condition ConfigValid indicating some of the referenced configs are
+	// missing or unsupported.
+	ConfigValidReasonInvalid = "ConfigsInvalid"
+)
+
+// NewConfigValidCondition returns the ConfigValid condition of an addon from the referenced configs which are
+// missing and the ones whose resource types are not supported by the addon manager.
+func NewConfigValidCondition(missing, unsupported []string) metav1.Condition {
+	if len(missing) == 0 && len(unsupported) == 0 {
+		return metav1.Condition{
+			Type:    AddonConditionConfigValid,
+			Status:  metav1.ConditionTrue,
+			Reason:  ConfigValidReasonValid,
+			Message: "All the referenced configs are valid",
+		}
+	}
+
+	var messages []string
+	if len(missing) > 0 {
+		messages = append(messages, fmt.Sprintf("configs not found: %s", strings.Join(missing, ", ")))
+	}
+	if len(unsupported) > 0 {
+		messages = append(messages, fmt.Sprintf("configs not supported: %s", strings.Join(unsupported, ", ")))
+	}
+	return metav1.Condition{
+		Type:    AddonConditionConfigValid,
+		Status:  metav1.ConditionFalse,
+		Reason:  ConfigValidReasonInvalid,
+		Message: strings.Join(messages, "; "),
+	}
+}
+
+const (
+	// AddonConditionEffectiveImages is the condition type of ManagedClusterAddOn recording the images of the agent
+	// workloads in the rendered manifests, after the images are overridden and pinned, for auditing.
+	AddonConditionEffectiveImages = "EffectiveImages"
+
+	// EffectiveImagesReasonRendered is the reason of condition EffectiveImages indicating the images are collected
+	// from the rendered manifests.
+	EffectiveImagesReasonRendered = "ImagesRendered"
+)
+
+const (
+	// DegradedReasonProbeDegraded is the reason of condition Degraded indicating the health checker reports the
+	// addon is degraded.
+	DegradedReasonProbeDegraded = "ProbeDegraded"
+
+	// DegradedReasonProbeNotDegraded is the reason of condition Degraded indicating the health checker reports the
+	// addon is not degraded.
+	DegradedReasonProbeNotDegraded = "ProbeNotDegraded"
+
+	// ProgressingReasonProbeProgressing is the reason of condition Progressing indicating the health checker
+	// reports the addon agent is rolling out.
+	ProgressingReasonProbeProgressing = "ProbeProgressing"
+)
+
+const (
+	// RegistrationAppliedReasonUnsupportedKubeClientDriver is the reason of condition RegistrationApplied indicating
+	// the kubeClientDriver reported by the addon agent is not supported.
+	RegistrationAppliedReasonUnsupportedKubeClientDriver = "UnsupportedKubeClientDriver"
+)
+
+// HubPermissionCleanupFinalizer is the finalizer of ManagedClusterAddOn added by the addon manager when the
+// registration option has a PermissionCleanup, it is removed once the permission of the addon is cleaned up.
+const HubPermissionCleanupFinalizer = "addon.open-cluster-management.io/hub-permission-cleanup"
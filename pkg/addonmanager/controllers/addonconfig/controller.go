@@ -3,8 +3,11 @@ package addonconfig
 import (
 	"context"
 	"fmt"
+	"sync"
+	"time"
 
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -13,12 +16,14 @@ import (
 	"k8s.io/client-go/dynamic/dynamiclister"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/util/workqueue"
+	"open-cluster-management.io/addon-framework/pkg/addonmanager/constants"
 	"open-cluster-management.io/addon-framework/pkg/index"
 	"open-cluster-management.io/addon-framework/pkg/utils"
 	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
 	addonv1alpha1client "open-cluster-management.io/api/client/addon/clientset/versioned"
 	addoninformerv1alpha1 "open-cluster-management.io/api/client/addon/informers/externalversions/addon/v1alpha1"
 	addonlisterv1alpha1 "open-cluster-management.io/api/client/addon/listers/addon/v1alpha1"
+	"open-cluster-management.io/sdk-go/pkg/basecontroller/events"
 	"open-cluster-management.io/sdk-go/pkg/basecontroller/factory"
 	"open-cluster-management.io/sdk-go/pkg/patcher"
 )
@@ -29,6 +34,29 @@ const (
 
 type enqueueFunc func(obj interface{})
 
+// ConfigChangeOptions configures how the changes of addon configs are propagated to the ManagedClusterAddOns
+// referencing them.
+type ConfigChangeOptions struct {
+	// CoalesceWindow is the duration the changes of a config are coalesced before the referencing addons are
+	// enqueued, so a config updated several times in a short period triggers only one reconcile of each
+	// addon. The window starts at the first change and is not extended by the later ones, so a config
+	// updated continuously still triggers the reconciles once per window. Zero disables the coalescing and
+	// the addons are enqueued on each change.
+	CoalesceWindow time.Duration
+
+	// FanOutQPS limits the rate at which the addons referencing one config are enqueued, so a change of a
+	// config shared by many addons does not flood the queue at once. Zero means no limit.
+	FanOutQPS float64
+}
+
+// pendingConfigChange is a config change waiting for the coalesce window to elapse.
+type pendingConfigChange struct {
+	gvr           schema.GroupVersionResource
+	namespaceName string
+	generation    int64
+	timer         *time.Timer
+}
+
 // addonConfigController reconciles all interested addon config types (GroupVersionResource) on the hub.
 type addonConfigController struct {
 	addonClient                  addonv1alpha1client.Interface
@@ -37,8 +65,28 @@ type addonConfigController struct {
 	configListers                map[schema.GroupResource]dynamiclister.Lister
 	queue                        workqueue.TypedRateLimitingInterface[string]
 	cmaFilterFunc                factory.EventFilterFunc
+	mcaFilterFunc                utils.ManagedClusterAddOnFilterFunc
 	configGVRs                   map[schema.GroupVersionResource]bool
 	clusterManagementAddonLister addonlisterv1alpha1.ClusterManagementAddOnLister
+	recorder                     events.Recorder
+	configChangeOptions          ConfigChangeOptions
+	specHashOptions              utils.ConfigSpecHashOptions
+
+	pendingLock    sync.Mutex
+	pendingChanges map[string]*pendingConfigChange
+	// stopped is set once the controller is stopped, the changes are no longer coalesced after it.
+	stopped bool
+}
+
+// controllerWithPendingChanges stops the timers of the pending config changes after the controller is stopped.
+type controllerWithPendingChanges struct {
+	factory.Controller
+	stopPendingChanges func()
+}
+
+func (c *controllerWithPendingChanges) Run(ctx context.Context, workers int) {
+	c.Controller.Run(ctx, workers)
+	c.stopPendingChanges()
 }
 
 func NewAddonConfigController(
@@ -48,6 +96,9 @@ func NewAddonConfigController(
 	configInformerFactory dynamicinformer.DynamicSharedInformerFactory,
 	configGVRs map[schema.GroupVersionResource]bool,
 	cmaFilterFunc factory.EventFilterFunc,
+	mcaFilterFunc utils.ManagedClusterAddOnFilterFunc,
+	configChangeOptions ConfigChangeOptions,
+	specHashOptions utils.ConfigSpecHashOptions,
 ) factory.Controller {
 	syncCtx := factory.NewSyncContext(controllerName)
 
@@ -58,13 +109,18 @@ func NewAddonConfigController(
 		configListers:                map[schema.GroupResource]dynamiclister.Lister{},
 		queue:                        syncCtx.Queue(),
 		cmaFilterFunc:                cmaFilterFunc,
+		mcaFilterFunc:                mcaFilterFunc,
 		configGVRs:                   configGVRs,
 		clusterManagementAddonLister: clusterManagementAddonInformers.Lister(),
+		recorder:                     syncCtx.Recorder(),
+		configChangeOptions:          configChangeOptions,
+		specHashOptions:              specHashOptions,
+		pendingChanges:               map[string]*pendingConfigChange{},
 	}
 
 	configInformers := c.buildConfigInformers(configInformerFactory, configGVRs)
 
-	return factory.New().
+	ctrl := factory.New().
 		WithSyncContext(syncCtx).
 		WithInformersQueueKeysFunc(func(obj runtime.Object) []string {
 			key, _ := cache.MetaNamespaceKeyFunc(obj)
@@ -74,6 +130,7 @@ func NewAddonConfigController(
 		// clusterManagementAddonLister is used, so wait for cache sync
 		WithBareInformers(clusterManagementAddonInformers.Informer()).
 		WithSync(c.sync).ToController(controllerName)
+	return &controllerWithPendingChanges{Controller: ctrl, stopPendingChanges: c.stopPendingChanges}
 }
 
 func (c *addonConfigController) buildConfigInformers(
@@ -111,20 +168,88 @@ func (c *addonConfigController) enqueueAddOnsByConfig(gvr schema.GroupVersionRes
 			return
 		}
 
-		objs, err := c.addonIndexer.ByIndex(index.AddonByConfig,
-			fmt.Sprintf("%s/%s/%s", gvr.Group, gvr.Resource, namespaceName))
-		if err != nil {
-			utilruntime.HandleError(fmt.Errorf("error to get addons: %v", err))
+		change := &pendingConfigChange{gvr: gvr, namespaceName: namespaceName}
+		if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
+		if accessor, err := meta.Accessor(obj); err == nil {
+			change.generation = accessor.GetGeneration()
+		}
+
+		if c.configChangeOptions.CoalesceWindow <= 0 {
+			c.fanOut(change)
 			return
 		}
 
-		for _, obj := range objs {
-			if obj == nil {
-				continue
+		// coalesce the changes of the same config in the window, only the latest generation is recorded and
+		// the addons are enqueued once the window elapses.
+		key := fmt.Sprintf("%s/%s/%s", gvr.Group, gvr.Resource, namespaceName)
+		c.pendingLock.Lock()
+		defer c.pendingLock.Unlock()
+		if c.stopped {
+			return
+		}
+		if pending, ok := c.pendingChanges[key]; ok {
+			pending.generation = change.generation
+			return
+		}
+		c.pendingChanges[key] = change
+		change.timer = time.AfterFunc(c.configChangeOptions.CoalesceWindow, func() {
+			c.pendingLock.Lock()
+			pending, ok := c.pendingChanges[key]
+			delete(c.pendingChanges, key)
+			c.pendingLock.Unlock()
+
+			// the change is dropped if the controller is stopped before the timer fires
+			if ok {
+				c.fanOut(pending)
 			}
-			key, _ := cache.MetaNamespaceKeyFunc(obj)
+		})
+	}
+}
+
+// stopPendingChanges stops the timers of the pending config changes and drops them.
+func (c *addonConfigController) stopPendingChanges() {
+	c.pendingLock.Lock()
+	defer c.pendingLock.Unlock()
+	c.stopped = true
+	for key, pending := range c.pendingChanges {
+		pending.timer.Stop()
+		delete(c.pendingChanges, key)
+	}
+}
+
+// fanOut enqueues the addons referencing the changed config, the addons are spread over time when the
+// fan-out rate is limited.
+func (c *addonConfigController) fanOut(change *pendingConfigChange) {
+	objs, err := c.addonIndexer.ByIndex(index.AddonByConfig,
+		fmt.Sprintf("%s/%s/%s", change.gvr.Group, change.gvr.Resource, change.namespaceName))
+	if err != nil {
+		utilruntime.HandleError(fmt.Errorf("error to get addons: %v", err))
+		return
+	}
+
+	count := 0
+	for _, obj := range objs {
+		if obj == nil {
+			continue
+		}
+		if addon, ok := obj.(*addonapiv1alpha1.ManagedClusterAddOn); ok && c.mcaFilterFunc != nil && !c.mcaFilterFunc(addon) {
+			continue
+		}
+		key, _ := cache.MetaNamespaceKeyFunc(obj)
+		if c.configChangeOptions.FanOutQPS > 0 {
+			c.queue.AddAfter(key, time.Duration(float64(count)/c.configChangeOptions.FanOutQPS*float64(time.Second)))
+		} else {
 			c.queue.Add(key)
 		}
+		count++
+	}
+
+	if count > 0 && c.recorder != nil {
+		c.recorder.Eventf(context.TODO(), "AddOnConfigChanged",
+			"Config %s %s with generation %d triggered the reconcile of %d addons",
+			change.gvr.GroupResource(), change.namespaceName, change.generation, count)
 	}
 }
 
@@ -144,6 +269,10 @@ func (c *addonConfigController) sync(ctx context.Context, syncCtx factory.SyncCo
 		return err
 	}
 
+	if c.mcaFilterFunc != nil && !c.mcaFilterFunc(addon) {
+		return nil
+	}
+
 	cma, err := c.clusterManagementAddonLister.Get(addonName)
 	if errors.IsNotFound(err) {
 		// cluster management addon could be deleted, ignore
@@ -158,10 +287,17 @@ func (c *addonConfigController) sync(ctx context.Context, syncCtx factory.SyncCo
 	}
 
 	addonCopy := addon.DeepCopy()
-	if err := c.updateConfigSpecHashAndGenerations(addonCopy); err != nil {
+	missing, unsupported, err := c.updateConfigSpecHashAndGenerations(addonCopy)
+	if err != nil {
 		return err
 	}
 
+	// only report the config validation for addons referencing configs, or the ones whose references are removed.
+	if len(addonCopy.Status.ConfigReferences) > 0 ||
+		meta.FindStatusCondition(addonCopy.Status.Conditions, constants.AddonConditionConfigValid) != nil {
+		meta.SetStatusCondition(&addonCopy.Status.Conditions, constants.NewConfigValidCondition(missing, unsupported))
+	}
+
 	addonPatcher := patcher.NewPatcher[
 		*addonapiv1alpha1.ManagedClusterAddOn,
 		addonapiv1alpha1.ManagedClusterAddOnSpec,
@@ -171,24 +307,33 @@ func (c *addonConfigController) sync(ctx context.Context, syncCtx factory.SyncCo
 	return err
 }
 
-func (c *addonConfigController) updateConfigSpecHashAndGenerations(addon *addonapiv1alpha1.ManagedClusterAddOn) error {
+// updateConfigSpecHashAndGenerations updates the generations and spec hashes of the configs in the addon status,
+// and returns the referenced configs which are missing or unsupported.
+func (c *addonConfigController) updateConfigSpecHashAndGenerations(
+	addon *addonapiv1alpha1.ManagedClusterAddOn) (missing, unsupported []string, err error) {
 	for index, configReference := range addon.Status.ConfigReferences {
+		if configReference.Name == "" {
+			// bad config reference, ignore
+			continue
+		}
+		configName := utils.ConfigReferentString(configReference.ConfigGroupResource, configReference.ConfigReferent)
 
 		// do not update for unsupported configs
 		if !utils.ContainGR(
 			c.configGVRs,
 			configReference.ConfigGroupResource.Group,
 			configReference.ConfigGroupResource.Resource) {
+			unsupported = append(unsupported, configName)
 			continue
 		}
 
 		lister, ok := c.configListers[schema.GroupResource{Group: configReference.ConfigGroupResource.Group, Resource: configReference.ConfigGroupResource.Resource}]
 		if !ok {
+			unsupported = append(unsupported, configName)
 			continue
 		}
 
 		var config *unstructured.Unstructured
-		var err error
 		if configReference.Namespace == "" {
 			config, err = lister.Get(configReference.Name)
 		} else {
@@ -196,11 +341,12 @@ func (c *addonConfigController) updateConfigSpecHashAndGenerations(addon *addona
 		}
 
 		if errors.IsNotFound(err) {
+			missing = append(missing, configName)
 			continue
 		}
 
 		if err != nil {
-			return err
+			return nil, nil, err
 		}
 
 		// update LastObservedGeneration for all the configs in status
@@ -214,14 +360,15 @@ func (c *addonConfigController) updateConfigSpecHashAndGenerations(addon *addona
 
 			if configReference.ConfigGroupResource == addonconfig.ConfigGroupResource &&
 				configReference.DesiredConfig.ConfigReferent == addonconfig.ConfigReferent {
-				specHash, err := utils.GetSpecHash(config)
+				specHash, err := c.specHashOptions.GetSpecHash(
+					configReference.ConfigGroupResource.Group, configReference.ConfigGroupResource.Resource, config)
 				if err != nil {
-					return err
+					return nil, nil, err
 				}
 				addon.Status.ConfigReferences[index].DesiredConfig.SpecHash = specHash
 			}
 		}
 	}
 
-	return nil
+	return missing, unsupported, nil
 }
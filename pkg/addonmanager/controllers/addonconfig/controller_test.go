@@ -6,6 +6,7 @@ import (
 	"testing"
 	"time"
 
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -16,7 +17,9 @@ import (
 	clienttesting "k8s.io/client-go/testing"
 	"k8s.io/client-go/tools/cache"
 	"open-cluster-management.io/addon-framework/pkg/addonmanager/addontesting"
+	"open-cluster-management.io/addon-framework/pkg/addonmanager/constants"
 	"open-cluster-management.io/addon-framework/pkg/index"
+	"open-cluster-management.io/addon-framework/pkg/utils"
 	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
 	fakeaddon "open-cluster-management.io/api/client/addon/clientset/versioned/fake"
 	addoninformers "open-cluster-management.io/api/client/addon/informers/externalversions"
@@ -34,6 +37,7 @@ func TestSync(t *testing.T) {
 		syncKey             string
 		managedClusteraddon []runtime.Object
 		configs             []runtime.Object
+		mcaFilterFunc       utils.ManagedClusterAddOnFilterFunc
 		validateActions     func(*testing.T, []clienttesting.Action)
 	}{
 		{
@@ -54,6 +58,35 @@ func TestSync(t *testing.T) {
 				addontesting.AssertNoActions(t, actions)
 			},
 		},
+		{
+			name:    "addon not owned",
+			syncKey: "cluster1/test",
+			managedClusteraddon: []runtime.Object{
+				func() *addonapiv1alpha1.ManagedClusterAddOn {
+					addon := addontesting.NewAddon("test", "cluster1")
+					addon.Status.ConfigReferences = []addonapiv1alpha1.ConfigReference{
+						{
+							ConfigGroupResource: addonapiv1alpha1.ConfigGroupResource{
+								Group:    fakeGVR.Group,
+								Resource: fakeGVR.Resource,
+							},
+							ConfigReferent: addonapiv1alpha1.ConfigReferent{
+								Namespace: "cluster1",
+								Name:      "test",
+							},
+						},
+					}
+					return addon
+				}(),
+			},
+			configs: []runtime.Object{newTestConfing("test", "cluster1", 2)},
+			mcaFilterFunc: func(mca *addonapiv1alpha1.ManagedClusterAddOn) bool {
+				return mca.Namespace != "cluster1"
+			},
+			validateActions: func(t *testing.T, actions []clienttesting.Action) {
+				addontesting.AssertNoActions(t, actions)
+			},
+		},
 		{
 			name:    "supported Configs",
 			syncKey: "cluster1/test",
@@ -110,6 +143,8 @@ func TestSync(t *testing.T) {
 				if addOn.Status.ConfigReferences[0].DesiredConfig.SpecHash != "5f0f8e6cc1574ce8832b6bcefac131d90ae93653fc7204c085bd6e91b6df0892" {
 					t.Errorf("Expect addon config spec hash is 5f0f8e6cc1574ce8832b6bcefac131d90ae93653fc7204c085bd6e91b6df0892, but got %v", addOn.Status.ConfigReferences[0].DesiredConfig.SpecHash)
 				}
+
+				assertConfigValidCondition(t, actions, metav1.ConditionTrue, "All the referenced configs are valid")
 			},
 		},
 		{
@@ -154,7 +189,8 @@ func TestSync(t *testing.T) {
 			},
 			configs: []runtime.Object{newTestConfing("test", "cluster1", 2)},
 			validateActions: func(t *testing.T, actions []clienttesting.Action) {
-				addontesting.AssertNoActions(t, actions)
+				assertConfigValidCondition(t, actions, metav1.ConditionFalse,
+					"configs not supported: configs-unsupported.configs.test/cluster1/test")
 			},
 		},
 		{
@@ -270,8 +306,11 @@ func TestSync(t *testing.T) {
 					return addon
 				}(),
 			},
-			configs:         []runtime.Object{},
-			validateActions: addontesting.AssertNoActions,
+			configs: []runtime.Object{},
+			validateActions: func(t *testing.T, actions []clienttesting.Action) {
+				assertConfigValidCondition(t, actions, metav1.ConditionFalse,
+					"configs not found: configs.configs.test/cluster1/test")
+			},
 		},
 
 		{
@@ -372,6 +411,7 @@ func TestSync(t *testing.T) {
 				clusterManagementAddonLister: addonInformers.Addon().V1alpha1().ClusterManagementAddOns().Lister(),
 				configListers:                map[schema.GroupResource]dynamiclister.Lister{},
 				cmaFilterFunc:                func(obj interface{}) bool { return true },
+				mcaFilterFunc:                c.mcaFilterFunc,
 				configGVRs:                   map[schema.GroupVersionResource]bool{fakeGVR: true},
 			}
 
@@ -387,11 +427,30 @@ func TestSync(t *testing.T) {
 	}
 }
 
+func assertConfigValidCondition(t *testing.T, actions []clienttesting.Action,
+	expectedStatus metav1.ConditionStatus, expectedMessage string) {
+	addontesting.AssertActions(t, actions, "patch")
+	patch := actions[0].(clienttesting.PatchActionImpl).Patch
+	addOn := &addonapiv1alpha1.ManagedClusterAddOn{}
+	if err := json.Unmarshal(patch, addOn); err != nil {
+		t.Fatal(err)
+	}
+	cond := meta.FindStatusCondition(addOn.Status.Conditions, constants.AddonConditionConfigValid)
+	if cond == nil {
+		t.Fatalf("expected condition %s, but got none", constants.AddonConditionConfigValid)
+	}
+	if cond.Status != expectedStatus || cond.Message != expectedMessage {
+		t.Errorf("expected condition %s with message %q, but got %s with message %q",
+			expectedStatus, expectedMessage, cond.Status, cond.Message)
+	}
+}
+
 func TestEnqueue(t *testing.T) {
 	cases := []struct {
 		name              string
 		addons            []runtime.Object
 		config            runtime.Object
+		mcaFilterFunc     utils.ManagedClusterAddOnFilterFunc
 		expectedQueueSize int
 	}{
 		{
@@ -532,6 +591,32 @@ func TestEnqueue(t *testing.T) {
 			config:            newTestConfing("test", "cluster1", 1),
 			expectedQueueSize: 1,
 		},
+		{
+			name: "addons not owned",
+			addons: []runtime.Object{
+				func() *addonapiv1alpha1.ManagedClusterAddOn {
+					addon := addontesting.NewAddon("test", "cluster1")
+					addon.Status.ConfigReferences = []addonapiv1alpha1.ConfigReference{
+						{
+							ConfigGroupResource: addonapiv1alpha1.ConfigGroupResource{
+								Group:    fakeGVR.Group,
+								Resource: fakeGVR.Resource,
+							},
+							ConfigReferent: addonapiv1alpha1.ConfigReferent{
+								Namespace: "cluster1",
+								Name:      "test",
+							},
+						},
+					}
+					return addon
+				}(),
+			},
+			config: newTestConfing("test", "cluster1", 1),
+			mcaFilterFunc: func(mca *addonapiv1alpha1.ManagedClusterAddOn) bool {
+				return mca.Namespace != "cluster1"
+			},
+			expectedQueueSize: 0,
+		},
 	}
 
 	for _, c := range cases {
@@ -541,8 +626,9 @@ func TestEnqueue(t *testing.T) {
 			addonInformer := addonInformers.Addon().V1alpha1().ManagedClusterAddOns().Informer()
 
 			ctrl := &addonConfigController{
-				addonIndexer: addonInformer.GetIndexer(),
-				queue:        addontesting.NewFakeSyncContext(t).Queue(),
+				addonIndexer:  addonInformer.GetIndexer(),
+				queue:         addontesting.NewFakeSyncContext(t).Queue(),
+				mcaFilterFunc: c.mcaFilterFunc,
 			}
 
 			if err := addonInformer.AddIndexers(cache.Indexers{index.AddonByConfig: index.IndexAddonByConfig}); err != nil {
@@ -595,3 +681,139 @@ func newTestConfing(name, namespace string, generation int64) *unstructured.Unst
 		},
 	}
 }
+
+func newAddonWithConfig(namespace string) *addonapiv1alpha1.ManagedClusterAddOn {
+	addon := addontesting.NewAddon("test", namespace)
+	addon.Status.ConfigReferences = []addonapiv1alpha1.ConfigReference{
+		{
+			ConfigGroupResource: addonapiv1alpha1.ConfigGroupResource{
+				Group:    fakeGVR.Group,
+				Resource: fakeGVR.Resource,
+			},
+			ConfigReferent: addonapiv1alpha1.ConfigReferent{
+				Name: "test",
+			},
+		},
+	}
+	return addon
+}
+
+func TestEnqueueWithConfigChangeOptions(t *testing.T) {
+	cases := []struct {
+		name                 string
+		options              ConfigChangeOptions
+		changes              int
+		expectedInitialQueue int
+		expectedFinalQueue   int
+	}{
+		{
+			name:                 "no coalescing",
+			changes:              3,
+			expectedInitialQueue: 9,
+			expectedFinalQueue:   9,
+		},
+		{
+			name:                 "changes coalesced in the window",
+			options:              ConfigChangeOptions{CoalesceWindow: 100 * time.Millisecond},
+			changes:              3,
+			expectedInitialQueue: 0,
+			expectedFinalQueue:   3,
+		},
+		{
+			name:                 "fan-out rate limited",
+			options:              ConfigChangeOptions{FanOutQPS: 5},
+			changes:              1,
+			expectedInitialQueue: 1,
+			expectedFinalQueue:   3,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			addons := []runtime.Object{
+				newAddonWithConfig("cluster1"),
+				newAddonWithConfig("cluster2"),
+				newAddonWithConfig("cluster3"),
+			}
+			fakeAddonClient := fakeaddon.NewSimpleClientset(addons...)
+			addonInformers := addoninformers.NewSharedInformerFactory(fakeAddonClient, 10*time.Minute)
+			addonInformer := addonInformers.Addon().V1alpha1().ManagedClusterAddOns().Informer()
+			if err := addonInformer.AddIndexers(cache.Indexers{index.AddonByConfig: index.IndexAddonByConfig}); err != nil {
+				t.Fatal(err)
+			}
+			for _, addon := range addons {
+				if err := addonInformer.GetStore().Add(addon); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			syncCtx := addontesting.NewFakeSyncContext(t)
+			ctrl := &addonConfigController{
+				addonIndexer:        addonInformer.GetIndexer(),
+				queue:               syncCtx.Queue(),
+				recorder:            syncCtx.Recorder(),
+				configChangeOptions: c.options,
+				pendingChanges:      map[string]*pendingConfigChange{},
+			}
+
+			// process the queued keys so that each enqueue of the same key is counted
+			processed := 0
+			drain := func() {
+				for ctrl.queue.Len() > 0 {
+					key, _ := ctrl.queue.Get()
+					ctrl.queue.Done(key)
+					processed++
+				}
+			}
+
+			for i := 1; i <= c.changes; i++ {
+				ctrl.enqueueAddOnsByConfig(fakeGVR)(newTestConfing("test", "", int64(i)))
+				drain()
+			}
+			if processed != c.expectedInitialQueue {
+				t.Errorf("expect %d addons enqueued initially, but got %d", c.expectedInitialQueue, processed)
+			}
+
+			time.Sleep(600 * time.Millisecond)
+			drain()
+			if processed != c.expectedFinalQueue {
+				t.Errorf("expect %d addons enqueued finally, but got %d", c.expectedFinalQueue, processed)
+			}
+		})
+	}
+}
+
+func TestStopPendingChanges(t *testing.T) {
+	addon := newAddonWithConfig("cluster1")
+	fakeAddonClient := fakeaddon.NewSimpleClientset(addon)
+	addonInformers := addoninformers.NewSharedInformerFactory(fakeAddonClient, 10*time.Minute)
+	addonInformer := addonInformers.Addon().V1alpha1().ManagedClusterAddOns().Informer()
+	if err := addonInformer.AddIndexers(cache.Indexers{index.AddonByConfig: index.IndexAddonByConfig}); err != nil {
+		t.Fatal(err)
+	}
+	if err := addonInformer.GetStore().Add(addon); err != nil {
+		t.Fatal(err)
+	}
+
+	syncCtx := addontesting.NewFakeSyncContext(t)
+	ctrl := &addonConfigController{
+		addonIndexer:        addonInformer.GetIndexer(),
+		queue:               syncCtx.Queue(),
+		recorder:            syncCtx.Recorder(),
+		configChangeOptions: ConfigChangeOptions{CoalesceWindow: 100 * time.Millisecond},
+		pendingChanges:      map[string]*pendingConfigChange{},
+	}
+
+	ctrl.enqueueAddOnsByConfig(fakeGVR)(newTestConfing("test", "", 1))
+	ctrl.stopPendingChanges()
+	// the changes after the controller is stopped are dropped
+	ctrl.enqueueAddOnsByConfig(fakeGVR)(newTestConfing("test", "", 2))
+
+	time.Sleep(300 * time.Millisecond)
+	if ctrl.queue.Len() != 0 {
+		t.Errorf("expect no addon enqueued after the controller is stopped, but got %d", ctrl.queue.Len())
+	}
+	if len(ctrl.pendingChanges) != 0 {
+		t.Errorf("expect no pending changes, but got %d", len(ctrl.pendingChanges))
+	}
+}
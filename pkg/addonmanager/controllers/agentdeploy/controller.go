@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"strings"
 
+	coordinationv1 "k8s.io/api/coordination/v1"
 	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
@@ -12,6 +13,8 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	errorsutil "k8s.io/apimachinery/pkg/util/errors"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	coordinationinformers "k8s.io/client-go/informers/coordination/v1"
+	coordinationlisters "k8s.io/client-go/listers/coordination/v1"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog/v2"
@@ -32,6 +35,7 @@ import (
 	"open-cluster-management.io/addon-framework/pkg/addonmanager/constants"
 	"open-cluster-management.io/addon-framework/pkg/agent"
 	"open-cluster-management.io/addon-framework/pkg/index"
+	"open-cluster-management.io/addon-framework/pkg/lease"
 	"open-cluster-management.io/addon-framework/pkg/utils"
 	"open-cluster-management.io/sdk-go/pkg/basecontroller/factory"
 )
@@ -49,17 +53,22 @@ type addonDeployController struct {
 	managedClusterAddonLister  addonlisterv1alpha1.ManagedClusterAddOnLister
 	managedClusterAddonIndexer cache.Indexer
 	workIndexer                cache.Indexer
+	leaseLister                coordinationlisters.LeaseLister
+	endpointProbeCache         *endpointProbeCache
 	agentAddons                map[string]agent.AgentAddon
 	queue                      workqueue.TypedRateLimitingInterface[string]
 	mcaFilterFunc              utils.ManagedClusterAddOnFilterFunc
 }
 
+// NewAddonDeployController creates a new addon deploy controller. If leaseInformer is set, the addon leases on
+// the hub are probed for the addons with the Lease health prober.
 func NewAddonDeployController(
 	workClient workv1client.Interface,
 	addonClient addonv1alpha1client.Interface,
 	clusterInformers clusterinformers.ManagedClusterInformer,
 	addonInformers addoninformerv1alpha1.ManagedClusterAddOnInformer,
 	workInformers workinformers.ManifestWorkInformer,
+	leaseInformer coordinationinformers.LeaseInformer,
 	agentAddons map[string]agent.AgentAddon,
 	mcaFilterFunc utils.ManagedClusterAddOnFilterFunc,
 ) factory.Controller {
@@ -78,10 +87,18 @@ func NewAddonDeployController(
 		workIndexer:                workInformers.Informer().GetIndexer(),
 		agentAddons:                agentAddons,
 		mcaFilterFunc:              mcaFilterFunc,
+		endpointProbeCache:         newEndpointProbeCache(),
 	}
 
 	c.setClusterInformerHandler(clusterInformers)
 
+	bareInformers := []factory.Informer{clusterInformers.Informer()}
+	if leaseInformer != nil {
+		c.leaseLister = leaseInformer.Lister()
+		c.setLeaseInformerHandler(leaseInformer)
+		bareInformers = append(bareInformers, leaseInformer.Informer())
+	}
+
 	f := factory.New().WithSyncContext(syncCtx).
 		WithFilteredEventsInformersQueueKeysFunc(
 			func(obj runtime.Object) []string {
@@ -132,7 +149,7 @@ func NewAddonDeployController(
 			},
 			workInformers.Informer(),
 		).
-		WithBareInformers(clusterInformers.Informer()).
+		WithBareInformers(bareInformers...).
 		WithSync(c.sync)
 
 	return f.ToController(controllerName)
@@ -175,6 +192,51 @@ func (c addonDeployController) setClusterInformerHandler(clusterInformers cluste
 	}
 }
 
+// setLeaseInformerHandler enqueues the addon when the health check annotations of its lease change. The renewal
+// of the lease is not watched, the addon is requeued when the lease is about to expire instead.
+func (c addonDeployController) setLeaseInformerHandler(leaseInformer coordinationinformers.LeaseInformer) {
+	enqueue := func(obj interface{}) {
+		accessor, err := meta.Accessor(obj)
+		if err != nil {
+			return
+		}
+		addonName := accessor.GetLabels()[addonapiv1alpha1.AddonLabelKey]
+		if _, ok := c.agentAddons[addonName]; !ok || accessor.GetName() != addonName {
+			return
+		}
+		c.queue.Add(fmt.Sprintf("%s/%s", accessor.GetNamespace(), addonName))
+	}
+
+	_, err := leaseInformer.Informer().AddEventHandler(
+		cache.ResourceEventHandlerFuncs{
+			AddFunc: enqueue,
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				oldLease, ook := oldObj.(*coordinationv1.Lease)
+				newLease, nok := newObj.(*coordinationv1.Lease)
+				if !ook || !nok {
+					return
+				}
+				if oldLease.Annotations[lease.HealthCheckAnnotationKey] == newLease.Annotations[lease.HealthCheckAnnotationKey] &&
+					oldLease.Annotations[lease.HealthCheckReasonAnnotationKey] == newLease.Annotations[lease.HealthCheckReasonAnnotationKey] &&
+					oldLease.Annotations[lease.HealthCheckMessageAnnotationKey] == newLease.Annotations[lease.HealthCheckMessageAnnotationKey] &&
+					(oldLease.Spec.RenewTime == nil) == (newLease.Spec.RenewTime == nil) {
+					return
+				}
+				enqueue(newObj)
+			},
+			DeleteFunc: func(obj interface{}) {
+				if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+					obj = tombstone.Obj
+				}
+				enqueue(obj)
+			},
+		},
+	)
+	if err != nil {
+		utilruntime.HandleError(err)
+	}
+}
+
 func (c *addonDeployController) enqueueAddOnsByCluster() func(obj interface{}) {
 	return func(obj interface{}) {
 		accessor, _ := meta.Accessor(obj)
@@ -233,6 +295,7 @@ func (c *addonDeployController) sync(ctx context.Context, syncCtx factory.SyncCo
 	addon, err := c.managedClusterAddonLister.ManagedClusterAddOns(clusterName).Get(addonName)
 	if errors.IsNotFound(err) {
 		// need to find a way to clean up cache by addon
+		c.endpointProbeCache.deleteAddon(clusterName, addonName)
 		return nil
 	}
 	if err != nil {
@@ -299,6 +362,8 @@ func (c *addonDeployController) sync(ctx context.Context, syncCtx factory.SyncCo
 		&healthCheckSyncer{
 			getWorkByAddon:       c.getWorksByAddonFn(index.ManifestWorkByAddon),
 			getWorkByHostedAddon: c.getWorksByAddonFn(index.ManifestWorkByHostedAddon),
+			leaseLister:          c.leaseLister,
+			endpointCache:        c.endpointProbeCache,
 			agentAddon:           agentAddon,
 		},
 	}
@@ -404,9 +469,7 @@ func (c *addonDeployController) buildDeployManifestWorksFunc(addonWorkBuilder *a
 			return nil, nil, fmt.Errorf("failed to get agentAddon")
 		}
 
-		if agentAddon.GetAgentAddonOptions().ConfigCheckEnabled &&
-			!meta.IsStatusConditionTrue(addon.Status.Conditions, addonapiv1alpha1.ManagedClusterAddOnConditionConfigured) {
-			klog.InfoS("Addon configured condition is not set in status", "addonName", addon.Name)
+		if agentAddon.GetAgentAddonOptions().ConfigCheckEnabled && !configReady(addon) {
 			return nil, nil, nil
 		}
 
@@ -421,6 +484,12 @@ func (c *addonDeployController) buildDeployManifestWorksFunc(addonWorkBuilder *a
 			return nil, nil, err
 		}
 
+		if agentAddon.GetAgentAddonOptions().EffectiveImagesEnabled {
+			if err := setEffectiveImagesCondition(addon, objects); err != nil {
+				return nil, nil, err
+			}
+		}
+
 		// this is to retrieve the intended mode of the addon.
 		var mode string
 		if agentAddon.GetAgentAddonOptions().HostedModeInfoFunc == nil {
@@ -461,6 +530,41 @@ func (c *addonDeployController) buildDeployManifestWorksFunc(addonWorkBuilder *a
 	}
 }
 
+// setEffectiveImagesCondition records the images of the agent workloads in the addon status, so the images
+// deployed on the managed cluster can be audited on the hub.
+func setEffectiveImagesCondition(addon *addonapiv1alpha1.ManagedClusterAddOn, objects []runtime.Object) error {
+	images, err := getEffectiveImages(objects)
+	if err != nil {
+		return fmt.Errorf("failed to get the images of the manifests: %v", err)
+	}
+	if len(images) == 0 {
+		meta.RemoveStatusCondition(&addon.Status.Conditions, constants.AddonConditionEffectiveImages)
+		return nil
+	}
+
+	meta.SetStatusCondition(&addon.Status.Conditions, metav1.Condition{
+		Type:    constants.AddonConditionEffectiveImages,
+		Status:  metav1.ConditionTrue,
+		Reason:  constants.EffectiveImagesReasonRendered,
+		Message: strings.Join(images, ","),
+	})
+	return nil
+}
+
+// configReady returns true if the addon is configured and none of its referenced configs is missing or
+// unsupported, the manifests should not be rendered with the default values in place of the missing configs.
+func configReady(addon *addonapiv1alpha1.ManagedClusterAddOn) bool {
+	if !meta.IsStatusConditionTrue(addon.Status.Conditions, addonapiv1alpha1.ManagedClusterAddOnConditionConfigured) {
+		klog.InfoS("Addon configured condition is not set in status", "addonName", addon.Name)
+		return false
+	}
+	if meta.IsStatusConditionFalse(addon.Status.Conditions, constants.AddonConditionConfigValid) {
+		klog.InfoS("Addon references invalid configs", "addonName", addon.Name)
+		return false
+	}
+	return true
+}
+
 type buildDeployHookFunc func(
 	workNamespace string,
 	cluster *clusterv1.ManagedCluster,
@@ -476,9 +580,7 @@ func (c *addonDeployController) buildHookManifestWorkFunc(addonWorkBuilder *addo
 			return nil, fmt.Errorf("failed to get agentAddon")
 		}
 
-		if agentAddon.GetAgentAddonOptions().ConfigCheckEnabled &&
-			!meta.IsStatusConditionTrue(addon.Status.Conditions, addonapiv1alpha1.ManagedClusterAddOnConditionConfigured) {
-			klog.InfoS("Addon configured condition is not set in status", "addonName", addon.Name)
+		if agentAddon.GetAgentAddonOptions().ConfigCheckEnabled && !configReady(addon) {
 			return nil, nil
 		}
 
@@ -9,6 +9,7 @@ import (
 
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	clienttesting "k8s.io/client-go/testing"
 	"k8s.io/client-go/tools/cache"
@@ -25,6 +26,7 @@ import (
 	workbuilder "open-cluster-management.io/sdk-go/pkg/apis/work/v1/builder"
 
 	"open-cluster-management.io/addon-framework/pkg/addonmanager/addontesting"
+	"open-cluster-management.io/addon-framework/pkg/addonmanager/constants"
 	"open-cluster-management.io/addon-framework/pkg/agent"
 	"open-cluster-management.io/addon-framework/pkg/index"
 )
@@ -58,6 +60,8 @@ type testAgent struct {
 	Updaters           []agent.Updater
 	ManifestConfigs    []workapiv1.ManifestConfigOption
 	ConfigCheckEnabled bool
+
+	EffectiveImagesEnabled bool
 }
 
 func (t *testAgent) Manifests(cluster *clusterv1.ManagedCluster, addon *addonapiv1alpha1.ManagedClusterAddOn) ([]runtime.Object, error) {
@@ -71,6 +75,8 @@ func (t *testAgent) GetAgentAddonOptions() agent.AgentAddonOptions {
 		Updaters:           t.Updaters,
 		ManifestConfigs:    t.ManifestConfigs,
 		ConfigCheckEnabled: t.ConfigCheckEnabled,
+
+		EffectiveImagesEnabled: t.EffectiveImagesEnabled,
 	}
 }
 
@@ -281,6 +287,63 @@ func TestDefaultReconcile(t *testing.T) {
 			validateAddonActions: addontesting.AssertNoActions,
 			validateWorkActions:  addontesting.AssertNoActions,
 		},
+		{
+			name: "not deploy manifests for an addon referencing missing configs when ConfigCheckEnabled is true",
+			key:  "cluster1/test",
+			addon: []runtime.Object{addontesting.NewAddonWithConditions("test", "cluster1",
+				registrationAppliedCondition, configuredCondition,
+				metav1.Condition{
+					Type:    constants.AddonConditionConfigValid,
+					Status:  metav1.ConditionFalse,
+					Reason:  constants.ConfigValidReasonInvalid,
+					Message: "configs not found: addondeploymentconfigs.addon.open-cluster-management.io/cluster1/test",
+				},
+			)},
+			cluster: []runtime.Object{addontesting.NewManagedCluster("cluster1")},
+			testaddon: &testAgent{name: "test", objects: []runtime.Object{
+				addontesting.NewUnstructured("v1", "ConfigMap", "default", "test"),
+			}, ConfigCheckEnabled: true},
+			validateAddonActions: addontesting.AssertNoActions,
+			validateWorkActions:  addontesting.AssertNoActions,
+		},
+		{
+			name:    "not record effective images for an addon when EffectiveImagesEnabled is false",
+			key:     "cluster1/test",
+			addon:   []runtime.Object{addontesting.NewAddonWithConditions("test", "cluster1", registrationAppliedCondition)},
+			cluster: []runtime.Object{addontesting.NewManagedCluster("cluster1")},
+			testaddon: &testAgent{name: "test", objects: []runtime.Object{
+				newDeploymentWithImage("agent", "quay.io/ocm/agent:v1"),
+			}},
+			validateAddonActions: addontesting.AssertNoActions,
+			validateWorkActions: func(t *testing.T, actions []clienttesting.Action) {
+				addontesting.AssertActions(t, actions, "create")
+			},
+		},
+		{
+			name:    "record effective images for an addon when EffectiveImagesEnabled is true",
+			key:     "cluster1/test",
+			addon:   []runtime.Object{addontesting.NewAddonWithConditions("test", "cluster1", registrationAppliedCondition)},
+			cluster: []runtime.Object{addontesting.NewManagedCluster("cluster1")},
+			testaddon: &testAgent{name: "test", objects: []runtime.Object{
+				newDeploymentWithImage("agent", "quay.io/ocm/agent:v1"),
+			}, EffectiveImagesEnabled: true},
+			validateAddonActions: func(t *testing.T, actions []clienttesting.Action) {
+				addontesting.AssertActions(t, actions, "patch")
+				patch := actions[0].(clienttesting.PatchActionImpl).Patch
+				addOn := &addonapiv1alpha1.ManagedClusterAddOn{}
+				err := json.Unmarshal(patch, addOn)
+				if err != nil {
+					t.Fatal(err)
+				}
+				cond := meta.FindStatusCondition(addOn.Status.Conditions, constants.AddonConditionEffectiveImages)
+				if cond == nil || cond.Message != "quay.io/ocm/agent:v1" {
+					t.Errorf("EffectiveImages condition is not correct: %v", addOn.Status.Conditions)
+				}
+			},
+			validateWorkActions: func(t *testing.T, actions []clienttesting.Action) {
+				addontesting.AssertActions(t, actions, "create")
+			},
+		},
 		{
 			name: "clear stale False ManifestApplied condition when WorkApplied is nil",
 			key:  "cluster1/test",
@@ -447,3 +510,17 @@ func TestDefaultReconcile(t *testing.T) {
 		})
 	}
 }
+
+func newDeploymentWithImage(name, image string) *unstructured.Unstructured {
+	deployment := addontesting.NewUnstructured("apps/v1", "Deployment", "default", name)
+	deployment.Object["spec"] = map[string]interface{}{
+		"template": map[string]interface{}{
+			"spec": map[string]interface{}{
+				"containers": []interface{}{
+					map[string]interface{}{"name": name, "image": image},
+				},
+			},
+		},
+	}
+	return deployment
+}
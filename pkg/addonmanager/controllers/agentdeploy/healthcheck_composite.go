@@ -0,0 +1,184 @@
+package agentdeploy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	errorsutil "k8s.io/apimachinery/pkg/util/errors"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+
+	"open-cluster-management.io/addon-framework/pkg/addonmanager/constants"
+	"open-cluster-management.io/addon-framework/pkg/agent"
+	"open-cluster-management.io/sdk-go/pkg/basecontroller/factory"
+)
+
+// subProberAgentAddon overrides the health prober of the agent addon with a sub-prober of the composite health
+// prober, so the sub-prober is probed in the same way as the health prober of an addon.
+type subProberAgentAddon struct {
+	agent.AgentAddon
+	healthProber *agent.HealthProber
+}
+
+func (a *subProberAgentAddon) GetAgentAddonOptions() agent.AgentAddonOptions {
+	options := a.AgentAddon.GetAgentAddonOptions()
+	options.HealthProber = a.healthProber
+	return options
+}
+
+// subProberResult is the Available status of the addon probed by a sub-prober of the composite health prober.
+type subProberResult struct {
+	name    string
+	weight  int32
+	status  metav1.ConditionStatus
+	reason  string
+	message string
+}
+
+func (s *healthCheckSyncer) probeCompositeAddonStatus(
+	ctx context.Context,
+	syncCtx factory.SyncContext,
+	cluster *clusterv1.ManagedCluster,
+	addon *addonapiv1alpha1.ManagedClusterAddOn) error {
+	compositeProber := s.agentAddon.GetAgentAddonOptions().HealthProber.CompositeProber
+	if compositeProber == nil || len(compositeProber.Probers) == 0 {
+		return nil
+	}
+
+	if cluster != nil {
+		clusterAvailableCondition := meta.FindStatusCondition(cluster.Status.Conditions,
+			clusterv1.ManagedClusterConditionAvailable)
+		if clusterAvailableCondition != nil && clusterAvailableCondition.Status == metav1.ConditionUnknown {
+			// the registration agent will set all addon status to unknown
+			return nil
+		}
+	}
+
+	var results []subProberResult
+	var errs []error
+	for _, subProber := range compositeProber.Probers {
+		result, err := s.probeSubProber(ctx, syncCtx, cluster, addon, subProber)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to probe %s: %v", subProber.Name, err))
+		}
+		results = append(results, result)
+	}
+
+	meta.SetStatusCondition(&addon.Status.Conditions, combineSubProberResults(addon.Name, compositeProber, results))
+	return errorsutil.NewAggregate(errs)
+}
+
+// probeSubProber probes a copy of the addon with the sub-prober, and returns the Available condition of the copy
+// as the result. The result is unknown if the sub-prober does not set the Available condition.
+func (s *healthCheckSyncer) probeSubProber(
+	ctx context.Context,
+	syncCtx factory.SyncContext,
+	cluster *clusterv1.ManagedCluster,
+	addon *addonapiv1alpha1.ManagedClusterAddOn,
+	subProber agent.CompositeSubProber) (subProberResult, error) {
+	result := subProberResult{
+		name:    subProber.Name,
+		weight:  subProber.Weight,
+		status:  metav1.ConditionUnknown,
+		reason:  addonapiv1alpha1.AddonAvailableReasonNoProbeResult,
+		message: "Probe results are not returned",
+	}
+	if result.weight <= 0 {
+		result.weight = 1
+	}
+
+	switch {
+	case subProber.Prober != nil:
+		if err := agent.ValidateCompositeSubProber(subProber); err != nil {
+			result.message = err.Error()
+			return result, err
+		}
+
+		subAddon := addon.DeepCopy()
+		meta.RemoveStatusCondition(&subAddon.Status.Conditions, addonapiv1alpha1.ManagedClusterAddOnConditionAvailable)
+		subSyncer := &healthCheckSyncer{
+			getWorkByAddon:       s.getWorkByAddon,
+			getWorkByHostedAddon: s.getWorkByHostedAddon,
+			leaseLister:          s.leaseLister,
+			endpointCache:        s.endpointCache,
+			agentAddon:           &subProberAgentAddon{AgentAddon: s.agentAddon, healthProber: subProber.Prober},
+		}
+
+		if err := subSyncer.probeAddonStatus(ctx, syncCtx, cluster, subAddon); err != nil {
+			result.message = err.Error()
+			return result, err
+		}
+
+		if cond := meta.FindStatusCondition(subAddon.Status.Conditions,
+			addonapiv1alpha1.ManagedClusterAddOnConditionAvailable); cond != nil {
+			result.status, result.reason, result.message = cond.Status, cond.Reason, cond.Message
+		}
+	case subProber.Check != nil:
+		if err := subProber.Check(cluster, addon); err != nil {
+			result.status = metav1.ConditionFalse
+			result.reason = addonapiv1alpha1.AddonAvailableReasonProbeUnavailable
+			result.message = err.Error()
+		} else {
+			result.status = metav1.ConditionTrue
+			result.reason = addonapiv1alpha1.AddonAvailableReasonProbeAvailable
+			result.message = "check passed"
+		}
+	default:
+		result.message = "neither prober nor check is set"
+	}
+
+	return result, nil
+}
+
+// combineSubProberResults returns the Available condition of the addon combined from the results of the
+// sub-probers. The addon is unavailable if the total weight of the unavailable sub-probers reaches the threshold,
+// unknown if it reaches the threshold with the unknown sub-probers, and degraded if some of the sub-probers are
+// not available.
+func combineSubProberResults(addonName string, compositeProber *agent.CompositeHealthProber,
+	results []subProberResult) metav1.Condition {
+	var total, unavailable, unknown int32
+	var messages []string
+	for _, result := range results {
+		total += result.weight
+		switch result.status {
+		case metav1.ConditionTrue:
+		case metav1.ConditionFalse:
+			unavailable += result.weight
+		default:
+			unknown += result.weight
+		}
+		messages = append(messages, fmt.Sprintf("[%s] %s: %s", result.name, result.reason, result.message))
+	}
+
+	threshold := compositeProber.UnavailableThreshold
+	if threshold <= 0 {
+		threshold = 1
+		if compositeProber.Operator == agent.CompositeOperatorOr {
+			threshold = total
+		}
+	}
+
+	cond := metav1.Condition{
+		Type: addonapiv1alpha1.ManagedClusterAddOnConditionAvailable,
+	}
+	var state string
+	switch {
+	case unavailable >= threshold:
+		cond.Status, cond.Reason, state = metav1.ConditionFalse,
+			addonapiv1alpha1.AddonAvailableReasonProbeUnavailable, "not available"
+	case unavailable+unknown >= threshold:
+		cond.Status, cond.Reason, state = metav1.ConditionUnknown,
+			addonapiv1alpha1.AddonAvailableReasonNoProbeResult, "unknown"
+	case unavailable+unknown > 0:
+		cond.Status, cond.Reason, state = metav1.ConditionTrue,
+			constants.AddonAvailableReasonProbeDegraded, "degraded"
+	default:
+		cond.Status, cond.Reason, state = metav1.ConditionTrue,
+			addonapiv1alpha1.AddonAvailableReasonProbeAvailable, "available"
+	}
+	cond.Message = fmt.Sprintf("%s add-on is %s. %s", addonName, state, strings.Join(messages, "; "))
+	return cond
+}
@@ -0,0 +1,214 @@
+package agentdeploy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	coordinationlisters "k8s.io/client-go/listers/coordination/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/utils/ptr"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+
+	"open-cluster-management.io/addon-framework/pkg/addonmanager/addontesting"
+	"open-cluster-management.io/addon-framework/pkg/addonmanager/constants"
+	"open-cluster-management.io/addon-framework/pkg/agent"
+	"open-cluster-management.io/addon-framework/pkg/lease"
+)
+
+func TestHealthCheckComposite(t *testing.T) {
+	renewedLease := &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "cluster1"},
+		Spec: coordinationv1.LeaseSpec{
+			LeaseDurationSeconds: ptr.To[int32](60),
+			RenewTime:            &metav1.MicroTime{Time: time.Now()},
+		},
+	}
+	failedLease := renewedLease.DeepCopy()
+	failedLease.Annotations = map[string]string{
+		lease.HealthCheckAnnotationKey:        "database",
+		lease.HealthCheckReasonAnnotationKey:  "ConnectionRefused",
+		lease.HealthCheckMessageAnnotationKey: "failed to connect to db",
+	}
+
+	leaseProber := agent.CompositeSubProber{
+		Name:   "lease",
+		Prober: &agent.HealthProber{Type: agent.HealthProberTypeLease},
+	}
+	checkProber := func(name string, err error, weight int32) agent.CompositeSubProber {
+		return agent.CompositeSubProber{
+			Name: name,
+			Check: func(_ *clusterv1.ManagedCluster, _ *addonapiv1alpha1.ManagedClusterAddOn) error {
+				return err
+			},
+			Weight: weight,
+		}
+	}
+	agentProber := checkProber("agent", nil, 0)
+	operandNotReady := fmt.Errorf("operand not ready")
+
+	cases := []struct {
+		name             string
+		lease            *coordinationv1.Lease
+		compositeProber  *agent.CompositeHealthProber
+		expectedStatus   metav1.ConditionStatus
+		expectedReason   string
+		expectedMessages []string
+		expectedErr      bool
+	}{
+		{
+			name: "all available",
+			compositeProber: &agent.CompositeHealthProber{
+				Probers: []agent.CompositeSubProber{agentProber, checkProber("operand", nil, 0)},
+			},
+			expectedStatus: metav1.ConditionTrue,
+			expectedReason: addonapiv1alpha1.AddonAvailableReasonProbeAvailable,
+			expectedMessages: []string{
+				"test add-on is available.",
+				"[agent] ProbeAvailable: check passed",
+				"[operand] ProbeAvailable: check passed",
+			},
+		},
+		{
+			name: "and with a sub-prober unavailable",
+			compositeProber: &agent.CompositeHealthProber{
+				Probers: []agent.CompositeSubProber{agentProber, checkProber("operand", operandNotReady, 0)},
+			},
+			expectedStatus:   metav1.ConditionFalse,
+			expectedReason:   addonapiv1alpha1.AddonAvailableReasonProbeUnavailable,
+			expectedMessages: []string{"[operand] ProbeUnavailable: operand not ready"},
+		},
+		{
+			name: "or with a sub-prober unavailable",
+			compositeProber: &agent.CompositeHealthProber{
+				Operator: agent.CompositeOperatorOr,
+				Probers:  []agent.CompositeSubProber{agentProber, checkProber("operand", operandNotReady, 0)},
+			},
+			expectedStatus:   metav1.ConditionTrue,
+			expectedReason:   constants.AddonAvailableReasonProbeDegraded,
+			expectedMessages: []string{"test add-on is degraded."},
+		},
+		{
+			name: "unavailable weight below the threshold",
+			compositeProber: &agent.CompositeHealthProber{
+				UnavailableThreshold: 3,
+				Probers:              []agent.CompositeSubProber{agentProber, checkProber("operand", operandNotReady, 2)},
+			},
+			expectedStatus: metav1.ConditionTrue,
+			expectedReason: constants.AddonAvailableReasonProbeDegraded,
+		},
+		{
+			name: "unavailable weight reaches the threshold",
+			compositeProber: &agent.CompositeHealthProber{
+				UnavailableThreshold: 2,
+				Probers:              []agent.CompositeSubProber{agentProber, checkProber("operand", operandNotReady, 2)},
+			},
+			expectedStatus: metav1.ConditionFalse,
+			expectedReason: addonapiv1alpha1.AddonAvailableReasonProbeUnavailable,
+		},
+		{
+			name: "no probe result",
+			compositeProber: &agent.CompositeHealthProber{
+				Probers: []agent.CompositeSubProber{agentProber, {Name: "empty"}},
+			},
+			expectedStatus:   metav1.ConditionUnknown,
+			expectedReason:   addonapiv1alpha1.AddonAvailableReasonNoProbeResult,
+			expectedMessages: []string{"[empty] NoProbeResult: neither prober nor check is set"},
+		},
+		{
+			name:  "lease sub-prober",
+			lease: renewedLease,
+			compositeProber: &agent.CompositeHealthProber{
+				Probers: []agent.CompositeSubProber{leaseProber, checkProber("operand", nil, 0)},
+			},
+			expectedStatus: metav1.ConditionTrue,
+			expectedReason: addonapiv1alpha1.AddonAvailableReasonProbeAvailable,
+			expectedMessages: []string{
+				"[lease] ManagedClusterAddOnLeaseUpdated: test add-on is available.",
+				"[operand] ProbeAvailable: check passed",
+			},
+		},
+		{
+			name:  "lease sub-prober with failing health check",
+			lease: failedLease,
+			compositeProber: &agent.CompositeHealthProber{
+				Probers: []agent.CompositeSubProber{leaseProber, checkProber("operand", nil, 0)},
+			},
+			expectedStatus: metav1.ConditionFalse,
+			expectedReason: addonapiv1alpha1.AddonAvailableReasonProbeUnavailable,
+			expectedMessages: []string{
+				"[lease] HealthCheckFailed: Health check database failed with reason ConnectionRefused: failed to connect to db",
+			},
+		},
+		{
+			name: "lease not found",
+			compositeProber: &agent.CompositeHealthProber{
+				Probers: []agent.CompositeSubProber{leaseProber, checkProber("operand", nil, 0)},
+			},
+			expectedStatus:   metav1.ConditionUnknown,
+			expectedReason:   addonapiv1alpha1.AddonAvailableReasonNoProbeResult,
+			expectedMessages: []string{"[lease] NoProbeResult: The lease of test add-on is not found on the hub."},
+		},
+		{
+			name: "nested composite prober",
+			compositeProber: &agent.CompositeHealthProber{
+				Probers: []agent.CompositeSubProber{
+					agentProber,
+					{Name: "nested", Prober: &agent.HealthProber{Type: agent.HealthProberTypeComposite}},
+				},
+			},
+			expectedStatus: metav1.ConditionUnknown,
+			expectedReason: addonapiv1alpha1.AddonAvailableReasonNoProbeResult,
+			expectedErr:    true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			if c.lease != nil {
+				if err := indexer.Add(c.lease); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			syncer := healthCheckSyncer{
+				leaseLister: coordinationlisters.NewLeaseLister(indexer),
+				agentAddon: &healthCheckTestAgent{name: "test",
+					health: &agent.HealthProber{Type: agent.HealthProberTypeComposite, CompositeProber: c.compositeProber}},
+			}
+
+			addon, err := syncer.sync(context.TODO(), addontesting.NewFakeSyncContext(t),
+				addontesting.NewManagedCluster("cluster1"), addontesting.NewAddon("test", "cluster1"))
+			if c.expectedErr && err == nil {
+				t.Errorf("expected error, but got none")
+			}
+			if !c.expectedErr && err != nil {
+				t.Fatal(err)
+			}
+			if addon.Status.HealthCheck.Mode != addonapiv1alpha1.HealthCheckModeCustomized {
+				t.Errorf("expected health check mode Customized, but got %v", addon.Status.HealthCheck.Mode)
+			}
+
+			cond := meta.FindStatusCondition(addon.Status.Conditions, addonapiv1alpha1.ManagedClusterAddOnConditionAvailable)
+			if cond == nil {
+				t.Fatalf("expected available condition, but got none")
+			}
+			if cond.Status != c.expectedStatus || cond.Reason != c.expectedReason {
+				t.Errorf("expected condition %s/%s, but got %s/%s",
+					c.expectedStatus, c.expectedReason, cond.Status, cond.Reason)
+			}
+			for _, message := range c.expectedMessages {
+				if !strings.Contains(cond.Message, message) {
+					t.Errorf("expected message %q in %q", message, cond.Message)
+				}
+			}
+		})
+	}
+}
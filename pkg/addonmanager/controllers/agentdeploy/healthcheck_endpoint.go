@@ -0,0 +1,225 @@
+package agentdeploy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+
+	"open-cluster-management.io/addon-framework/pkg/addonmanager/constants"
+	"open-cluster-management.io/addon-framework/pkg/agent"
+	"open-cluster-management.io/sdk-go/pkg/basecontroller/factory"
+)
+
+// maxEndpointResponseMessageBytes is the max length of the response body of the health endpoint put in the
+// message of the Available condition.
+const maxEndpointResponseMessageBytes = 256
+
+// endpointProbeResult is the result of a probe of the agent health endpoint.
+type endpointProbeResult struct {
+	condition metav1.Condition
+	probedAt  time.Time
+}
+
+// endpointProbeCache caches the results of the agent health endpoint probes per addon on a cluster. The endpoints
+// are probed in the background so the reconcile of the addons never waits on the managed clusters, and the
+// reconcile only reads the cached results.
+type endpointProbeCache struct {
+	lock     sync.Mutex
+	results  map[string]endpointProbeResult
+	inflight map[string]bool
+}
+
+func newEndpointProbeCache() *endpointProbeCache {
+	return &endpointProbeCache{
+		results:  map[string]endpointProbeResult{},
+		inflight: map[string]bool{},
+	}
+}
+
+// get returns the last result of the key, and whether it was probed within the interval.
+func (c *endpointProbeCache) get(key string, interval time.Duration, now time.Time) (endpointProbeResult, bool, bool) {
+	if c == nil {
+		return endpointProbeResult{}, false, false
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	result, ok := c.results[key]
+	return result, ok, ok && now.Before(result.probedAt.Add(interval))
+}
+
+// startProbe marks the key as being probed, it returns false if a probe of the key is already in flight.
+func (c *endpointProbeCache) startProbe(key string) bool {
+	if c == nil {
+		return false
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.inflight[key] {
+		return false
+	}
+	c.inflight[key] = true
+	return true
+}
+
+// finishProbe stores the result of an in-flight probe, the result is dropped if the addon was deleted during the
+// probe.
+func (c *endpointProbeCache) finishProbe(key string, result endpointProbeResult) {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if !c.inflight[key] {
+		return
+	}
+	delete(c.inflight, key)
+	c.results[key] = result
+}
+
+// deleteAddon deletes the cached results of the addon once the addon is deleted.
+func (c *endpointProbeCache) deleteAddon(addonNamespace, addonName string) {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	prefix := fmt.Sprintf("%s/%s/", addonNamespace, addonName)
+	for key := range c.results {
+		if strings.HasPrefix(key, prefix) {
+			delete(c.results, key)
+		}
+	}
+	for key := range c.inflight {
+		if strings.HasPrefix(key, prefix) {
+			delete(c.inflight, key)
+		}
+	}
+}
+
+func (s *healthCheckSyncer) probeEndpointAddonStatus(
+	ctx context.Context,
+	syncCtx factory.SyncContext,
+	cluster *clusterv1.ManagedCluster,
+	addon *addonapiv1alpha1.ManagedClusterAddOn) error {
+	endpointProber := s.agentAddon.GetAgentAddonOptions().HealthProber.EndpointProber
+	if endpointProber == nil || endpointProber.Transport == nil || endpointProber.URL == nil || cluster == nil {
+		return nil
+	}
+
+	clusterAvailableCondition := meta.FindStatusCondition(cluster.Status.Conditions,
+		clusterv1.ManagedClusterConditionAvailable)
+	if clusterAvailableCondition != nil && clusterAvailableCondition.Status == metav1.ConditionUnknown {
+		// the registration agent will set all addon status to unknown
+		return nil
+	}
+
+	interval := endpointProber.Interval
+	if interval <= 0 {
+		interval = agent.DefaultEndpointProbeInterval
+	}
+
+	url, err := endpointProber.URL(cluster, addon)
+	if err != nil {
+		return fmt.Errorf("failed to get the health endpoint of addon %s/%s: %v", addon.Namespace, addon.Name, err)
+	}
+
+	addonKey := fmt.Sprintf("%s/%s", addon.Namespace, addon.Name)
+	key := fmt.Sprintf("%s/%s", addonKey, url)
+	now := time.Now()
+	result, found, fresh := s.endpointCache.get(key, interval, now)
+	if fresh {
+		// the endpoint is not watched, requeue the addon to probe the endpoint again after the interval
+		syncCtx.Queue().AddAfter(addonKey, result.probedAt.Add(interval).Sub(now))
+	} else if s.endpointCache.startProbe(key) {
+		clusterName, addonName := cluster.Name, addon.Name
+		go func() {
+			s.endpointCache.finishProbe(key, probeEndpoint(ctx, endpointProber, clusterName, url, addonName))
+			syncCtx.Queue().Add(addonKey)
+		}()
+	}
+
+	// keep the condition as it is until the endpoint is probed for the first time, a stale result is used
+	// until the probe in flight finishes.
+	if found {
+		meta.SetStatusCondition(&addon.Status.Conditions, result.condition)
+	}
+	return nil
+}
+
+// probeEndpoint calls the health endpoint through the transport, the addon is available if the endpoint responds
+// with a 2xx status code, and the status is unknown if the endpoint cannot be reached. The latency of the probe is
+// recorded in the endpointProbeDurationSeconds metric.
+func probeEndpoint(ctx context.Context, endpointProber *agent.EndpointHealthProber,
+	clusterName, url, addonName string) endpointProbeResult {
+	timeout := endpointProber.Timeout
+	if timeout <= 0 {
+		timeout = agent.DefaultEndpointProbeTimeout
+	}
+
+	start := time.Now()
+	result := endpointProbeResult{probedAt: start}
+	defer func() {
+		endpointProbeDurationSeconds.WithLabelValues(clusterName, addonName, string(result.condition.Status)).
+			Observe(time.Since(start).Seconds())
+	}()
+
+	unreachable := func(err error) endpointProbeResult {
+		result.condition = metav1.Condition{
+			Type:    addonapiv1alpha1.ManagedClusterAddOnConditionAvailable,
+			Status:  metav1.ConditionUnknown,
+			Reason:  constants.AddonAvailableReasonEndpointUnreachable,
+			Message: fmt.Sprintf("Failed to probe the health endpoint %s: %v", url, err),
+		}
+		return result
+	}
+
+	transport, err := endpointProber.Transport.RoundTripper(clusterName)
+	if err != nil {
+		return unreachable(err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return unreachable(err)
+	}
+	resp, err := (&http.Client{Transport: transport}).Do(req)
+	if err != nil {
+		return unreachable(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxEndpointResponseMessageBytes))
+
+	if resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices {
+		result.condition = metav1.Condition{
+			Type:   addonapiv1alpha1.ManagedClusterAddOnConditionAvailable,
+			Status: metav1.ConditionTrue,
+			Reason: addonapiv1alpha1.AddonAvailableReasonProbeAvailable,
+			Message: fmt.Sprintf("%s add-on is available. The health endpoint responded with %d.",
+				addonName, resp.StatusCode),
+		}
+		return result
+	}
+
+	result.condition = metav1.Condition{
+		Type:    addonapiv1alpha1.ManagedClusterAddOnConditionAvailable,
+		Status:  metav1.ConditionFalse,
+		Reason:  addonapiv1alpha1.AddonAvailableReasonProbeUnavailable,
+		Message: fmt.Sprintf("The health endpoint responded with %d: %s", resp.StatusCode, strings.TrimSpace(string(body))),
+	}
+	return result
+}
@@ -0,0 +1,258 @@
+package agentdeploy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+
+	"open-cluster-management.io/addon-framework/pkg/addonmanager/addontesting"
+	"open-cluster-management.io/addon-framework/pkg/addonmanager/constants"
+	"open-cluster-management.io/addon-framework/pkg/agent"
+)
+
+// testEndpointTransport sends the requests to the local http server standing in for the managed cluster.
+type testEndpointTransport struct {
+	err error
+}
+
+func (t *testEndpointTransport) RoundTripper(_ string) (http.RoundTripper, error) {
+	if t.err != nil {
+		return nil, t.err
+	}
+	return http.DefaultTransport, nil
+}
+
+// waitForRequeue waits until the addon is requeued once the endpoint probe in the background finishes.
+func waitForRequeue(t *testing.T, syncCtx *addontesting.FakeSyncContext, key string) {
+	requeued := make(chan string, 1)
+	go func() {
+		item, _ := syncCtx.Queue().Get()
+		syncCtx.Queue().Done(item)
+		requeued <- item
+	}()
+
+	select {
+	case item := <-requeued:
+		if item != key {
+			t.Errorf("expected %s requeued, but got %s", key, item)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("timeout waiting for %s to be requeued", key)
+	}
+}
+
+func TestHealthCheckEndpoint(t *testing.T) {
+	cases := []struct {
+		name             string
+		statusCode       int
+		transportErr     error
+		expectedStatus   metav1.ConditionStatus
+		expectedReason   string
+		expectedMessages []string
+	}{
+		{
+			name:             "endpoint healthy",
+			statusCode:       http.StatusOK,
+			expectedStatus:   metav1.ConditionTrue,
+			expectedReason:   addonapiv1alpha1.AddonAvailableReasonProbeAvailable,
+			expectedMessages: []string{"test add-on is available.", "responded with 200"},
+		},
+		{
+			name:             "endpoint unhealthy",
+			statusCode:       http.StatusInternalServerError,
+			expectedStatus:   metav1.ConditionFalse,
+			expectedReason:   addonapiv1alpha1.AddonAvailableReasonProbeUnavailable,
+			expectedMessages: []string{"responded with 500", "not ready"},
+		},
+		{
+			name:             "transport error",
+			transportErr:     fmt.Errorf("tunnel is down"),
+			expectedStatus:   metav1.ConditionUnknown,
+			expectedReason:   constants.AddonAvailableReasonEndpointUnreachable,
+			expectedMessages: []string{"tunnel is down"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var hits int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				atomic.AddInt32(&hits, 1)
+				w.WriteHeader(c.statusCode)
+				if c.statusCode != http.StatusOK {
+					fmt.Fprint(w, "not ready")
+				}
+			}))
+			defer server.Close()
+
+			syncer := healthCheckSyncer{
+				endpointCache: newEndpointProbeCache(),
+				agentAddon: &healthCheckTestAgent{name: "test",
+					health: &agent.HealthProber{
+						Type: agent.HealthProberTypeEndpoint,
+						EndpointProber: &agent.EndpointHealthProber{
+							Transport: &testEndpointTransport{err: c.transportErr},
+							URL: func(_ *clusterv1.ManagedCluster, _ *addonapiv1alpha1.ManagedClusterAddOn) (string, error) {
+								return server.URL + "/healthz", nil
+							},
+						},
+					}},
+			}
+
+			syncCtx := addontesting.NewFakeSyncContext(t)
+			cluster := addontesting.NewManagedCluster("cluster1")
+
+			// the first sync does not wait for the probe in the background
+			addon, err := syncer.sync(context.TODO(), syncCtx, cluster, addontesting.NewAddon("test", "cluster1"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cond := meta.FindStatusCondition(addon.Status.Conditions,
+				addonapiv1alpha1.ManagedClusterAddOnConditionAvailable); cond != nil {
+				t.Errorf("expected no available condition before the probe finishes, but got %v", cond)
+			}
+			waitForRequeue(t, syncCtx, "cluster1/test")
+
+			// the syncs within the interval use the cached result
+			for i := 0; i < 2; i++ {
+				addon, err := syncer.sync(context.TODO(), syncCtx, cluster, addontesting.NewAddon("test", "cluster1"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if addon.Status.HealthCheck.Mode != addonapiv1alpha1.HealthCheckModeCustomized {
+					t.Errorf("expected health check mode Customized, but got %v", addon.Status.HealthCheck.Mode)
+				}
+
+				cond := meta.FindStatusCondition(addon.Status.Conditions, addonapiv1alpha1.ManagedClusterAddOnConditionAvailable)
+				if cond == nil {
+					t.Fatalf("expected available condition, but got none")
+				}
+				if cond.Status != c.expectedStatus || cond.Reason != c.expectedReason {
+					t.Errorf("expected condition %s/%s, but got %s/%s",
+						c.expectedStatus, c.expectedReason, cond.Status, cond.Reason)
+				}
+				for _, message := range c.expectedMessages {
+					if !strings.Contains(cond.Message, message) {
+						t.Errorf("expected message %q in %q", message, cond.Message)
+					}
+				}
+			}
+
+			expectedHits := int32(1)
+			if c.transportErr != nil {
+				expectedHits = 0
+			}
+			if hits != expectedHits {
+				t.Errorf("expected the endpoint to be called %d times, but got %d", expectedHits, hits)
+			}
+
+			syncer.endpointCache.deleteAddon("cluster1", "test")
+			if len(syncer.endpointCache.results) != 0 || len(syncer.endpointCache.inflight) != 0 {
+				t.Errorf("expected the cache to be cleaned up, but got %v", syncer.endpointCache.results)
+			}
+		})
+	}
+}
+
+func TestHealthCheckEndpointInComposite(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	syncer := healthCheckSyncer{
+		endpointCache: newEndpointProbeCache(),
+		agentAddon: &healthCheckTestAgent{name: "test",
+			health: &agent.HealthProber{
+				Type: agent.HealthProberTypeComposite,
+				CompositeProber: &agent.CompositeHealthProber{
+					Operator: agent.CompositeOperatorOr,
+					Probers: []agent.CompositeSubProber{
+						{
+							Name: "endpoint",
+							Prober: &agent.HealthProber{
+								Type: agent.HealthProberTypeEndpoint,
+								EndpointProber: &agent.EndpointHealthProber{
+									Transport: &testEndpointTransport{},
+									URL: func(_ *clusterv1.ManagedCluster, _ *addonapiv1alpha1.ManagedClusterAddOn) (string, error) {
+										return server.URL, nil
+									},
+								},
+							},
+						},
+						{
+							Name: "operand",
+							Check: func(_ *clusterv1.ManagedCluster, _ *addonapiv1alpha1.ManagedClusterAddOn) error {
+								return nil
+							},
+						},
+					},
+				},
+			}},
+	}
+
+	syncCtx := addontesting.NewFakeSyncContext(t)
+	cluster := addontesting.NewManagedCluster("cluster1")
+	if _, err := syncer.sync(context.TODO(), syncCtx, cluster, addontesting.NewAddon("test", "cluster1")); err != nil {
+		t.Fatal(err)
+	}
+	waitForRequeue(t, syncCtx, "cluster1/test")
+
+	addon, err := syncer.sync(context.TODO(), syncCtx, cluster, addontesting.NewAddon("test", "cluster1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cond := meta.FindStatusCondition(addon.Status.Conditions, addonapiv1alpha1.ManagedClusterAddOnConditionAvailable)
+	if cond == nil {
+		t.Fatalf("expected available condition, but got none")
+	}
+	if cond.Status != metav1.ConditionTrue || cond.Reason != constants.AddonAvailableReasonProbeDegraded {
+		t.Errorf("expected condition True/%s, but got %s/%s",
+			constants.AddonAvailableReasonProbeDegraded, cond.Status, cond.Reason)
+	}
+	if !strings.Contains(cond.Message, "[endpoint] ProbeUnavailable: The health endpoint responded with 503") {
+		t.Errorf("unexpected message %q", cond.Message)
+	}
+}
+
+func TestEndpointProbeCache(t *testing.T) {
+	cache := newEndpointProbeCache()
+	now := time.Now()
+	key := "cluster1/test/https://agent/healthz"
+
+	if !cache.startProbe(key) {
+		t.Fatalf("expected the probe to start")
+	}
+	if cache.startProbe(key) {
+		t.Errorf("expected only one probe of the key in flight")
+	}
+	cache.finishProbe(key, endpointProbeResult{probedAt: now})
+
+	if _, found, fresh := cache.get(key, time.Minute, now.Add(30*time.Second)); !found || !fresh {
+		t.Errorf("expected a fresh result, but got found %v, fresh %v", found, fresh)
+	}
+	if _, found, fresh := cache.get(key, time.Minute, now.Add(2*time.Minute)); !found || fresh {
+		t.Errorf("expected a stale result, but got found %v, fresh %v", found, fresh)
+	}
+
+	// the result of a probe finished after the addon is deleted is dropped
+	if !cache.startProbe(key) {
+		t.Fatalf("expected the probe to start")
+	}
+	cache.deleteAddon("cluster1", "test")
+	cache.finishProbe(key, endpointProbeResult{probedAt: now})
+	if _, found, _ := cache.get(key, time.Minute, now); found {
+		t.Errorf("expected the result dropped after the addon is deleted")
+	}
+}
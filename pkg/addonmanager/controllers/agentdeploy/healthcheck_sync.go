@@ -3,18 +3,23 @@ package agentdeploy
 import (
 	"context"
 	"fmt"
-	"regexp"
 	"strings"
+	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	coordinationlisters "k8s.io/client-go/listers/coordination/v1"
 	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
 	clusterv1 "open-cluster-management.io/api/cluster/v1"
 	workapiv1 "open-cluster-management.io/api/work/v1"
 
 	"open-cluster-management.io/addon-framework/pkg/addonmanager/constants"
 	"open-cluster-management.io/addon-framework/pkg/agent"
+	"open-cluster-management.io/addon-framework/pkg/lease"
 	"open-cluster-management.io/addon-framework/pkg/utils"
 	"open-cluster-management.io/sdk-go/pkg/basecontroller/factory"
 )
@@ -22,9 +27,14 @@ import (
 type healthCheckSyncer struct {
 	getWorkByAddon       func(addonName, addonNamespace string) ([]*workapiv1.ManifestWork, error)
 	getWorkByHostedAddon func(addonName, addonNamespace string) ([]*workapiv1.ManifestWork, error)
+	leaseLister          coordinationlisters.LeaseLister
+	endpointCache        *endpointProbeCache
 	agentAddon           agent.AgentAddon
 }
 
+// defaultAddonLeaseDurationSeconds is used when the lease duration is not set on the addon lease.
+const defaultAddonLeaseDurationSeconds = 60
+
 func (s *healthCheckSyncer) sync(ctx context.Context,
 	syncCtx factory.SyncContext,
 	cluster *clusterv1.ManagedCluster,
@@ -38,10 +48,15 @@ func (s *healthCheckSyncer) sync(ctx context.Context,
 
 	switch s.agentAddon.GetAgentAddonOptions().HealthProber.Type {
 	case agent.HealthProberTypeWork, agent.HealthProberTypeNone,
-		agent.HealthProberTypeDeploymentAvailability, agent.HealthProberTypeWorkloadAvailability:
+		agent.HealthProberTypeDeploymentAvailability, agent.HealthProberTypeWorkloadAvailability,
+		agent.HealthProberTypeComposite, agent.HealthProberTypeEndpoint:
 		expectedHealthCheckMode = addonapiv1alpha1.HealthCheckModeCustomized
 	case agent.HealthProberTypeLease:
 		expectedHealthCheckMode = addonapiv1alpha1.HealthCheckModeLease
+		// the addon lease on the hub is probed by the addon manager instead of the registration agent
+		if s.agentAddon.GetAgentAddonOptions().HealthProber.LeaseProber != nil {
+			expectedHealthCheckMode = addonapiv1alpha1.HealthCheckModeCustomized
+		}
 	default:
 		expectedHealthCheckMode = addonapiv1alpha1.HealthCheckModeLease
 	}
@@ -50,11 +65,107 @@ func (s *healthCheckSyncer) sync(ctx context.Context,
 		addon.Status.HealthCheck.Mode = expectedHealthCheckMode
 	}
 
-	err := s.probeAddonStatus(cluster, addon)
+	if expectedHealthCheckMode == addonapiv1alpha1.HealthCheckModeLease {
+		return addon, nil
+	}
+
+	err := s.probeAddonStatus(ctx, syncCtx, cluster, addon)
 	return addon, err
 }
 
+// probeLeaseAddonStatus probes the freshness of the addon lease maintained on the hub in the cluster namespace
+// and sets the Available condition, the failing health check published on the lease is put in the message.
+func (s *healthCheckSyncer) probeLeaseAddonStatus(
+	syncCtx factory.SyncContext,
+	cluster *clusterv1.ManagedCluster,
+	addon *addonapiv1alpha1.ManagedClusterAddOn) error {
+	if s.leaseLister == nil {
+		return nil
+	}
+
+	if cluster != nil {
+		clusterAvailableCondition := meta.FindStatusCondition(cluster.Status.Conditions,
+			clusterv1.ManagedClusterConditionAvailable)
+		if clusterAvailableCondition != nil && clusterAvailableCondition.Status == metav1.ConditionUnknown {
+			// the registration agent will set all addon status to unknown
+			return nil
+		}
+	}
+
+	addonLease, err := s.leaseLister.Leases(addon.Namespace).Get(addon.Name)
+	if errors.IsNotFound(err) {
+		meta.SetStatusCondition(&addon.Status.Conditions, metav1.Condition{
+			Type:    addonapiv1alpha1.ManagedClusterAddOnConditionAvailable,
+			Status:  metav1.ConditionUnknown,
+			Reason:  addonapiv1alpha1.AddonAvailableReasonNoProbeResult,
+			Message: fmt.Sprintf("The lease of %s add-on is not found on the hub.", addon.Name),
+		})
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if failedCheck, ok := addonLease.Annotations[lease.HealthCheckAnnotationKey]; ok {
+		meta.SetStatusCondition(&addon.Status.Conditions, metav1.Condition{
+			Type:   addonapiv1alpha1.ManagedClusterAddOnConditionAvailable,
+			Status: metav1.ConditionFalse,
+			Reason: constants.AddonAvailableReasonHealthCheckFailed,
+			Message: fmt.Sprintf("Health check %s failed with reason %s: %s", failedCheck,
+				addonLease.Annotations[lease.HealthCheckReasonAnnotationKey],
+				addonLease.Annotations[lease.HealthCheckMessageAnnotationKey]),
+		})
+		return nil
+	}
+
+	now := time.Now()
+	expireAt := leaseExpireTime(addonLease, s.leaseGracePeriodFactor())
+	if !now.Before(expireAt) {
+		meta.SetStatusCondition(&addon.Status.Conditions, metav1.Condition{
+			Type:    addonapiv1alpha1.ManagedClusterAddOnConditionAvailable,
+			Status:  metav1.ConditionUnknown,
+			Reason:  addonapiv1alpha1.AddonAvailableReasonLeaseUpdateStopped,
+			Message: fmt.Sprintf("The lease of %s add-on is not renewed.", addon.Name),
+		})
+		return nil
+	}
+
+	meta.SetStatusCondition(&addon.Status.Conditions, metav1.Condition{
+		Type:    addonapiv1alpha1.ManagedClusterAddOnConditionAvailable,
+		Status:  metav1.ConditionTrue,
+		Reason:  addonapiv1alpha1.AddonAvailableReasonLeaseLeaseUpdated,
+		Message: fmt.Sprintf("%s add-on is available.", addon.Name),
+	})
+	// the lease renewal is not watched, requeue the addon to check the lease after it expires
+	syncCtx.Queue().AddAfter(fmt.Sprintf("%s/%s", addon.Namespace, addon.Name), expireAt.Sub(now))
+	return nil
+}
+
+// leaseGracePeriodFactor returns the grace period factor of the LeaseProber, or the default one if it is not set.
+func (s *healthCheckSyncer) leaseGracePeriodFactor() float64 {
+	if leaseProber := s.agentAddon.GetAgentAddonOptions().HealthProber.LeaseProber; leaseProber != nil &&
+		leaseProber.GracePeriodFactor > 0 {
+		return leaseProber.GracePeriodFactor
+	}
+	return agent.DefaultLeaseGracePeriodFactor
+}
+
+// leaseExpireTime returns the time the lease expires, which is the LeaseDurationSeconds of the lease multiplied
+// by the gracePeriodFactor after the last renewal. A lease never renewed is expired.
+func leaseExpireTime(addonLease *coordinationv1.Lease, gracePeriodFactor float64) time.Time {
+	if addonLease.Spec.RenewTime == nil {
+		return time.Time{}
+	}
+	durationSeconds := int32(defaultAddonLeaseDurationSeconds)
+	if addonLease.Spec.LeaseDurationSeconds != nil && *addonLease.Spec.LeaseDurationSeconds > 0 {
+		durationSeconds = *addonLease.Spec.LeaseDurationSeconds
+	}
+	return addonLease.Spec.RenewTime.Add(time.Duration(float64(durationSeconds) * gracePeriodFactor * float64(time.Second)))
+}
+
 func (s *healthCheckSyncer) probeAddonStatus(
+	ctx context.Context,
+	syncCtx factory.SyncContext,
 	cluster *clusterv1.ManagedCluster,
 	addon *addonapiv1alpha1.ManagedClusterAddOn) error {
 	switch s.agentAddon.GetAgentAddonOptions().HealthProber.Type {
@@ -64,6 +175,12 @@ func (s *healthCheckSyncer) probeAddonStatus(
 		return s.probeDeploymentAvailabilityAddonStatus(cluster, addon)
 	case agent.HealthProberTypeWorkloadAvailability:
 		return s.probeWorkloadAvailabilityAddonStatus(cluster, addon)
+	case agent.HealthProberTypeComposite:
+		return s.probeCompositeAddonStatus(ctx, syncCtx, cluster, addon)
+	case agent.HealthProberTypeEndpoint:
+		return s.probeEndpointAddonStatus(ctx, syncCtx, cluster, addon)
+	case agent.HealthProberTypeLease:
+		return s.probeLeaseAddonStatus(syncCtx, cluster, addon)
 	default:
 		return nil
 	}
@@ -187,6 +304,7 @@ func (s *healthCheckSyncer) probeAddonStatusByWorks(
 		return err
 	}
 
+	resultChecker := s.healthResultChecker()
 	var fieldResults []agent.FieldResult
 
 	for _, field := range probeFields {
@@ -198,8 +316,8 @@ func (s *healthCheckSyncer) probeAddonStatusByWorks(
 		}
 
 		fieldResults = append(fieldResults, results...)
-		// healthCheck will be ignored if healthChecker is set
-		if healthChecker != nil {
+		// healthCheck will be ignored if healthChecker or resultChecker is set
+		if healthChecker != nil || resultChecker != nil {
 			continue
 		}
 
@@ -242,6 +360,11 @@ func (s *healthCheckSyncer) probeAddonStatusByWorks(
 	// If we have fieldResults but some probes are empty, still proceed with healthChecker
 	// This allows partial probe results to be considered valid
 
+	if resultChecker != nil {
+		setHealthCheckResultConditions(addon, resultChecker(fieldResults, cluster, addon))
+		return nil
+	}
+
 	if healthChecker != nil {
 		if err := healthChecker(fieldResults, cluster, addon); err != nil {
 			meta.SetStatusCondition(&addon.Status.Conditions, metav1.Condition{
@@ -263,6 +386,85 @@ func (s *healthCheckSyncer) probeAddonStatusByWorks(
 	return nil
 }
 
+// healthResultChecker returns the HealthResultChecker of the work prober, or the built-in one of the
+// HealthProberTypeWorkloadAvailability if the WorkloadProber enables ReportDegraded.
+func (s *healthCheckSyncer) healthResultChecker() agent.AddonHealthResultCheckerFunc {
+	healthProber := s.agentAddon.GetAgentAddonOptions().HealthProber
+	switch healthProber.Type {
+	case agent.HealthProberTypeWork:
+		if healthProber.WorkProber == nil {
+			return nil
+		}
+		return healthProber.WorkProber.HealthResultChecker
+	case agent.HealthProberTypeWorkloadAvailability:
+		if healthProber.WorkloadProber == nil || !healthProber.WorkloadProber.ReportDegraded {
+			return nil
+		}
+		return utils.NewWorkloadAvailabilityHealthResultChecker(workloadResourceProbes(s.agentAddon)...)
+	default:
+		return nil
+	}
+}
+
+// setHealthCheckResultConditions maps the result of the health checker onto the Available, Degraded and
+// Progressing conditions of the addon. The Progressing condition is also maintained by the addon manager for
+// the rollout of the configs, so it is only set back once the rollout reported by the health checker completes.
+func setHealthCheckResultConditions(addon *addonapiv1alpha1.ManagedClusterAddOn, result agent.HealthCheckResult) {
+	availableCond := metav1.Condition{
+		Type: addonapiv1alpha1.ManagedClusterAddOnConditionAvailable,
+	}
+	switch result.Available {
+	case metav1.ConditionTrue:
+		availableCond.Status = metav1.ConditionTrue
+		availableCond.Reason = addonapiv1alpha1.AddonAvailableReasonProbeAvailable
+		availableCond.Message = fmt.Sprintf("%s add-on is available.", addon.Name)
+	case metav1.ConditionFalse:
+		availableCond.Status = metav1.ConditionFalse
+		availableCond.Reason = addonapiv1alpha1.AddonAvailableReasonProbeUnavailable
+		availableCond.Message = fmt.Sprintf("Probe addon unavailable: %s", result.Message)
+	default:
+		availableCond.Status = metav1.ConditionUnknown
+		availableCond.Reason = addonapiv1alpha1.AddonAvailableReasonNoProbeResult
+		availableCond.Message = fmt.Sprintf("Probe addon status unknown: %s", result.Message)
+	}
+	if availableCond.Status == metav1.ConditionTrue && len(result.Message) > 0 {
+		availableCond.Message = fmt.Sprintf("%s %s", availableCond.Message, result.Message)
+	}
+	meta.SetStatusCondition(&addon.Status.Conditions, availableCond)
+
+	degradedCond := metav1.Condition{
+		Type:    addonapiv1alpha1.ManagedClusterAddOnConditionDegraded,
+		Status:  metav1.ConditionFalse,
+		Reason:  constants.DegradedReasonProbeNotDegraded,
+		Message: fmt.Sprintf("%s add-on is not degraded.", addon.Name),
+	}
+	if result.Degraded {
+		degradedCond.Status = metav1.ConditionTrue
+		degradedCond.Reason = constants.DegradedReasonProbeDegraded
+		degradedCond.Message = result.Message
+	}
+	meta.SetStatusCondition(&addon.Status.Conditions, degradedCond)
+
+	progressingCond := meta.FindStatusCondition(addon.Status.Conditions,
+		addonapiv1alpha1.ManagedClusterAddOnConditionProgressing)
+	switch {
+	case result.Progressing:
+		meta.SetStatusCondition(&addon.Status.Conditions, metav1.Condition{
+			Type:    addonapiv1alpha1.ManagedClusterAddOnConditionProgressing,
+			Status:  metav1.ConditionTrue,
+			Reason:  constants.ProgressingReasonProbeProgressing,
+			Message: result.Message,
+		})
+	case progressingCond != nil && progressingCond.Reason == constants.ProgressingReasonProbeProgressing:
+		meta.SetStatusCondition(&addon.Status.Conditions, metav1.Condition{
+			Type:    addonapiv1alpha1.ManagedClusterAddOnConditionProgressing,
+			Status:  metav1.ConditionFalse,
+			Reason:  addonapiv1alpha1.ProgressingReasonCompleted,
+			Message: fmt.Sprintf("%s add-on rollout is completed.", addon.Name),
+		})
+	}
+}
+
 // TODO: use wildcard to refactor analyzeDeploymentWorkProber and analyzeWorkloadsWorkProber
 func (s *healthCheckSyncer) analyzeWorkProber(
 	agentAddon agent.AgentAddon,
@@ -328,7 +530,7 @@ func (s *healthCheckSyncer) analyzeWorkloadsWorkProber(
 		return nil, nil, err
 	}
 
-	workloads := utils.FilterWorkloads(manifests)
+	workloads := filterWorkloads(manifests, agentAddon.GetAgentAddonOptions().HealthProber)
 	for _, workload := range workloads {
 		// Not probe the deployment with zero replicas
 		if workload.GroupResource.Group == appsv1.GroupName &&
@@ -337,9 +539,12 @@ func (s *healthCheckSyncer) analyzeWorkloadsWorkProber(
 			workload.DeploymentSpec.Replicas == 0 {
 			continue
 		}
+		// Not probe the statefulset with zero replicas
+		if workload.StatefulSetSpec != nil && workload.StatefulSetSpec.Replicas == 0 {
+			continue
+		}
 
-		manifestConfig := utils.WellKnowManifestConfig(workload.Group, workload.Resource,
-			workload.Namespace, workload.Name)
+		manifestConfig := utils.WorkloadManifestConfig(workload)
 
 		probeFields = append(probeFields, agent.ProbeField{
 			ResourceIdentifier: manifestConfig.ResourceIdentifier,
@@ -347,7 +552,34 @@ func (s *healthCheckSyncer) analyzeWorkloadsWorkProber(
 		})
 	}
 
-	return probeFields, utils.WorkloadAvailabilityHealthChecker, nil
+	resourceProbes := workloadResourceProbes(agentAddon)
+	for _, probe := range resourceProbes {
+		manifestConfig := utils.WorkloadResourceProbeManifestConfig(probe)
+		probeFields = append(probeFields, agent.ProbeField{
+			ResourceIdentifier: manifestConfig.ResourceIdentifier,
+			ProbeRules:         manifestConfig.FeedbackRules,
+		})
+	}
+
+	return probeFields, utils.NewWorkloadAvailabilityHealthChecker(resourceProbes...), nil
+}
+
+// filterWorkloads returns the workloads in the manifests probed by the health prober, the jobs are only probed if
+// the WorkloadProber enables ProbeJobs.
+func filterWorkloads(manifests []runtime.Object, healthProber *agent.HealthProber) []utils.WorkloadMetadata {
+	if healthProber != nil && healthProber.WorkloadProber != nil && healthProber.WorkloadProber.ProbeJobs {
+		return utils.FilterWorkloadsWithJobs(manifests)
+	}
+	return utils.FilterWorkloads(manifests)
+}
+
+// workloadResourceProbes returns the resources declared in the WorkloadProber of the addon.
+func workloadResourceProbes(agentAddon agent.AgentAddon) []agent.WorkloadResourceProbe {
+	healthProber := agentAddon.GetAgentAddonOptions().HealthProber
+	if healthProber == nil || healthProber.WorkloadProber == nil {
+		return nil
+	}
+	return healthProber.WorkloadProber.Resources
 }
 
 func findResultsByIdentifier(identifier workapiv1.ResourceIdentifier,
@@ -370,26 +602,9 @@ func findResultsByIdentifier(identifier workapiv1.ResourceIdentifier,
 	return results
 }
 
-// compare two string, target may include *
-func wildcardMatch(resource, target string) bool {
-	if resource == target || target == "*" {
-		return true
-	}
-
-	pattern := "^" + regexp.QuoteMeta(target) + "$"
-	pattern = strings.ReplaceAll(pattern, "\\*", ".*")
-
-	re, err := regexp.Compile(pattern)
-	if err != nil {
-		return false
-	}
-
-	return re.MatchString(resource)
-}
-
 func resourceMatch(resourceMeta workapiv1.ManifestResourceMeta, resource workapiv1.ResourceIdentifier) bool {
 	return resourceMeta.Group == resource.Group &&
 		resourceMeta.Resource == resource.Resource &&
-		wildcardMatch(resourceMeta.Namespace, resource.Namespace) &&
-		wildcardMatch(resourceMeta.Name, resource.Name)
+		utils.WildcardMatch(resourceMeta.Namespace, resource.Namespace) &&
+		utils.WildcardMatch(resourceMeta.Name, resource.Name)
 }
@@ -2,21 +2,26 @@ package agentdeploy
 
 import (
 	"context"
+	"fmt"
 	"testing"
 	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
+	coordinationv1 "k8s.io/api/coordination/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	coordinationlisters "k8s.io/client-go/listers/coordination/v1"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/utils/ptr"
 	"open-cluster-management.io/addon-framework/pkg/addonmanager/addontesting"
 	"open-cluster-management.io/addon-framework/pkg/addonmanager/constants"
 	"open-cluster-management.io/addon-framework/pkg/agent"
 	"open-cluster-management.io/addon-framework/pkg/index"
+	"open-cluster-management.io/addon-framework/pkg/lease"
 	"open-cluster-management.io/addon-framework/pkg/utils"
 	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
 	fakework "open-cluster-management.io/api/client/work/clientset/versioned/fake"
@@ -1412,3 +1417,320 @@ func newDeploymentsCheckAllProber(deployments ...types.NamespacedName) *agent.He
 		},
 	}
 }
+
+func TestHealthCheckLease(t *testing.T) {
+	newLease := func(renewTime *metav1.MicroTime, annotations map[string]string) *coordinationv1.Lease {
+		return &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "test",
+				Namespace:   "cluster1",
+				Annotations: annotations,
+			},
+			Spec: coordinationv1.LeaseSpec{
+				LeaseDurationSeconds: ptr.To[int32](60),
+				RenewTime:            renewTime,
+			},
+		}
+	}
+
+	cases := []struct {
+		name              string
+		lease             *coordinationv1.Lease
+		leaseProber       *agent.LeaseHealthProber
+		expectedMode      addonapiv1alpha1.HealthCheckMode
+		expectedCondition *metav1.Condition
+		expectedMessage   string
+	}{
+		{
+			name:         "lease probed by the registration agent",
+			lease:        newLease(&metav1.MicroTime{Time: time.Now().Add(-3 * time.Minute)}, nil),
+			expectedMode: addonapiv1alpha1.HealthCheckModeLease,
+		},
+		{
+			name:         "lease not found on hub",
+			leaseProber:  &agent.LeaseHealthProber{},
+			expectedMode: addonapiv1alpha1.HealthCheckModeCustomized,
+			expectedCondition: &metav1.Condition{
+				Status: metav1.ConditionUnknown,
+				Reason: addonapiv1alpha1.AddonAvailableReasonNoProbeResult,
+			},
+		},
+		{
+			name:         "lease is renewed",
+			lease:        newLease(&metav1.MicroTime{Time: time.Now()}, nil),
+			leaseProber:  &agent.LeaseHealthProber{},
+			expectedMode: addonapiv1alpha1.HealthCheckModeCustomized,
+			expectedCondition: &metav1.Condition{
+				Status: metav1.ConditionTrue,
+				Reason: addonapiv1alpha1.AddonAvailableReasonLeaseLeaseUpdated,
+			},
+		},
+		{
+			name:         "lease is expired",
+			lease:        newLease(&metav1.MicroTime{Time: time.Now().Add(-3 * time.Minute)}, nil),
+			leaseProber:  &agent.LeaseHealthProber{},
+			expectedMode: addonapiv1alpha1.HealthCheckModeCustomized,
+			expectedCondition: &metav1.Condition{
+				Status: metav1.ConditionUnknown,
+				Reason: addonapiv1alpha1.AddonAvailableReasonLeaseUpdateStopped,
+			},
+		},
+		{
+			name:         "lease is in grace period",
+			lease:        newLease(&metav1.MicroTime{Time: time.Now().Add(-90 * time.Second)}, nil),
+			leaseProber:  &agent.LeaseHealthProber{},
+			expectedMode: addonapiv1alpha1.HealthCheckModeCustomized,
+			expectedCondition: &metav1.Condition{
+				Status: metav1.ConditionTrue,
+				Reason: addonapiv1alpha1.AddonAvailableReasonLeaseLeaseUpdated,
+			},
+		},
+		{
+			name:         "lease is expired with custom grace period factor",
+			lease:        newLease(&metav1.MicroTime{Time: time.Now().Add(-90 * time.Second)}, nil),
+			leaseProber:  &agent.LeaseHealthProber{GracePeriodFactor: 1},
+			expectedMode: addonapiv1alpha1.HealthCheckModeCustomized,
+			expectedCondition: &metav1.Condition{
+				Status: metav1.ConditionUnknown,
+				Reason: addonapiv1alpha1.AddonAvailableReasonLeaseUpdateStopped,
+			},
+		},
+		{
+			name: "health check fails",
+			lease: newLease(&metav1.MicroTime{Time: time.Unix(0, 0)}, map[string]string{
+				lease.HealthCheckAnnotationKey:        "database",
+				lease.HealthCheckReasonAnnotationKey:  "ConnectionRefused",
+				lease.HealthCheckMessageAnnotationKey: "failed to connect to db",
+			}),
+			leaseProber:  &agent.LeaseHealthProber{},
+			expectedMode: addonapiv1alpha1.HealthCheckModeCustomized,
+			expectedCondition: &metav1.Condition{
+				Status: metav1.ConditionFalse,
+				Reason: constants.AddonAvailableReasonHealthCheckFailed,
+			},
+			expectedMessage: "Health check database failed with reason ConnectionRefused: failed to connect to db",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			if c.lease != nil {
+				if err := indexer.Add(c.lease); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			syncer := healthCheckSyncer{
+				leaseLister: coordinationlisters.NewLeaseLister(indexer),
+				agentAddon: &healthCheckTestAgent{name: "test",
+					health: &agent.HealthProber{Type: agent.HealthProberTypeLease, LeaseProber: c.leaseProber}},
+			}
+
+			addon, err := syncer.sync(context.TODO(), addontesting.NewFakeSyncContext(t), addontesting.NewManagedCluster("cluster1"),
+				addontesting.NewAddon("test", "cluster1"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if addon.Status.HealthCheck.Mode != c.expectedMode {
+				t.Errorf("expected health check mode %s, but got %v", c.expectedMode, addon.Status.HealthCheck.Mode)
+			}
+
+			cond := meta.FindStatusCondition(addon.Status.Conditions, addonapiv1alpha1.ManagedClusterAddOnConditionAvailable)
+			switch {
+			case c.expectedCondition == nil && cond != nil:
+				t.Errorf("expected no available condition, but got %v", cond)
+			case c.expectedCondition != nil && cond == nil:
+				t.Errorf("expected available condition, but got none")
+			case c.expectedCondition != nil:
+				if cond.Status != c.expectedCondition.Status || cond.Reason != c.expectedCondition.Reason {
+					t.Errorf("expected condition %s/%s, but got %s/%s",
+						c.expectedCondition.Status, c.expectedCondition.Reason, cond.Status, cond.Reason)
+				}
+				if len(c.expectedMessage) > 0 && cond.Message != c.expectedMessage {
+					t.Errorf("expected message %q, but got %q", c.expectedMessage, cond.Message)
+				}
+			}
+		})
+	}
+}
+
+func TestHealthCheckResultChecker(t *testing.T) {
+	newWork := func(readyReplicas int64) *v1.ManifestWork {
+		return &v1.ManifestWork{
+			ObjectMeta: metav1.ObjectMeta{Name: "addon-test-deploy-0", Namespace: "cluster1"},
+			Status: v1.ManifestWorkStatus{
+				Conditions: []metav1.Condition{{Type: v1.WorkAvailable, Status: metav1.ConditionTrue}},
+				ResourceStatus: v1.ManifestResourceStatus{
+					Manifests: []v1.ManifestCondition{
+						{
+							ResourceMeta: v1.ManifestResourceMeta{
+								Group: "apps", Resource: "deployments", Name: "test-deployment", Namespace: "default"},
+							StatusFeedbacks: v1.StatusFeedbackResult{
+								Values: []v1.FeedbackValue{
+									{Name: "Replicas", Value: v1.FieldValue{Integer: boolPtr(3)}},
+									{Name: "ReadyReplicas", Value: v1.FieldValue{Integer: boolPtr(readyReplicas)}},
+								},
+							},
+						},
+					},
+				},
+			},
+		}
+	}
+	managerProgressingCondition := metav1.Condition{
+		Type:   addonapiv1alpha1.ManagedClusterAddOnConditionProgressing,
+		Status: metav1.ConditionTrue,
+		Reason: addonapiv1alpha1.ProgressingReasonProgressing,
+	}
+
+	cases := []struct {
+		name                string
+		work                *v1.ManifestWork
+		existingConditions  []metav1.Condition
+		healthProber        *agent.HealthProber
+		resultChecker       agent.AddonHealthResultCheckerFunc
+		expectedAvailable   metav1.ConditionStatus
+		expectedDegraded    metav1.ConditionStatus
+		expectedProgressing *metav1.Condition
+	}{
+		{
+			name:              "all replicas ready",
+			work:              newWork(3),
+			resultChecker:     utils.WorkloadAvailabilityHealthResultChecker,
+			expectedAvailable: metav1.ConditionTrue,
+			expectedDegraded:  metav1.ConditionFalse,
+		},
+		{
+			name:              "degraded",
+			work:              newWork(2),
+			resultChecker:     utils.WorkloadAvailabilityHealthResultChecker,
+			expectedAvailable: metav1.ConditionTrue,
+			expectedDegraded:  metav1.ConditionTrue,
+		},
+		{
+			name:              "unavailable",
+			work:              newWork(0),
+			resultChecker:     utils.WorkloadAvailabilityHealthResultChecker,
+			expectedAvailable: metav1.ConditionFalse,
+			expectedDegraded:  metav1.ConditionFalse,
+		},
+		{
+			name: "workload availability prober reports degraded",
+			work: newWork(2),
+			healthProber: &agent.HealthProber{
+				Type:           agent.HealthProberTypeWorkloadAvailability,
+				WorkloadProber: &agent.WorkloadHealthProber{ReportDegraded: true},
+			},
+			expectedAvailable: metav1.ConditionTrue,
+			expectedDegraded:  metav1.ConditionTrue,
+		},
+		{
+			name:              "workload availability prober does not report degraded by default",
+			work:              newWork(2),
+			healthProber:      &agent.HealthProber{Type: agent.HealthProberTypeWorkloadAvailability},
+			expectedAvailable: metav1.ConditionTrue,
+		},
+		{
+			name:               "manager progressing is kept",
+			work:               newWork(3),
+			existingConditions: []metav1.Condition{managerProgressingCondition},
+			resultChecker:      utils.WorkloadAvailabilityHealthResultChecker,
+			expectedAvailable:  metav1.ConditionTrue,
+			expectedDegraded:   metav1.ConditionFalse,
+			expectedProgressing: &metav1.Condition{
+				Status: metav1.ConditionTrue,
+				Reason: addonapiv1alpha1.ProgressingReasonProgressing,
+			},
+		},
+		{
+			name: "progressing",
+			work: newWork(3),
+			resultChecker: func(_ []agent.FieldResult, _ *clusterv1.ManagedCluster,
+				_ *addonapiv1alpha1.ManagedClusterAddOn) agent.HealthCheckResult {
+				return agent.HealthCheckResult{Available: metav1.ConditionTrue, Progressing: true, Message: "upgrading"}
+			},
+			expectedAvailable: metav1.ConditionTrue,
+			expectedDegraded:  metav1.ConditionFalse,
+			expectedProgressing: &metav1.Condition{
+				Status: metav1.ConditionTrue,
+				Reason: constants.ProgressingReasonProbeProgressing,
+			},
+		},
+		{
+			name: "progressing completed",
+			work: newWork(3),
+			existingConditions: []metav1.Condition{{
+				Type:   addonapiv1alpha1.ManagedClusterAddOnConditionProgressing,
+				Status: metav1.ConditionTrue,
+				Reason: constants.ProgressingReasonProbeProgressing,
+			}},
+			resultChecker:     utils.WorkloadAvailabilityHealthResultChecker,
+			expectedAvailable: metav1.ConditionTrue,
+			expectedDegraded:  metav1.ConditionFalse,
+			expectedProgressing: &metav1.Condition{
+				Status: metav1.ConditionFalse,
+				Reason: addonapiv1alpha1.ProgressingReasonCompleted,
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			mc := utils.DeploymentWellKnowManifestConfig("default", "test-deployment")
+			healthProber := c.healthProber
+			if healthProber == nil {
+				healthProber = &agent.HealthProber{
+					Type: agent.HealthProberTypeWork,
+					WorkProber: &agent.WorkHealthProber{
+						ProbeFields: []agent.ProbeField{
+							{ResourceIdentifier: mc.ResourceIdentifier, ProbeRules: mc.FeedbackRules},
+						},
+						HealthChecker: func(_ []agent.FieldResult, _ *clusterv1.ManagedCluster,
+							_ *addonapiv1alpha1.ManagedClusterAddOn) error {
+							return fmt.Errorf("health checker should be ignored")
+						},
+						HealthResultChecker: c.resultChecker,
+					},
+				}
+			}
+			syncer := healthCheckSyncer{
+				getWorkByAddon: func(_, _ string) ([]*v1.ManifestWork, error) {
+					return []*v1.ManifestWork{c.work}, nil
+				},
+				agentAddon: &healthCheckTestAgent{name: "test", health: healthProber},
+			}
+
+			conditions := append([]metav1.Condition{manifestAppliedCondition}, c.existingConditions...)
+			addon, err := syncer.sync(context.TODO(), addontesting.NewFakeSyncContext(t),
+				addontesting.NewManagedCluster("cluster1"),
+				addontesting.NewAddonWithConditions("test", "cluster1", conditions...))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if cond := meta.FindStatusCondition(addon.Status.Conditions,
+				addonapiv1alpha1.ManagedClusterAddOnConditionAvailable); cond == nil || cond.Status != c.expectedAvailable {
+				t.Errorf("expected available condition %s, but got %v", c.expectedAvailable, cond)
+			}
+			degraded := meta.FindStatusCondition(addon.Status.Conditions, addonapiv1alpha1.ManagedClusterAddOnConditionDegraded)
+			switch {
+			case len(c.expectedDegraded) == 0 && degraded != nil:
+				t.Errorf("expected no degraded condition, but got %v", degraded)
+			case len(c.expectedDegraded) > 0 && (degraded == nil || degraded.Status != c.expectedDegraded):
+				t.Errorf("expected degraded condition %s, but got %v", c.expectedDegraded, degraded)
+			}
+
+			progressing := meta.FindStatusCondition(addon.Status.Conditions,
+				addonapiv1alpha1.ManagedClusterAddOnConditionProgressing)
+			switch {
+			case c.expectedProgressing == nil && progressing != nil:
+				t.Errorf("expected no progressing condition, but got %v", progressing)
+			case c.expectedProgressing != nil && (progressing == nil || progressing.Status != c.expectedProgressing.Status ||
+				progressing.Reason != c.expectedProgressing.Reason):
+				t.Errorf("expected progressing condition %s/%s, but got %v",
+					c.expectedProgressing.Status, c.expectedProgressing.Reason, progressing)
+			}
+		})
+	}
+}
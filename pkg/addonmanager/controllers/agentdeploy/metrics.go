@@ -0,0 +1,23 @@
+package agentdeploy
+
+import (
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+)
+
+var (
+	// endpointProbeDurationSeconds records the latency of the probes of the agent health endpoints, labeled by
+	// the status of the Available condition the probe results in.
+	endpointProbeDurationSeconds = metrics.NewHistogramVec(
+		&metrics.HistogramOpts{
+			Name:    "addon_agent_health_endpoint_probe_duration_seconds",
+			Help:    "Latency in seconds of the probes of the addon agent health endpoints, labeled by cluster, addon and result.",
+			Buckets: metrics.ExponentialBuckets(0.01, 2, 10),
+		},
+		[]string{"cluster", "addon", "result"},
+	)
+)
+
+func init() {
+	legacyregistry.MustRegister(endpointProbeDurationSeconds)
+}
@@ -5,6 +5,9 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
@@ -265,6 +268,136 @@ func TestGetManifestConfigOption(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "workload availability type without probing jobs",
+			agentAddon: &testAgent{
+				name: "test",
+				objects: []runtime.Object{
+					&batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "test-job", Namespace: "default"}},
+				},
+				healthProber: &agent.HealthProber{
+					Type: agent.HealthProberTypeWorkloadAvailability,
+				},
+			},
+			expectedManifestConfigOption: []workapiv1.ManifestConfigOption{},
+		},
+		{
+			name: "workload availability type with statefulset, job and custom resource",
+			agentAddon: &testAgent{
+				name: "test",
+				objects: []runtime.Object{
+					&appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "test-statefulset", Namespace: "default"}},
+					&batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "test-job", Namespace: "default"}},
+					addontesting.NewHookJob("test-hook", "default"),
+				},
+				healthProber: &agent.HealthProber{
+					Type: agent.HealthProberTypeWorkloadAvailability,
+					WorkloadProber: &agent.WorkloadHealthProber{
+						ProbeJobs: true,
+						Resources: []agent.WorkloadResourceProbe{
+							{
+								ResourceIdentifier: workapiv1.ResourceIdentifier{
+									Group:     "example.io",
+									Resource:  "gateways",
+									Name:      "*",
+									Namespace: "default",
+								},
+								ConditionType: "Ready",
+								JsonPaths: []agent.ExpectedJsonPath{
+									{JsonPath: workapiv1.JsonPath{Name: "phase", Path: ".phase"}, Value: "Running"},
+								},
+							},
+						},
+					},
+				},
+			},
+			expectedManifestConfigOption: []workapiv1.ManifestConfigOption{
+				{
+					ResourceIdentifier: workapiv1.ResourceIdentifier{
+						Group:     "apps",
+						Resource:  "statefulsets",
+						Name:      "test-statefulset",
+						Namespace: "default",
+					},
+					FeedbackRules: []workapiv1.FeedbackRule{
+						{
+							Type: workapiv1.JSONPathsType,
+							JsonPaths: []workapiv1.JsonPath{
+								{Name: "ReadyReplicas", Path: ".readyReplicas"},
+								{Name: "UpdatedReplicas", Path: ".updatedReplicas"},
+								{Name: "Replicas", Path: ".replicas"},
+							},
+						},
+					},
+				},
+				{
+					ResourceIdentifier: workapiv1.ResourceIdentifier{
+						Group:     "batch",
+						Resource:  "jobs",
+						Name:      "test-job",
+						Namespace: "default",
+					},
+					FeedbackRules: []workapiv1.FeedbackRule{
+						{
+							Type: workapiv1.WellKnownStatusType,
+						},
+					},
+				},
+				{
+					ResourceIdentifier: workapiv1.ResourceIdentifier{
+						Group:     "example.io",
+						Resource:  "gateways",
+						Name:      "*",
+						Namespace: "default",
+					},
+					FeedbackRules: []workapiv1.FeedbackRule{
+						{
+							Type: workapiv1.JSONPathsType,
+							JsonPaths: []workapiv1.JsonPath{
+								{Name: "ConditionReady", Path: `.conditions[?(@.type=="Ready")].status`},
+								{Name: "phase", Path: ".phase"},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "composite type",
+			agentAddon: &testAgent{
+				name: "test",
+				objects: []runtime.Object{
+					NewFakeDeployment("test-deployment", "default"),
+				},
+				healthProber: &agent.HealthProber{
+					Type: agent.HealthProberTypeComposite,
+					CompositeProber: &agent.CompositeHealthProber{
+						Probers: []agent.CompositeSubProber{
+							{Name: "lease", Prober: &agent.HealthProber{Type: agent.HealthProberTypeLease}},
+							{Name: "deployments", Prober: &agent.HealthProber{
+								Type: agent.HealthProberTypeDeploymentAvailability}},
+							{Name: "workloads", Prober: &agent.HealthProber{
+								Type: agent.HealthProberTypeWorkloadAvailability}},
+						},
+					},
+				},
+			},
+			expectedManifestConfigOption: []workapiv1.ManifestConfigOption{
+				{
+					ResourceIdentifier: workapiv1.ResourceIdentifier{
+						Group:     "apps",
+						Resource:  "deployments",
+						Name:      "test-deployment",
+						Namespace: "default",
+					},
+					FeedbackRules: []workapiv1.FeedbackRule{
+						{
+							Type: workapiv1.WellKnownStatusType,
+						},
+					},
+				},
+			},
+		},
 		{
 			name: "set updater",
 			agentAddon: &testAgent{
@@ -682,3 +815,46 @@ func TestMergeFeedbackRule(t *testing.T) {
 		})
 	}
 }
+
+func TestGetEffectiveImages(t *testing.T) {
+	deployment := &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Name: "agent", Namespace: "default"},
+		Spec: appsv1.DeploymentSpec{
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					InitContainers: []corev1.Container{{Name: "init", Image: "quay.io/ocm/init:v1"}},
+					Containers: []corev1.Container{
+						{Name: "agent", Image: "quay.io/ocm/agent:v1"},
+						{Name: "sidecar", Image: "quay.io/ocm/sidecar:v1"},
+					},
+				},
+			},
+		},
+	}
+
+	cronJob := addontesting.NewUnstructured("batch/v1", "CronJob", "default", "cleanup")
+	cronJob.Object["spec"] = map[string]interface{}{
+		"jobTemplate": map[string]interface{}{
+			"spec": map[string]interface{}{
+				"template": map[string]interface{}{
+					"spec": map[string]interface{}{
+						"containers": []interface{}{
+							map[string]interface{}{"name": "cleanup", "image": "quay.io/ocm/agent:v1"},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	images, err := getEffectiveImages([]runtime.Object{
+		deployment,
+		cronJob,
+		addontesting.NewUnstructured("v1", "ConfigMap", "default", "config"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"quay.io/ocm/agent:v1", "quay.io/ocm/init:v1", "quay.io/ocm/sidecar:v1"}, images)
+}
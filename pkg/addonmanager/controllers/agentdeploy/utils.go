@@ -9,6 +9,7 @@ import (
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/klog/v2"
 	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
 	clusterv1 "open-cluster-management.io/api/cluster/v1"
@@ -481,48 +482,10 @@ func newAddonWorkObjectMeta(namePrefix, addonName, addonNamespace, workNamespace
 func getManifestConfigOption(agentAddon agent.AgentAddon,
 	cluster *clusterv1.ManagedCluster,
 	addon *addonapiv1alpha1.ManagedClusterAddOn) ([]workapiv1.ManifestConfigOption, error) {
-	manifestConfigs := []workapiv1.ManifestConfigOption{}
-
-	if agentAddon.GetAgentAddonOptions().HealthProber != nil &&
-		agentAddon.GetAgentAddonOptions().HealthProber.Type == agent.HealthProberTypeWork &&
-		agentAddon.GetAgentAddonOptions().HealthProber.WorkProber != nil {
-		probeRules := agentAddon.GetAgentAddonOptions().HealthProber.WorkProber.ProbeFields
-		for _, rule := range probeRules {
-			manifestConfigs = append(manifestConfigs, workapiv1.ManifestConfigOption{
-				ResourceIdentifier: rule.ResourceIdentifier,
-				FeedbackRules:      rule.ProbeRules,
-			})
-		}
-	}
-
-	if agentAddon.GetAgentAddonOptions().HealthProber != nil &&
-		agentAddon.GetAgentAddonOptions().HealthProber.Type == agent.HealthProberTypeDeploymentAvailability {
-
-		manifests, err := agentAddon.Manifests(cluster, addon)
-		if err != nil {
-			return manifestConfigs, fmt.Errorf("get all deployments error: %v", err)
-		}
-
-		deployments := utils.FilterDeployments(manifests)
-		for _, deployment := range deployments {
-			manifestConfig := utils.DeploymentWellKnowManifestConfig(deployment.Namespace, deployment.Name)
-			manifestConfigs = append(manifestConfigs, manifestConfig)
-		}
-	}
-
-	if agentAddon.GetAgentAddonOptions().HealthProber != nil &&
-		agentAddon.GetAgentAddonOptions().HealthProber.Type == agent.HealthProberTypeWorkloadAvailability {
-
-		manifests, err := agentAddon.Manifests(cluster, addon)
-		if err != nil {
-			return manifestConfigs, fmt.Errorf("get all workloads error: %v", err)
-		}
-		workloads := utils.FilterWorkloads(manifests)
-		for _, workload := range workloads {
-			manifestConfig := utils.WellKnowManifestConfig(workload.Group, workload.Resource,
-				workload.Namespace, workload.Name)
-			manifestConfigs = append(manifestConfigs, manifestConfig)
-		}
+	manifestConfigs, err := healthProberManifestConfigs(agentAddon, agentAddon.GetAgentAddonOptions().HealthProber,
+		cluster, addon)
+	if err != nil {
+		return manifestConfigs, err
 	}
 
 	if updaters := agentAddon.GetAgentAddonOptions().Updaters; updaters != nil {
@@ -555,6 +518,80 @@ func getManifestConfigOption(agentAddon agent.AgentAddon,
 	return manifestConfigs, nil
 }
 
+// healthProberManifestConfigs returns the manifest configs with the feedback rules required by the health prober,
+// including the ones of the sub-probers of a composite health prober.
+func healthProberManifestConfigs(agentAddon agent.AgentAddon, healthProber *agent.HealthProber,
+	cluster *clusterv1.ManagedCluster,
+	addon *addonapiv1alpha1.ManagedClusterAddOn) ([]workapiv1.ManifestConfigOption, error) {
+	manifestConfigs := []workapiv1.ManifestConfigOption{}
+	if healthProber == nil {
+		return manifestConfigs, nil
+	}
+
+	switch healthProber.Type {
+	case agent.HealthProberTypeWork:
+		if healthProber.WorkProber == nil {
+			break
+		}
+		for _, rule := range healthProber.WorkProber.ProbeFields {
+			manifestConfigs = append(manifestConfigs, workapiv1.ManifestConfigOption{
+				ResourceIdentifier: rule.ResourceIdentifier,
+				FeedbackRules:      rule.ProbeRules,
+			})
+		}
+	case agent.HealthProberTypeDeploymentAvailability:
+		manifests, err := agentAddon.Manifests(cluster, addon)
+		if err != nil {
+			return manifestConfigs, fmt.Errorf("get all deployments error: %v", err)
+		}
+
+		deployments := utils.FilterDeployments(manifests)
+		for _, deployment := range deployments {
+			manifestConfig := utils.DeploymentWellKnowManifestConfig(deployment.Namespace, deployment.Name)
+			manifestConfigs = append(manifestConfigs, manifestConfig)
+		}
+	case agent.HealthProberTypeWorkloadAvailability:
+		manifests, err := agentAddon.Manifests(cluster, addon)
+		if err != nil {
+			return manifestConfigs, fmt.Errorf("get all workloads error: %v", err)
+		}
+		workloads := filterWorkloads(manifests, healthProber)
+		for _, workload := range workloads {
+			manifestConfigs = append(manifestConfigs, utils.WorkloadManifestConfig(workload))
+		}
+		if healthProber.WorkloadProber != nil {
+			for _, probe := range healthProber.WorkloadProber.Resources {
+				manifestConfigs = append(manifestConfigs, utils.WorkloadResourceProbeManifestConfig(probe))
+			}
+		}
+	case agent.HealthProberTypeComposite:
+		if healthProber.CompositeProber == nil {
+			break
+		}
+		for _, subProber := range healthProber.CompositeProber.Probers {
+			// the unsupported sub-probers are reported by the health check
+			if subProber.Prober == nil || agent.ValidateCompositeSubProber(subProber) != nil {
+				continue
+			}
+			subManifestConfigs, err := healthProberManifestConfigs(agentAddon, subProber.Prober, cluster, addon)
+			if err != nil {
+				return manifestConfigs, err
+			}
+			for _, mc := range subManifestConfigs {
+				index := containsResourceIdentifier(manifestConfigs, mc.ResourceIdentifier)
+				if index == -1 {
+					manifestConfigs = append(manifestConfigs, mc)
+					continue
+				}
+				for _, rule := range mc.FeedbackRules {
+					manifestConfigs[index].FeedbackRules = mergeFeedbackRule(manifestConfigs[index].FeedbackRules, rule)
+				}
+			}
+		}
+	}
+	return manifestConfigs, nil
+}
+
 func containsResourceIdentifier(mcs []workapiv1.ManifestConfigOption, ri workapiv1.ResourceIdentifier) int {
 	for index, mc := range mcs {
 		if mc.ResourceIdentifier == ri {
@@ -683,3 +720,40 @@ func ConfigsToMap(configReference []addonapiv1alpha1.ConfigReference) map[string
 
 	return specHashMap
 }
+
+// podSpecPaths are the paths of the pod spec in the workloads, for example: the Pod, the Deployment, and the CronJob.
+var podSpecPaths = [][]string{
+	{"spec"},
+	{"spec", "template", "spec"},
+	{"spec", "jobTemplate", "spec", "template", "spec"},
+}
+
+// getEffectiveImages returns the sorted images of the containers and init containers of the workloads in the objects.
+func getEffectiveImages(objects []runtime.Object) ([]string, error) {
+	images := sets.New[string]()
+	for _, obj := range objects {
+		content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, path := range podSpecPaths {
+			for _, field := range []string{"containers", "initContainers"} {
+				containers, found, err := unstructured.NestedSlice(content, append(path, field)...)
+				if err != nil || !found {
+					continue
+				}
+				for _, container := range containers {
+					c, ok := container.(map[string]interface{})
+					if !ok {
+						continue
+					}
+					if image, ok := c["image"].(string); ok && len(image) > 0 {
+						images.Insert(image)
+					}
+				}
+			}
+		}
+	}
+	return sets.List(images), nil
+}
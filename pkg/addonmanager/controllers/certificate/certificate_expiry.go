@@ -0,0 +1,332 @@
+package certificate
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	certificatesv1 "k8s.io/api/certificates/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	certificatesinformers "k8s.io/client-go/informers/certificates/v1"
+	certificateslisters "k8s.io/client-go/listers/certificates/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	addonv1alpha1client "open-cluster-management.io/api/client/addon/clientset/versioned"
+	addoninformerv1alpha1 "open-cluster-management.io/api/client/addon/informers/externalversions/addon/v1alpha1"
+	addonlisterv1alpha1 "open-cluster-management.io/api/client/addon/listers/addon/v1alpha1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+	"open-cluster-management.io/sdk-go/pkg/patcher"
+
+	"open-cluster-management.io/addon-framework/pkg/agent"
+	"open-cluster-management.io/addon-framework/pkg/utils"
+	"open-cluster-management.io/sdk-go/pkg/basecontroller/factory"
+)
+
+const (
+	// ClientCertificatesAnnotationKey is the annotation key on the ManagedClusterAddOn recording the latest client
+	// certificate issued to the addon agent for each signer. The value is a json list of ClientCertificateInfo.
+	ClientCertificatesAnnotationKey = "addon.open-cluster-management.io/client-certificates"
+
+	// ManagedClusterAddOnConditionCertificateExpiringSoon is a condition type representing whether one of the
+	// client certificates issued to the addon agent is about to expire without being rotated.
+	ManagedClusterAddOnConditionCertificateExpiringSoon = "CertificateExpiringSoon"
+
+	// the reasons of condition ManagedClusterAddOnConditionCertificateExpiringSoon
+	CertificateExpiringSoonReasonValid        = "CertificatesValid"
+	CertificateExpiringSoonReasonExpiringSoon = "CertificateExpiringSoon"
+	CertificateExpiringSoonReasonExpired      = "CertificateExpired"
+)
+
+var (
+	// CertificateExpiringSoonThreshold is the fraction of the certificate lifetime left under which the
+	// certificate is considered as expiring soon. The agent normally rotates its client certificate when 70%~90%
+	// of the lifetime has passed, so a certificate crossing this threshold means the rotation is not working.
+	CertificateExpiringSoonThreshold = 0.1
+
+	// certificateExpiryResyncInterval is the interval to refresh the certificate age metrics and conditions.
+	certificateExpiryResyncInterval = 10 * time.Minute
+)
+
+// ClientCertificateInfo describes a client certificate issued to an addon agent.
+type ClientCertificateInfo struct {
+	SignerName   string      `json:"signerName"`
+	SerialNumber string      `json:"serialNumber"`
+	NotBefore    metav1.Time `json:"notBefore"`
+	NotAfter     metav1.Time `json:"notAfter"`
+}
+
+// certificateExpiryController tracks the client certificates issued to the addon agents, either signed by the
+// csrSignController or by the kube-controller-manager after the csr is approved by the csrApprovingController.
+// It records the latest certificate of each signer on the ManagedClusterAddOn, sets the CertificateExpiringSoon
+// condition and exposes the age of the certificates as metrics.
+type certificateExpiryController struct {
+	addonClient               addonv1alpha1client.Interface
+	agentAddons               map[string]agent.AgentAddon
+	managedClusterAddonLister addonlisterv1alpha1.ManagedClusterAddOnLister
+	csrLister                 certificateslisters.CertificateSigningRequestLister
+	mcaFilterFunc             utils.ManagedClusterAddOnFilterFunc
+}
+
+// NewCertificateExpiryController creates a new certificate expiry controller
+func NewCertificateExpiryController(
+	addonClient addonv1alpha1client.Interface,
+	csrInformer certificatesinformers.CertificateSigningRequestInformer,
+	addonInformers addoninformerv1alpha1.ManagedClusterAddOnInformer,
+	agentAddons map[string]agent.AgentAddon,
+	mcaFilterFunc utils.ManagedClusterAddOnFilterFunc,
+) factory.Controller {
+	c := &certificateExpiryController{
+		addonClient:               addonClient,
+		agentAddons:               agentAddons,
+		managedClusterAddonLister: addonInformers.Lister(),
+		csrLister:                 csrInformer.Lister(),
+		mcaFilterFunc:             mcaFilterFunc,
+	}
+	return factory.New().
+		WithFilteredEventsInformersQueueKeysFunc(
+			func(obj runtime.Object) []string {
+				accessor, _ := meta.Accessor(obj)
+				return []string{fmt.Sprintf("%s/%s",
+					accessor.GetLabels()[clusterv1.ClusterNameLabelKey], accessor.GetLabels()[addonapiv1alpha1.AddonLabelKey])}
+			},
+			func(obj interface{}) bool {
+				accessor, _ := meta.Accessor(obj)
+				if !strings.HasPrefix(accessor.GetName(), "addon") {
+					return false
+				}
+				if len(accessor.GetLabels()[clusterv1.ClusterNameLabelKey]) == 0 {
+					return false
+				}
+				if _, ok := agentAddons[accessor.GetLabels()[addonapiv1alpha1.AddonLabelKey]]; !ok {
+					return false
+				}
+				return true
+			},
+			csrInformer.Informer()).
+		WithFilteredEventsInformersQueueKeysFunc(
+			func(obj runtime.Object) []string {
+				key, _ := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+				return []string{key}
+			},
+			func(obj interface{}) bool {
+				accessor, _ := meta.Accessor(obj)
+				_, ok := agentAddons[accessor.GetName()]
+				return ok
+			},
+			addonInformers.Informer()).
+		WithSync(c.sync).
+		ToController("CertificateExpiryController")
+}
+
+func (c *certificateExpiryController) sync(ctx context.Context, syncCtx factory.SyncContext, key string) error {
+	klog.V(4).Infof("Reconciling client certificates of addon %q", key)
+
+	clusterName, addonName, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		// ignore addon whose key is not in format: namespace/name
+		return nil
+	}
+
+	if _, ok := c.agentAddons[addonName]; !ok {
+		return nil
+	}
+
+	addon, err := c.managedClusterAddonLister.ManagedClusterAddOns(clusterName).Get(addonName)
+	if errors.IsNotFound(err) {
+		deleteClientCertificateMetrics(clusterName, addonName)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if c.mcaFilterFunc != nil && !c.mcaFilterFunc(addon) {
+		return nil
+	}
+
+	csrs, err := c.csrLister.List(labels.SelectorFromSet(labels.Set{
+		clusterv1.ClusterNameLabelKey:  clusterName,
+		addonapiv1alpha1.AddonLabelKey: addonName,
+	}))
+	if err != nil {
+		return err
+	}
+
+	// the csrs are garbage collected after a while, the certificates recorded on the addon are kept tracking
+	// until the agent rotates them.
+	certs := latestClientCertificates(recordedClientCertificates(addon), csrs)
+	if len(certs) == 0 {
+		syncCtx.Queue().AddAfter(key, certificateExpiryResyncInterval)
+		return nil
+	}
+
+	now := time.Now()
+	for _, cert := range certs {
+		clientCertificateAgeSeconds.WithLabelValues(clusterName, addonName, cert.SignerName).Set(
+			now.Sub(cert.NotBefore.Time).Seconds())
+		clientCertificateExpirationSeconds.WithLabelValues(clusterName, addonName, cert.SignerName).Set(
+			float64(cert.NotAfter.Unix()))
+	}
+
+	certsData, err := json.Marshal(certs)
+	if err != nil {
+		return err
+	}
+
+	addonCopy := addon.DeepCopy()
+	addonPatcher := patcher.NewPatcher[
+		*addonapiv1alpha1.ManagedClusterAddOn,
+		addonapiv1alpha1.ManagedClusterAddOnSpec,
+		addonapiv1alpha1.ManagedClusterAddOnStatus](c.addonClient.AddonV1alpha1().ManagedClusterAddOns(clusterName))
+
+	if addonCopy.Annotations == nil {
+		addonCopy.Annotations = map[string]string{}
+	}
+	addonCopy.Annotations[ClientCertificatesAnnotationKey] = string(certsData)
+	annotationChanged, err := addonPatcher.PatchLabelAnnotations(ctx, addonCopy, addonCopy.ObjectMeta, addon.ObjectMeta)
+	if annotationChanged {
+		if err != nil {
+			return fmt.Errorf("failed to patch client certificates annotation of managedclusteraddon: %w", err)
+		}
+		// the condition is patched in the next reconcile triggered by the annotation change
+		syncCtx.Queue().AddAfter(key, certificateExpiryResyncInterval)
+		return nil
+	}
+
+	condition, requeueAfter := certificateExpiringSoonCondition(certs, now)
+	meta.SetStatusCondition(&addonCopy.Status.Conditions, condition)
+	if _, err := addonPatcher.PatchStatus(ctx, addonCopy, addonCopy.Status, addon.Status); err != nil {
+		return fmt.Errorf("failed to patch status condition(certificate expiring soon) of managedclusteraddon: %w", err)
+	}
+
+	if requeueAfter <= 0 || requeueAfter > certificateExpiryResyncInterval {
+		requeueAfter = certificateExpiryResyncInterval
+	}
+	syncCtx.Queue().AddAfter(key, requeueAfter)
+	return nil
+}
+
+// recordedClientCertificates returns the client certificates recorded in the annotation of the addon.
+func recordedClientCertificates(addon *addonapiv1alpha1.ManagedClusterAddOn) []ClientCertificateInfo {
+	data, ok := addon.Annotations[ClientCertificatesAnnotationKey]
+	if !ok {
+		return nil
+	}
+	var certs []ClientCertificateInfo
+	if err := json.Unmarshal([]byte(data), &certs); err != nil {
+		klog.Warningf("failed to parse client certificates annotation of addon %s/%s: %v", addon.Namespace, addon.Name, err)
+		return nil
+	}
+	return certs
+}
+
+// latestClientCertificates returns the certificate with the latest expiry of each signer from the recorded
+// certificates and the csrs, the result is sorted by the signer name.
+func latestClientCertificates(recorded []ClientCertificateInfo,
+	csrs []*certificatesv1.CertificateSigningRequest) []ClientCertificateInfo {
+	latest := map[string]ClientCertificateInfo{}
+	for _, cert := range recorded {
+		if current, ok := latest[cert.SignerName]; ok && !cert.NotAfter.After(current.NotAfter.Time) {
+			continue
+		}
+		latest[cert.SignerName] = cert
+	}
+	for _, csr := range csrs {
+		if len(csr.Status.Certificate) == 0 {
+			continue
+		}
+		cert, err := parseLeafCertificate(csr.Status.Certificate)
+		if err != nil {
+			klog.Warningf("failed to parse certificate of csr %q: %v", csr.Name, err)
+			continue
+		}
+		if current, ok := latest[csr.Spec.SignerName]; ok && !cert.NotAfter.After(current.NotAfter.Time) {
+			continue
+		}
+		latest[csr.Spec.SignerName] = ClientCertificateInfo{
+			SignerName:   csr.Spec.SignerName,
+			SerialNumber: cert.SerialNumber.Text(16),
+			NotBefore:    metav1.NewTime(cert.NotBefore),
+			NotAfter:     metav1.NewTime(cert.NotAfter),
+		}
+	}
+
+	certs := make([]ClientCertificateInfo, 0, len(latest))
+	for _, cert := range latest {
+		certs = append(certs, cert)
+	}
+	sort.Slice(certs, func(i, j int) bool {
+		return certs[i].SignerName < certs[j].SignerName
+	})
+	return certs
+}
+
+// certificateExpiringSoonCondition builds the CertificateExpiringSoon condition of the certificates, and returns
+// the duration after which the condition should be re-evaluated.
+func certificateExpiringSoonCondition(certs []ClientCertificateInfo, now time.Time) (metav1.Condition, time.Duration) {
+	var expired, expiring []string
+	var requeueAfter time.Duration
+	for _, cert := range certs {
+		lifetime := cert.NotAfter.Sub(cert.NotBefore.Time)
+		threshold := cert.NotAfter.Add(-time.Duration(float64(lifetime) * CertificateExpiringSoonThreshold))
+		switch {
+		case !now.Before(cert.NotAfter.Time):
+			expired = append(expired, cert.SignerName)
+		case !now.Before(threshold):
+			expiring = append(expiring, cert.SignerName)
+			if d := cert.NotAfter.Sub(now); requeueAfter == 0 || d < requeueAfter {
+				requeueAfter = d
+			}
+		default:
+			if d := threshold.Sub(now); requeueAfter == 0 || d < requeueAfter {
+				requeueAfter = d
+			}
+		}
+	}
+
+	switch {
+	case len(expired) > 0:
+		return metav1.Condition{
+			Type:    ManagedClusterAddOnConditionCertificateExpiringSoon,
+			Status:  metav1.ConditionTrue,
+			Reason:  CertificateExpiringSoonReasonExpired,
+			Message: fmt.Sprintf("Client certificates of signers %s are expired", strings.Join(expired, ",")),
+		}, requeueAfter
+	case len(expiring) > 0:
+		return metav1.Condition{
+			Type:    ManagedClusterAddOnConditionCertificateExpiringSoon,
+			Status:  metav1.ConditionTrue,
+			Reason:  CertificateExpiringSoonReasonExpiringSoon,
+			Message: fmt.Sprintf("Client certificates of signers %s are expiring soon", strings.Join(expiring, ",")),
+		}, requeueAfter
+	default:
+		return metav1.Condition{
+			Type:    ManagedClusterAddOnConditionCertificateExpiringSoon,
+			Status:  metav1.ConditionFalse,
+			Reason:  CertificateExpiringSoonReasonValid,
+			Message: "Client certificates of the addon agent are valid",
+		}, requeueAfter
+	}
+}
+
+func parseLeafCertificate(data []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("PEM block type must be CERTIFICATE")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+func deleteClientCertificateMetrics(clusterName, addonName string) {
+	clientCertificateAgeSeconds.DeletePartialMatch(map[string]string{"cluster": clusterName, "addon": addonName})
+	clientCertificateExpirationSeconds.DeletePartialMatch(map[string]string{"cluster": clusterName, "addon": addonName})
+}
@@ -0,0 +1,276 @@
+package certificate
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	certv1 "k8s.io/api/certificates/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubeinformers "k8s.io/client-go/informers"
+	fakekube "k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	fakeaddon "open-cluster-management.io/api/client/addon/clientset/versioned/fake"
+	addoninformers "open-cluster-management.io/api/client/addon/informers/externalversions"
+
+	"open-cluster-management.io/addon-framework/pkg/addonmanager/addontesting"
+	"open-cluster-management.io/addon-framework/pkg/agent"
+)
+
+func newTestCertificate(t *testing.T, serial int64, notBefore, notAfter time.Time) []byte {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func newIssuedCSR(name, addon, cluster, signer string, cert []byte) *certv1.CertificateSigningRequest {
+	csr := addontesting.NewApprovedCSR(addon, cluster)
+	csr.Name = name
+	csr.Spec.SignerName = signer
+	csr.Status.Certificate = cert
+	return csr
+}
+
+func TestCertificateExpiryReconcile(t *testing.T) {
+	now := time.Now()
+	validCert := newTestCertificate(t, 10, now.Add(-1*time.Hour), now.Add(9*time.Hour))
+	expiringCert := newTestCertificate(t, 11, now.Add(-95*time.Hour), now.Add(5*time.Hour))
+	expiredCert := newTestCertificate(t, 12, now.Add(-10*time.Hour), now.Add(-1*time.Hour))
+
+	cases := []struct {
+		name                 string
+		addon                []runtime.Object
+		csr                  []runtime.Object
+		validateAddonActions func(t *testing.T, actions []clienttesting.Action)
+	}{
+		{
+			name:                 "no addon",
+			csr:                  []runtime.Object{newIssuedCSR("addon-test-1", "test", "cluster1", certv1.KubeAPIServerClientSignerName, validCert)},
+			validateAddonActions: addontesting.AssertNoActions,
+		},
+		{
+			name:                 "no issued certificate",
+			addon:                []runtime.Object{addontesting.NewAddon("test", "cluster1")},
+			csr:                  []runtime.Object{addontesting.NewApprovedCSR("test", "cluster1")},
+			validateAddonActions: addontesting.AssertNoActions,
+		},
+		{
+			name:  "record latest certificates",
+			addon: []runtime.Object{addontesting.NewAddon("test", "cluster1")},
+			csr: []runtime.Object{
+				newIssuedCSR("addon-test-1", "test", "cluster1", certv1.KubeAPIServerClientSignerName, expiredCert),
+				newIssuedCSR("addon-test-2", "test", "cluster1", certv1.KubeAPIServerClientSignerName, validCert),
+				newIssuedCSR("addon-test-3", "test", "cluster1", "example.com/signer", expiringCert),
+			},
+			validateAddonActions: func(t *testing.T, actions []clienttesting.Action) {
+				addontesting.AssertActions(t, actions, "patch")
+				patch := actions[0].(clienttesting.PatchActionImpl).Patch
+				addon := &addonapiv1alpha1.ManagedClusterAddOn{}
+				if err := json.Unmarshal(patch, addon); err != nil {
+					t.Fatal(err)
+				}
+				certs := []ClientCertificateInfo{}
+				if err := json.Unmarshal([]byte(addon.Annotations[ClientCertificatesAnnotationKey]), &certs); err != nil {
+					t.Fatal(err)
+				}
+				if len(certs) != 2 {
+					t.Fatalf("expected 2 certificates, but got %v", certs)
+				}
+				if certs[0].SignerName != "example.com/signer" || certs[0].SerialNumber != "b" {
+					t.Errorf("unexpected certificate %v", certs[0])
+				}
+				if certs[1].SignerName != certv1.KubeAPIServerClientSignerName || certs[1].SerialNumber != "a" {
+					t.Errorf("unexpected certificate %v", certs[1])
+				}
+			},
+		},
+		{
+			name: "certificate expiring soon",
+			addon: []runtime.Object{func() *addonapiv1alpha1.ManagedClusterAddOn {
+				addon := addontesting.NewAddon("test", "cluster1")
+				certs, _ := json.Marshal(latestClientCertificates(nil, []*certv1.CertificateSigningRequest{
+					newIssuedCSR("addon-test-1", "test", "cluster1", certv1.KubeAPIServerClientSignerName, expiringCert),
+				}))
+				addon.Annotations = map[string]string{ClientCertificatesAnnotationKey: string(certs)}
+				return addon
+			}()},
+			csr: []runtime.Object{
+				newIssuedCSR("addon-test-1", "test", "cluster1", certv1.KubeAPIServerClientSignerName, expiringCert),
+			},
+			validateAddonActions: func(t *testing.T, actions []clienttesting.Action) {
+				addontesting.AssertActions(t, actions, "patch")
+				patch := actions[0].(clienttesting.PatchActionImpl).Patch
+				addon := &addonapiv1alpha1.ManagedClusterAddOn{}
+				if err := json.Unmarshal(patch, addon); err != nil {
+					t.Fatal(err)
+				}
+				cond := meta.FindStatusCondition(addon.Status.Conditions, ManagedClusterAddOnConditionCertificateExpiringSoon)
+				if cond == nil || cond.Status != metav1.ConditionTrue || cond.Reason != CertificateExpiringSoonReasonExpiringSoon {
+					t.Errorf("unexpected condition %v", cond)
+				}
+			},
+		},
+		{
+			name: "csrs cleaned up",
+			addon: []runtime.Object{func() *addonapiv1alpha1.ManagedClusterAddOn {
+				addon := addontesting.NewAddon("test", "cluster1")
+				certs, _ := json.Marshal(latestClientCertificates(nil, []*certv1.CertificateSigningRequest{
+					newIssuedCSR("addon-test-1", "test", "cluster1", certv1.KubeAPIServerClientSignerName, expiredCert),
+				}))
+				addon.Annotations = map[string]string{ClientCertificatesAnnotationKey: string(certs)}
+				return addon
+			}()},
+			validateAddonActions: func(t *testing.T, actions []clienttesting.Action) {
+				addontesting.AssertActions(t, actions, "patch")
+				patch := actions[0].(clienttesting.PatchActionImpl).Patch
+				addon := &addonapiv1alpha1.ManagedClusterAddOn{}
+				if err := json.Unmarshal(patch, addon); err != nil {
+					t.Fatal(err)
+				}
+				if len(addon.Annotations) != 0 {
+					t.Errorf("expected the recorded certificates kept, but got %v", addon.Annotations)
+				}
+				cond := meta.FindStatusCondition(addon.Status.Conditions, ManagedClusterAddOnConditionCertificateExpiringSoon)
+				if cond == nil || cond.Status != metav1.ConditionTrue || cond.Reason != CertificateExpiringSoonReasonExpired {
+					t.Errorf("unexpected condition %v", cond)
+				}
+			},
+		},
+		{
+			name: "recorded certificate rotated",
+			addon: []runtime.Object{func() *addonapiv1alpha1.ManagedClusterAddOn {
+				addon := addontesting.NewAddon("test", "cluster1")
+				certs, _ := json.Marshal(latestClientCertificates(nil, []*certv1.CertificateSigningRequest{
+					newIssuedCSR("addon-test-1", "test", "cluster1", certv1.KubeAPIServerClientSignerName, expiredCert),
+				}))
+				addon.Annotations = map[string]string{ClientCertificatesAnnotationKey: string(certs)}
+				return addon
+			}()},
+			csr: []runtime.Object{
+				newIssuedCSR("addon-test-2", "test", "cluster1", certv1.KubeAPIServerClientSignerName, validCert),
+			},
+			validateAddonActions: func(t *testing.T, actions []clienttesting.Action) {
+				addontesting.AssertActions(t, actions, "patch")
+				patch := actions[0].(clienttesting.PatchActionImpl).Patch
+				addon := &addonapiv1alpha1.ManagedClusterAddOn{}
+				if err := json.Unmarshal(patch, addon); err != nil {
+					t.Fatal(err)
+				}
+				certs := []ClientCertificateInfo{}
+				if err := json.Unmarshal([]byte(addon.Annotations[ClientCertificatesAnnotationKey]), &certs); err != nil {
+					t.Fatal(err)
+				}
+				if len(certs) != 1 || certs[0].SerialNumber != "a" {
+					t.Errorf("expected the rotated certificate recorded, but got %v", certs)
+				}
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			fakeAddonClient := fakeaddon.NewSimpleClientset(c.addon...)
+			fakeKubeClient := fakekube.NewSimpleClientset(c.csr...)
+
+			addonInformers := addoninformers.NewSharedInformerFactory(fakeAddonClient, 10*time.Minute)
+			kubeInfomers := kubeinformers.NewSharedInformerFactory(fakeKubeClient, 10*time.Minute)
+
+			for _, obj := range c.addon {
+				if err := addonInformers.Addon().V1alpha1().ManagedClusterAddOns().Informer().GetStore().Add(obj); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, csr := range c.csr {
+				if err := kubeInfomers.Certificates().V1().CertificateSigningRequests().Informer().GetStore().Add(csr); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			controller := &certificateExpiryController{
+				addonClient:               fakeAddonClient,
+				agentAddons:               map[string]agent.AgentAddon{"test": &testSignAgent{name: "test"}},
+				managedClusterAddonLister: addonInformers.Addon().V1alpha1().ManagedClusterAddOns().Lister(),
+				csrLister:                 kubeInfomers.Certificates().V1().CertificateSigningRequests().Lister(),
+			}
+
+			syncContext := addontesting.NewFakeSyncContext(t)
+			if err := controller.sync(context.TODO(), syncContext, "cluster1/test"); err != nil {
+				t.Errorf("expected no error when sync: %v", err)
+			}
+			c.validateAddonActions(t, fakeAddonClient.Actions())
+		})
+	}
+}
+
+func TestCertificateExpiringSoonCondition(t *testing.T) {
+	now := time.Now()
+	cases := []struct {
+		name           string
+		certs          []ClientCertificateInfo
+		expectedStatus metav1.ConditionStatus
+		expectedReason string
+		expectedAfter  time.Duration
+	}{
+		{
+			name: "valid",
+			certs: []ClientCertificateInfo{
+				{SignerName: "a", NotBefore: metav1.NewTime(now.Add(-1 * time.Hour)), NotAfter: metav1.NewTime(now.Add(9 * time.Hour))},
+			},
+			expectedStatus: metav1.ConditionFalse,
+			expectedReason: CertificateExpiringSoonReasonValid,
+			expectedAfter:  8 * time.Hour,
+		},
+		{
+			name: "expiring",
+			certs: []ClientCertificateInfo{
+				{SignerName: "a", NotBefore: metav1.NewTime(now.Add(-1 * time.Hour)), NotAfter: metav1.NewTime(now.Add(9 * time.Hour))},
+				{SignerName: "b", NotBefore: metav1.NewTime(now.Add(-95 * time.Hour)), NotAfter: metav1.NewTime(now.Add(5 * time.Hour))},
+			},
+			expectedStatus: metav1.ConditionTrue,
+			expectedReason: CertificateExpiringSoonReasonExpiringSoon,
+			expectedAfter:  5 * time.Hour,
+		},
+		{
+			name: "expired",
+			certs: []ClientCertificateInfo{
+				{SignerName: "a", NotBefore: metav1.NewTime(now.Add(-10 * time.Hour)), NotAfter: metav1.NewTime(now.Add(-1 * time.Hour))},
+			},
+			expectedStatus: metav1.ConditionTrue,
+			expectedReason: CertificateExpiringSoonReasonExpired,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cond, after := certificateExpiringSoonCondition(c.certs, now)
+			if cond.Status != c.expectedStatus || cond.Reason != c.expectedReason {
+				t.Errorf("unexpected condition %v", cond)
+			}
+			if after != c.expectedAfter {
+				t.Errorf("expected requeue after %v, but got %v", c.expectedAfter, after)
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package certificate
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	corev1informers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/klog/v2"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+
+	"open-cluster-management.io/addon-framework/pkg/agent"
+	"open-cluster-management.io/sdk-go/pkg/basecontroller/factory"
+)
+
+const (
+	// crlHashAnnotationKey is the annotation on the CRL ConfigMap recording the hash of the revoked certificates
+	// in the CRL, so the CRL is only re-signed when the revoked certificates change or it is about to expire.
+	crlHashAnnotationKey = "addon.open-cluster-management.io/crl-hash"
+
+	// crlResyncInterval is the interval to check whether the CRLs need to be refreshed.
+	crlResyncInterval = 10 * time.Minute
+)
+
+// crlController publishes the certificate revocation list of the addons with CRLSign set in the registration
+// option. It merges the revoked serials in the revocation ConfigMaps of all the clusters and publishes the
+// signed CRL in the ConfigMap CRLConfigMapName(addonName) in the CRLNamespace.
+type crlController struct {
+	kubeClient      kubernetes.Interface
+	agentAddons     map[string]agent.AgentAddon
+	configMapLister corev1listers.ConfigMapLister
+}
+
+// NewCRLController creates a new crl controller.
+func NewCRLController(
+	kubeClient kubernetes.Interface,
+	configMapInformer corev1informers.ConfigMapInformer,
+	agentAddons map[string]agent.AgentAddon,
+) factory.Controller {
+	c := &crlController{
+		kubeClient:      kubeClient,
+		agentAddons:     agentAddons,
+		configMapLister: configMapInformer.Lister(),
+	}
+	return factory.New().
+		WithFilteredEventsInformersQueueKeysFunc(
+			func(obj runtime.Object) []string {
+				accessor, _ := meta.Accessor(obj)
+				return []string{accessor.GetLabels()[addonapiv1alpha1.AddonLabelKey]}
+			},
+			func(obj interface{}) bool {
+				accessor, _ := meta.Accessor(obj)
+				addonName := accessor.GetLabels()[addonapiv1alpha1.AddonLabelKey]
+				if _, ok := agentAddons[addonName]; !ok {
+					return false
+				}
+				return accessor.GetName() == RevocationConfigMapName(addonName)
+			},
+			configMapInformer.Informer()).
+		WithSync(c.sync).
+		ToController("CRLController")
+}
+
+func (c *crlController) sync(ctx context.Context, syncCtx factory.SyncContext, addonName string) error {
+	klog.V(4).Infof("Reconciling certificate revocation list of addon %q", addonName)
+
+	agentAddon, ok := c.agentAddons[addonName]
+	if !ok {
+		return nil
+	}
+	registrationOption := agentAddon.GetAgentAddonOptions().Registration
+	if registrationOption == nil || registrationOption.CRLSign == nil {
+		return nil
+	}
+	if len(registrationOption.CRLNamespace) == 0 {
+		return fmt.Errorf("the crl namespace of addon %q is not set", addonName)
+	}
+
+	configMaps, err := c.configMapLister.List(labels.SelectorFromSet(labels.Set{
+		addonapiv1alpha1.AddonLabelKey: addonName,
+	}))
+	if err != nil {
+		return err
+	}
+
+	revoked := map[string]time.Time{}
+	for _, cm := range configMaps {
+		if cm.Name != RevocationConfigMapName(addonName) {
+			continue
+		}
+		for serial, revokedAt := range parseRevocationList(cm).serials {
+			if existing, ok := revoked[serial]; ok && existing.Before(revokedAt) {
+				continue
+			}
+			revoked[serial] = revokedAt
+		}
+	}
+	entries := revocationListEntries(revoked)
+	hash := revocationListHash(entries)
+
+	crlName := CRLConfigMapName(addonName)
+	existing, err := c.kubeClient.CoreV1().ConfigMaps(registrationOption.CRLNamespace).Get(ctx, crlName, metav1.GetOptions{})
+	switch {
+	case errors.IsNotFound(err):
+		existing = nil
+	case err != nil:
+		return err
+	}
+
+	now := time.Now()
+	if existing != nil && existing.Annotations[crlHashAnnotationKey] == hash {
+		if refreshAt, ok := crlRefreshTime(existing.Data[CRLKey]); ok && now.Before(refreshAt) {
+			syncCtx.Queue().AddAfter(addonName, minDuration(refreshAt.Sub(now), crlResyncInterval))
+			return nil
+		}
+	}
+
+	crl, err := registrationOption.CRLSign(entries)
+	if err != nil {
+		return fmt.Errorf("failed to sign crl of addon %q: %v", addonName, err)
+	}
+
+	required := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        crlName,
+			Namespace:   registrationOption.CRLNamespace,
+			Labels:      map[string]string{addonapiv1alpha1.AddonLabelKey: addonName},
+			Annotations: map[string]string{crlHashAnnotationKey: hash},
+		},
+		Data: map[string]string{CRLKey: string(crl)},
+	}
+	if existing == nil {
+		_, err = c.kubeClient.CoreV1().ConfigMaps(registrationOption.CRLNamespace).Create(ctx, required, metav1.CreateOptions{})
+	} else {
+		updated := existing.DeepCopy()
+		if updated.Labels == nil {
+			updated.Labels = map[string]string{}
+		}
+		if updated.Annotations == nil {
+			updated.Annotations = map[string]string{}
+		}
+		updated.Labels[addonapiv1alpha1.AddonLabelKey] = addonName
+		updated.Annotations[crlHashAnnotationKey] = hash
+		updated.Data = required.Data
+		_, err = c.kubeClient.CoreV1().ConfigMaps(registrationOption.CRLNamespace).Update(ctx, updated, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return err
+	}
+	syncCtx.Recorder().Eventf(ctx, "CRLPublished",
+		"certificate revocation list of addon %q is published with %d revoked certificates", addonName, len(entries))
+
+	if refreshAt, ok := crlRefreshTime(string(crl)); ok {
+		syncCtx.Queue().AddAfter(addonName, minDuration(refreshAt.Sub(now), crlResyncInterval))
+	}
+	return nil
+}
+
+// revocationListEntries converts the revoked serials to the entries of CRL sorted by the serial number.
+func revocationListEntries(revoked map[string]time.Time) []x509.RevocationListEntry {
+	serials := make([]string, 0, len(revoked))
+	for serial := range revoked {
+		serials = append(serials, serial)
+	}
+	sort.Strings(serials)
+
+	entries := make([]x509.RevocationListEntry, 0, len(serials))
+	for _, serial := range serials {
+		n, _ := new(big.Int).SetString(serial, 16)
+		entries = append(entries, x509.RevocationListEntry{
+			SerialNumber:   n,
+			RevocationTime: revoked[serial],
+		})
+	}
+	return entries
+}
+
+func revocationListHash(entries []x509.RevocationListEntry) string {
+	h := sha256.New()
+	for _, entry := range entries {
+		fmt.Fprintf(h, "%s %s\n", entry.SerialNumber.Text(16), entry.RevocationTime.UTC().Format(time.RFC3339))
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// crlRefreshTime returns the time to re-sign the CRL, which is the middle of its validity period.
+func crlRefreshTime(data string) (time.Time, bool) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return time.Time{}, false
+	}
+	crl, err := x509.ParseRevocationList(block.Bytes)
+	if err != nil || crl.NextUpdate.IsZero() {
+		return time.Time{}, false
+	}
+	return crl.ThisUpdate.Add(crl.NextUpdate.Sub(crl.ThisUpdate) / 2), true
+}
+
+func minDuration(a, b time.Duration) time.Duration {
+	if a < b {
+		return a
+	}
+	return b
+}
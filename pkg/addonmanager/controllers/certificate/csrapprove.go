@@ -14,9 +14,11 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	certificatesinformers "k8s.io/client-go/informers/certificates/v1"
 	v1beta1certificatesinformers "k8s.io/client-go/informers/certificates/v1beta1"
+	corev1informers "k8s.io/client-go/informers/core/v1"
 	"k8s.io/client-go/kubernetes"
 	certificateslisters "k8s.io/client-go/listers/certificates/v1"
 	v1beta1certificateslisters "k8s.io/client-go/listers/certificates/v1beta1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/klog/v2"
 	addonv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
@@ -59,16 +61,19 @@ type csrApprovingController struct {
 	managedClusterAddonLister addonlisterv1alpha1.ManagedClusterAddOnLister
 	csrLister                 certificateslisters.CertificateSigningRequestLister
 	csrListerBeta             v1beta1certificateslisters.CertificateSigningRequestLister
+	configMapLister           corev1listers.ConfigMapLister
 	mcaFilterFunc             utils.ManagedClusterAddOnFilterFunc
 }
 
-// NewCSRApprovingController creates a new csr approving controller
+// NewCSRApprovingController creates a new csr approving controller. If configMapInformer is set, the csrs
+// requesting a certificate for an identity revoked in the revocation ConfigMap are denied.
 func NewCSRApprovingController(
 	kubeClient kubernetes.Interface,
 	clusterInformers clusterinformers.ManagedClusterInformer,
 	csrV1Informer certificatesinformers.CertificateSigningRequestInformer,
 	csrBetaInformer v1beta1certificatesinformers.CertificateSigningRequestInformer,
 	addonInformers addoninformerv1alpha1.ManagedClusterAddOnInformer,
+	configMapInformer corev1informers.ConfigMapInformer,
 	agentAddons map[string]agent.AgentAddon,
 	mcaFilterFunc utils.ManagedClusterAddOnFilterFunc,
 ) factory.Controller {
@@ -91,6 +96,11 @@ func NewCSRApprovingController(
 		c.csrListerBeta = csrBetaInformer.Lister()
 		csrInformer = csrBetaInformer.Informer()
 	}
+	bareInformers := []factory.Informer{clusterInformers.Informer(), addonInformers.Informer()}
+	if configMapInformer != nil {
+		c.configMapLister = configMapInformer.Lister()
+		bareInformers = append(bareInformers, configMapInformer.Informer())
+	}
 
 	return factory.New().
 		WithFilteredEventsInformersQueueKeysFunc(
@@ -113,8 +123,8 @@ func NewCSRApprovingController(
 				return true
 			},
 			csrInformer).
-		// clusterLister and addonLister are used, so wait for cache sync
-		WithBareInformers(clusterInformers.Informer(), addonInformers.Informer()).
+		// clusterLister, addonLister and configMapLister are used, so wait for cache sync
+		WithBareInformers(bareInformers...).
 		WithSync(c.sync).
 		ToController("CSRApprovingController")
 }
@@ -170,6 +180,18 @@ func (c *csrApprovingController) sync(ctx context.Context, syncCtx factory.SyncC
 		return nil
 	}
 
+	if c.configMapLister != nil {
+		revocations, err := getRevocationList(c.configMapLister, clusterName, addonName)
+		if err != nil {
+			return err
+		}
+		if subject, revoked := revocations.isSubjectRevoked(toV1CSR(csr)); revoked {
+			syncCtx.Recorder().Warningf(ctx, "AddonCSRDenied",
+				"addon csr %q is denied since the identity %q is revoked", csr.GetName(), subject)
+			return c.deny(ctx, csr, subject)
+		}
+	}
+
 	if registrationOption.CSRApproveCheck == nil {
 		klog.V(4).Infof("addon csr %q cannont be auto approved due to approve check not defined", csr.GetName())
 		return nil
@@ -235,6 +257,33 @@ func (c *csrApprovingController) approve(
 	}
 }
 
+func (c *csrApprovingController) deny(ctx context.Context, csr metav1.Object, subject string) error {
+	message := fmt.Sprintf("Identity %q of the addon agent is revoked.", subject)
+	switch t := csr.(type) {
+	case *certificatesv1.CertificateSigningRequest:
+		t.Status.Conditions = append(t.Status.Conditions, certificatesv1.CertificateSigningRequestCondition{
+			Type:    certificatesv1.CertificateDenied,
+			Status:  corev1.ConditionTrue,
+			Reason:  "AddonAgentCertificateRevoked",
+			Message: message,
+		})
+		_, err := c.kubeClient.CertificatesV1().CertificateSigningRequests().UpdateApproval(ctx, t.GetName(), t, metav1.UpdateOptions{})
+		return err
+	// TODO: remove the following block for deprecating V1beta1 CSR compatibility
+	case *certificatesv1beta1.CertificateSigningRequest:
+		t.Status.Conditions = append(t.Status.Conditions, certificatesv1beta1.CertificateSigningRequestCondition{
+			Type:    certificatesv1beta1.CertificateDenied,
+			Status:  corev1.ConditionTrue,
+			Reason:  "AddonAgentCertificateRevoked",
+			Message: message,
+		})
+		_, err := c.kubeClient.CertificatesV1beta1().CertificateSigningRequests().UpdateApproval(ctx, t, metav1.UpdateOptions{})
+		return err
+	default:
+		return fmt.Errorf("unknown csr object type: %t", csr)
+	}
+}
+
 func (c *csrApprovingController) approveCSRV1(ctx context.Context, v1CSR *certificatesv1.CertificateSigningRequest) error {
 	v1CSR.Status.Conditions = append(v1CSR.Status.Conditions, certificatesv1.CertificateSigningRequestCondition{
 		Type:    certificatesv1.CertificateApproved,
@@ -317,6 +366,19 @@ func isCSRApproved(csr metav1.Object) bool {
 	return approved
 }
 
+// toV1CSR returns the csr in V1 api, a V1beta1 csr is converted.
+func toV1CSR(csr metav1.Object) *certificatesv1.CertificateSigningRequest {
+	switch t := csr.(type) {
+	case *certificatesv1.CertificateSigningRequest:
+		return t
+	// TODO: remove the following block for deprecating V1beta1 CSR compatibility
+	case *certificatesv1beta1.CertificateSigningRequest:
+		return unsafeConvertV1beta1CSRToV1CSR(t)
+	default:
+		return &certificatesv1.CertificateSigningRequest{}
+	}
+}
+
 // TODO: remove the following block for deprecating V1beta1 CSR compatibility
 func unsafeConvertV1beta1CSRToV1CSR(v1beta1CSR *certificatesv1beta1.CertificateSigningRequest) *certificatesv1.CertificateSigningRequest {
 	v1CSR := &certificatesv1.CertificateSigningRequest{
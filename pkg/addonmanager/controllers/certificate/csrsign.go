@@ -11,8 +11,10 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	certificatesinformers "k8s.io/client-go/informers/certificates/v1"
+	corev1informers "k8s.io/client-go/informers/core/v1"
 	"k8s.io/client-go/kubernetes"
 	certificateslisters "k8s.io/client-go/listers/certificates/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
 	"k8s.io/klog/v2"
 	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
 	addoninformerv1alpha1 "open-cluster-management.io/api/client/addon/informers/externalversions/addon/v1alpha1"
@@ -33,15 +35,18 @@ type csrSignController struct {
 	managedClusterLister      clusterlister.ManagedClusterLister
 	managedClusterAddonLister addonlisterv1alpha1.ManagedClusterAddOnLister
 	csrLister                 certificateslisters.CertificateSigningRequestLister
+	configMapLister           corev1listers.ConfigMapLister
 	mcaFilterFunc             utils.ManagedClusterAddOnFilterFunc
 }
 
-// NewCSRApprovingController creates a new csr approving controller
+// NewCSRSignController creates a new csr signing controller. If configMapInformer is set, the csrs requesting
+// a certificate for an identity revoked in the revocation ConfigMap are not signed.
 func NewCSRSignController(
 	kubeClient kubernetes.Interface,
 	clusterInformers clusterinformers.ManagedClusterInformer,
 	csrInformer certificatesinformers.CertificateSigningRequestInformer,
 	addonInformers addoninformerv1alpha1.ManagedClusterAddOnInformer,
+	configMapInformer corev1informers.ConfigMapInformer,
 	agentAddons map[string]agent.AgentAddon,
 	mcaFilterFunc utils.ManagedClusterAddOnFilterFunc,
 ) factory.Controller {
@@ -53,6 +58,11 @@ func NewCSRSignController(
 		csrLister:                 csrInformer.Lister(),
 		mcaFilterFunc:             mcaFilterFunc,
 	}
+	bareInformers := []factory.Informer{clusterInformers.Informer(), addonInformers.Informer()}
+	if configMapInformer != nil {
+		c.configMapLister = configMapInformer.Lister()
+		bareInformers = append(bareInformers, configMapInformer.Informer())
+	}
 	return factory.New().
 		WithFilteredEventsInformersQueueKeysFunc(
 			func(obj runtime.Object) []string {
@@ -74,8 +84,8 @@ func NewCSRSignController(
 				return true
 			},
 			csrInformer.Informer()).
-		// clusterLister and addonLister are used, so wait for cache sync
-		WithBareInformers(clusterInformers.Informer(), addonInformers.Informer()).
+		// clusterLister, addonLister and configMapLister are used, so wait for cache sync
+		WithBareInformers(bareInformers...).
 		WithSync(c.sync).
 		ToController("CSRSignController")
 }
@@ -143,6 +153,18 @@ func (c *csrSignController) sync(ctx context.Context, syncCtx factory.SyncContex
 		return nil
 	}
 
+	if c.configMapLister != nil {
+		revocations, err := getRevocationList(c.configMapLister, clusterName, addonName)
+		if err != nil {
+			return err
+		}
+		if subject, revoked := revocations.isSubjectRevoked(csr); revoked {
+			syncCtx.Recorder().Warningf(ctx, "AddonCSRNotSigned",
+				"addon csr %q is not signed since the identity %q is revoked", csr.Name, subject)
+			return nil
+		}
+	}
+
 	csr.Status.Certificate, err = registrationOption.CSRSign(cluster, addon, csr)
 	if err != nil {
 		return fmt.Errorf("failed to sign addon csr %q: %v", csr.Name, err)
@@ -0,0 +1,33 @@
+package certificate
+
+import (
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+)
+
+var (
+	// clientCertificateAgeSeconds records the age of the latest client certificate issued to an addon agent,
+	// an ever-growing age for a cluster means the agent fails to rotate its certificate.
+	clientCertificateAgeSeconds = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Name: "addon_agent_client_certificate_age_seconds",
+			Help: "Age in seconds of the latest client certificate issued to an addon agent, labeled by cluster, addon and signer.",
+		},
+		[]string{"cluster", "addon", "signer"},
+	)
+
+	// clientCertificateExpirationSeconds records the expiration timestamp of the latest client certificate
+	// issued to an addon agent.
+	clientCertificateExpirationSeconds = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Name: "addon_agent_client_certificate_expiration_timestamp_seconds",
+			Help: "Expiration unix timestamp of the latest client certificate issued to an addon agent, labeled by cluster, addon and signer.",
+		},
+		[]string{"cluster", "addon", "signer"},
+	)
+)
+
+func init() {
+	legacyregistry.MustRegister(clientCertificateAgeSeconds)
+	legacyregistry.MustRegister(clientCertificateExpirationSeconds)
+}
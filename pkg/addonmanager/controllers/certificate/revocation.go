@@ -0,0 +1,133 @@
+package certificate
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	certificatesv1 "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// RevokedSerialsKey is the key in the revocation ConfigMap listing the serial numbers of the revoked client
+	// certificates, one hex encoded serial number per line. A serial number can be followed by the revocation
+	// time in RFC3339 format separated by a space, otherwise the creation time of the ConfigMap is used.
+	RevokedSerialsKey = "serials"
+
+	// RevokedSubjectsKey is the key in the revocation ConfigMap listing the revoked identities, one common name
+	// (user) of the certificate subject per line. Any further CSR requested with a revoked identity is denied.
+	RevokedSubjectsKey = "subjects"
+
+	// CRLKey is the key in the CRL ConfigMap of the PEM encoded certificate revocation list.
+	CRLKey = "ca.crl"
+)
+
+// RevocationConfigMapName returns the name of the ConfigMap in the cluster namespace keeping the deny-list of
+// the client certificates issued to the addon agent in that cluster. The ConfigMap must have the label
+// "addon.open-cluster-management.io/name=<addon name>" to be watched by the addon manager.
+func RevocationConfigMapName(addonName string) string {
+	return fmt.Sprintf("addon-%s-revocation", addonName)
+}
+
+// CRLConfigMapName returns the name of the ConfigMap where the CRL of the addon is published.
+func CRLConfigMapName(addonName string) string {
+	return fmt.Sprintf("addon-%s-crl", addonName)
+}
+
+// revocationList is the deny-list of the client certificates of an addon agent in a cluster.
+type revocationList struct {
+	// serials maps the normalized hex serial number to the revocation time
+	serials  map[string]time.Time
+	subjects sets.Set[string]
+}
+
+// getRevocationList returns the deny-list of the addon in the cluster namespace, an empty list is returned if
+// the revocation ConfigMap does not exist.
+func getRevocationList(lister corev1listers.ConfigMapLister, clusterName, addonName string) (*revocationList, error) {
+	cm, err := lister.ConfigMaps(clusterName).Get(RevocationConfigMapName(addonName))
+	if errors.IsNotFound(err) {
+		return &revocationList{serials: map[string]time.Time{}, subjects: sets.New[string]()}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseRevocationList(cm), nil
+}
+
+func parseRevocationList(cm *corev1.ConfigMap) *revocationList {
+	list := &revocationList{serials: map[string]time.Time{}, subjects: sets.New[string]()}
+
+	for _, line := range revocationEntries(cm.Data[RevokedSerialsKey]) {
+		fields := strings.Fields(line)
+		serial, ok := normalizeSerialNumber(fields[0])
+		if !ok {
+			klog.Warningf("ignore invalid serial number %q in configmap %s/%s", fields[0], cm.Namespace, cm.Name)
+			continue
+		}
+		revokedAt := cm.CreationTimestamp.Time
+		if len(fields) > 1 {
+			t, err := time.Parse(time.RFC3339, fields[1])
+			if err != nil {
+				klog.Warningf("ignore invalid revocation time %q in configmap %s/%s", fields[1], cm.Namespace, cm.Name)
+			} else {
+				revokedAt = t
+			}
+		}
+		list.serials[serial] = revokedAt
+	}
+
+	for _, line := range revocationEntries(cm.Data[RevokedSubjectsKey]) {
+		list.subjects.Insert(line)
+	}
+	return list
+}
+
+// revocationEntries splits the data into lines, the empty lines and the lines starting with # are skipped.
+func revocationEntries(data string) []string {
+	var entries []string
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		entries = append(entries, line)
+	}
+	return entries
+}
+
+// normalizeSerialNumber converts a hex serial number, optionally separated by colons, to the lowercase hex
+// format without leading zeros which is the format of ClientCertificateInfo.SerialNumber.
+func normalizeSerialNumber(serial string) (string, bool) {
+	n, ok := new(big.Int).SetString(strings.ReplaceAll(serial, ":", ""), 16)
+	if !ok {
+		return "", false
+	}
+	return n.Text(16), true
+}
+
+// isSubjectRevoked returns the revoked identity if the csr requests a certificate for it.
+func (l *revocationList) isSubjectRevoked(csr *certificatesv1.CertificateSigningRequest) (string, bool) {
+	if l.subjects.Len() == 0 {
+		return "", false
+	}
+	block, _ := pem.Decode(csr.Spec.Request)
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return "", false
+	}
+	request, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return "", false
+	}
+	if l.subjects.Has(request.Subject.CommonName) {
+		return request.Subject.CommonName, true
+	}
+	return "", false
+}
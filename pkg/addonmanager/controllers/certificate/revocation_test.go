@@ -0,0 +1,275 @@
+package certificate
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	certv1 "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubeinformers "k8s.io/client-go/informers"
+	fakekube "k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+	certutil "k8s.io/client-go/util/cert"
+	"k8s.io/client-go/util/keyutil"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	fakeaddon "open-cluster-management.io/api/client/addon/clientset/versioned/fake"
+	addoninformers "open-cluster-management.io/api/client/addon/informers/externalversions"
+	fakecluster "open-cluster-management.io/api/client/cluster/clientset/versioned/fake"
+	clusterv1informers "open-cluster-management.io/api/client/cluster/informers/externalversions"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
+
+	"open-cluster-management.io/addon-framework/pkg/addonmanager/addontesting"
+	"open-cluster-management.io/addon-framework/pkg/agent"
+)
+
+func newRevocationConfigMap(addonName, clusterName, serials, subjects string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              RevocationConfigMapName(addonName),
+			Namespace:         clusterName,
+			Labels:            map[string]string{addonapiv1alpha1.AddonLabelKey: addonName},
+			CreationTimestamp: metav1.NewTime(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)),
+		},
+		Data: map[string]string{
+			RevokedSerialsKey:  serials,
+			RevokedSubjectsKey: subjects,
+		},
+	}
+}
+
+func newCSRWithSubject(addon, cluster, commonName string) *certv1.CertificateSigningRequest {
+	csr := addontesting.NewCSR(addon, cluster)
+	clientKey, _ := keyutil.MakeEllipticPrivateKeyPEM()
+	privateKey, _ := keyutil.ParsePrivateKeyPEM(clientKey)
+	csr.Spec.Request, _ = certutil.MakeCSR(privateKey, &pkix.Name{CommonName: commonName}, nil, nil)
+	return csr
+}
+
+func TestParseRevocationList(t *testing.T) {
+	cm := newRevocationConfigMap("test", "cluster1",
+		"# comment\n0A:0b\n\n1f 2024-02-01T00:00:00Z\ninvalid\n", "user1\n user2 \n")
+
+	list := parseRevocationList(cm)
+	if len(list.serials) != 2 {
+		t.Fatalf("expected 2 serials, but got %v", list.serials)
+	}
+	if !list.serials["a0b"].Equal(cm.CreationTimestamp.Time) {
+		t.Errorf("expected revocation time of a0b to be the creation time, but got %v", list.serials["a0b"])
+	}
+	if !list.serials["1f"].Equal(time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected revocation time of 1f %v", list.serials["1f"])
+	}
+	if !list.subjects.Has("user1") || !list.subjects.Has("user2") || list.subjects.Len() != 2 {
+		t.Errorf("unexpected subjects %v", list.subjects)
+	}
+}
+
+func TestDenyRevokedCSR(t *testing.T) {
+	cases := []struct {
+		name               string
+		configMaps         []runtime.Object
+		csr                *certv1.CertificateSigningRequest
+		validateCSRActions func(t *testing.T, actions []clienttesting.Action)
+	}{
+		{
+			name: "no revocation",
+			csr:  newCSRWithSubject("test", "cluster1", "user1"),
+			validateCSRActions: func(t *testing.T, actions []clienttesting.Action) {
+				addontesting.AssertActions(t, actions, "update")
+				csr := actions[0].(clienttesting.UpdateActionImpl).Object.(*certv1.CertificateSigningRequest)
+				if !isCSRApproved(csr) {
+					t.Errorf("csr is not approved: %v", csr)
+				}
+			},
+		},
+		{
+			name:       "subject not revoked",
+			configMaps: []runtime.Object{newRevocationConfigMap("test", "cluster1", "", "user2")},
+			csr:        newCSRWithSubject("test", "cluster1", "user1"),
+			validateCSRActions: func(t *testing.T, actions []clienttesting.Action) {
+				addontesting.AssertActions(t, actions, "update")
+				csr := actions[0].(clienttesting.UpdateActionImpl).Object.(*certv1.CertificateSigningRequest)
+				if !isCSRApproved(csr) {
+					t.Errorf("csr is not approved: %v", csr)
+				}
+			},
+		},
+		{
+			name:       "subject revoked",
+			configMaps: []runtime.Object{newRevocationConfigMap("test", "cluster1", "", "user1")},
+			csr:        newCSRWithSubject("test", "cluster1", "user1"),
+			validateCSRActions: func(t *testing.T, actions []clienttesting.Action) {
+				addontesting.AssertActions(t, actions, "update")
+				csr := actions[0].(clienttesting.UpdateActionImpl).Object.(*certv1.CertificateSigningRequest)
+				if isCSRApproved(csr) || !IsCSRInTerminalState(csr) {
+					t.Errorf("csr is not denied: %v", csr)
+				}
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			fakeClusterClient := fakecluster.NewSimpleClientset(addontesting.NewManagedCluster("cluster1"))
+			fakeAddonClient := fakeaddon.NewSimpleClientset(addontesting.NewAddon("test", "cluster1"))
+			fakeKubeClient := fakekube.NewSimpleClientset(c.csr)
+
+			addonInformers := addoninformers.NewSharedInformerFactory(fakeAddonClient, 10*time.Minute)
+			clusterInformers := clusterv1informers.NewSharedInformerFactory(fakeClusterClient, 10*time.Minute)
+			kubeInfomers := kubeinformers.NewSharedInformerFactory(fakeKubeClient, 10*time.Minute)
+
+			if err := clusterInformers.Cluster().V1().ManagedClusters().Informer().GetStore().Add(
+				addontesting.NewManagedCluster("cluster1")); err != nil {
+				t.Fatal(err)
+			}
+			if err := addonInformers.Addon().V1alpha1().ManagedClusterAddOns().Informer().GetStore().Add(
+				addontesting.NewAddon("test", "cluster1")); err != nil {
+				t.Fatal(err)
+			}
+			if err := kubeInfomers.Certificates().V1().CertificateSigningRequests().Informer().GetStore().Add(c.csr); err != nil {
+				t.Fatal(err)
+			}
+			for _, obj := range c.configMaps {
+				if err := kubeInfomers.Core().V1().ConfigMaps().Informer().GetStore().Add(obj); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			controller := &csrApprovingController{
+				kubeClient:                fakeKubeClient,
+				agentAddons:               map[string]agent.AgentAddon{"test": &testApproveAgent{name: "test", approved: true}},
+				managedClusterLister:      clusterInformers.Cluster().V1().ManagedClusters().Lister(),
+				managedClusterAddonLister: addonInformers.Addon().V1alpha1().ManagedClusterAddOns().Lister(),
+				csrLister:                 kubeInfomers.Certificates().V1().CertificateSigningRequests().Lister(),
+				configMapLister:           kubeInfomers.Core().V1().ConfigMaps().Lister(),
+			}
+
+			syncContext := addontesting.NewFakeSyncContext(t)
+			if err := controller.sync(context.TODO(), syncContext, c.csr.Name); err != nil {
+				t.Errorf("expected no error when sync: %v", err)
+			}
+			c.validateCSRActions(t, fakeKubeClient.Actions())
+		})
+	}
+}
+
+type testCRLAgent struct {
+	name    string
+	revoked []x509.RevocationListEntry
+}
+
+func (t *testCRLAgent) Manifests(cluster *clusterv1.ManagedCluster, addon *addonapiv1alpha1.ManagedClusterAddOn) ([]runtime.Object, error) {
+	return []runtime.Object{}, nil
+}
+
+func (t *testCRLAgent) GetAgentAddonOptions() agent.AgentAddonOptions {
+	return agent.AgentAddonOptions{
+		AddonName: t.name,
+		Registration: &agent.RegistrationOption{
+			CRLNamespace: "open-cluster-management-hub",
+			CRLSign: func(revoked []x509.RevocationListEntry) ([]byte, error) {
+				t.revoked = revoked
+				return []byte("crl"), nil
+			},
+		},
+	}
+}
+
+func TestCRLReconcile(t *testing.T) {
+	configMaps := []runtime.Object{
+		newRevocationConfigMap("test", "cluster1", "a\n0b 2023-01-01T00:00:00Z", ""),
+		newRevocationConfigMap("test", "cluster2", "b", ""),
+	}
+	testAgent := &testCRLAgent{name: "test"}
+
+	fakeKubeClient := fakekube.NewSimpleClientset()
+	kubeInfomers := kubeinformers.NewSharedInformerFactory(fakeKubeClient, 10*time.Minute)
+	for _, obj := range configMaps {
+		if err := kubeInfomers.Core().V1().ConfigMaps().Informer().GetStore().Add(obj); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	controller := &crlController{
+		kubeClient:      fakeKubeClient,
+		agentAddons:     map[string]agent.AgentAddon{"test": testAgent},
+		configMapLister: kubeInfomers.Core().V1().ConfigMaps().Lister(),
+	}
+
+	syncContext := addontesting.NewFakeSyncContext(t)
+	if err := controller.sync(context.TODO(), syncContext, "test"); err != nil {
+		t.Errorf("expected no error when sync: %v", err)
+	}
+
+	addontesting.AssertActions(t, fakeKubeClient.Actions(), "get", "create")
+	cm := fakeKubeClient.Actions()[1].(clienttesting.CreateActionImpl).Object.(*corev1.ConfigMap)
+	if cm.Name != CRLConfigMapName("test") || cm.Namespace != "open-cluster-management-hub" || cm.Data[CRLKey] != "crl" {
+		t.Errorf("unexpected crl configmap %v", cm)
+	}
+
+	if len(testAgent.revoked) != 2 {
+		t.Fatalf("expected 2 revoked certificates, but got %v", testAgent.revoked)
+	}
+	if testAgent.revoked[0].SerialNumber.Cmp(big.NewInt(10)) != 0 || testAgent.revoked[1].SerialNumber.Cmp(big.NewInt(11)) != 0 {
+		t.Errorf("unexpected revoked certificates %v", testAgent.revoked)
+	}
+	if !testAgent.revoked[1].RevocationTime.Equal(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the earliest revocation time, but got %v", testAgent.revoked[1].RevocationTime)
+	}
+}
+
+func TestCRLRefreshTime(t *testing.T) {
+	if _, ok := crlRefreshTime("invalid"); ok {
+		t.Errorf("expected no refresh time for invalid crl")
+	}
+
+	caKey, caCert := newTestCA(t)
+	now := time.Now().Truncate(time.Second)
+	der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: now,
+		NextUpdate: now.Add(2 * time.Hour),
+	}, caCert, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refreshAt, ok := crlRefreshTime(string(pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der})))
+	if !ok || !refreshAt.Equal(now.Add(time.Hour)) {
+		t.Errorf("expected refresh at %v, but got %v", now.Add(time.Hour), refreshAt)
+	}
+}
+
+func newTestCA(t *testing.T) (*ecdsa.PrivateKey, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, cert
+}
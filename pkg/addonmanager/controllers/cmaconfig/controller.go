@@ -3,12 +3,15 @@ package cmaconfig
 import (
 	"context"
 	"fmt"
+	"sync"
 
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/dynamic/dynamicinformer"
 	"k8s.io/client-go/dynamic/dynamiclister"
 	"k8s.io/client-go/tools/cache"
@@ -19,6 +22,7 @@ import (
 	addonlisterv1alpha1 "open-cluster-management.io/api/client/addon/listers/addon/v1alpha1"
 	"open-cluster-management.io/sdk-go/pkg/patcher"
 
+	"open-cluster-management.io/addon-framework/pkg/addonmanager/constants"
 	"open-cluster-management.io/addon-framework/pkg/index"
 	"open-cluster-management.io/addon-framework/pkg/utils"
 	"open-cluster-management.io/sdk-go/pkg/basecontroller/factory"
@@ -39,9 +43,15 @@ type cmaConfigController struct {
 	queue                         workqueue.TypedRateLimitingInterface[string]
 	cmaFilterFunc                 factory.EventFilterFunc
 	configGVRs                    map[schema.GroupVersionResource]bool
+	specHashOptions               utils.ConfigSpecHashOptions
 	addonPatcher                  patcher.Patcher[*addonapiv1alpha1.ClusterManagementAddOn,
 		addonapiv1alpha1.ClusterManagementAddOnSpec,
 		addonapiv1alpha1.ClusterManagementAddOnStatus]
+
+	// invalidDefaultConfigs records the message of the invalid default configs last reported for each addon, so
+	// the warning is only emitted when the invalid configs change.
+	invalidDefaultConfigsLock sync.Mutex
+	invalidDefaultConfigs     map[string]string
 }
 
 func NewCMAConfigController(
@@ -50,6 +60,7 @@ func NewCMAConfigController(
 	configInformerFactory dynamicinformer.DynamicSharedInformerFactory,
 	configGVRs map[schema.GroupVersionResource]bool,
 	cmaFilterFunc factory.EventFilterFunc,
+	specHashOptions utils.ConfigSpecHashOptions,
 ) factory.Controller {
 	syncCtx := factory.NewSyncContext(controllerName)
 
@@ -61,9 +72,11 @@ func NewCMAConfigController(
 		queue:                         syncCtx.Queue(),
 		cmaFilterFunc:                 cmaFilterFunc,
 		configGVRs:                    configGVRs,
+		specHashOptions:               specHashOptions,
 		addonPatcher: patcher.NewPatcher[*addonapiv1alpha1.ClusterManagementAddOn,
 			addonapiv1alpha1.ClusterManagementAddOnSpec,
 			addonapiv1alpha1.ClusterManagementAddOnStatus](addonClient.AddonV1alpha1().ClusterManagementAddOns()),
+		invalidDefaultConfigs: map[string]string{},
 	}
 
 	configInformers := c.buildConfigInformers(configInformerFactory, configGVRs)
@@ -139,6 +152,7 @@ func (c *cmaConfigController) sync(ctx context.Context, syncCtx factory.SyncCont
 	cma, err := c.clusterManagementAddonLister.Get(addonName)
 	if errors.IsNotFound(err) {
 		// addon cloud be deleted, ignore
+		c.recordInvalidDefaultConfigs(addonName, "")
 		return nil
 	}
 	if err != nil {
@@ -150,63 +164,116 @@ func (c *cmaConfigController) sync(ctx context.Context, syncCtx factory.SyncCont
 	}
 
 	cmaCopy := cma.DeepCopy()
-	if err := c.updateConfigSpecHash(cmaCopy); err != nil {
+	missing, unsupported, err := c.updateConfigSpecHash(cmaCopy)
+	if err != nil {
 		return err
 	}
 
+	// the status of ClusterManagementAddOn has no conditions besides the ones of install progressions, so the
+	// invalid default configs are reported by events.
+	var invalidMessage string
+	if missing.Len()+unsupported.Len() > 0 {
+		invalidMessage = constants.NewConfigValidCondition(sets.List(missing), sets.List(unsupported)).Message
+	}
+	if c.recordInvalidDefaultConfigs(cma.Name, invalidMessage) && len(invalidMessage) > 0 {
+		syncCtx.Recorder().Warningf(ctx, "DefaultConfigInvalid", "Default configs of addon %s are invalid: %s",
+			cma.Name, invalidMessage)
+	}
+
 	_, err = c.addonPatcher.PatchStatus(ctx, cmaCopy, cmaCopy.Status, cma.Status)
 	return err
 }
 
-func (c *cmaConfigController) updateConfigSpecHash(cma *addonapiv1alpha1.ClusterManagementAddOn) error {
+// recordInvalidDefaultConfigs records the message of the invalid default configs of the addon, an empty message
+// means the default configs are valid. It returns true if the message is changed.
+func (c *cmaConfigController) recordInvalidDefaultConfigs(addonName, message string) bool {
+	c.invalidDefaultConfigsLock.Lock()
+	defer c.invalidDefaultConfigsLock.Unlock()
+	if c.invalidDefaultConfigs[addonName] == message {
+		return false
+	}
+	if len(message) == 0 {
+		delete(c.invalidDefaultConfigs, addonName)
+		return true
+	}
+	if c.invalidDefaultConfigs == nil {
+		c.invalidDefaultConfigs = map[string]string{}
+	}
+	c.invalidDefaultConfigs[addonName] = message
+	return true
+}
+
+// updateConfigSpecHash updates the spec hashes of the desired configs in the status and the ConfigValid condition
+// of each install progression, and returns the default configs which are missing or unsupported.
+func (c *cmaConfigController) updateConfigSpecHash(
+	cma *addonapiv1alpha1.ClusterManagementAddOn) (missing, unsupported sets.Set[string], err error) {
+	missing, unsupported = sets.New[string](), sets.New[string]()
 
 	for i, defaultConfigReference := range cma.Status.DefaultConfigReferences {
+		if defaultConfigReference.DesiredConfig == nil || defaultConfigReference.DesiredConfig.Name == "" {
+			continue
+		}
+
 		if !utils.ContainGR(
 			c.configGVRs,
 			defaultConfigReference.ConfigGroupResource.Group,
 			defaultConfigReference.ConfigGroupResource.Resource) {
+			unsupported.Insert(utils.ConfigReferentString(
+				defaultConfigReference.ConfigGroupResource, defaultConfigReference.DesiredConfig.ConfigReferent))
 			continue
 		}
 
-		if defaultConfigReference.DesiredConfig == nil || defaultConfigReference.DesiredConfig.Name == "" {
-			continue
-		}
-
-		specHash, err := c.getConfigSpecHash(defaultConfigReference.ConfigGroupResource, defaultConfigReference.DesiredConfig.ConfigReferent)
+		specHash, err := c.getConfigSpecHash(defaultConfigReference.ConfigGroupResource,
+			defaultConfigReference.DesiredConfig.ConfigReferent, missing, unsupported)
 		if err != nil {
-			return nil
+			return missing, unsupported, nil
 		}
 		cma.Status.DefaultConfigReferences[i].DesiredConfig.SpecHash = specHash
 	}
 
 	for i, installProgression := range cma.Status.InstallProgressions {
+		progressionMissing, progressionUnsupported := sets.New[string](), sets.New[string]()
+		desired := 0
 		for j, configReference := range installProgression.ConfigReferences {
 			if configReference.DesiredConfig == nil || configReference.DesiredConfig.Name == "" {
 				continue
 			}
+			desired++
 
 			if !utils.ContainGR(
 				c.configGVRs,
 				configReference.ConfigGroupResource.Group,
 				configReference.ConfigGroupResource.Resource) {
+				progressionUnsupported.Insert(utils.ConfigReferentString(
+					configReference.ConfigGroupResource, configReference.DesiredConfig.ConfigReferent))
 				continue
 			}
 
-			specHash, err := c.getConfigSpecHash(configReference.ConfigGroupResource, configReference.DesiredConfig.ConfigReferent)
+			specHash, err := c.getConfigSpecHash(configReference.ConfigGroupResource,
+				configReference.DesiredConfig.ConfigReferent, progressionMissing, progressionUnsupported)
 			if err != nil {
-				return nil
+				return missing, unsupported, nil
 			}
 			cma.Status.InstallProgressions[i].ConfigReferences[j].DesiredConfig.SpecHash = specHash
 		}
+
+		// only report the config validation for progressions with desired configs, or the ones whose
+		// configs are removed.
+		if desired > 0 || meta.FindStatusCondition(
+			installProgression.Conditions, constants.AddonConditionConfigValid) != nil {
+			meta.SetStatusCondition(&cma.Status.InstallProgressions[i].Conditions,
+				constants.NewConfigValidCondition(sets.List(progressionMissing), sets.List(progressionUnsupported)))
+		}
 	}
 
-	return nil
+	return missing, unsupported, nil
 }
 
 func (c *cmaConfigController) getConfigSpecHash(gr addonapiv1alpha1.ConfigGroupResource,
-	cr addonapiv1alpha1.ConfigReferent) (string, error) {
+	cr addonapiv1alpha1.ConfigReferent, missing, unsupported sets.Set[string]) (string, error) {
 	lister, ok := c.configListers[schema.GroupResource{Group: gr.Group, Resource: gr.Resource}]
 	if !ok {
+		unsupported.Insert(utils.ConfigReferentString(gr, cr))
 		return "", nil
 	}
 
@@ -218,11 +285,12 @@ func (c *cmaConfigController) getConfigSpecHash(gr addonapiv1alpha1.ConfigGroupR
 		config, err = lister.Namespace(cr.Namespace).Get(cr.Name)
 	}
 	if errors.IsNotFound(err) {
+		missing.Insert(utils.ConfigReferentString(gr, cr))
 		return "", nil
 	}
 	if err != nil {
 		return "", err
 	}
 
-	return utils.GetSpecHash(config)
+	return c.specHashOptions.GetSpecHash(gr.Group, gr.Resource, config)
 }
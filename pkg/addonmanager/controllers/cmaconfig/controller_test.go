@@ -6,6 +6,8 @@ import (
 	"testing"
 	"time"
 
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -15,10 +17,13 @@ import (
 	clienttesting "k8s.io/client-go/testing"
 	"k8s.io/client-go/tools/cache"
 	"open-cluster-management.io/addon-framework/pkg/addonmanager/addontesting"
+	"open-cluster-management.io/addon-framework/pkg/addonmanager/constants"
 	"open-cluster-management.io/addon-framework/pkg/index"
 	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
 	fakeaddon "open-cluster-management.io/api/client/addon/clientset/versioned/fake"
 	addoninformers "open-cluster-management.io/api/client/addon/informers/externalversions"
+	"open-cluster-management.io/sdk-go/pkg/basecontroller/events"
+	"open-cluster-management.io/sdk-go/pkg/basecontroller/factory"
 	"open-cluster-management.io/sdk-go/pkg/patcher"
 )
 
@@ -230,6 +235,51 @@ func TestSync(t *testing.T) {
 				}
 			},
 		},
+		{
+			name:    "missing install progression config",
+			syncKey: "test",
+			clusterManagementAddon: []runtime.Object{
+				func() *addonapiv1alpha1.ClusterManagementAddOn {
+					cma := addontesting.NewClusterManagementAddon("test", "", "").Build()
+					cma.Status.InstallProgressions = []addonapiv1alpha1.InstallProgression{{
+						PlacementRef: addonapiv1alpha1.PlacementRef{Name: "placement1", Namespace: "test"},
+						ConfigReferences: []addonapiv1alpha1.InstallConfigReference{
+							{
+								ConfigGroupResource: addonapiv1alpha1.ConfigGroupResource{
+									Group:    fakeGVR.Group,
+									Resource: fakeGVR.Resource,
+								},
+								DesiredConfig: &addonapiv1alpha1.ConfigSpecHash{
+									ConfigReferent: addonapiv1alpha1.ConfigReferent{
+										Namespace: "cluster1",
+										Name:      "missing",
+									},
+								},
+							},
+						},
+					}}
+					return cma
+				}(),
+			},
+			configs: []runtime.Object{newTestConfing("test", "cluster1", 2)},
+			validateActions: func(t *testing.T, actions []clienttesting.Action) {
+				addontesting.AssertActions(t, actions, "patch")
+				patch := actions[0].(clienttesting.PatchActionImpl).Patch
+				cma := &addonapiv1alpha1.ClusterManagementAddOn{}
+				err := json.Unmarshal(patch, cma)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				cond := meta.FindStatusCondition(cma.Status.InstallProgressions[0].Conditions, constants.AddonConditionConfigValid)
+				if cond == nil || cond.Status != metav1.ConditionFalse {
+					t.Fatalf("Expect condition ConfigValid false, but got %v", cond)
+				}
+				if cond.Message != "configs not found: configs.configs.test/cluster1/missing" {
+					t.Errorf("Unexpected condition message %q", cond.Message)
+				}
+			},
+		},
 	}
 
 	for _, c := range cases {
@@ -403,3 +453,89 @@ func newTestConfing(name, namespace string, generation int64) *unstructured.Unst
 		},
 	}
 }
+
+// warningRecorder counts the warnings and logs the other events.
+type warningRecorder struct {
+	events.Recorder
+	warnings int
+}
+
+func (r *warningRecorder) Warningf(ctx context.Context, reason, messageFmt string, args ...interface{}) {
+	r.warnings++
+	r.Recorder.Warningf(ctx, reason, messageFmt, args...)
+}
+
+type warningSyncContext struct {
+	factory.SyncContext
+	recorder *warningRecorder
+}
+
+func (c *warningSyncContext) Recorder() events.Recorder {
+	return c.recorder
+}
+
+func TestDefaultConfigInvalidEvent(t *testing.T) {
+	cma := addontesting.NewClusterManagementAddon("test", "", "").Build()
+	cma.Status.DefaultConfigReferences = []addonapiv1alpha1.DefaultConfigReference{
+		{
+			ConfigGroupResource: addonapiv1alpha1.ConfigGroupResource{Group: "other.test", Resource: "others"},
+			DesiredConfig: &addonapiv1alpha1.ConfigSpecHash{
+				ConfigReferent: addonapiv1alpha1.ConfigReferent{Name: "test"},
+			},
+		},
+	}
+
+	fakeAddonClient := fakeaddon.NewSimpleClientset(cma)
+	addonInformers := addoninformers.NewSharedInformerFactory(fakeAddonClient, 10*time.Minute)
+	cmaStore := addonInformers.Addon().V1alpha1().ClusterManagementAddOns().Informer().GetStore()
+	if err := cmaStore.Add(cma); err != nil {
+		t.Fatal(err)
+	}
+
+	ctrl := &cmaConfigController{
+		addonClient:                  fakeAddonClient,
+		clusterManagementAddonLister: addonInformers.Addon().V1alpha1().ClusterManagementAddOns().Lister(),
+		configListers:                map[schema.GroupResource]dynamiclister.Lister{},
+		configGVRs:                   map[schema.GroupVersionResource]bool{fakeGVR: true},
+		addonPatcher: patcher.NewPatcher[*addonapiv1alpha1.ClusterManagementAddOn,
+			addonapiv1alpha1.ClusterManagementAddOnSpec,
+			addonapiv1alpha1.ClusterManagementAddOnStatus](fakeAddonClient.AddonV1alpha1().ClusterManagementAddOns()),
+	}
+	syncCtx := &warningSyncContext{
+		SyncContext: addontesting.NewFakeSyncContext(t),
+		recorder:    &warningRecorder{Recorder: addontesting.NewTestingEventRecorder(t)},
+	}
+
+	syncAddon := func() {
+		if err := ctrl.sync(context.TODO(), syncCtx, "test"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the warning is emitted once for the same invalid configs
+	syncAddon()
+	syncAddon()
+	if syncCtx.recorder.warnings != 1 {
+		t.Errorf("expected 1 warning, but got %d", syncCtx.recorder.warnings)
+	}
+
+	// the warning is emitted again after the invalid configs change
+	cma = cma.DeepCopy()
+	cma.Status.DefaultConfigReferences[0].DesiredConfig.Name = "another"
+	if err := cmaStore.Update(cma); err != nil {
+		t.Fatal(err)
+	}
+	syncAddon()
+	if syncCtx.recorder.warnings != 2 {
+		t.Errorf("expected 2 warnings, but got %d", syncCtx.recorder.warnings)
+	}
+
+	// the record is cleared after the addon is deleted
+	if err := cmaStore.Delete(cma); err != nil {
+		t.Fatal(err)
+	}
+	syncAddon()
+	if len(ctrl.invalidDefaultConfigs) != 0 {
+		t.Errorf("expected no invalid default configs recorded, but got %v", ctrl.invalidDefaultConfigs)
+	}
+}
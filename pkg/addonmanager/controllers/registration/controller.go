@@ -19,8 +19,10 @@ import (
 	addonlisterv1alpha1 "open-cluster-management.io/api/client/addon/listers/addon/v1alpha1"
 	clusterinformers "open-cluster-management.io/api/client/cluster/informers/externalversions/cluster/v1"
 	clusterlister "open-cluster-management.io/api/client/cluster/listers/cluster/v1"
+	clusterv1 "open-cluster-management.io/api/cluster/v1"
 	"open-cluster-management.io/sdk-go/pkg/patcher"
 
+	"open-cluster-management.io/addon-framework/pkg/addonmanager/constants"
 	"open-cluster-management.io/addon-framework/pkg/agent"
 	"open-cluster-management.io/addon-framework/pkg/utils"
 	"open-cluster-management.io/sdk-go/pkg/basecontroller/factory"
@@ -75,7 +77,8 @@ func NewAddonRegistrationController(
 //   - "token": preserves subject from existing registrations, or empty if not found
 //   - "csr": uses subject from newConfigs, or sets default if empty
 //
-// For other signer names, always uses subject from newConfigs.
+// For other signer names, always uses subject from newConfigs. The kubeClientDriver must be validated with
+// utils.ValidateKubeClientDriver before.
 func buildRegistrationConfigs(newConfigs, existingRegistrations []addonapiv1alpha1.RegistrationConfig,
 	kubeClientDriver, clusterName, addonName string) []addonapiv1alpha1.RegistrationConfig {
 	result := []addonapiv1alpha1.RegistrationConfig{}
@@ -98,7 +101,7 @@ func buildRegistrationConfigs(newConfigs, existingRegistrations []addonapiv1alph
 			continue
 		}
 
-		if kubeClientDriver == "token" {
+		if kubeClientDriver == utils.KubeClientDriverToken {
 			// Token driver - preserve existing subject set by agent
 			found := false
 			for j := range existingRegistrations {
@@ -112,7 +115,7 @@ func buildRegistrationConfigs(newConfigs, existingRegistrations []addonapiv1alph
 			if !found {
 				config.Subject = addonapiv1alpha1.Subject{}
 			}
-		} else if kubeClientDriver == "csr" {
+		} else if kubeClientDriver == utils.KubeClientDriverCSR {
 			// CSR driver - use subject from newConfigs, or set default if empty
 			if equality.Semantic.DeepEqual(config.Subject, addonapiv1alpha1.Subject{}) {
 				config.Subject = addonapiv1alpha1.Subject{
@@ -121,7 +124,6 @@ func buildRegistrationConfigs(newConfigs, existingRegistrations []addonapiv1alph
 				}
 			}
 		}
-		// For other drivers, use subject from newConfigs
 
 		result = append(result, config)
 	}
@@ -143,8 +145,7 @@ func (c *addonRegistrationController) sync(ctx context.Context, syncCtx factory.
 		return nil
 	}
 
-	// Get ManagedCluster
-	managedCluster, err := c.managedClusterLister.Get(clusterName)
+	managedClusterAddon, err := c.managedClusterAddonLister.ManagedClusterAddOns(clusterName).Get(addonName)
 	if apierrors.IsNotFound(err) {
 		return nil
 	}
@@ -152,17 +153,31 @@ func (c *addonRegistrationController) sync(ctx context.Context, syncCtx factory.
 		return err
 	}
 
-	managedClusterAddon, err := c.managedClusterAddonLister.ManagedClusterAddOns(clusterName).Get(addonName)
-	if apierrors.IsNotFound(err) {
+	if c.mcaFilterFunc != nil && !c.mcaFilterFunc(managedClusterAddon) {
 		return nil
 	}
-	if err != nil {
-		return err
+
+	addonPatcher := patcher.NewPatcher[
+		*addonapiv1alpha1.ManagedClusterAddOn,
+		addonapiv1alpha1.ManagedClusterAddOnSpec,
+		addonapiv1alpha1.ManagedClusterAddOnStatus](c.addonClient.AddonV1alpha1().ManagedClusterAddOns(clusterName))
+
+	// the permission is cleaned up even if the cluster is deleted, so it is handled before getting the cluster.
+	if cleanup := agentAddon.GetAgentAddonOptions().Registration; cleanup != nil && cleanup.PermissionCleanup != nil {
+		done, err := c.syncPermissionCleanup(ctx, addonPatcher, cleanup.PermissionCleanup, managedClusterAddon)
+		if done || err != nil {
+			return err
+		}
 	}
 
-	if c.mcaFilterFunc != nil && !c.mcaFilterFunc(managedClusterAddon) {
+	// Get ManagedCluster
+	managedCluster, err := c.managedClusterLister.Get(clusterName)
+	if apierrors.IsNotFound(err) {
 		return nil
 	}
+	if err != nil {
+		return err
+	}
 
 	managedClusterAddonCopy := managedClusterAddon.DeepCopy()
 
@@ -172,11 +187,6 @@ func (c *addonRegistrationController) sync(ctx context.Context, syncCtx factory.
 		return nil
 	}
 
-	addonPatcher := patcher.NewPatcher[
-		*addonapiv1alpha1.ManagedClusterAddOn,
-		addonapiv1alpha1.ManagedClusterAddOnSpec,
-		addonapiv1alpha1.ManagedClusterAddOnStatus](c.addonClient.AddonV1alpha1().ManagedClusterAddOns(clusterName))
-
 	// patch supported configs
 	var supportedConfigs []addonapiv1alpha1.ConfigGroupResource
 	for _, config := range agentAddon.GetAgentAddonOptions().SupportedConfigGVRs {
@@ -253,6 +263,22 @@ func (c *addonRegistrationController) sync(ctx context.Context, syncCtx factory.
 		return nil
 	}
 
+	// the subject of the kube-apiserver-client registration depends on the kubeClientDriver, wait until the agent
+	// reports a supported one.
+	if err := utils.ValidateKubeClientDriver(managedClusterAddon); err != nil {
+		meta.SetStatusCondition(&managedClusterAddonCopy.Status.Conditions, metav1.Condition{
+			Type:    addonapiv1alpha1.ManagedClusterAddOnRegistrationApplied,
+			Status:  metav1.ConditionFalse,
+			Reason:  constants.RegistrationAppliedReasonUnsupportedKubeClientDriver,
+			Message: err.Error(),
+		})
+		_, err = addonPatcher.PatchStatus(ctx, managedClusterAddonCopy, managedClusterAddonCopy.Status, managedClusterAddon.Status)
+		if err != nil {
+			return fmt.Errorf("failed to patch status condition(unsupported kubeClientDriver) of managedclusteraddon: %w", err)
+		}
+		return nil
+	}
+
 	configs, err := registrationOption.CSRConfigurations(managedCluster, managedClusterAddonCopy)
 	if err != nil {
 		return fmt.Errorf("failed to get csr configurations: %w", err)
@@ -308,3 +334,39 @@ func (c *addonRegistrationController) sync(ctx context.Context, syncCtx factory.
 	}
 	return nil
 }
+
+// syncPermissionCleanup adds the finalizer constants.HubPermissionCleanupFinalizer to the addon, and cleans up the
+// permission and removes the finalizer once it is the last finalizer of the deleting addon. The permission is kept
+// until the other finalizers are removed, since the agent may still run, e.g. the pre-delete hook. It returns true
+// if the sync should stop.
+func (c *addonRegistrationController) syncPermissionCleanup(ctx context.Context,
+	addonPatcher patcher.Patcher[*addonapiv1alpha1.ManagedClusterAddOn,
+		addonapiv1alpha1.ManagedClusterAddOnSpec, addonapiv1alpha1.ManagedClusterAddOnStatus],
+	permissionCleanup agent.PermissionConfigFunc, addon *addonapiv1alpha1.ManagedClusterAddOn) (bool, error) {
+	if addon.DeletionTimestamp.IsZero() {
+		return addonPatcher.AddFinalizer(ctx, addon, constants.HubPermissionCleanupFinalizer)
+	}
+
+	hasFinalizer := false
+	for _, f := range addon.Finalizers {
+		if f == constants.HubPermissionCleanupFinalizer {
+			hasFinalizer = true
+			break
+		}
+	}
+
+	// no permission is set up once the finalizer is removed, since it cannot be cleaned up anymore.
+	if !hasFinalizer {
+		return true, nil
+	}
+	if len(addon.Finalizers) > 1 {
+		return false, nil
+	}
+
+	// the cluster may be deleted, only its name is required to clean up the permission.
+	cluster := &clusterv1.ManagedCluster{ObjectMeta: metav1.ObjectMeta{Name: addon.Namespace}}
+	if err := permissionCleanup(cluster, addon); err != nil {
+		return true, fmt.Errorf("failed to clean up the permission of managedclusteraddon: %w", err)
+	}
+	return true, addonPatcher.RemoveFinalizer(ctx, addon, constants.HubPermissionCleanupFinalizer)
+}
@@ -14,6 +14,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	clienttesting "k8s.io/client-go/testing"
 	"open-cluster-management.io/addon-framework/pkg/addonmanager/addontesting"
+	"open-cluster-management.io/addon-framework/pkg/addonmanager/constants"
 	"open-cluster-management.io/addon-framework/pkg/agent"
 	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
 	fakeaddon "open-cluster-management.io/api/client/addon/clientset/versioned/fake"
@@ -29,6 +30,7 @@ type testAgent struct {
 	registrations         []addonapiv1alpha1.RegistrationConfig
 	agentInstallNamespace func(addon *addonapiv1alpha1.ManagedClusterAddOn) (string, error)
 	permissionConfig      agent.PermissionConfigFunc
+	permissionCleanup     agent.PermissionConfigFunc
 }
 
 func (t *testAgent) Manifests(cluster *clusterv1.ManagedCluster, addon *addonapiv1alpha1.ManagedClusterAddOn) ([]runtime.Object, error) {
@@ -47,8 +49,9 @@ func (t *testAgent) GetAgentAddonOptions() agent.AgentAddonOptions {
 			CSRConfigurations: func(cluster *clusterv1.ManagedCluster, addon *addonapiv1alpha1.ManagedClusterAddOn) ([]addonapiv1alpha1.RegistrationConfig, error) {
 				return t.registrations, nil
 			},
-			PermissionConfig: t.permissionConfig,
-			Namespace:        t.namespace,
+			PermissionConfig:  t.permissionConfig,
+			PermissionCleanup: t.permissionCleanup,
+			Namespace:         t.namespace,
 		},
 	}
 
@@ -149,6 +152,42 @@ func TestReconcile(t *testing.T) {
 				},
 			}},
 		},
+		{
+			name:    "unsupported kubeClientDriver",
+			cluster: []runtime.Object{addontesting.NewManagedCluster("cluster1")},
+			addon: []runtime.Object{
+				func() *addonapiv1alpha1.ManagedClusterAddOn {
+					addon := addontesting.NewAddon("test", "cluster1", metav1.OwnerReference{
+						Kind: "ClusterManagementAddOn",
+						Name: "test",
+					})
+					addon.Status.KubeClientDriver = "unknown"
+					return addon
+				}(),
+			},
+			validateAddonActions: func(t *testing.T, actions []clienttesting.Action) {
+				addontesting.AssertActions(t, actions, "patch")
+				actual := actions[0].(clienttesting.PatchActionImpl).Patch
+				addOn := &addonapiv1alpha1.ManagedClusterAddOn{}
+				err := json.Unmarshal(actual, addOn)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(addOn.Status.Registrations) != 0 {
+					t.Errorf("expected no registrations, but got %v", addOn.Status.Registrations)
+				}
+				cond := meta.FindStatusCondition(addOn.Status.Conditions, addonapiv1alpha1.ManagedClusterAddOnRegistrationApplied)
+				if cond == nil || cond.Status != metav1.ConditionFalse ||
+					cond.Reason != constants.RegistrationAppliedReasonUnsupportedKubeClientDriver {
+					t.Errorf("unexpected RegistrationApplied condition %v", cond)
+				}
+			},
+			testaddon: &testAgent{name: "test", namespace: "default", registrations: []addonapiv1alpha1.RegistrationConfig{
+				{
+					SignerName: certificatesv1.KubeAPIServerClientSignerName,
+				},
+			}},
+		},
 		{
 			name:    "with registrations and override namespace",
 			cluster: []runtime.Object{addontesting.NewManagedCluster("cluster1")},
@@ -499,6 +538,121 @@ func TestReconcile(t *testing.T) {
 	}
 }
 
+func TestReconcilePermissionCleanup(t *testing.T) {
+	owner := metav1.OwnerReference{Kind: "ClusterManagementAddOn", Name: "test"}
+	cases := []struct {
+		name                 string
+		addon                *addonapiv1alpha1.ManagedClusterAddOn
+		cluster              []runtime.Object
+		expectedCleanup      bool
+		validateAddonActions func(t *testing.T, actions []clienttesting.Action)
+	}{
+		{
+			name:    "add finalizer",
+			cluster: []runtime.Object{addontesting.NewManagedCluster("cluster1")},
+			addon:   addontesting.NewAddon("test", "cluster1", owner),
+			validateAddonActions: func(t *testing.T, actions []clienttesting.Action) {
+				addontesting.AssertActions(t, actions, "patch")
+				addOn := &addonapiv1alpha1.ManagedClusterAddOn{}
+				if err := json.Unmarshal(actions[0].(clienttesting.PatchActionImpl).Patch, addOn); err != nil {
+					t.Fatal(err)
+				}
+				if len(addOn.Finalizers) != 1 || addOn.Finalizers[0] != constants.HubPermissionCleanupFinalizer {
+					t.Errorf("expected the permission cleanup finalizer, but got %v", addOn.Finalizers)
+				}
+			},
+		},
+		{
+			name:    "deleting with other finalizers",
+			cluster: []runtime.Object{addontesting.NewManagedCluster("cluster1")},
+			addon: addontesting.SetAddonFinalizers(
+				addontesting.SetAddonDeletionTimestamp(addontesting.NewAddon("test", "cluster1", owner), time.Now()),
+				addonapiv1alpha1.AddonPreDeleteHookFinalizer, constants.HubPermissionCleanupFinalizer),
+			validateAddonActions: func(t *testing.T, actions []clienttesting.Action) {
+				// the registration is still reconciled for the pre-delete hook
+				addontesting.AssertActions(t, actions, "patch")
+				addOn := &addonapiv1alpha1.ManagedClusterAddOn{}
+				if err := json.Unmarshal(actions[0].(clienttesting.PatchActionImpl).Patch, addOn); err != nil {
+					t.Fatal(err)
+				}
+				if len(addOn.Finalizers) != 0 {
+					t.Errorf("expected finalizers not patched, but got %v", addOn.Finalizers)
+				}
+			},
+		},
+		{
+			name: "deleting with the cluster deleted",
+			addon: addontesting.SetAddonFinalizers(
+				addontesting.SetAddonDeletionTimestamp(addontesting.NewAddon("test", "cluster1", owner), time.Now()),
+				constants.HubPermissionCleanupFinalizer),
+			expectedCleanup: true,
+			validateAddonActions: func(t *testing.T, actions []clienttesting.Action) {
+				addontesting.AssertActions(t, actions, "patch")
+				patch := map[string]map[string]interface{}{}
+				if err := json.Unmarshal(actions[0].(clienttesting.PatchActionImpl).Patch, &patch); err != nil {
+					t.Fatal(err)
+				}
+				if finalizers, ok := patch["metadata"]["finalizers"]; !ok || finalizers != nil {
+					t.Errorf("expected the finalizer removed, but got %v", patch)
+				}
+			},
+		},
+		{
+			name:    "deleting without finalizer",
+			cluster: []runtime.Object{addontesting.NewManagedCluster("cluster1")},
+			addon: addontesting.SetAddonDeletionTimestamp(
+				addontesting.NewAddon("test", "cluster1", owner), time.Now()),
+			validateAddonActions: addontesting.AssertNoActions,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			fakeClusterClient := fakecluster.NewSimpleClientset(c.cluster...)
+			fakeAddonClient := fakeaddon.NewSimpleClientset(c.addon)
+
+			addonInformers := addoninformers.NewSharedInformerFactory(fakeAddonClient, 10*time.Minute)
+			clusterInformers := clusterv1informers.NewSharedInformerFactory(fakeClusterClient, 10*time.Minute)
+			for _, obj := range c.cluster {
+				if err := clusterInformers.Cluster().V1().ManagedClusters().Informer().GetStore().Add(obj); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := addonInformers.Addon().V1alpha1().ManagedClusterAddOns().Informer().GetStore().Add(c.addon); err != nil {
+				t.Fatal(err)
+			}
+
+			cleanedUp := false
+			testAddon := &testAgent{
+				name:          "test",
+				registrations: []addonapiv1alpha1.RegistrationConfig{{SignerName: "test"}},
+				permissionCleanup: func(cluster *clusterv1.ManagedCluster, addon *addonapiv1alpha1.ManagedClusterAddOn) error {
+					if cluster.Name != "cluster1" {
+						t.Errorf("expected cluster1, but got %s", cluster.Name)
+					}
+					cleanedUp = true
+					return nil
+				},
+			}
+			controller := addonRegistrationController{
+				addonClient:               fakeAddonClient,
+				managedClusterLister:      clusterInformers.Cluster().V1().ManagedClusters().Lister(),
+				managedClusterAddonLister: addonInformers.Addon().V1alpha1().ManagedClusterAddOns().Lister(),
+				agentAddons:               map[string]agent.AgentAddon{testAddon.name: testAddon},
+			}
+
+			err := controller.sync(context.TODO(), addontesting.NewFakeSyncContext(t), "cluster1/test")
+			if err != nil {
+				t.Errorf("expected no error when sync: %v", err)
+			}
+			if cleanedUp != c.expectedCleanup {
+				t.Errorf("expected cleanup %v, but got %v", c.expectedCleanup, cleanedUp)
+			}
+			c.validateAddonActions(t, fakeAddonClient.Actions())
+		})
+	}
+}
+
 func TestBuildRegistrationConfigs(t *testing.T) {
 	customSignerName := "example.com/custom-signer"
 	testSubject := addonapiv1alpha1.Subject{
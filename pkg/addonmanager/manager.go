@@ -133,6 +133,7 @@ func (a *addonManager) Start(ctx context.Context) error {
 	addonInformers.Start(ctx.Done())
 	clusterInformers.Start(ctx.Done())
 	dynamicInformers.Start(ctx.Done())
+
 	return nil
 }
 
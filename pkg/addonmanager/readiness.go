@@ -0,0 +1,98 @@
+package addonmanager
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/cache"
+
+	"open-cluster-management.io/sdk-go/pkg/basecontroller/factory"
+)
+
+// Readiness is the readyz checker of the addon manager. The addon manager is ready once it is started, the
+// caches of the tracked informers are synced and all its controllers are running.
+type Readiness struct {
+	lock               sync.RWMutex
+	started            bool
+	unsyncedInformers  sets.Set[string]
+	runningControllers map[string]bool
+}
+
+// NewReadiness returns a Readiness which is not ready until the addon manager is started.
+func NewReadiness() *Readiness {
+	return &Readiness{
+		unsyncedInformers:  sets.New[string](),
+		runningControllers: map[string]bool{},
+	}
+}
+
+// Name returns the name of the readyz check.
+func (r *Readiness) Name() string {
+	return "addon-manager"
+}
+
+// Check returns an error if the addon manager is not ready.
+func (r *Readiness) Check(_ *http.Request) error {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	if !r.started {
+		return fmt.Errorf("addon manager is not started")
+	}
+	if r.unsyncedInformers.Len() > 0 {
+		return fmt.Errorf("caches of informers %v are not synced", sets.List(r.unsyncedInformers))
+	}
+	var stopped []string
+	for name, running := range r.runningControllers {
+		if !running {
+			stopped = append(stopped, name)
+		}
+	}
+	if len(stopped) > 0 {
+		sort.Strings(stopped)
+		return fmt.Errorf("controllers %v are not running", stopped)
+	}
+	return nil
+}
+
+// TrackCacheSync tracks the cache sync of the named informers, the addon manager is not ready until all the
+// cacheSyncs return true. It can be called before the informers are started.
+func (r *Readiness) TrackCacheSync(ctx context.Context, name string, cacheSyncs ...cache.InformerSynced) {
+	r.lock.Lock()
+	r.unsyncedInformers.Insert(name)
+	r.lock.Unlock()
+
+	go func() {
+		if !cache.WaitForCacheSync(ctx.Done(), cacheSyncs...) {
+			return
+		}
+		r.lock.Lock()
+		defer r.lock.Unlock()
+		r.unsyncedInformers.Delete(name)
+	}()
+}
+
+// startController starts a goroutine to run the controller and tracks whether it is running.
+func (r *Readiness) startController(ctx context.Context, controller factory.Controller, workers int) {
+	r.setControllerRunning(controller.Name(), true)
+	go func() {
+		defer r.setControllerRunning(controller.Name(), false)
+		controller.Run(ctx, workers)
+	}()
+}
+
+func (r *Readiness) setControllerRunning(name string, running bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.runningControllers[name] = running
+}
+
+func (r *Readiness) setStarted() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.started = true
+}
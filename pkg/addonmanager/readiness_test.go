@@ -0,0 +1,151 @@
+package addonmanager
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	fakedynamic "k8s.io/client-go/dynamic/fake"
+	kubeinformers "k8s.io/client-go/informers"
+	fakekube "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+	fakeaddon "open-cluster-management.io/api/client/addon/clientset/versioned/fake"
+	addoninformers "open-cluster-management.io/api/client/addon/informers/externalversions"
+	fakecluster "open-cluster-management.io/api/client/cluster/clientset/versioned/fake"
+	clusterv1informers "open-cluster-management.io/api/client/cluster/informers/externalversions"
+	fakework "open-cluster-management.io/api/client/work/clientset/versioned/fake"
+	workinformers "open-cluster-management.io/api/client/work/informers/externalversions"
+
+	"open-cluster-management.io/sdk-go/pkg/basecontroller/factory"
+)
+
+type fakeController struct {
+	name string
+}
+
+func (c *fakeController) Run(ctx context.Context, _ int) {
+	<-ctx.Done()
+}
+
+func (c *fakeController) Sync(_ context.Context, _ factory.SyncContext, _ string) error {
+	return nil
+}
+
+func (c *fakeController) Name() string {
+	return c.name
+}
+
+func (c *fakeController) SyncContext() factory.SyncContext {
+	return nil
+}
+
+func TestReadiness(t *testing.T) {
+	readiness := NewReadiness()
+	if err := readiness.Check(nil); err == nil {
+		t.Errorf("expected not ready before the manager is started")
+	}
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	controllerCtx, stopController := context.WithCancel(ctx)
+	readiness.startController(controllerCtx, &fakeController{name: "test-controller"}, 1)
+
+	var synced atomic.Bool
+	readiness.TrackCacheSync(ctx, "test", synced.Load)
+	readiness.setStarted()
+	if err := readiness.Check(nil); err == nil || err.Error() != "caches of informers [test] are not synced" {
+		t.Errorf("expected informers not synced, but got %v", err)
+	}
+
+	synced.Store(true)
+	if err := wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, time.Second, true,
+		func(context.Context) (bool, error) {
+			return readiness.Check(nil) == nil, nil
+		}); err != nil {
+		t.Errorf("expected ready, but got %v", readiness.Check(nil))
+	}
+
+	stopController()
+	if err := wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, time.Second, true,
+		func(context.Context) (bool, error) {
+			return readiness.Check(nil) != nil, nil
+		}); err != nil {
+		t.Errorf("expected not ready once the controller stopped")
+	}
+	if err := readiness.Check(nil); err.Error() != "controllers [test-controller] are not running" {
+		t.Errorf("unexpected readiness error %v", err)
+	}
+}
+
+// newTestHubServer serves the discovery of the v1 CSR api, which the manager checks before starting the
+// controllers.
+func newTestHubServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api":
+			fmt.Fprint(w, `{"kind":"APIVersions","versions":["v1"]}`)
+		case "/apis":
+			fmt.Fprint(w, `{"kind":"APIGroupList","apiVersion":"v1","groups":[{"name":"certificates.k8s.io",`+
+				`"versions":[{"groupVersion":"certificates.k8s.io/v1","version":"v1"}],`+
+				`"preferredVersion":{"groupVersion":"certificates.k8s.io/v1","version":"v1"}}]}`)
+		case "/apis/certificates.k8s.io/v1":
+			fmt.Fprint(w, `{"kind":"APIResourceList","apiVersion":"v1","groupVersion":"certificates.k8s.io/v1",`+
+				`"resources":[{"name":"certificatesigningrequests","namespaced":false,`+
+				`"kind":"CertificateSigningRequest","verbs":["get","list","watch"]}]}`)
+		default:
+			fmt.Fprint(w, `{"kind":"APIResourceList","apiVersion":"v1","resources":[]}`)
+		}
+	}))
+}
+
+func TestReadinessStartWithInformers(t *testing.T) {
+	server := newTestHubServer()
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	manager := NewBaseAddonManagerImpl(&rest.Config{Host: server.URL})
+	manager.ApplyOptionFuncs()
+	if err := manager.Readiness().Check(nil); err == nil {
+		t.Errorf("expected not ready before the manager is started")
+	}
+
+	kubeInformers := kubeinformers.NewSharedInformerFactory(fakekube.NewSimpleClientset(), 10*time.Minute)
+	addonInformers := addoninformers.NewSharedInformerFactory(fakeaddon.NewSimpleClientset(), 10*time.Minute)
+	clusterInformers := clusterv1informers.NewSharedInformerFactory(fakecluster.NewSimpleClientset(), 10*time.Minute)
+	dynamicInformers := dynamicinformer.NewDynamicSharedInformerFactory(
+		fakedynamic.NewSimpleDynamicClient(runtime.NewScheme()), 10*time.Minute)
+	workClient := fakework.NewSimpleClientset()
+	workInformers := workinformers.NewSharedInformerFactory(workClient, 10*time.Minute)
+
+	if err := manager.StartWithInformers(ctx, workClient, workInformers.Work().V1().ManifestWorks(),
+		kubeInformers, addonInformers, clusterInformers, dynamicInformers); err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.Readiness().Check(nil); err == nil || !strings.Contains(err.Error(), "are not synced") {
+		t.Errorf("expected informers not synced before they are started, but got %v", err)
+	}
+
+	kubeInformers.Start(ctx.Done())
+	addonInformers.Start(ctx.Done())
+	clusterInformers.Start(ctx.Done())
+	dynamicInformers.Start(ctx.Done())
+	workInformers.Start(ctx.Done())
+
+	if err := wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, 10*time.Second, true,
+		func(context.Context) (bool, error) {
+			return manager.Readiness().Check(nil) == nil, nil
+		}); err != nil {
+		t.Errorf("expected ready once the manager is started, but got %v", manager.Readiness().Check(nil))
+	}
+}
@@ -0,0 +1,194 @@
+package sharding
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// ShardGroupLabelKey is the label on the membership leases of the replicas in a shard group.
+	ShardGroupLabelKey = "addon.open-cluster-management.io/shard-group"
+
+	defaultLeaseDurationSeconds = 60
+)
+
+// Sharder distributes the cluster namespaces across the active replicas of the addon manager. Each replica
+// keeps a membership lease labeled with the shard group, and a cluster is owned by one of the live members by
+// rendezvous hashing on the cluster name, so only the clusters of the joining or leaving member move when the
+// membership changes.
+type Sharder struct {
+	kubeClient           kubernetes.Interface
+	namespace            string
+	group                string
+	memberName           string
+	leaseDurationSeconds int32
+
+	lock     sync.RWMutex
+	members  []string
+	handlers []func()
+}
+
+// NewSharder returns a Sharder of the shard group, the membership leases are kept in the namespace.
+func NewSharder(kubeClient kubernetes.Interface, namespace, group string) *Sharder {
+	return &Sharder{
+		kubeClient:           kubeClient,
+		namespace:            namespace,
+		group:                group,
+		memberName:           fmt.Sprintf("%s-%s", group, utilrand.String(8)),
+		leaseDurationSeconds: defaultLeaseDurationSeconds,
+	}
+}
+
+// WithLeaseDuration sets the duration of the membership lease, a replica not renewing its lease in the
+// duration is removed from the members. The default is 60s.
+func (s *Sharder) WithLeaseDuration(duration time.Duration) *Sharder {
+	if seconds := int32(duration / time.Second); seconds > 0 {
+		s.leaseDurationSeconds = seconds
+	}
+	return s
+}
+
+// OnMembershipChange registers a handler called once the members change, so the replica can resync the
+// clusters it owns after rebalancing. It must be called before Start.
+func (s *Sharder) OnMembershipChange(handler func()) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.handlers = append(s.handlers, handler)
+}
+
+// Owns returns whether the cluster is owned by this replica. No cluster is owned before this replica joins
+// the members.
+func (s *Sharder) Owns(clusterName string) bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return owner(s.members, clusterName) == s.memberName
+}
+
+// Members returns the names of the live members sorted.
+func (s *Sharder) Members() []string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return append([]string{}, s.members...)
+}
+
+// Start renews the membership lease of this replica and refreshes the members periodically until the ctx is
+// done, the membership lease is deleted afterwards so the clusters are rebalanced to the other replicas.
+func (s *Sharder) Start(ctx context.Context) {
+	interval := time.Duration(s.leaseDurationSeconds) * time.Second / 3
+	wait.UntilWithContext(ctx, s.sync, interval)
+
+	// use a new context since ctx is done.
+	deleteCtx, cancel := context.WithTimeout(context.Background(), interval)
+	defer cancel()
+	err := s.kubeClient.CoordinationV1().Leases(s.namespace).Delete(deleteCtx, s.memberName, metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		klog.Warningf("Failed to delete membership lease %s/%s: %v", s.namespace, s.memberName, err)
+	}
+}
+
+func (s *Sharder) sync(ctx context.Context) {
+	if err := s.renew(ctx); err != nil {
+		klog.Errorf("Failed to renew membership lease %s/%s: %v", s.namespace, s.memberName, err)
+		return
+	}
+	if err := s.refreshMembers(ctx); err != nil {
+		klog.Errorf("Failed to refresh members of shard group %s: %v", s.group, err)
+	}
+}
+
+func (s *Sharder) renew(ctx context.Context) error {
+	now := metav1.NewMicroTime(time.Now())
+	lease, err := s.kubeClient.CoordinationV1().Leases(s.namespace).Get(ctx, s.memberName, metav1.GetOptions{})
+	switch {
+	case errors.IsNotFound(err):
+		lease = &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      s.memberName,
+				Namespace: s.namespace,
+				Labels:    map[string]string{ShardGroupLabelKey: s.group},
+			},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       &s.memberName,
+				LeaseDurationSeconds: &s.leaseDurationSeconds,
+				AcquireTime:          &now,
+				RenewTime:            &now,
+			},
+		}
+		_, err = s.kubeClient.CoordinationV1().Leases(s.namespace).Create(ctx, lease, metav1.CreateOptions{})
+		return err
+	case err != nil:
+		return err
+	}
+
+	lease = lease.DeepCopy()
+	lease.Spec.RenewTime = &now
+	lease.Spec.LeaseDurationSeconds = &s.leaseDurationSeconds
+	_, err = s.kubeClient.CoordinationV1().Leases(s.namespace).Update(ctx, lease, metav1.UpdateOptions{})
+	return err
+}
+
+func (s *Sharder) refreshMembers(ctx context.Context) error {
+	leases, err := s.kubeClient.CoordinationV1().Leases(s.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(labels.Set{ShardGroupLabelKey: s.group}).String(),
+	})
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var members []string
+	for _, lease := range leases.Items {
+		if lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+			continue
+		}
+		expireAt := lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second)
+		if now.After(expireAt) {
+			continue
+		}
+		members = append(members, lease.Name)
+	}
+	sort.Strings(members)
+
+	s.lock.Lock()
+	changed := !equality.Semantic.DeepEqual(members, s.members)
+	s.members = members
+	handlers := s.handlers
+	s.lock.Unlock()
+
+	if changed {
+		klog.Infof("Members of shard group %s changed to %v", s.group, members)
+		for _, handler := range handlers {
+			handler()
+		}
+	}
+	return nil
+}
+
+// owner returns the member owning the key by rendezvous hashing, which is the member with the highest hash of
+// the member and the key.
+func owner(members []string, key string) string {
+	var owner string
+	var maxScore uint64
+	for _, member := range members {
+		sum := sha256.Sum256([]byte(member + "/" + key))
+		if score := binary.BigEndian.Uint64(sum[:8]); len(owner) == 0 || score > maxScore {
+			owner, maxScore = member, score
+		}
+	}
+	return owner
+}
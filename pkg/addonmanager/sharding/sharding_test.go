@@ -0,0 +1,120 @@
+package sharding
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/ptr"
+)
+
+func newMemberLease(name, group string, renewTime time.Time) *coordinationv1.Lease {
+	return &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "open-cluster-management-hub",
+			Labels:    map[string]string{ShardGroupLabelKey: group},
+		},
+		Spec: coordinationv1.LeaseSpec{
+			LeaseDurationSeconds: ptr.To[int32](60),
+			RenewTime:            &metav1.MicroTime{Time: renewTime},
+		},
+	}
+}
+
+func TestOwner(t *testing.T) {
+	var clusters []string
+	for i := 0; i < 1000; i++ {
+		clusters = append(clusters, fmt.Sprintf("cluster%d", i))
+	}
+
+	members := []string{"member-a", "member-b", "member-c"}
+	owners := map[string]string{}
+	counts := map[string]int{}
+	for _, cluster := range clusters {
+		owners[cluster] = owner(members, cluster)
+		counts[owners[cluster]]++
+	}
+	for _, member := range members {
+		if counts[member] < 200 {
+			t.Errorf("expected clusters distributed across members, but got %v", counts)
+		}
+	}
+
+	// only the clusters of the leaving member move
+	for _, cluster := range clusters {
+		newOwner := owner([]string{"member-a", "member-c"}, cluster)
+		if owners[cluster] != "member-b" && newOwner != owners[cluster] {
+			t.Errorf("expected cluster %s stays on %s, but moved to %s", cluster, owners[cluster], newOwner)
+		}
+	}
+
+	if owner(nil, "cluster1") != "" {
+		t.Errorf("expected no owner without members")
+	}
+}
+
+func TestSync(t *testing.T) {
+	kubeClient := kubefake.NewSimpleClientset([]runtime.Object{
+		newMemberLease("addon-manager-live", "addon-manager", time.Now()),
+		newMemberLease("addon-manager-expired", "addon-manager", time.Now().Add(-2*time.Minute)),
+		newMemberLease("other-live", "other", time.Now()),
+	}...)
+
+	sharder := NewSharder(kubeClient, "open-cluster-management-hub", "addon-manager")
+	changed := 0
+	sharder.OnMembershipChange(func() { changed++ })
+
+	if sharder.Owns("cluster1") {
+		t.Errorf("expected no cluster owned before joining the members")
+	}
+
+	sharder.sync(context.TODO())
+	expected := []string{"addon-manager-live", sharder.memberName}
+	if expected[0] > expected[1] {
+		expected[0], expected[1] = expected[1], expected[0]
+	}
+	members := sharder.Members()
+	if len(members) != 2 || members[0] != expected[0] || members[1] != expected[1] {
+		t.Errorf("expected members %v, but got %v", expected, members)
+	}
+	if changed != 1 {
+		t.Errorf("expected membership change handled once, but got %d", changed)
+	}
+
+	owned := 0
+	for i := 0; i < 100; i++ {
+		if sharder.Owns(fmt.Sprintf("cluster%d", i)) {
+			owned++
+		}
+	}
+	if owned == 0 || owned == 100 {
+		t.Errorf("expected clusters shared with the other member, but owned %d", owned)
+	}
+
+	// the membership does not change
+	sharder.sync(context.TODO())
+	if changed != 1 {
+		t.Errorf("expected membership change handled once, but got %d", changed)
+	}
+}
+
+func TestStart(t *testing.T) {
+	kubeClient := kubefake.NewSimpleClientset()
+	sharder := NewSharder(kubeClient, "open-cluster-management-hub", "addon-manager")
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	sharder.Start(ctx)
+
+	// the membership lease is deleted once stopped
+	if _, err := kubeClient.CoordinationV1().Leases("open-cluster-management-hub").Get(
+		context.TODO(), sharder.memberName, metav1.GetOptions{}); err == nil {
+		t.Errorf("expected membership lease deleted")
+	}
+}
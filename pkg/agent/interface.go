@@ -1,9 +1,14 @@
 package agent
 
 import (
+	"crypto/x509"
 	"fmt"
+	"net/http"
+	"time"
 
 	certificatesv1 "k8s.io/api/certificates/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
@@ -46,6 +51,16 @@ type AgentAddon interface {
 	GetAgentAddonOptions() AgentAddonOptions
 }
 
+// SpecHashFunc returns the spec hash of a config of the group and resource.
+type SpecHashFunc func(group, resource string, config *unstructured.Unstructured) (string, error)
+
+// SpecHashAware is an optional interface of the AgentAddon which computes the spec hashes of its configs, e.g. to
+// check a fetched config is the desired one in the addon status. When the agent is added, the addon manager sets
+// the SpecHashFunc computing the spec hashes with its SpecHashOptions, so the options are only set on the manager.
+type SpecHashAware interface {
+	SetSpecHashFunc(specHashFunc SpecHashFunc)
+}
+
 // AgentAddonOptions prescribes the future customization for the addon.
 type AgentAddonOptions struct {
 	// AddonName is the name of the addon.
@@ -104,9 +119,18 @@ type AgentAddonOptions struct {
 	ManifestConfigs []workapiv1.ManifestConfigOption
 
 	// ConfigCheckEnabled defines whether to check the configured condition before rendering manifests.
+	// When enabled, the manifests are not rendered until the addon is configured and all the configs it
+	// references exist, which is reported by the ConfigValid condition of the addon.
 	// If not set, will be defaulted to false.
 	// +optional
 	ConfigCheckEnabled bool
+
+	// EffectiveImagesEnabled defines whether to record the images of the agent workloads in the rendered
+	// manifests by the EffectiveImages condition of the addon. It is useful to audit the images when they are
+	// overridden or pinned to digests, for example, by addonfactory.GetAgentImageValuesWithOptions.
+	// If not set, will be defaulted to false.
+	// +optional
+	EffectiveImagesEnabled bool
 }
 
 type CSRConfigurationsFunc func(cluster *clusterv1.ManagedCluster,
@@ -115,6 +139,8 @@ type CSRConfigurationsFunc func(cluster *clusterv1.ManagedCluster,
 type CSRSignerFunc func(cluster *clusterv1.ManagedCluster,
 	addon *addonapiv1alpha1.ManagedClusterAddOn, csr *certificatesv1.CertificateSigningRequest) ([]byte, error)
 
+type CRLSignerFunc func(revoked []x509.RevocationListEntry) ([]byte, error)
+
 type CSRApproveFunc func(cluster *clusterv1.ManagedCluster,
 	addon *addonapiv1alpha1.ManagedClusterAddOn, csr *certificatesv1.CertificateSigningRequest) bool
 
@@ -166,10 +192,29 @@ type RegistrationOption struct {
 	// +optional
 	PermissionConfig PermissionConfigFunc
 
+	// PermissionCleanup removes the permission set up by PermissionConfig which is not deleted with the addon,
+	// e.g. the cluster scoped rbac objects which cannot be owned by the addon. If it is set, the addon manager
+	// adds the finalizer constants.HubPermissionCleanupFinalizer to the addon, and calls it once the addon is
+	// deleting and the other finalizers are removed. The cluster may only have the name set if it is deleted.
+	// +optional
+	PermissionCleanup PermissionConfigFunc
+
 	// CSRSign signs a csr and returns a certificate. It is used when the addon has its own customized signer.
 	// The returned byte array shall be a valid non-nil PEM encoded x509 certificate.
 	// +optional
 	CSRSign CSRSignerFunc
+
+	// CRLSign signs a certificate revocation list with the revoked client certificates issued by CSRSign and
+	// returns the PEM encoded CRL. If it is set, the serials revoked in the revocation ConfigMaps of all the
+	// clusters are published in the ConfigMap "addon-<addon name>-crl" in CRLNamespace, so the hub side
+	// servers of the addon can mount it to reject the revoked client certificates.
+	// +optional
+	CRLSign CRLSignerFunc
+
+	// CRLNamespace is the namespace on the hub where the CRL ConfigMap is published. It is required if
+	// CRLSign is set.
+	// +optional
+	CRLNamespace string
 }
 
 type Updater struct {
@@ -184,6 +229,162 @@ type HealthProber struct {
 	Type HealthProberType
 
 	WorkProber *WorkHealthProber
+
+	// LeaseProber makes the addon manager probe the addon lease on the hub when the Type is HealthProberTypeLease,
+	// and set the Available condition with the failing health check published on the lease in the message. The
+	// agent must maintain its lease on the hub with lease.LeaseUpdater.WithHubLease. If it is nil, the addon lease
+	// on the managed cluster is probed by the registration agent, which owns the Available condition.
+	LeaseProber *LeaseHealthProber
+
+	// WorkloadProber configures the additional resources probed when the Type is
+	// HealthProberTypeWorkloadAvailability.
+	WorkloadProber *WorkloadHealthProber
+
+	// CompositeProber configures the sub-probers when the Type is HealthProberTypeComposite.
+	CompositeProber *CompositeHealthProber
+
+	// EndpointProber configures the probing of the agent health endpoint when the Type is
+	// HealthProberTypeEndpoint.
+	EndpointProber *EndpointHealthProber
+}
+
+const (
+	// DefaultEndpointProbeTimeout is the default timeout of a request to the agent health endpoint.
+	DefaultEndpointProbeTimeout = 5 * time.Second
+	// DefaultEndpointProbeInterval is the default interval to probe the agent health endpoint.
+	DefaultEndpointProbeInterval = 30 * time.Second
+)
+
+// EndpointTransport sends the requests from the hub to the endpoints on the managed clusters. The production
+// implementation goes through a tunnel to the managed cluster, for example the cluster-proxy.
+type EndpointTransport interface {
+	// RoundTripper returns the http.RoundTripper sending the requests to the managed cluster.
+	RoundTripper(clusterName string) (http.RoundTripper, error)
+}
+
+// EndpointHealthProber probes the health endpoint exposed by the addon agent, the addon is available if the
+// endpoint responds with a 2xx status code. The endpoints are probed in the background and the results are cached
+// per cluster during the Interval, the latency of the probes is exposed in the
+// addon_agent_health_endpoint_probe_duration_seconds metric.
+type EndpointHealthProber struct {
+	// Transport sends the probe requests to the managed cluster.
+	Transport EndpointTransport
+
+	// URL returns the URL of the health endpoint of the agent on the managed cluster, for example
+	// "https://helloworld-agent.open-cluster-management-agent-addon.svc:8443/healthz".
+	URL func(cluster *clusterv1.ManagedCluster, addon *addonapiv1alpha1.ManagedClusterAddOn) (string, error)
+
+	// Timeout is the timeout of a probe request, defaults to DefaultEndpointProbeTimeout.
+	Timeout time.Duration
+
+	// Interval is the interval to probe the endpoint, defaults to DefaultEndpointProbeInterval.
+	Interval time.Duration
+}
+
+type CompositeOperator string
+
+const (
+	// CompositeOperatorAnd requires all the sub-probers to be available, the addon is degraded if the total weight
+	// of the unavailable sub-probers is less than the UnavailableThreshold.
+	CompositeOperatorAnd CompositeOperator = "And"
+	// CompositeOperatorOr requires any of the sub-probers to be available, the addon is degraded if some of the
+	// sub-probers are unavailable.
+	CompositeOperatorOr CompositeOperator = "Or"
+)
+
+// CompositeHealthProber combines the results of several sub-probers into the Available condition of the addon,
+// the result of each sub-prober is put in the message of the condition.
+type CompositeHealthProber struct {
+	// Operator defines how the results of the sub-probers are combined, defaults to CompositeOperatorAnd.
+	Operator CompositeOperator
+
+	// UnavailableThreshold is the total weight of the unavailable sub-probers at which the addon is unavailable,
+	// the addon is degraded if some sub-probers are unavailable but the total weight is below it. It defaults to 1
+	// for CompositeOperatorAnd and to the total weight of all the sub-probers for CompositeOperatorOr.
+	UnavailableThreshold int32
+
+	// Probers are the sub-probers.
+	Probers []CompositeSubProber
+}
+
+// CompositeSubProber is a sub-prober of the CompositeHealthProber, either a HealthProber or a custom Check.
+type CompositeSubProber struct {
+	// Name identifies the sub-prober in the message of the Available condition.
+	Name string
+
+	// Prober is the sub-prober, the type must not be HealthProberTypeComposite. A HealthProberTypeLease sub-prober
+	// checks the freshness of the addon lease on the hub in the cluster namespace, the leases on the managed
+	// cluster are not visible to the hub, so the agent must maintain its lease on the hub with
+	// lease.LeaseUpdater.WithHubLease.
+	Prober *HealthProber
+
+	// Check is a custom check of the addon, which is used if the Prober is nil. The sub-prober is unavailable if
+	// the check returns an error.
+	Check func(cluster *clusterv1.ManagedCluster, addon *addonapiv1alpha1.ManagedClusterAddOn) error
+
+	// Weight is the weight of the sub-prober when it is unavailable, defaults to 1.
+	Weight int32
+}
+
+// ValidateCompositeSubProber returns an error if the type of the sub-prober is not supported in a composite health
+// prober.
+func ValidateCompositeSubProber(subProber CompositeSubProber) error {
+	if subProber.Prober == nil {
+		return nil
+	}
+	if subProber.Prober.Type == HealthProberTypeComposite {
+		return fmt.Errorf("nested composite prober %s is not supported", subProber.Name)
+	}
+	return nil
+}
+
+// WorkloadHealthProber declares the resources other than the built-in workloads, for example the custom resources,
+// whose availability is checked by the HealthProberTypeWorkloadAvailability prober.
+type WorkloadHealthProber struct {
+	// Resources are the resources to probe, the feedback rules of them are added to the deploy ManifestWorks.
+	Resources []WorkloadResourceProbe
+
+	// ProbeJobs probes the Jobs in the manifests of the addon besides the pre-delete hook Jobs, which are available
+	// once they are completed. The Jobs are not probed by default, since the Jobs which run again, e.g. with the
+	// TTL, or fail on purpose would make the addon unavailable.
+	ProbeJobs bool
+
+	// ReportDegraded enables the built-in HealthResultChecker of the HealthProberTypeWorkloadAvailability prober,
+	// which reports the addon degraded if some of the replicas of an available deployment are not ready. The
+	// Degraded condition of the addon is then owned by the addon manager.
+	ReportDegraded bool
+}
+
+// WorkloadResourceProbe defines how the availability of a resource is checked with the fields of its status. The
+// resource is available if the condition of ConditionType is True and all the JsonPaths have the expected values.
+type WorkloadResourceProbe struct {
+	// ResourceIdentifier sets what resources are probed, the name and namespace support the wildcard "*", for
+	// example "agent-*".
+	ResourceIdentifier workapiv1.ResourceIdentifier
+
+	// ConditionType is the type of the condition in the status which must be True, it is not checked if empty.
+	ConditionType string
+
+	// JsonPaths are the fields under the status with their expected values.
+	JsonPaths []ExpectedJsonPath
+}
+
+// ExpectedJsonPath is a field under the status of the resource with its expected value.
+type ExpectedJsonPath struct {
+	workapiv1.JsonPath
+
+	// Value is the expected value of the field in string format, for example "true", "3" or "Running".
+	Value string
+}
+
+// DefaultLeaseGracePeriodFactor is the default grace period factor of the lease health prober.
+const DefaultLeaseGracePeriodFactor = 2.0
+
+type LeaseHealthProber struct {
+	// GracePeriodFactor is the multiple of the LeaseDurationSeconds of the lease after the last renewal, before
+	// the Available condition of the addon turns unknown. It tolerates the jitter of the renewal and the latency to update the
+	// lease, the default is DefaultLeaseGracePeriodFactor.
+	GracePeriodFactor float64
 }
 
 type AddonHealthCheckFunc func(workapiv1.ResourceIdentifier, workapiv1.StatusFeedbackResult) error
@@ -201,6 +402,32 @@ type WorkHealthProber struct {
 
 	// HealthChecker check status of the addon based of all results of probeFields
 	HealthChecker AddonHealthCheckerFunc
+
+	// HealthResultChecker check status of the addon based of all results of probeFields, and returns a structured
+	// result which is mapped onto the Available, Degraded and Progressing conditions of the addon.
+	// HealthChecker and HealthCheck will be ignored if HealthResultChecker is set.
+	HealthResultChecker AddonHealthResultCheckerFunc
+}
+
+type AddonHealthResultCheckerFunc func([]FieldResult, *clusterv1.ManagedCluster,
+	*addonapiv1alpha1.ManagedClusterAddOn) HealthCheckResult
+
+// HealthCheckResult is the structured result of the AddonHealthResultCheckerFunc.
+type HealthCheckResult struct {
+	// Available is the status of the Available condition, an empty status is regarded as Unknown.
+	Available metav1.ConditionStatus
+
+	// Degraded indicates the addon is running but not fully functional, for example 2 of 3 replicas are ready or
+	// there is a version skew among the agents. It is reflected on the Degraded condition.
+	Degraded bool
+
+	// Progressing indicates the addon agent is rolling out, for example a new version is being deployed. It is
+	// reflected on the Progressing condition, which is set back to completed once the rollout reported by the
+	// health checker completes.
+	Progressing bool
+
+	// Message explains the result, it is set in the message of the conditions.
+	Message string
 }
 
 // ProbeField defines the field of a resource to be probed
@@ -243,10 +470,21 @@ const (
 	// It's a special case of HealthProberTypeWork.
 	HealthProberTypeDeploymentAvailability HealthProberType = "DeploymentAvailability"
 	// HealthProberTypeWorkloadAvailability indicates the healthiness of the addon is connected
-	// with the availability of all the corresponding agent workload resources(only Deployment and
-	// DaemonSet are supported for now) on the managed cluster.
+	// with the availability of all the corresponding agent workload resources(Deployment, DaemonSet,
+	// StatefulSet, and Job if WorkloadProber.ProbeJobs is set) on the managed cluster, and the resources
+	// declared in the WorkloadProber.
+	// The addon is reported degraded if some of the replicas of an available deployment are not ready and
+	// WorkloadProber.ReportDegraded is set.
 	// It's a special case of HealthProberTypeWork.
 	HealthProberTypeWorkloadAvailability HealthProberType = "WorkloadAvailability"
+	// HealthProberTypeComposite indicates the healthiness of the addon is combined from the results
+	// of the sub-probers in the CompositeProber, for example, an addon requires both its agent lease
+	// on the hub and its operand custom resource to be available.
+	HealthProberTypeComposite HealthProberType = "Composite"
+	// HealthProberTypeEndpoint indicates the healthiness of the addon is connected with the response
+	// of the health endpoint exposed by the agent, which is called from the hub through the transport
+	// in the EndpointProber. It refreshes faster than the lease and the status feedback of the work.
+	HealthProberTypeEndpoint HealthProberType = "Endpoint"
 )
 
 func KubeClientSignerConfigurations(addonName, agentName string) CSRConfigurationsFunc {
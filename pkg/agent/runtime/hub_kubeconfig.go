@@ -0,0 +1,135 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/klog/v2"
+
+	"open-cluster-management.io/addon-framework/pkg/utils"
+)
+
+// HubKubeConfig loads the hub kubeconfig produced by the registration, and reloads it once the hub kubeconfig
+// secret mount changes, for example when the client certificate is rotated or the token is refreshed. The clients
+// built with RestConfig send the requests with the reloaded credentials, so the informers keep running without
+// restarting the agent.
+type HubKubeConfig struct {
+	kubeconfigFile string
+	watcher        *utils.ConfigWatcher
+
+	lock      sync.RWMutex
+	server    *url.URL
+	transport http.RoundTripper
+	config    *rest.Config
+}
+
+var _ http.RoundTripper = &HubKubeConfig{}
+
+// NewHubKubeConfig loads the hub kubeconfig, the kubeconfig and the credential files it references are watched once
+// Start is called.
+func NewHubKubeConfig(kubeconfigFile string) (*HubKubeConfig, error) {
+	h := &HubKubeConfig{kubeconfigFile: kubeconfigFile}
+	config, err := h.load()
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{kubeconfigFile}
+	for _, file := range []string{config.CertFile, config.KeyFile, config.CAFile, config.BearerTokenFile} {
+		if len(file) == 0 {
+			continue
+		}
+		if _, err := os.Stat(file); err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	h.watcher, err = utils.NewConfigWatcher("hub-kubeconfig", files...)
+	if err != nil {
+		return nil, err
+	}
+	h.watcher.AddReloadFunc(func(_ []utils.ConfigChange) error {
+		_, err := h.load()
+		return err
+	})
+
+	return h, nil
+}
+
+// Start watches the hub kubeconfig until the ctx is done.
+func (h *HubKubeConfig) Start(ctx context.Context) error {
+	return h.watcher.Start(ctx)
+}
+
+// HealthChecker returns the health checker failing if the hub kubeconfig cannot be reloaded, so the agent is
+// restarted by the liveness probe as a fallback.
+func (h *HubKubeConfig) HealthChecker() *utils.ConfigWatcher {
+	return h.watcher
+}
+
+// RestConfig returns the config sending the requests to the hub with the latest hub kubeconfig. The credentials are
+// not in the returned config, they are added by the transport.
+func (h *HubKubeConfig) RestConfig() *rest.Config {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	return &rest.Config{
+		Host:          h.config.Host,
+		APIPath:       h.config.APIPath,
+		ContentConfig: h.config.ContentConfig,
+		UserAgent:     h.config.UserAgent,
+		QPS:           h.config.QPS,
+		Burst:         h.config.Burst,
+		Timeout:       h.config.Timeout,
+		Transport:     h,
+	}
+}
+
+// RoundTrip sends the request with the transport built from the latest hub kubeconfig, the request is redirected to
+// the latest hub server if the server changes.
+func (h *HubKubeConfig) RoundTrip(req *http.Request) (*http.Response, error) {
+	h.lock.RLock()
+	server, transport := h.server, h.transport
+	h.lock.RUnlock()
+
+	if req.URL.Scheme != server.Scheme || req.URL.Host != server.Host {
+		req = req.Clone(req.Context())
+		req.URL.Scheme, req.URL.Host, req.Host = server.Scheme, server.Host, ""
+	}
+	return transport.RoundTrip(req)
+}
+
+// load builds the transport from the hub kubeconfig, and replaces the current one.
+func (h *HubKubeConfig) load() (*rest.Config, error) {
+	config, err := clientcmd.BuildConfigFromFlags("" /* leave masterurl as empty */, h.kubeconfigFile)
+	if err != nil {
+		return nil, err
+	}
+	server, _, err := rest.DefaultServerURL(config.Host, config.APIPath, schema.GroupVersion{}, rest.IsConfigTransportTLS(*config))
+	if err != nil {
+		return nil, fmt.Errorf("invalid hub server %q: %v", config.Host, err)
+	}
+	transport, err := rest.TransportFor(config)
+	if err != nil {
+		return nil, err
+	}
+
+	h.lock.Lock()
+	previous := h.transport
+	h.server, h.transport, h.config = server, transport, config
+	h.lock.Unlock()
+
+	if previous != nil {
+		// the connections with the previous credentials are closed once they are idle
+		utilnet.CloseIdleConnectionsFor(previous)
+		klog.Infof("Reloaded the hub kubeconfig %s", h.kubeconfigFile)
+	}
+	return config, nil
+}
@@ -0,0 +1,162 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+)
+
+// testHubServer records the bearer tokens of the requests to the version endpoint, it serves TLS since the
+// credentials are only sent to the https servers.
+type testHubServer struct {
+	*httptest.Server
+	lock   sync.Mutex
+	tokens []string
+}
+
+func newTestHubServer() *testHubServer {
+	s := &testHubServer{}
+	s.Server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.lock.Lock()
+		s.tokens = append(s.tokens, r.Header.Get("Authorization"))
+		s.lock.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"major":"1","minor":"35","gitVersion":"v1.35.0"}`)
+	}))
+	return s
+}
+
+func (s *testHubServer) lastToken() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(s.tokens) == 0 {
+		return ""
+	}
+	return s.tokens[len(s.tokens)-1]
+}
+
+func writeHubKubeconfig(t *testing.T, file, server, token string) {
+	kubeconfig := fmt.Sprintf(`apiVersion: v1
+kind: Config
+clusters:
+- name: hub
+  cluster:
+    server: %s
+    insecure-skip-tls-verify: true
+contexts:
+- name: hub
+  context:
+    cluster: hub
+    user: agent
+current-context: hub
+users:
+- name: agent
+  user:
+    token: %s
+`, server, token)
+	// replace the file atomically like the secret mount, so the partially written file is not loaded
+	if err := os.WriteFile(file+".tmp", []byte(kubeconfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(file+".tmp", file); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHubKubeConfigReload(t *testing.T) {
+	hub1, hub2 := newTestHubServer(), newTestHubServer()
+	defer hub1.Close()
+	defer hub2.Close()
+
+	kubeconfigFile := filepath.Join(t.TempDir(), "kubeconfig")
+	writeHubKubeconfig(t, kubeconfigFile, hub1.URL, "token1")
+
+	hubKubeConfig, err := NewHubKubeConfig(kubeconfigFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	go func() {
+		if err := hubKubeConfig.Start(ctx); err != nil {
+			t.Errorf("failed to watch the hub kubeconfig: %v", err)
+		}
+	}()
+
+	// the client is built once and keeps working after the hub kubeconfig is reloaded
+	client, err := kubernetes.NewForConfig(hubKubeConfig.RestConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Discovery().ServerVersion(); err != nil {
+		t.Fatal(err)
+	}
+	if token := hub1.lastToken(); token != "Bearer token1" {
+		t.Errorf("expected token1, but got %q", token)
+	}
+
+	cases := []struct {
+		name   string
+		server *testHubServer
+		token  string
+	}{
+		{name: "token refreshed", server: hub1, token: "token2"},
+		{name: "server changed", server: hub2, token: "token3"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			expected := "Bearer " + c.token
+			err := wait.PollUntilContextTimeout(ctx, 100*time.Millisecond, 10*time.Second, true,
+				func(context.Context) (bool, error) {
+					writeHubKubeconfig(t, kubeconfigFile, c.server.URL, c.token)
+					if _, err := client.Discovery().ServerVersion(); err != nil {
+						return false, err
+					}
+					return c.server.lastToken() == expected, nil
+				})
+			if err != nil {
+				t.Errorf("expected the request with %q to %s, but got %v", expected, c.server.URL, err)
+			}
+		})
+	}
+
+	if err := hubKubeConfig.HealthChecker().Check(nil); err != nil {
+		t.Errorf("expected the health checker to pass, but got %v", err)
+	}
+}
+
+func TestHubKubeConfigReloadFailed(t *testing.T) {
+	kubeconfigFile := filepath.Join(t.TempDir(), "kubeconfig")
+	writeHubKubeconfig(t, kubeconfigFile, "https://hub.example.com:6443", "token1")
+
+	hubKubeConfig, err := NewHubKubeConfig(kubeconfigFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	go func() {
+		_ = hubKubeConfig.Start(ctx)
+	}()
+
+	// the agent falls back to be restarted by the liveness probe if the hub kubeconfig cannot be loaded
+	err = wait.PollUntilContextTimeout(ctx, 100*time.Millisecond, 10*time.Second, true,
+		func(context.Context) (bool, error) {
+			if err := os.WriteFile(kubeconfigFile, []byte("invalid"), 0600); err != nil {
+				return false, err
+			}
+			return hubKubeConfig.HealthChecker().Check(nil) != nil, nil
+		})
+	if err != nil {
+		t.Errorf("expected the health checker to fail, but got %v", err)
+	}
+}
@@ -0,0 +1,22 @@
+package runtime
+
+import (
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+)
+
+var (
+	// tokenExpirationTimestampSeconds records when the token of the addon agent expires, so the alerts can fire
+	// before the agent loses the access to the hub if the renewal keeps failing.
+	tokenExpirationTimestampSeconds = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Name: "addon_agent_token_expiration_timestamp_seconds",
+			Help: "Unix timestamp in seconds when the hub token of the addon agent expires, labeled by cluster and addon.",
+		},
+		[]string{"cluster", "addon"},
+	)
+)
+
+func init() {
+	legacyregistry.MustRegister(tokenExpirationTimestampSeconds)
+}
@@ -0,0 +1,130 @@
+package runtime
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	addonv1alpha1client "open-cluster-management.io/api/client/addon/clientset/versioned"
+)
+
+// AgentOptions defines the common flags of the addon agents.
+type AgentOptions struct {
+	HubKubeconfigFile     string
+	ManagedKubeconfigFile string
+	SpokeClusterName      string
+	AddonName             string
+	AddonNamespace        string
+}
+
+// NewAgentOptions returns the flags with default value set
+func NewAgentOptions(addonName string) *AgentOptions {
+	return &AgentOptions{AddonName: addonName}
+}
+
+// AddFlags registers the flags of the agent command.
+func (o *AgentOptions) AddFlags(cmd *cobra.Command) {
+	flags := cmd.Flags()
+	flags.StringVar(&o.HubKubeconfigFile, "hub-kubeconfig", o.HubKubeconfigFile,
+		"Location of kubeconfig file to connect to hub cluster.")
+	flags.StringVar(&o.ManagedKubeconfigFile, "managed-kubeconfig", o.ManagedKubeconfigFile,
+		"Location of kubeconfig file to connect to the managed cluster.")
+	flags.StringVar(&o.SpokeClusterName, "cluster-name", o.SpokeClusterName, "Name of spoke cluster.")
+	flags.StringVar(&o.AddonNamespace, "addon-namespace", o.AddonNamespace, "Installation namespace of addon.")
+	flags.StringVar(&o.AddonName, "addon-name", o.AddonName, "name of the addon.")
+}
+
+// AddCleanupFlags registers the flags of the cleanup command, which only connects to the managed cluster.
+func (o *AgentOptions) AddCleanupFlags(cmd *cobra.Command) {
+	flags := cmd.Flags()
+	flags.StringVar(&o.AddonNamespace, "addon-namespace", o.AddonNamespace, "Installation namespace of addon.")
+	flags.StringVar(&o.ManagedKubeconfigFile, "managed-kubeconfig", o.ManagedKubeconfigFile,
+		"Location of kubeconfig file to connect to the managed cluster.")
+}
+
+// Validate checks the flags of the agent command are set.
+func (o *AgentOptions) Validate() error {
+	if len(o.HubKubeconfigFile) == 0 {
+		return fmt.Errorf("hub kubeconfig is required")
+	}
+	if len(o.SpokeClusterName) == 0 {
+		return fmt.Errorf("cluster name is required")
+	}
+	if len(o.AddonName) == 0 {
+		return fmt.Errorf("addon name is required")
+	}
+	if len(o.AddonNamespace) == 0 {
+		return fmt.Errorf("addon namespace is required")
+	}
+	return nil
+}
+
+// AgentContext holds the clients of the agent built from the options, it is passed to the controllers of the agent.
+type AgentContext struct {
+	ClusterName    string
+	AddonName      string
+	AddonNamespace string
+
+	// HubKubeConfig sends the requests with the credentials reloaded from the hub kubeconfig, it is nil in the
+	// cleanup command.
+	HubKubeConfig  *rest.Config
+	HubKubeClient  kubernetes.Interface
+	HubAddonClient addonv1alpha1client.Interface
+
+	// ManagementKubeConfig is the config of the cluster the agent runs on, which is the hosting cluster in the
+	// Hosted mode.
+	ManagementKubeConfig *rest.Config
+	ManagementKubeClient kubernetes.Interface
+
+	// ManagedKubeConfig is loaded from the managed kubeconfig, it is the same as the ManagementKubeConfig if the
+	// managed kubeconfig is not set.
+	ManagedKubeConfig *rest.Config
+	ManagedKubeClient kubernetes.Interface
+}
+
+// buildAgentContext builds the clients of the managed cluster, and of the hub if hubKubeConfig is not nil.
+func (o *AgentOptions) buildAgentContext(kubeConfig *rest.Config, hubKubeConfig *HubKubeConfig) (*AgentContext, error) {
+	agentCtx := &AgentContext{
+		ClusterName:          o.SpokeClusterName,
+		AddonName:            o.AddonName,
+		AddonNamespace:       o.AddonNamespace,
+		ManagementKubeConfig: kubeConfig,
+		ManagedKubeConfig:    kubeConfig,
+	}
+
+	var err error
+	agentCtx.ManagementKubeClient, err = kubernetes.NewForConfig(kubeConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	agentCtx.ManagedKubeClient = agentCtx.ManagementKubeClient
+	if len(o.ManagedKubeconfigFile) != 0 {
+		agentCtx.ManagedKubeConfig, err = clientcmd.BuildConfigFromFlags("", /* leave masterurl as empty */
+			o.ManagedKubeconfigFile)
+		if err != nil {
+			return nil, err
+		}
+		agentCtx.ManagedKubeClient, err = kubernetes.NewForConfig(agentCtx.ManagedKubeConfig)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if hubKubeConfig == nil {
+		return agentCtx, nil
+	}
+
+	agentCtx.HubKubeConfig = hubKubeConfig.RestConfig()
+	agentCtx.HubKubeClient, err = kubernetes.NewForConfig(agentCtx.HubKubeConfig)
+	if err != nil {
+		return nil, err
+	}
+	agentCtx.HubAddonClient, err = addonv1alpha1client.NewForConfig(agentCtx.HubKubeConfig)
+	if err != nil {
+		return nil, err
+	}
+	return agentCtx, nil
+}
@@ -0,0 +1,180 @@
+// Package runtime provides the boilerplate of the addon agents running on the managed clusters, the agents only
+// supply their controllers.
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apiserver/pkg/server/healthz"
+	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+
+	cmdfactory "open-cluster-management.io/addon-framework/pkg/cmd/factory"
+	"open-cluster-management.io/addon-framework/pkg/lease"
+	"open-cluster-management.io/addon-framework/pkg/utils"
+	"open-cluster-management.io/addon-framework/pkg/version"
+)
+
+// RunFunc starts the controllers of the agent with the clients in the agentCtx, and blocks until the ctx is done.
+type RunFunc func(ctx context.Context, agentCtx *AgentContext) error
+
+// AgentConfig wires up the addon agent: the hub and managed cluster clients, the reload of the hub kubeconfig, the
+// lease updater, the config checker and the graceful shutdown.
+type AgentConfig struct {
+	componentName       string
+	options             *AgentOptions
+	runFunc             RunFunc
+	leaseHealthChecks   []lease.HealthCheck
+	disableLeaseUpdater bool
+	configFiles         []string
+	shutdownHooks       []cmdfactory.ShutdownHook
+	configChecker       *deferredHealthChecker
+}
+
+// NewAgentConfig returns an AgentConfig running the runFunc with the clients built from the options.
+func NewAgentConfig(componentName string, options *AgentOptions, runFunc RunFunc) *AgentConfig {
+	return &AgentConfig{
+		componentName: componentName,
+		options:       options,
+		runFunc:       runFunc,
+		configChecker: &deferredHealthChecker{name: "agent-config"},
+	}
+}
+
+// WithLeaseHealthChecks appends the health checks of the lease updater, the lease is only renewed when all of them
+// pass.
+func (c *AgentConfig) WithLeaseHealthChecks(healthChecks ...lease.HealthCheck) *AgentConfig {
+	c.leaseHealthChecks = append(c.leaseHealthChecks, healthChecks...)
+	return c
+}
+
+// WithoutLeaseUpdater disables the lease updater, for the addons whose health prober is not the lease prober.
+func (c *AgentConfig) WithoutLeaseUpdater() *AgentConfig {
+	c.disableLeaseUpdater = true
+	return c
+}
+
+// WithConfigFiles appends the config files checked by the config checker, the agent is restarted by the liveness
+// probe once they change.
+func (c *AgentConfig) WithConfigFiles(configFiles ...string) *AgentConfig {
+	c.configFiles = append(c.configFiles, configFiles...)
+	return c
+}
+
+// WithShutdownHooks appends the hooks called in order once the controllers are stopped.
+func (c *AgentConfig) WithShutdownHooks(hooks ...cmdfactory.ShutdownHook) *AgentConfig {
+	c.shutdownHooks = append(c.shutdownHooks, hooks...)
+	return c
+}
+
+// NewCommand returns the command running the agent.
+func (c *AgentConfig) NewCommand() *cobra.Command {
+	cmd := cmdfactory.
+		NewControllerCommandConfig(c.componentName, version.Get(), c.run).
+		WithHealthChecks(c.configChecker).
+		WithShutdownHooks(c.shutdownHooks...).
+		NewCommand()
+	cmd.Use = "agent"
+	cmd.Short = "Start the addon agent"
+
+	c.options.AddFlags(cmd)
+	return cmd
+}
+
+// NewCleanupCommand returns the command running the cleanupFunc, which cleans up the resources of the agent on the
+// managed cluster, for example in a pre-delete job. The hub clients are not set in the agentCtx of the cleanupFunc.
+func NewCleanupCommand(componentName string, options *AgentOptions, cleanupFunc RunFunc) *cobra.Command {
+	cmd := cmdfactory.
+		NewControllerCommandConfig(componentName, version.Get(), func(ctx context.Context, kubeConfig *rest.Config) error {
+			agentCtx, err := options.buildAgentContext(kubeConfig, nil)
+			if err != nil {
+				return err
+			}
+			return cleanupFunc(ctx, agentCtx)
+		}).
+		NewCommand()
+	cmd.Use = "cleanup"
+	cmd.Short = "Clean up the resources of the addon agent"
+
+	options.AddCleanupFlags(cmd)
+	return cmd
+}
+
+// run is the StartFunc of the command, it builds the clients, starts the lease updater and runs the controllers.
+func (c *AgentConfig) run(ctx context.Context, kubeConfig *rest.Config) error {
+	if err := c.options.Validate(); err != nil {
+		return err
+	}
+
+	// the hub kubeconfig is reloaded in process, the agent is only restarted if it fails to reload
+	hubKubeConfig, err := NewHubKubeConfig(c.options.HubKubeconfigFile)
+	if err != nil {
+		return err
+	}
+	go func() {
+		if err := hubKubeConfig.Start(ctx); err != nil {
+			klog.Errorf("failed to watch the hub kubeconfig: %v", err)
+		}
+	}()
+	checkers := []healthz.HealthChecker{hubKubeConfig.HealthChecker()}
+
+	if len(c.configFiles) > 0 {
+		configChecker, err := utils.NewConfigChecker(c.configChecker.name, c.configFiles...)
+		if err != nil {
+			return err
+		}
+		checkers = append(checkers, configChecker)
+	}
+	c.configChecker.set(checkers...)
+
+	agentCtx, err := c.options.buildAgentContext(kubeConfig, hubKubeConfig)
+	if err != nil {
+		return err
+	}
+
+	if !c.disableLeaseUpdater {
+		leaseUpdater := lease.NewLeaseUpdater(
+			agentCtx.ManagementKubeClient,
+			c.options.AddonName,
+			c.options.AddonNamespace,
+		).WithHealthChecks(c.leaseHealthChecks...)
+		go leaseUpdater.Start(ctx)
+	}
+
+	return c.runFunc(ctx, agentCtx)
+}
+
+// deferredHealthChecker is registered to the health checks when the command is built, and delegates to the
+// checkers set once the flags are parsed. It passes until the checkers are set.
+type deferredHealthChecker struct {
+	name     string
+	lock     sync.RWMutex
+	checkers []healthz.HealthChecker
+}
+
+var _ healthz.HealthChecker = &deferredHealthChecker{}
+
+func (d *deferredHealthChecker) set(checkers ...healthz.HealthChecker) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.checkers = checkers
+}
+
+func (d *deferredHealthChecker) Name() string {
+	return d.name
+}
+
+func (d *deferredHealthChecker) Check(req *http.Request) error {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	for _, checker := range d.checkers {
+		if err := checker.Check(req); err != nil {
+			return fmt.Errorf("%s: %v", checker.Name(), err)
+		}
+	}
+	return nil
+}
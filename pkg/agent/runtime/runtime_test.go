@@ -0,0 +1,130 @@
+package runtime
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"k8s.io/client-go/rest"
+)
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: hub
+  cluster:
+    server: https://hub.example.com:6443
+contexts:
+- name: hub
+  context:
+    cluster: hub
+    user: agent
+current-context: hub
+users:
+- name: agent
+  user:
+    token: test-token
+`
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		name        string
+		options     *AgentOptions
+		expectedErr bool
+	}{
+		{
+			name: "valid",
+			options: &AgentOptions{HubKubeconfigFile: "/var/run/hub/kubeconfig", SpokeClusterName: "cluster1",
+				AddonName: "test", AddonNamespace: "open-cluster-management-agent-addon"},
+		},
+		{
+			name: "no hub kubeconfig",
+			options: &AgentOptions{SpokeClusterName: "cluster1", AddonName: "test",
+				AddonNamespace: "open-cluster-management-agent-addon"},
+			expectedErr: true,
+		},
+		{
+			name: "no cluster name",
+			options: &AgentOptions{HubKubeconfigFile: "/var/run/hub/kubeconfig", AddonName: "test",
+				AddonNamespace: "open-cluster-management-agent-addon"},
+			expectedErr: true,
+		},
+		{
+			name:        "no addon namespace",
+			options:     &AgentOptions{HubKubeconfigFile: "/var/run/hub/kubeconfig", SpokeClusterName: "cluster1", AddonName: "test"},
+			expectedErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := c.options.Validate()
+			if c.expectedErr && err == nil {
+				t.Errorf("expected error, but got none")
+			}
+			if !c.expectedErr && err != nil {
+				t.Errorf("unexpected error %v", err)
+			}
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	hubKubeconfig := filepath.Join(dir, "kubeconfig")
+	if err := os.WriteFile(hubKubeconfig, []byte(testKubeconfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	options := NewAgentOptions("test")
+	options.HubKubeconfigFile = hubKubeconfig
+	options.SpokeClusterName = "cluster1"
+	options.AddonNamespace = "open-cluster-management-agent-addon"
+
+	configFile := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(configFile, []byte("key: value\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var agentCtx *AgentContext
+	config := NewAgentConfig("test-agent", options, func(_ context.Context, ctx *AgentContext) error {
+		agentCtx = ctx
+		return nil
+	}).WithoutLeaseUpdater().WithConfigFiles(configFile)
+
+	if err := config.configChecker.Check(nil); err != nil {
+		t.Errorf("expected the config checker to pass before the agent runs, but got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	kubeConfig := &rest.Config{Host: "https://managed.example.com:6443"}
+	if err := config.run(ctx, kubeConfig); err != nil {
+		t.Fatal(err)
+	}
+
+	if agentCtx.ClusterName != "cluster1" || agentCtx.AddonName != "test" ||
+		agentCtx.AddonNamespace != "open-cluster-management-agent-addon" {
+		t.Errorf("unexpected agent context %v", agentCtx)
+	}
+	if agentCtx.HubKubeConfig.Host != "https://hub.example.com:6443" || agentCtx.HubKubeConfig.Transport == nil {
+		t.Errorf("unexpected hub kubeconfig %v", agentCtx.HubKubeConfig)
+	}
+	if agentCtx.ManagedKubeConfig != kubeConfig || agentCtx.ManagedKubeClient != agentCtx.ManagementKubeClient {
+		t.Errorf("expected the managed cluster clients to be the management cluster clients")
+	}
+	if agentCtx.HubKubeClient == nil || agentCtx.HubAddonClient == nil {
+		t.Errorf("expected the hub clients to be built")
+	}
+
+	if err := config.configChecker.Check(nil); err != nil {
+		t.Errorf("expected the config checker to pass, but got %v", err)
+	}
+	if err := os.WriteFile(configFile, []byte("key: changed\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.configChecker.Check(nil); err == nil {
+		t.Errorf("expected the config checker to fail once the config file changes")
+	}
+}
@@ -0,0 +1,250 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/klog/v2"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	addonv1alpha1client "open-cluster-management.io/api/client/addon/clientset/versioned"
+	"open-cluster-management.io/sdk-go/pkg/patcher"
+
+	"open-cluster-management.io/addon-framework/pkg/utils"
+)
+
+const (
+	// defaultTokenRenewRatio renews the token once 80% of its lifetime passes.
+	defaultTokenRenewRatio = 0.8
+	// defaultTokenRetryInterval is the interval to request the token again once the request fails.
+	defaultTokenRetryInterval = 10 * time.Second
+)
+
+// TokenDriver requests the tokens the addon agent authenticates to the hub with.
+type TokenDriver interface {
+	// RequestToken returns a new token and its expiration time.
+	RequestToken(ctx context.Context) (token string, expirationTime time.Time, err error)
+
+	// Subject returns the subject the tokens authenticate as, the hub binds the permissions of the addon to it.
+	Subject() addonapiv1alpha1.Subject
+}
+
+type serviceAccountTokenDriver struct {
+	client            corev1client.ServiceAccountsGetter
+	namespace         string
+	name              string
+	audiences         []string
+	expirationSeconds int64
+}
+
+// NewServiceAccountTokenDriver returns a TokenDriver requesting the tokens of the service account on the hub with
+// the TokenRequest API.
+func NewServiceAccountTokenDriver(client corev1client.ServiceAccountsGetter, namespace, name string,
+	audiences []string, expirationSeconds int64) TokenDriver {
+	return &serviceAccountTokenDriver{
+		client:            client,
+		namespace:         namespace,
+		name:              name,
+		audiences:         audiences,
+		expirationSeconds: expirationSeconds,
+	}
+}
+
+func (d *serviceAccountTokenDriver) RequestToken(ctx context.Context) (string, time.Time, error) {
+	tokenRequest := &authenticationv1.TokenRequest{
+		Spec: authenticationv1.TokenRequestSpec{
+			Audiences: d.audiences,
+		},
+	}
+	if d.expirationSeconds > 0 {
+		tokenRequest.Spec.ExpirationSeconds = &d.expirationSeconds
+	}
+	tokenRequest, err := d.client.ServiceAccounts(d.namespace).CreateToken(ctx, d.name, tokenRequest, metav1.CreateOptions{})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return tokenRequest.Status.Token, tokenRequest.Status.ExpirationTimestamp.Time, nil
+}
+
+func (d *serviceAccountTokenDriver) Subject() addonapiv1alpha1.Subject {
+	// the service account groups are not reported, since they include all the service accounts
+	return addonapiv1alpha1.Subject{
+		User: fmt.Sprintf("system:serviceaccount:%s:%s", d.namespace, d.name),
+	}
+}
+
+// TokenRenewer requests the token with the driver, writes it into the token file referenced by the hub kubeconfig,
+// and renews it before it expires.
+//
+// It reports the subject of the token into the kube-apiserver-client registration of the addon, which the hub keeps
+// for the token driver. Like the CSR driver, the RegistrationApplied condition stays False with the reason
+// PermissionConfigPending until the subject is reported, and turns True once the hub binds the permissions.
+type TokenRenewer struct {
+	driver        TokenDriver
+	tokenFile     string
+	addonClient   addonv1alpha1client.Interface
+	clusterName   string
+	addonName     string
+	renewRatio    float64
+	retryInterval time.Duration
+
+	lock           sync.RWMutex
+	expirationTime time.Time
+}
+
+// NewTokenRenewer returns a TokenRenewer writing the token into the tokenFile. The subject is not reported if the
+// addonClient is nil.
+func NewTokenRenewer(driver TokenDriver, tokenFile string, addonClient addonv1alpha1client.Interface,
+	clusterName, addonName string) *TokenRenewer {
+	return &TokenRenewer{
+		driver:        driver,
+		tokenFile:     tokenFile,
+		addonClient:   addonClient,
+		clusterName:   clusterName,
+		addonName:     addonName,
+		renewRatio:    defaultTokenRenewRatio,
+		retryInterval: defaultTokenRetryInterval,
+	}
+}
+
+// ExpirationTime returns the expiration time of the current token, it is zero before the token is requested or if
+// the token never expires.
+func (r *TokenRenewer) ExpirationTime() time.Time {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.expirationTime
+}
+
+// Start renews the token until the ctx is done.
+func (r *TokenRenewer) Start(ctx context.Context) {
+	for {
+		interval, err := r.renew(ctx)
+		if err != nil {
+			klog.Errorf("Failed to renew the token of addon %s: %v", r.addonName, err)
+			interval = r.retryInterval
+		}
+		if interval == 0 {
+			// the token never expires
+			<-ctx.Done()
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait.Jitter(interval, 0.1)):
+		}
+	}
+}
+
+// renew requests a new token, and returns the interval until the token should be renewed again. The interval is
+// zero if the token never expires.
+func (r *TokenRenewer) renew(ctx context.Context) (time.Duration, error) {
+	token, expirationTime, err := r.driver.RequestToken(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to request token: %v", err)
+	}
+	if expirationTime.IsZero() {
+		// fall back to the exp claim if the driver does not return the expiration time, the tokens which are not
+		// JWTs are treated as never expiring.
+		if expirationTime, err = utils.TokenExpirationTime(token); err != nil {
+			klog.V(4).Infof("Failed to read the expiration time of the token of addon %s: %v", r.addonName, err)
+		}
+	}
+	if err := writeFileAtomically(r.tokenFile, []byte(token)); err != nil {
+		return 0, fmt.Errorf("failed to write token: %v", err)
+	}
+
+	now := time.Now()
+	r.lock.Lock()
+	r.expirationTime = expirationTime
+	r.lock.Unlock()
+	if expirationTime.IsZero() {
+		tokenExpirationTimestampSeconds.DeleteLabelValues(r.clusterName, r.addonName)
+		klog.V(4).Infof("Renewed the token of addon %s, it never expires", r.addonName)
+	} else {
+		tokenExpirationTimestampSeconds.WithLabelValues(r.clusterName, r.addonName).Set(float64(expirationTime.Unix()))
+		klog.V(4).Infof("Renewed the token of addon %s, it expires at %v", r.addonName, expirationTime)
+	}
+
+	if err := r.reportSubject(ctx); err != nil {
+		return 0, err
+	}
+
+	if expirationTime.IsZero() {
+		return 0, nil
+	}
+	interval := time.Duration(float64(expirationTime.Sub(now)) * r.renewRatio)
+	if interval < r.retryInterval {
+		interval = r.retryInterval
+	}
+	return interval, nil
+}
+
+// reportSubject sets the subject of the token into the kube-apiserver-client registration of the addon.
+func (r *TokenRenewer) reportSubject(ctx context.Context) error {
+	if r.addonClient == nil {
+		return nil
+	}
+
+	addon, err := r.addonClient.AddonV1alpha1().ManagedClusterAddOns(r.clusterName).Get(ctx, r.addonName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	addonCopy := addon.DeepCopy()
+	addonCopy.Status.KubeClientDriver = utils.KubeClientDriverToken
+	subject := r.driver.Subject()
+	found := false
+	for i := range addonCopy.Status.Registrations {
+		if addonCopy.Status.Registrations[i].SignerName == certificatesv1.KubeAPIServerClientSignerName {
+			addonCopy.Status.Registrations[i].Subject = subject
+			found = true
+		}
+	}
+	if !found {
+		addonCopy.Status.Registrations = append(addonCopy.Status.Registrations, addonapiv1alpha1.RegistrationConfig{
+			SignerName: certificatesv1.KubeAPIServerClientSignerName,
+			Subject:    subject,
+		})
+	}
+	if equality.Semantic.DeepEqual(addonCopy.Status, addon.Status) {
+		return nil
+	}
+
+	addonPatcher := patcher.NewPatcher[
+		*addonapiv1alpha1.ManagedClusterAddOn,
+		addonapiv1alpha1.ManagedClusterAddOnSpec,
+		addonapiv1alpha1.ManagedClusterAddOnStatus](r.addonClient.AddonV1alpha1().ManagedClusterAddOns(r.clusterName))
+	if _, err := addonPatcher.PatchStatus(ctx, addonCopy, addonCopy.Status, addon.Status); err != nil {
+		return fmt.Errorf("failed to report the token subject of addon %s: %v", r.addonName, err)
+	}
+	return nil
+}
+
+// writeFileAtomically replaces the file with the data, so the readers never read a partially written file.
+func writeFileAtomically(file string, data []byte) error {
+	tmpFile, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := tmpFile.Write(data); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile.Name(), file)
+}
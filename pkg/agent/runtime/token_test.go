@@ -0,0 +1,238 @@
+package runtime
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	fakeaddon "open-cluster-management.io/api/client/addon/clientset/versioned/fake"
+
+	"open-cluster-management.io/addon-framework/pkg/addonmanager/addontesting"
+	"open-cluster-management.io/addon-framework/pkg/utils"
+)
+
+type testTokenDriver struct {
+	// token is returned if it is set, otherwise the tokens are numbered.
+	token          string
+	tokens         int
+	expirationTime time.Time
+	err            error
+}
+
+func (d *testTokenDriver) RequestToken(_ context.Context) (string, time.Time, error) {
+	if d.err != nil {
+		return "", time.Time{}, d.err
+	}
+	d.tokens++
+	if len(d.token) > 0 {
+		return d.token, d.expirationTime, nil
+	}
+	return fmt.Sprintf("token%d", d.tokens), d.expirationTime, nil
+}
+
+func (d *testTokenDriver) Subject() addonapiv1alpha1.Subject {
+	return addonapiv1alpha1.Subject{User: "system:serviceaccount:cluster1:test"}
+}
+
+func TestTokenRenewer(t *testing.T) {
+	cases := []struct {
+		name                  string
+		driverErr             error
+		registrations         []addonapiv1alpha1.RegistrationConfig
+		expectedRegistrations []addonapiv1alpha1.RegistrationConfig
+		expectedErr           bool
+	}{
+		{
+			name: "subject reported",
+			registrations: []addonapiv1alpha1.RegistrationConfig{
+				{SignerName: certificatesv1.KubeAPIServerClientSignerName},
+				{SignerName: "example.com/signer", Subject: addonapiv1alpha1.Subject{User: "other"}},
+			},
+			expectedRegistrations: []addonapiv1alpha1.RegistrationConfig{
+				{
+					SignerName: certificatesv1.KubeAPIServerClientSignerName,
+					Subject:    addonapiv1alpha1.Subject{User: "system:serviceaccount:cluster1:test"},
+				},
+				{SignerName: "example.com/signer", Subject: addonapiv1alpha1.Subject{User: "other"}},
+			},
+		},
+		{
+			name: "registration added",
+			expectedRegistrations: []addonapiv1alpha1.RegistrationConfig{
+				{
+					SignerName: certificatesv1.KubeAPIServerClientSignerName,
+					Subject:    addonapiv1alpha1.Subject{User: "system:serviceaccount:cluster1:test"},
+				},
+			},
+		},
+		{
+			name:        "token request failed",
+			driverErr:   fmt.Errorf("forbidden"),
+			expectedErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			addon := addontesting.NewAddon("test", "cluster1")
+			addon.Status.Registrations = c.registrations
+			addonClient := fakeaddon.NewSimpleClientset(addon)
+
+			tokenFile := filepath.Join(t.TempDir(), "token")
+			driver := &testTokenDriver{expirationTime: time.Now().Add(time.Hour), err: c.driverErr}
+			renewer := NewTokenRenewer(driver, tokenFile, addonClient, "cluster1", "test")
+
+			interval, err := renewer.renew(context.TODO())
+			if c.expectedErr {
+				if err == nil {
+					t.Errorf("expected error, but got none")
+				}
+				if !renewer.ExpirationTime().IsZero() {
+					t.Errorf("expected no expiration time, but got %v", renewer.ExpirationTime())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// renewed after 80% of the lifetime
+			if interval < 47*time.Minute || interval > 48*time.Minute {
+				t.Errorf("unexpected renew interval %v", interval)
+			}
+			if !renewer.ExpirationTime().Equal(driver.expirationTime) {
+				t.Errorf("expected expiration time %v, but got %v", driver.expirationTime, renewer.ExpirationTime())
+			}
+			token, err := os.ReadFile(tokenFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(token) != "token1" {
+				t.Errorf("expected token1, but got %q", token)
+			}
+
+			addontesting.AssertActions(t, addonClient.Actions(), "get", "patch")
+			actual, err := addonClient.AddonV1alpha1().ManagedClusterAddOns("cluster1").Get(context.TODO(), "test", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if actual.Status.KubeClientDriver != utils.KubeClientDriverToken {
+				t.Errorf("expected kubeClientDriver token, but got %q", actual.Status.KubeClientDriver)
+			}
+			if fmt.Sprint(actual.Status.Registrations) != fmt.Sprint(c.expectedRegistrations) {
+				t.Errorf("expected registrations %v, but got %v", c.expectedRegistrations, actual.Status.Registrations)
+			}
+
+			// the token is renewed and the subject is not reported again
+			if _, err := renewer.renew(context.TODO()); err != nil {
+				t.Fatal(err)
+			}
+			addontesting.AssertActions(t, addonClient.Actions()[3:], "get")
+			if token, _ := os.ReadFile(tokenFile); string(token) != "token2" {
+				t.Errorf("expected token2, but got %q", token)
+			}
+		})
+	}
+}
+
+func TestTokenRenewerExpirationTime(t *testing.T) {
+	exp := time.Now().Add(time.Hour).Truncate(time.Second)
+	cases := []struct {
+		name                   string
+		token                  string
+		expectedExpirationTime time.Time
+	}{
+		{
+			name:  "opaque token never expires",
+			token: "opaque-token",
+		},
+		{
+			name: "jwt without exp never expires",
+			token: "header." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"agent"}`)) +
+				".signature",
+		},
+		{
+			name: "expiration time from exp claim",
+			token: "header." + base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"exp":%d}`, exp.Unix()))) +
+				".signature",
+			expectedExpirationTime: exp,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			driver := &testTokenDriver{token: c.token}
+			renewer := NewTokenRenewer(driver, filepath.Join(t.TempDir(), "token"), nil, "cluster1", "test")
+
+			interval, err := renewer.renew(context.TODO())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !renewer.ExpirationTime().Equal(c.expectedExpirationTime) {
+				t.Errorf("expected expiration time %v, but got %v", c.expectedExpirationTime, renewer.ExpirationTime())
+			}
+			if c.expectedExpirationTime.IsZero() {
+				if interval != 0 {
+					t.Errorf("expected the token not to be renewed, but got interval %v", interval)
+				}
+				return
+			}
+			if interval < 47*time.Minute || interval > 48*time.Minute {
+				t.Errorf("unexpected renew interval %v", interval)
+			}
+		})
+	}
+}
+
+func TestTokenRenewerStartNeverExpiring(t *testing.T) {
+	driver := &testTokenDriver{token: "opaque-token"}
+	renewer := NewTokenRenewer(driver, filepath.Join(t.TempDir(), "token"), nil, "cluster1", "test")
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 100*time.Millisecond)
+	defer cancel()
+	renewer.Start(ctx)
+	if driver.tokens != 1 {
+		t.Errorf("expected the token to be requested once, but got %d", driver.tokens)
+	}
+}
+
+func TestServiceAccountTokenDriver(t *testing.T) {
+	expirationTime := metav1.NewTime(time.Now().Add(time.Hour).Truncate(time.Second))
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("create", "serviceaccounts",
+		func(action clienttesting.Action) (bool, runtime.Object, error) {
+			if action.GetSubresource() != "token" {
+				return false, nil, nil
+			}
+			tokenRequest := action.(clienttesting.CreateAction).GetObject().(*authenticationv1.TokenRequest)
+			if len(tokenRequest.Spec.Audiences) != 1 || tokenRequest.Spec.Audiences[0] != "addon" ||
+				*tokenRequest.Spec.ExpirationSeconds != 3600 {
+				t.Errorf("unexpected token request %v", tokenRequest.Spec)
+			}
+			tokenRequest.Status = authenticationv1.TokenRequestStatus{Token: "token", ExpirationTimestamp: expirationTime}
+			return true, tokenRequest, nil
+		})
+
+	driver := NewServiceAccountTokenDriver(client.CoreV1(), "cluster1", "test", []string{"addon"}, 3600)
+	token, actualExpirationTime, err := driver.RequestToken(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "token" || !actualExpirationTime.Equal(expirationTime.Time) {
+		t.Errorf("unexpected token %q expiring at %v", token, actualExpirationTime)
+	}
+	if subject := driver.Subject(); subject.User != "system:serviceaccount:cluster1:test" || len(subject.Groups) != 0 {
+		t.Errorf("unexpected subject %v", subject)
+	}
+}
@@ -86,11 +86,21 @@ func (a Asset) WriteFile(path string) error {
 
 // MustCreateAssetFromTemplate process the given template using and return an asset.
 func MustCreateAssetFromTemplate(name string, template []byte, config interface{}) Asset {
-	asset, err := assetFromTemplate(name, template, config)
+	asset, err := CreateAssetFromTemplate(name, template, config)
 	if err != nil {
 		panic(err)
 	}
-	return *asset
+	return asset
+}
+
+// CreateAssetFromTemplate process the given template using and return an asset, or an error if the template
+// cannot be rendered.
+func CreateAssetFromTemplate(name string, template []byte, config interface{}) (Asset, error) {
+	asset, err := assetFromTemplate(name, template, config)
+	if err != nil {
+		return Asset{}, err
+	}
+	return *asset, nil
 }
 
 func assetFromTemplate(name string, tb []byte, data interface{}) (*Asset, error) {
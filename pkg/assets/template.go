@@ -3,6 +3,7 @@ package assets
 import (
 	"bytes"
 	"encoding/base64"
+	"encoding/json"
 	"regexp"
 	"strings"
 	"text/template"
@@ -19,6 +20,7 @@ var templateFuncs = map[string]interface{}{
 	"indent":     indent,
 	"load":       load,
 	"regexMatch": regexMatch,
+	"toJson":     toJson,
 }
 
 func indent(indention int, v []byte) string {
@@ -26,6 +28,15 @@ func indent(indention int, v []byte) string {
 	return strings.Replace(string(v), "\n", newline, -1) //nolint:gocritic
 }
 
+// toJson returns the json encoding of the value, it can be used to render structured values in yaml templates.
+func toJson(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
 func base64encode(v []byte) string {
 	return base64.StdEncoding.EncodeToString(v)
 }
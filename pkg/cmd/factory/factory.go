@@ -7,6 +7,8 @@ import (
 	"net"
 	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -33,6 +35,13 @@ import (
 	"k8s.io/klog/v2"
 )
 
+const (
+	defaultLeaseDuration = 137 * time.Second
+	defaultRenewDeadline = 107 * time.Second
+	defaultRetryPeriod   = 26 * time.Second
+	defaultSecurePort    = 8443
+)
+
 // ControllerFlags provides the "normal" controller flags
 type ControllerFlags struct {
 	// KubeConfigFile points to a kubeconfig file if you don't want to use the in cluster config
@@ -41,11 +50,41 @@ type ControllerFlags struct {
 	EnableLeaderElection bool
 	// ComponentNamespace is the namespace to run component
 	ComponentNamespace string
+
+	// LeaseDuration is the duration that non-leader candidates will wait to force acquire leadership.
+	LeaseDuration time.Duration
+	// RenewDeadline is the duration that the acting leader will retry refreshing leadership before giving up.
+	RenewDeadline time.Duration
+	// RetryPeriod is the duration the leader election clients should wait between tries of actions.
+	RetryPeriod time.Duration
+
+	// DisableSecureServing disables the secure server serving the health checks.
+	DisableSecureServing bool
+	// BindAddress is the IP address the secure server listens on.
+	BindAddress string
+	// SecurePort is the port the secure server serves on.
+	SecurePort int
+	// TLSCertFile and TLSKeyFile are the serving certificate and key of the secure server, they are reloaded
+	// when the files change. A self-signed certificate is generated if they are not set.
+	TLSCertFile string
+	TLSKeyFile  string
+
+	// GracefulTerminationDuration is the time the controllers are given to stop their workers once the process
+	// is stopped or the leadership is lost, the shutdown hooks are given the same time afterwards.
+	GracefulTerminationDuration time.Duration
 }
 
 // NewControllerFlags returns flags with default values set
 func NewControllerFlags() *ControllerFlags {
-	return &ControllerFlags{}
+	return &ControllerFlags{
+		LeaseDuration: defaultLeaseDuration,
+		RenewDeadline: defaultRenewDeadline,
+		RetryPeriod:   defaultRetryPeriod,
+		BindAddress:   "0.0.0.0",
+		SecurePort:    defaultSecurePort,
+
+		GracefulTerminationDuration: defaultGracefulTerminationDuration,
+	}
 }
 
 // AddFlags register and binds the default flags
@@ -56,6 +95,50 @@ func (f *ControllerFlags) AddFlags(cmd *cobra.Command) {
 	flags.StringVar(&f.KubeConfigFile, "kubeconfig", f.KubeConfigFile, "Location of the master configuration file to run from.")
 	flags.StringVar(&f.ComponentNamespace, "component-namespace", f.ComponentNamespace, "Namespace of the component.")
 	flags.BoolVar(&f.EnableLeaderElection, "enable-leader-election", f.EnableLeaderElection, "Enables the leader election for the controller")
+	flags.DurationVar(&f.LeaseDuration, "leader-election-lease-duration", f.LeaseDuration,
+		"The duration that non-leader candidates will wait after observing a leadership renewal until attempting to acquire leadership.")
+	flags.DurationVar(&f.RenewDeadline, "leader-election-renew-deadline", f.RenewDeadline,
+		"The interval between attempts by the acting leader to renew a leadership slot before it stops leading.")
+	flags.DurationVar(&f.RetryPeriod, "leader-election-retry-period", f.RetryPeriod,
+		"The duration the clients should wait between attempting acquisition and renewal of a leadership.")
+	flags.BoolVar(&f.DisableSecureServing, "disable-secure-serving", f.DisableSecureServing, "Disables the secure server serving the health checks.")
+	flags.StringVar(&f.BindAddress, "bind-address", f.BindAddress, "The IP address on which to listen for the --secure-port port.")
+	flags.IntVar(&f.SecurePort, "secure-port", f.SecurePort, "The port on which to serve HTTPS with authentication and authorization.")
+	flags.StringVar(&f.TLSCertFile, "tls-cert-file", f.TLSCertFile,
+		"File containing the default x509 Certificate for HTTPS, a self-signed certificate is generated if it is not set.")
+	flags.StringVar(&f.TLSKeyFile, "tls-private-key-file", f.TLSKeyFile, "File containing the default x509 private key matching --tls-cert-file.")
+	flags.DurationVar(&f.GracefulTerminationDuration, "graceful-termination-duration", f.GracefulTerminationDuration,
+		"The time the controllers are given to stop once the process is terminated or the leadership is lost. "+
+			"The pod must set a longer termination grace period.")
+}
+
+// Validate checks the flags are valid.
+func (f *ControllerFlags) Validate() error {
+	if f.GracefulTerminationDuration <= 0 {
+		return fmt.Errorf("graceful termination duration %v must be positive", f.GracefulTerminationDuration)
+	}
+	if f.EnableLeaderElection {
+		if f.LeaseDuration <= f.RenewDeadline {
+			return fmt.Errorf("leader election lease duration %v must be greater than renew deadline %v", f.LeaseDuration, f.RenewDeadline)
+		}
+		if f.RetryPeriod <= 0 || f.RenewDeadline <= time.Duration(leaderelection.JitterFactor*float64(f.RetryPeriod)) {
+			return fmt.Errorf("leader election renew deadline %v must be greater than %v times of retry period %v",
+				f.RenewDeadline, leaderelection.JitterFactor, f.RetryPeriod)
+		}
+	}
+	if f.DisableSecureServing {
+		return nil
+	}
+	if f.SecurePort < 1 || f.SecurePort > 65535 {
+		return fmt.Errorf("secure port %d must be between 1 and 65535", f.SecurePort)
+	}
+	if net.ParseIP(f.BindAddress) == nil {
+		return fmt.Errorf("bind address %q is not a valid IP address", f.BindAddress)
+	}
+	if (len(f.TLSCertFile) == 0) != (len(f.TLSKeyFile) == 0) {
+		return fmt.Errorf("tls cert file and tls private key file must be set together")
+	}
+	return nil
 }
 
 // ControllerCommandConfig holds values required to construct a command to run.
@@ -64,6 +147,11 @@ type ControllerCommandConfig struct {
 	startFunc     StartFunc
 	version       version.Info
 	healthChecks  []healthz.HealthChecker
+	readyzChecks  []healthz.HealthChecker
+	shutdownHooks []ShutdownHook
+	exitPolicy    ExitPolicy
+	shutdownOnce  sync.Once
+	exit          func(code int)
 
 	basicFlags *ControllerFlags
 }
@@ -78,16 +166,32 @@ func NewControllerCommandConfig(componentName string, version version.Info, star
 		startFunc:     startFunc,
 		componentName: componentName,
 		version:       version,
+		exitPolicy:    DefaultExitPolicy(),
+		exit:          os.Exit,
 
 		basicFlags: NewControllerFlags(),
 	}
 }
 
+// WithControllerFlags sets the flags of the controller, it allows the callers of StartController to configure
+// the controller without the command.
+func (c *ControllerCommandConfig) WithControllerFlags(flags *ControllerFlags) *ControllerCommandConfig {
+	c.basicFlags = flags
+	return c
+}
+
 func (c *ControllerCommandConfig) WithHealthChecks(healthChecks ...healthz.HealthChecker) *ControllerCommandConfig {
 	c.healthChecks = append(c.healthChecks, healthChecks...)
 	return c
 }
 
+// WithReadyzChecks adds the checkers to the readyz endpoint only, e.g. the addonmanager.Readiness, so the
+// traffic is only routed to the controller when it is ready.
+func (c *ControllerCommandConfig) WithReadyzChecks(readyzChecks ...healthz.HealthChecker) *ControllerCommandConfig {
+	c.readyzChecks = append(c.readyzChecks, readyzChecks...)
+	return c
+}
+
 func (c *ControllerCommandConfig) NewCommand() *cobra.Command {
 	ctx := context.TODO()
 	cmd := &cobra.Command{
@@ -122,20 +226,59 @@ func (c *ControllerCommandConfig) NewCommand() *cobra.Command {
 // StartController runs the controller. This is the recommend entrypoint when you don't need
 // to customize the builder.
 func (c *ControllerCommandConfig) StartController(ctx context.Context) error {
+	if err := c.basicFlags.Validate(); err != nil {
+		return err
+	}
+
 	kubeConfig, err := clientcmd.BuildConfigFromFlags("", c.basicFlags.KubeConfigFile)
 	if err != nil {
 		return err
 	}
 
-	var server *genericapiserver.GenericAPIServer
-	serverConfig, err := toServerConfig()
+	if !c.basicFlags.DisableSecureServing {
+		if err := c.startServer(ctx); err != nil {
+			return err
+		}
+	}
+
+	if !c.basicFlags.EnableLeaderElection {
+		err := c.startFunc(ctx, kubeConfig)
+		c.shutdownOnce.Do(c.runShutdownHooks)
+		return err
+	}
+
+	leaderConfig := rest.CopyConfig(kubeConfig)
+	leaderElection, err := toLeaderElection(leaderConfig, c.componentName, c.basicFlags)
+	if err != nil {
+		return err
+	}
+
+	// GracefulTerminationDuration is the graceful termination time we give the controllers to finish their workers.
+	// when this time pass, we exit with non-zero code, killing all controller workers.
+	// NOTE: The pod must set the termination graceful time.
+	state := newLeadingState()
+	leaderElection.Callbacks.OnStartedLeading = c.getOnStartedLeadingFunc(
+		kubeConfig, c.basicFlags.GracefulTerminationDuration, state)
+	leaderElection.Callbacks.OnStoppedLeading = c.getOnStoppedLeadingFunc(ctx, state)
+
+	// the leader election callbacks only report what happened, the exit code is decided here so the process
+	// exits once with a deterministic code.
+	go leaderelection.RunOrDie(ctx, leaderElection)
+	c.shutdown(state.waitForExitCode())
+	return nil
+}
+
+// startServer starts the secure server serving the health checks.
+func (c *ControllerCommandConfig) startServer(ctx context.Context) error {
+	serverConfig, err := toServerConfig(c.basicFlags)
 	if err != nil {
 		return err
 	}
 	serverConfig.EffectiveVersion = utilversion.NewEffectiveVersionFromString("v1.0.0", "", "")
 	serverConfig.HealthzChecks = append(serverConfig.HealthzChecks, c.healthChecks...)
+	serverConfig.AddReadyzChecks(c.readyzChecks...)
 
-	server, err = serverConfig.Complete(nil).New(c.componentName, genericapiserver.NewEmptyDelegate())
+	server, err := serverConfig.Complete(nil).New(c.componentName, genericapiserver.NewEmptyDelegate())
 	if err != nil {
 		return err
 	}
@@ -146,58 +289,108 @@ func (c *ControllerCommandConfig) StartController(ctx context.Context) error {
 		}
 		klog.Info("server exited")
 	}()
+	return nil
+}
 
-	if !c.basicFlags.EnableLeaderElection {
-		return c.startFunc(ctx, kubeConfig)
-	}
+// leadingState tracks the controllers started on leading.
+type leadingState struct {
+	// started is set once the leadership is acquired.
+	started atomic.Bool
+	// stoppedCh is closed once the controllers are stopped in the graceful termination duration.
+	stoppedCh chan struct{}
+	// failedCh receives the exit code once the controllers fail to start, terminate prematurely or do not
+	// stop in the graceful termination duration.
+	failedCh chan int
+	// stoppedLeadingCh receives the exit code once the leadership is lost or the process is terminated.
+	stoppedLeadingCh chan int
+}
 
-	leaderConfig := rest.CopyConfig(kubeConfig)
-	leaderElection, err := toLeaderElection(leaderConfig, c.componentName, c.basicFlags.ComponentNamespace)
-	if err != nil {
-		return err
+func newLeadingState() *leadingState {
+	return &leadingState{
+		stoppedCh:        make(chan struct{}),
+		failedCh:         make(chan int, 1),
+		stoppedLeadingCh: make(chan int, 1),
 	}
+}
 
-	// 10s is the graceful termination time we give the controllers to finish their workers.
-	// when this time pass, we exit with non-zero code, killing all controller workers.
-	// NOTE: The pod must set the termination graceful time.
-	leaderElection.Callbacks.OnStartedLeading = c.getOnStartedLeadingFunc(kubeConfig, 10*time.Second)
-
-	leaderelection.RunOrDie(ctx, leaderElection)
-	return nil
+// waitForExitCode returns the exit code of the process. A failure of the controllers takes precedence, otherwise
+// the code of losing the leadership is returned once the controllers are stopped.
+func (s *leadingState) waitForExitCode() int {
+	select {
+	case code := <-s.failedCh:
+		return code
+	case code := <-s.stoppedLeadingCh:
+		if !s.started.Load() {
+			return code
+		}
+		select {
+		case <-s.stoppedCh:
+			return code
+		case failed := <-s.failedCh:
+			return failed
+		}
+	}
 }
 
-func (c *ControllerCommandConfig) getOnStartedLeadingFunc(kubeConfig *rest.Config, gracefulTerminationDuration time.Duration) func(ctx context.Context) {
+// getOnStartedLeadingFunc returns the func to run the controllers once the leadership is acquired.
+func (c *ControllerCommandConfig) getOnStartedLeadingFunc(kubeConfig *rest.Config, gracefulTerminationDuration time.Duration,
+	state *leadingState) func(ctx context.Context) {
 	return func(ctx context.Context) {
+		state.started.Store(true)
 		stoppedCh := make(chan struct{})
+		var startErr error
 		go func() {
 			defer close(stoppedCh)
-			if err := c.startFunc(ctx, kubeConfig); err != nil {
-				klog.Warningf("failed to start controller with error: %v", err)
-				os.Exit(1)
-			}
+			startErr = c.startFunc(ctx, kubeConfig)
 		}()
 
 		select {
 		case <-ctx.Done(): // context closed means the process likely received signal to terminate
 		case <-stoppedCh:
+			if startErr != nil {
+				klog.Warningf("failed to start controller with error: %v", startErr)
+				state.failedCh <- c.exitPolicy.StartFailed
+				return
+			}
 			// if context was not cancelled (it is not "done"), but the startFunc terminated, it means it terminated prematurely
 			// when this happen, it means the controllers terminated without error.
 			if ctx.Err() == nil {
 				klog.Warningf("graceful termination failed, controllers terminated prematurely")
-				os.Exit(1)
+				state.failedCh <- c.exitPolicy.TerminatedPrematurely
+				return
 			}
 		}
 
 		select {
 		case <-time.After(gracefulTerminationDuration): // when context was closed above, give controllers extra time to terminate gracefully
 			klog.Warningf("graceful termination failed, some controllers failed to shutdown in %s", gracefulTerminationDuration)
-			os.Exit(1)
-		case <-stoppedCh: // stoppedCh here means the controllers finished termination and we exit 0
+			state.failedCh <- c.exitPolicy.GracefulTerminationTimeout
+		case <-stoppedCh: // stoppedCh here means the controllers finished termination
+			if startErr != nil {
+				klog.Warningf("failed to start controller with error: %v", startErr)
+				state.failedCh <- c.exitPolicy.StartFailed
+				return
+			}
+			close(state.stoppedCh)
+		}
+	}
+}
+
+// getOnStoppedLeadingFunc returns the func reporting the exit code once the leadership is lost or the process is
+// terminated.
+func (c *ControllerCommandConfig) getOnStoppedLeadingFunc(ctx context.Context, state *leadingState) func() {
+	return func() {
+		code := c.exitPolicy.LeaderElectionLost
+		if ctx.Err() != nil {
+			code = c.exitPolicy.Terminated
+		} else {
+			klog.Warningf("leader election lost")
 		}
+		state.stoppedLeadingCh <- code
 	}
 }
 
-func toLeaderElection(clientConfig *rest.Config, component, namespace string) (leaderelection.LeaderElectionConfig, error) {
+func toLeaderElection(clientConfig *rest.Config, component string, flags *ControllerFlags) (leaderelection.LeaderElectionConfig, error) {
 	kubeClient, err := kubernetes.NewForConfig(clientConfig)
 	if err != nil {
 		return leaderelection.LeaderElectionConfig{}, err
@@ -213,8 +406,8 @@ func toLeaderElection(clientConfig *rest.Config, component, namespace string) (l
 	}
 
 	var electionNamespace string
-	if len(namespace) > 0 {
-		electionNamespace = namespace
+	if len(flags.ComponentNamespace) > 0 {
+		electionNamespace = flags.ComponentNamespace
 	} else {
 		data, err := os.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/namespace")
 		if err != nil {
@@ -248,33 +441,34 @@ func toLeaderElection(clientConfig *rest.Config, component, namespace string) (l
 	return leaderelection.LeaderElectionConfig{
 		Lock:            rl,
 		ReleaseOnCancel: true,
-		LeaseDuration:   137 * time.Second,
-		RenewDeadline:   107 * time.Second,
-		RetryPeriod:     26 * time.Second,
-		Callbacks: leaderelection.LeaderCallbacks{
-			OnStoppedLeading: func() {
-				defer os.Exit(0)
-				klog.Warningf("leader election lost")
-			},
-		},
+		LeaseDuration:   flags.LeaseDuration,
+		RenewDeadline:   flags.RenewDeadline,
+		RetryPeriod:     flags.RetryPeriod,
 	}, nil
 }
 
-func toServerConfig() (*genericapiserver.Config, error) {
+func toServerConfig(flags *ControllerFlags) (*genericapiserver.Config, error) {
 	scheme := runtime.NewScheme()
 	metav1.AddToGroupVersion(scheme, metav1.SchemeGroupVersion)
 	config := genericapiserver.NewConfig(serializer.NewCodecFactory(scheme))
 
 	servingOptions := genericapiserveroptions.NewSecureServingOptions()
-	servingOptions.BindPort = 8443
-	temporaryCertDir, err := os.MkdirTemp("", "serving-cert")
-	if err != nil {
-		return nil, err
-	}
-	servingOptions.ServerCert.CertDirectory = temporaryCertDir
-	servingOptions.ServerCert.PairName = "tls"
-	if err := servingOptions.MaybeDefaultWithSelfSignedCerts("localhost", nil, []net.IP{net.ParseIP("127.0.0.1")}); err != nil {
-		return nil, err
+	servingOptions.BindAddress = net.ParseIP(flags.BindAddress)
+	servingOptions.BindPort = flags.SecurePort
+	if len(flags.TLSCertFile) > 0 {
+		// the serving certificate is loaded dynamically, so it is reloaded once the files change.
+		servingOptions.ServerCert.CertKey.CertFile = flags.TLSCertFile
+		servingOptions.ServerCert.CertKey.KeyFile = flags.TLSKeyFile
+	} else {
+		temporaryCertDir, err := os.MkdirTemp("", "serving-cert")
+		if err != nil {
+			return nil, err
+		}
+		servingOptions.ServerCert.CertDirectory = temporaryCertDir
+		servingOptions.ServerCert.PairName = "tls"
+		if err := servingOptions.MaybeDefaultWithSelfSignedCerts("localhost", nil, []net.IP{net.ParseIP("127.0.0.1")}); err != nil {
+			return nil, err
+		}
 	}
 
 	servingOptionsWithLoopback := servingOptions.WithLoopback()
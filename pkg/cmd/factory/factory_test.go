@@ -0,0 +1,148 @@
+package factory
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		name        string
+		mutate      func(f *ControllerFlags)
+		expectedErr bool
+	}{
+		{
+			name:   "default flags",
+			mutate: func(f *ControllerFlags) {},
+		},
+		{
+			name: "default leader election",
+			mutate: func(f *ControllerFlags) {
+				f.EnableLeaderElection = true
+			},
+		},
+		{
+			name: "non-positive graceful termination duration",
+			mutate: func(f *ControllerFlags) {
+				f.GracefulTerminationDuration = 0
+			},
+			expectedErr: true,
+		},
+		{
+			name: "lease duration not greater than renew deadline",
+			mutate: func(f *ControllerFlags) {
+				f.EnableLeaderElection = true
+				f.LeaseDuration = f.RenewDeadline
+			},
+			expectedErr: true,
+		},
+		{
+			name: "renew deadline too short for retry period",
+			mutate: func(f *ControllerFlags) {
+				f.EnableLeaderElection = true
+				f.RenewDeadline = f.RetryPeriod
+			},
+			expectedErr: true,
+		},
+		{
+			name: "leader election timings ignored without leader election",
+			mutate: func(f *ControllerFlags) {
+				f.LeaseDuration = f.RenewDeadline
+			},
+		},
+		{
+			name: "invalid secure port",
+			mutate: func(f *ControllerFlags) {
+				f.SecurePort = 0
+			},
+			expectedErr: true,
+		},
+		{
+			name: "invalid bind address",
+			mutate: func(f *ControllerFlags) {
+				f.BindAddress = "localhost"
+			},
+			expectedErr: true,
+		},
+		{
+			name: "tls cert file without key file",
+			mutate: func(f *ControllerFlags) {
+				f.TLSCertFile = "/var/run/serving-cert/tls.crt"
+			},
+			expectedErr: true,
+		},
+		{
+			name: "serving flags ignored when secure serving disabled",
+			mutate: func(f *ControllerFlags) {
+				f.DisableSecureServing = true
+				f.SecurePort = 0
+				f.BindAddress = ""
+				f.TLSKeyFile = "/var/run/serving-cert/tls.key"
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			flags := NewControllerFlags()
+			c.mutate(flags)
+			err := flags.Validate()
+			if c.expectedErr && err == nil {
+				t.Errorf("expected error, but got none")
+			}
+			if !c.expectedErr && err != nil {
+				t.Errorf("expected no error, but got %v", err)
+			}
+		})
+	}
+}
+
+func TestAddFlags(t *testing.T) {
+	flags := NewControllerFlags()
+	cmd := &cobra.Command{}
+	flags.AddFlags(cmd)
+
+	if err := cmd.ParseFlags([]string{
+		"--enable-leader-election",
+		"--leader-election-lease-duration=30s",
+		"--leader-election-renew-deadline=20s",
+		"--leader-election-retry-period=5s",
+		"--bind-address=127.0.0.1",
+		"--secure-port=9443",
+		"--tls-cert-file=/var/run/serving-cert/tls.crt",
+		"--tls-private-key-file=/var/run/serving-cert/tls.key",
+		"--graceful-termination-duration=30s",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &ControllerFlags{
+		EnableLeaderElection:        true,
+		LeaseDuration:               30 * time.Second,
+		RenewDeadline:               20 * time.Second,
+		RetryPeriod:                 5 * time.Second,
+		BindAddress:                 "127.0.0.1",
+		SecurePort:                  9443,
+		TLSCertFile:                 "/var/run/serving-cert/tls.crt",
+		TLSKeyFile:                  "/var/run/serving-cert/tls.key",
+		GracefulTerminationDuration: 30 * time.Second,
+	}
+	if *flags != *expected {
+		t.Errorf("expected flags %+v, but got %+v", expected, flags)
+	}
+	if err := flags.Validate(); err != nil {
+		t.Errorf("expected no error, but got %v", err)
+	}
+
+	cmd = &cobra.Command{}
+	flags = NewControllerFlags()
+	flags.AddFlags(cmd)
+	if err := cmd.ParseFlags([]string{"--disable-secure-serving"}); err != nil {
+		t.Fatal(err)
+	}
+	if !flags.DisableSecureServing || flags.SecurePort != defaultSecurePort || flags.LeaseDuration != defaultLeaseDuration {
+		t.Errorf("unexpected flags %+v", flags)
+	}
+}
@@ -0,0 +1,76 @@
+package factory
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+const defaultGracefulTerminationDuration = 10 * time.Second
+
+// ShutdownHook is called once the controllers are stopped, e.g. to flush the queues, release the hub leases or
+// write a final status condition. The ctx is done when the graceful termination duration passes.
+type ShutdownHook func(ctx context.Context) error
+
+// ExitPolicy is the exit codes of the controller process running with leader election.
+type ExitPolicy struct {
+	// StartFailed is the exit code when the controllers fail to start.
+	StartFailed int
+	// TerminatedPrematurely is the exit code when the controllers terminate before the process is stopped.
+	TerminatedPrematurely int
+	// GracefulTerminationTimeout is the exit code when the controllers do not stop in the graceful termination
+	// duration.
+	GracefulTerminationTimeout int
+	// LeaderElectionLost is the exit code when the leadership is lost.
+	LeaderElectionLost int
+	// Terminated is the exit code when the controllers stop after the process receives the termination signal.
+	Terminated int
+}
+
+// DefaultExitPolicy returns the exit policy exiting with 1 when the controllers fail, and 0 when the leadership
+// is lost or the process is terminated.
+func DefaultExitPolicy() ExitPolicy {
+	return ExitPolicy{
+		StartFailed:                1,
+		TerminatedPrematurely:      1,
+		GracefulTerminationTimeout: 1,
+		LeaderElectionLost:         0,
+		Terminated:                 0,
+	}
+}
+
+// WithShutdownHooks appends the hooks called in order once the controllers are stopped.
+func (c *ControllerCommandConfig) WithShutdownHooks(hooks ...ShutdownHook) *ControllerCommandConfig {
+	c.shutdownHooks = append(c.shutdownHooks, hooks...)
+	return c
+}
+
+// WithExitPolicy sets the exit codes of the controller process running with leader election.
+func (c *ControllerCommandConfig) WithExitPolicy(policy ExitPolicy) *ControllerCommandConfig {
+	c.exitPolicy = policy
+	return c
+}
+
+// runShutdownHooks calls the shutdown hooks in order, the hooks share the graceful termination duration.
+func (c *ControllerCommandConfig) runShutdownHooks() {
+	if len(c.shutdownHooks) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.basicFlags.GracefulTerminationDuration)
+	defer cancel()
+	for i, hook := range c.shutdownHooks {
+		if err := hook(ctx); err != nil {
+			klog.Warningf("shutdown hook %d failed: %v", i, err)
+		}
+	}
+}
+
+// shutdown runs the shutdown hooks and exits the process with the given code, only the first call takes effect.
+func (c *ControllerCommandConfig) shutdown(code int) {
+	c.shutdownOnce.Do(func() {
+		c.runShutdownHooks()
+		c.exit(code)
+	})
+}
@@ -0,0 +1,191 @@
+package factory
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/client-go/rest"
+)
+
+var testExitPolicy = ExitPolicy{
+	StartFailed:                11,
+	TerminatedPrematurely:      12,
+	GracefulTerminationTimeout: 13,
+	LeaderElectionLost:         14,
+	Terminated:                 15,
+}
+
+func TestExitPolicy(t *testing.T) {
+	cases := []struct {
+		name string
+		// startFunc runs the controllers, it is started once the leadership is acquired.
+		startFunc StartFunc
+		// neverLead indicates the leadership is never acquired.
+		neverLead bool
+		// terminate indicates the process is terminated, otherwise the leadership is lost.
+		terminate bool
+		// stopLeading indicates the leadership is lost or the process is terminated.
+		stopLeading  bool
+		expectedCode int
+	}{
+		{
+			name: "start failed",
+			startFunc: func(ctx context.Context, _ *rest.Config) error {
+				return fmt.Errorf("failed to start")
+			},
+			expectedCode: testExitPolicy.StartFailed,
+		},
+		{
+			name: "start failed after terminated",
+			startFunc: func(ctx context.Context, _ *rest.Config) error {
+				<-ctx.Done()
+				return fmt.Errorf("failed to start")
+			},
+			terminate:    true,
+			stopLeading:  true,
+			expectedCode: testExitPolicy.StartFailed,
+		},
+		{
+			name: "terminated prematurely",
+			startFunc: func(ctx context.Context, _ *rest.Config) error {
+				return nil
+			},
+			expectedCode: testExitPolicy.TerminatedPrematurely,
+		},
+		{
+			name: "graceful termination timeout",
+			startFunc: func(ctx context.Context, _ *rest.Config) error {
+				select {}
+			},
+			terminate:    true,
+			stopLeading:  true,
+			expectedCode: testExitPolicy.GracefulTerminationTimeout,
+		},
+		{
+			name: "leader election lost",
+			startFunc: func(ctx context.Context, _ *rest.Config) error {
+				<-ctx.Done()
+				return nil
+			},
+			stopLeading:  true,
+			expectedCode: testExitPolicy.LeaderElectionLost,
+		},
+		{
+			name: "terminated",
+			startFunc: func(ctx context.Context, _ *rest.Config) error {
+				<-ctx.Done()
+				return nil
+			},
+			terminate:    true,
+			stopLeading:  true,
+			expectedCode: testExitPolicy.Terminated,
+		},
+		{
+			name:         "terminated before leading",
+			neverLead:    true,
+			terminate:    true,
+			stopLeading:  true,
+			expectedCode: testExitPolicy.Terminated,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var hooks []string
+			exitCh := make(chan int, 2)
+			config := NewControllerCommandConfig("test", version.Info{}, c.startFunc).
+				WithExitPolicy(testExitPolicy).
+				WithShutdownHooks(func(ctx context.Context) error {
+					hooks = append(hooks, "hook")
+					return nil
+				})
+			config.basicFlags.GracefulTerminationDuration = 100 * time.Millisecond
+			config.exit = func(code int) {
+				exitCh <- code
+			}
+
+			processCtx, terminate := context.WithCancel(context.TODO())
+			defer terminate()
+			leadingCtx, stopLeading := context.WithCancel(processCtx)
+			defer stopLeading()
+
+			state := newLeadingState()
+			go func() {
+				config.shutdown(state.waitForExitCode())
+			}()
+
+			startedLeadingDone := make(chan struct{})
+			if c.neverLead {
+				close(startedLeadingDone)
+			} else {
+				go func() {
+					defer close(startedLeadingDone)
+					config.getOnStartedLeadingFunc(nil, config.basicFlags.GracefulTerminationDuration, state)(leadingCtx)
+				}()
+				// the leader election starts leading before it renews and stops leading
+				if err := wait.PollUntilContextTimeout(context.TODO(), 10*time.Millisecond, 10*time.Second, true,
+					func(context.Context) (bool, error) {
+						return state.started.Load(), nil
+					}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if c.stopLeading {
+				if c.terminate {
+					terminate()
+				}
+				stopLeading()
+				config.getOnStoppedLeadingFunc(processCtx, state)()
+			}
+			<-startedLeadingDone
+
+			select {
+			case code := <-exitCh:
+				if code != c.expectedCode {
+					t.Errorf("expected exit code %d, but got %d", c.expectedCode, code)
+				}
+			case <-time.After(10 * time.Second):
+				t.Fatalf("timeout waiting for the process to exit")
+			}
+
+			// the process exits only once
+			config.shutdown(0)
+			if len(exitCh) != 0 {
+				t.Errorf("expected the process to exit once, but got code %d", <-exitCh)
+			}
+			if !reflect.DeepEqual(hooks, []string{"hook"}) {
+				t.Errorf("expected the shutdown hooks to run once, but got %v", hooks)
+			}
+		})
+	}
+}
+
+func TestRunShutdownHooks(t *testing.T) {
+	var called []int
+	config := NewControllerCommandConfig("test", version.Info{}, nil).
+		WithShutdownHooks(
+			func(ctx context.Context) error {
+				called = append(called, 0)
+				return fmt.Errorf("failed to flush")
+			},
+			func(ctx context.Context) error {
+				called = append(called, 1)
+				if _, ok := ctx.Deadline(); !ok {
+					t.Errorf("expected the hooks to be given the graceful termination duration")
+				}
+				return nil
+			},
+		)
+
+	// a failed hook does not stop the following hooks
+	config.runShutdownHooks()
+	if !reflect.DeepEqual(called, []int{0, 1}) {
+		t.Errorf("expected the hooks called in order, but got %v", called)
+	}
+}
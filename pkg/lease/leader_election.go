@@ -0,0 +1,78 @@
+package lease
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/klog/v2"
+)
+
+// leaderElectionConfig returns the config to elect the replica renewing the lease. The lock lease has the same
+// duration as the lease, so a new leader is elected before the lease expires on the hub.
+func (r *leaseUpdater) leaderElectionConfig() (leaderelection.LeaderElectionConfig, error) {
+	identity := r.leaderIdentity
+	if len(identity) == 0 {
+		if hostname, err := os.Hostname(); err != nil {
+			// on errors, make sure we're unique
+			identity = string(uuid.NewUUID())
+		} else {
+			// add a uniquifier so that two processes on the same host don't accidentally both become active
+			identity = hostname + "_" + string(uuid.NewUUID())
+		}
+	}
+
+	lock, err := resourcelock.New(
+		resourcelock.LeasesResourceLock,
+		r.leaseNamespace,
+		fmt.Sprintf("%s-updater", r.leaseName),
+		r.kubeClient.CoreV1(),
+		r.kubeClient.CoordinationV1(),
+		resourcelock.ResourceLockConfig{Identity: identity},
+	)
+	if err != nil {
+		return leaderelection.LeaderElectionConfig{}, err
+	}
+
+	leaseDuration := time.Duration(r.leaseDurationSeconds) * time.Second
+	return leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		ReleaseOnCancel: true,
+		LeaseDuration:   leaseDuration,
+		RenewDeadline:   leaseDuration * 2 / 3,
+		RetryPeriod:     leaseDuration / 6,
+		Name:            r.leaseName,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				klog.Infof("Became the leader to renew lease %s/%s", r.leaseNamespace, r.leaseName)
+				r.renew(ctx)
+			},
+			OnStoppedLeading: func() {
+				klog.Infof("Stopped renewing lease %s/%s", r.leaseNamespace, r.leaseName)
+			},
+		},
+	}, nil
+}
+
+// startWithLeaderElection campaigns for the leadership until the ctx is done, the lease is only renewed while
+// the replica is the leader.
+func (r *leaseUpdater) startWithLeaderElection(ctx context.Context) {
+	config, err := r.leaderElectionConfig()
+	if err != nil {
+		klog.Errorf("Failed to build leader election config of lease %s/%s: %v", r.leaseNamespace, r.leaseName, err)
+		return
+	}
+	elector, err := leaderelection.NewLeaderElector(config)
+	if err != nil {
+		klog.Errorf("Failed to create leader elector of lease %s/%s: %v", r.leaseNamespace, r.leaseName, err)
+		return
+	}
+
+	// Run returns when the leadership is lost, campaign again until the ctx is done.
+	wait.UntilWithContext(ctx, elector.Run, config.RetryPeriod)
+}
@@ -2,6 +2,7 @@ package lease
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"time"
 
@@ -15,13 +16,65 @@ import (
 	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/rest"
 	"k8s.io/klog/v2"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
 )
 
 const (
 	leaseUpdateJitterFactor     = 0.25
 	defaultLeaseDurationSeconds = 60
+	defaultRenewIntervalRatio   = 1.0
+	defaultHealthCheckTimeout   = 10 * time.Second
 )
 
+// staleRenewTime is the renew time of a lease created while a health check fails, it is expired for any lease
+// duration.
+var staleRenewTime = time.Unix(0, 0)
+
+const (
+	// HealthCheckAnnotationKey is the annotation on the lease recording the name of the failing health check.
+	// The lease is not renewed while a health check fails, the annotations are removed once all the health
+	// checks pass again. The addon manager puts the failing health check in the Available condition of the addon
+	// if the lease is maintained on the hub, see WithHubLease.
+	HealthCheckAnnotationKey = "addon.open-cluster-management.io/health-check"
+
+	// HealthCheckReasonAnnotationKey is the annotation on the lease recording the reason of the failing health check.
+	HealthCheckReasonAnnotationKey = "addon.open-cluster-management.io/health-check-reason"
+
+	// HealthCheckMessageAnnotationKey is the annotation on the lease recording the message of the failing health check.
+	HealthCheckMessageAnnotationKey = "addon.open-cluster-management.io/health-check-message"
+
+	// HealthCheckFailedReason is the default reason of a failing health check.
+	HealthCheckFailedReason = "HealthCheckFailed"
+
+	// HealthCheckTimeoutReason is the reason of a health check not returning in the health check timeout.
+	HealthCheckTimeoutReason = "HealthCheckTimeout"
+)
+
+// HealthCheckResult is the result of a health check.
+type HealthCheckResult struct {
+	Healthy bool
+	Reason  string
+	Message string
+}
+
+// HealthCheck is a named health check of the addon agent. The name, reason and message of the first failing
+// health check are published on the lease, so the hub can tell why the addon agent is unhealthy. The ctx passed
+// to Check is cancelled when the health check timeout is reached.
+type HealthCheck struct {
+	Name  string
+	Check func(ctx context.Context) HealthCheckResult
+}
+
+// Healthy returns a healthy HealthCheckResult.
+func Healthy() HealthCheckResult {
+	return HealthCheckResult{Healthy: true}
+}
+
+// Unhealthy returns an unhealthy HealthCheckResult with the given reason and message.
+func Unhealthy(reason, format string, args ...interface{}) HealthCheckResult {
+	return HealthCheckResult{Reason: reason, Message: fmt.Sprintf(format, args...)}
+}
+
 // LeaseUpdater is to update lease with certain period
 type LeaseUpdater interface {
 	// Start starts a goroutine to update lease
@@ -30,6 +83,36 @@ type LeaseUpdater interface {
 	// WithHubLeaseConfig sets the lease config on hub cluster. It allows LeaseUpdater to create/update
 	// addon lease on hub cluster when resource 'Lease' is not available on managed cluster.
 	WithHubLeaseConfig(config *rest.Config, clusterName string) LeaseUpdater
+
+	// WithHubLease makes LeaseUpdater always maintain the addon lease on the hub cluster in the cluster namespace
+	// instead of the managed cluster, so the addon manager can probe the lease and the failing health checks with
+	// a HealthProberTypeLease sub-prober. It requires the hub lease config set by WithHubLeaseConfig.
+	WithHubLease() LeaseUpdater
+
+	// WithHealthChecks appends the named health checks to the LeaseUpdater. The lease is only renewed when all
+	// the health checks pass, otherwise the first failing health check is published on the lease annotations.
+	WithHealthChecks(healthChecks ...HealthCheck) LeaseUpdater
+
+	// WithLeaseDuration sets the duration of the lease, which is written into LeaseSpec.LeaseDurationSeconds and
+	// rounded to seconds. The default is 60s.
+	WithLeaseDuration(duration time.Duration) LeaseUpdater
+
+	// WithJitterFactor sets the jitter factor of the renew interval, the lease is renewed in a random period
+	// between the renew interval and (1 + factor) * renew interval. The default is 0.25.
+	WithJitterFactor(factor float64) LeaseUpdater
+
+	// WithRenewIntervalRatio sets the ratio of the renew interval to the lease duration, it must be in (0, 1].
+	// The default is 1.
+	WithRenewIntervalRatio(ratio float64) LeaseUpdater
+
+	// WithHealthCheckTimeout sets the timeout of each health check call, a health check not returning in the
+	// timeout fails with the reason HealthCheckTimeout. The default is 10s.
+	WithHealthCheckTimeout(timeout time.Duration) LeaseUpdater
+
+	// WithLeaderElection makes the replicas of the addon agent elect a leader through the lock lease
+	// "<lease name>-updater" in the lease namespace, only the leader renews the lease. The identity of the
+	// replica is generated from the hostname if it is empty.
+	WithLeaderElection(identity string) LeaseUpdater
 }
 
 // leaseUpdater update lease of with given name and namespace
@@ -38,9 +121,15 @@ type leaseUpdater struct {
 	leaseName            string
 	leaseNamespace       string
 	leaseDurationSeconds int32
+	jitterFactor         float64
+	renewIntervalRatio   float64
+	healthCheckTimeout   time.Duration
+	leaderIdentity       string
+	leaderElection       bool
 	clusterName          string
 	hubKubeClient        kubernetes.Interface
-	healthCheckFuncs     []func() bool
+	hubLease             bool
+	healthChecks         []HealthCheck
 }
 
 func NewLeaseUpdater(
@@ -48,17 +137,50 @@ func NewLeaseUpdater(
 	leaseName, leaseNamespace string,
 	healthCheckFuncs ...func() bool,
 ) LeaseUpdater {
-	return &leaseUpdater{
+	r := &leaseUpdater{
 		kubeClient:           kubeClient,
 		leaseName:            leaseName,
 		leaseNamespace:       leaseNamespace,
 		leaseDurationSeconds: defaultLeaseDurationSeconds,
-		healthCheckFuncs:     healthCheckFuncs,
+		jitterFactor:         leaseUpdateJitterFactor,
+		renewIntervalRatio:   defaultRenewIntervalRatio,
+		healthCheckTimeout:   defaultHealthCheckTimeout,
+	}
+	for i, f := range healthCheckFuncs {
+		r.healthChecks = append(r.healthChecks, boolHealthCheck(fmt.Sprintf("health-check-%d", i), f))
+	}
+	return r
+}
+
+// boolHealthCheck converts a health check func returning bool to a HealthCheck.
+func boolHealthCheck(name string, f func() bool) HealthCheck {
+	return HealthCheck{
+		Name: name,
+		Check: func(_ context.Context) HealthCheckResult {
+			if f() {
+				return Healthy()
+			}
+			return Unhealthy(HealthCheckFailedReason, "health check %s failed", name)
+		},
 	}
 }
 
 func (r *leaseUpdater) Start(ctx context.Context) {
-	wait.JitterUntilWithContext(ctx, r.reconcile, time.Duration(r.leaseDurationSeconds)*time.Second, leaseUpdateJitterFactor, true)
+	if r.leaderElection {
+		r.startWithLeaderElection(ctx)
+		return
+	}
+	r.renew(ctx)
+}
+
+// renew renews the lease periodically until the ctx is done.
+func (r *leaseUpdater) renew(ctx context.Context) {
+	wait.JitterUntilWithContext(ctx, r.reconcile, r.renewInterval(), r.jitterFactor, true)
+}
+
+// renewInterval returns the period to renew the lease.
+func (r *leaseUpdater) renewInterval() time.Duration {
+	return time.Duration(float64(r.leaseDurationSeconds) * r.renewIntervalRatio * float64(time.Second))
 }
 
 func (r *leaseUpdater) WithHubLeaseConfig(config *rest.Config, clusterName string) LeaseUpdater {
@@ -73,7 +195,64 @@ func (r *leaseUpdater) WithHubLeaseConfig(config *rest.Config, clusterName strin
 	return r
 }
 
-func (r *leaseUpdater) updateLease(ctx context.Context, namespace string, client kubernetes.Interface) error {
+func (r *leaseUpdater) WithHubLease() LeaseUpdater {
+	r.hubLease = true
+	return r
+}
+
+func (r *leaseUpdater) WithLeaseDuration(duration time.Duration) LeaseUpdater {
+	seconds := int32(duration.Round(time.Second) / time.Second)
+	if seconds < 1 {
+		klog.Warningf("Ignore invalid lease duration %v of lease %s/%s", duration, r.leaseNamespace, r.leaseName)
+		return r
+	}
+	r.leaseDurationSeconds = seconds
+	return r
+}
+
+func (r *leaseUpdater) WithJitterFactor(factor float64) LeaseUpdater {
+	if factor < 0 {
+		klog.Warningf("Ignore invalid jitter factor %v of lease %s/%s", factor, r.leaseNamespace, r.leaseName)
+		return r
+	}
+	r.jitterFactor = factor
+	return r
+}
+
+func (r *leaseUpdater) WithRenewIntervalRatio(ratio float64) LeaseUpdater {
+	if ratio <= 0 || ratio > 1 {
+		klog.Warningf("Ignore invalid renew interval ratio %v of lease %s/%s", ratio, r.leaseNamespace, r.leaseName)
+		return r
+	}
+	r.renewIntervalRatio = ratio
+	return r
+}
+
+func (r *leaseUpdater) WithHealthCheckTimeout(timeout time.Duration) LeaseUpdater {
+	if timeout <= 0 {
+		klog.Warningf("Ignore invalid health check timeout %v of lease %s/%s", timeout, r.leaseNamespace, r.leaseName)
+		return r
+	}
+	r.healthCheckTimeout = timeout
+	return r
+}
+
+func (r *leaseUpdater) WithLeaderElection(identity string) LeaseUpdater {
+	r.leaderElection = true
+	r.leaderIdentity = identity
+	return r
+}
+
+func (r *leaseUpdater) WithHealthChecks(healthChecks ...HealthCheck) LeaseUpdater {
+	r.healthChecks = append(r.healthChecks, healthChecks...)
+	return r
+}
+
+// updateLease renews the lease and removes the health check annotations if failed is nil, otherwise only the
+// health check annotations of the lease are updated. A lease created while a health check fails has a stale
+// renew time, so the consumers can always expect a renew time on the lease.
+func (r *leaseUpdater) updateLease(ctx context.Context, namespace string, client kubernetes.Interface,
+	failed *failedHealthCheck) error {
 	lease, err := client.CoordinationV1().Leases(namespace).Get(ctx, r.leaseName, metav1.GetOptions{})
 	switch {
 	case errors.IsNotFound(err):
@@ -82,6 +261,8 @@ func (r *leaseUpdater) updateLease(ctx context.Context, namespace string, client
 			ObjectMeta: metav1.ObjectMeta{
 				Name:      r.leaseName,
 				Namespace: namespace,
+				// the addon label allows the addon manager to watch the lease on the hub.
+				Labels: map[string]string{addonapiv1alpha1.AddonLabelKey: r.leaseName},
 			},
 			Spec: coordinationv1.LeaseSpec{
 				LeaseDurationSeconds: &r.leaseDurationSeconds,
@@ -90,6 +271,10 @@ func (r *leaseUpdater) updateLease(ctx context.Context, namespace string, client
 				},
 			},
 		}
+		if failed != nil {
+			lease.Annotations = failed.annotations()
+			lease.Spec.RenewTime = &metav1.MicroTime{Time: staleRenewTime}
+		}
 		if _, err := client.CoordinationV1().Leases(namespace).Create(ctx, lease, metav1.CreateOptions{}); err != nil {
 			return err
 		}
@@ -97,8 +282,40 @@ func (r *leaseUpdater) updateLease(ctx context.Context, namespace string, client
 		return err
 	default:
 		// update lease
-		lease.Spec.RenewTime = &metav1.MicroTime{Time: time.Now()}
-		if _, err = client.CoordinationV1().Leases(namespace).Update(context.TODO(), lease, metav1.UpdateOptions{}); err != nil {
+		lease = lease.DeepCopy()
+		changed := false
+		if failed != nil {
+			if lease.Annotations == nil {
+				lease.Annotations = map[string]string{}
+			}
+			for key, value := range failed.annotations() {
+				if lease.Annotations[key] != value {
+					lease.Annotations[key] = value
+					changed = true
+				}
+			}
+		} else {
+			for _, key := range []string{HealthCheckAnnotationKey, HealthCheckReasonAnnotationKey, HealthCheckMessageAnnotationKey} {
+				if _, ok := lease.Annotations[key]; ok {
+					delete(lease.Annotations, key)
+					changed = true
+				}
+			}
+			lease.Spec.RenewTime = &metav1.MicroTime{Time: time.Now()}
+			lease.Spec.LeaseDurationSeconds = &r.leaseDurationSeconds
+			changed = true
+		}
+		if _, ok := lease.Labels[addonapiv1alpha1.AddonLabelKey]; !ok {
+			if lease.Labels == nil {
+				lease.Labels = map[string]string{}
+			}
+			lease.Labels[addonapiv1alpha1.AddonLabelKey] = r.leaseName
+			changed = true
+		}
+		if !changed {
+			return nil
+		}
+		if _, err = client.CoordinationV1().Leases(namespace).Update(ctx, lease, metav1.UpdateOptions{}); err != nil {
 			return err
 		}
 	}
@@ -106,18 +323,84 @@ func (r *leaseUpdater) updateLease(ctx context.Context, namespace string, client
 	return nil
 }
 
+// failedHealthCheck is the first failing health check published on the lease.
+type failedHealthCheck struct {
+	name   string
+	result HealthCheckResult
+}
+
+func (f *failedHealthCheck) annotations() map[string]string {
+	reason := f.result.Reason
+	if len(reason) == 0 {
+		reason = HealthCheckFailedReason
+	}
+	return map[string]string{
+		HealthCheckAnnotationKey:        f.name,
+		HealthCheckReasonAnnotationKey:  reason,
+		HealthCheckMessageAnnotationKey: f.result.Message,
+	}
+}
+
+func (r *leaseUpdater) checkHealth(ctx context.Context) *failedHealthCheck {
+	for _, healthCheck := range r.healthChecks {
+		if result := r.runHealthCheck(ctx, healthCheck); !result.Healthy {
+			return &failedHealthCheck{name: healthCheck.Name, result: result}
+		}
+	}
+	return nil
+}
+
+// runHealthCheck runs the health check with the health check timeout. The result of a health check ignoring
+// the ctx is dropped once the timeout is reached.
+func (r *leaseUpdater) runHealthCheck(ctx context.Context, healthCheck HealthCheck) HealthCheckResult {
+	timeout := r.healthCheckTimeout
+	if timeout <= 0 {
+		timeout = defaultHealthCheckTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	resultCh := make(chan HealthCheckResult, 1)
+	go func() {
+		resultCh <- healthCheck.Check(ctx)
+	}()
+
+	select {
+	case result := <-resultCh:
+		return result
+	case <-ctx.Done():
+		return Unhealthy(HealthCheckTimeoutReason, "health check %s did not return in %v", healthCheck.Name, timeout)
+	}
+}
+
 func (r *leaseUpdater) reconcile(ctx context.Context) {
-	for _, f := range r.healthCheckFuncs {
-		if !f() {
-			// IF a healthy check fails, do not update lease.
+	// IF a healthy check fails, do not renew the lease but publish the failing check on the lease.
+	failed := r.checkHealth(ctx)
+	if ctx.Err() != nil {
+		// the lease updater is stopped or lost the leadership
+		return
+	}
+	if failed != nil {
+		klog.Warningf("Health check %s of lease %s/%s failed: %s", failed.name, r.leaseNamespace, r.leaseName,
+			failed.result.Message)
+	}
+
+	if r.hubLease {
+		if r.hubKubeClient == nil {
+			klog.Errorf("Failed to update lease %s/%s on hub: the hub lease config is not set", r.clusterName, r.leaseName)
 			return
 		}
+		if err := r.updateLease(ctx, r.clusterName, r.hubKubeClient, failed); err != nil {
+			klog.Errorf("Failed to update lease %s/%s: %v on hub", r.clusterName, r.leaseName, err)
+		}
+		return
 	}
+
 	// Update lease on managed cluster at first, it returns in valid, it means lease is not supported yet
 	// and fallback to use hub lease.
-	err := r.updateLease(ctx, r.leaseNamespace, r.kubeClient)
+	err := r.updateLease(ctx, r.leaseNamespace, r.kubeClient, failed)
 	if errors.IsNotFound(err) && r.hubKubeClient != nil {
-		if err := r.updateLease(ctx, r.clusterName, r.hubKubeClient); err != nil {
+		if err := r.updateLease(ctx, r.clusterName, r.hubKubeClient, failed); err != nil {
 			klog.Errorf("Failed to update lease %s/%s: %v on hub", r.clusterName, r.leaseNamespace, err)
 		}
 		return
@@ -131,41 +414,65 @@ func (r *leaseUpdater) reconcile(ctx context.Context) {
 // CheckAddonPodFunc checks whether the agent pod is running
 func CheckAddonPodFunc(podGetter corev1client.PodsGetter, namespace, labelSelector string) func() bool {
 	return func() bool {
-		pods, err := podGetter.Pods(namespace).List(context.TODO(), metav1.ListOptions{LabelSelector: labelSelector})
-		if err != nil {
-			klog.Errorf("Failed to get pods in namespace %s with label selector %s: %v", namespace, labelSelector, err)
-			return false
-		}
+		ctx, cancel := context.WithTimeout(context.Background(), defaultHealthCheckTimeout)
+		defer cancel()
+		return AddonPodHealthCheck(podGetter, namespace, labelSelector).Check(ctx).Healthy
+	}
+}
 
-		// If one of the pods is running, we think the agent is serving.
-		for _, pod := range pods.Items {
-			if pod.Status.Phase == corev1.PodRunning {
-				return true
+// AddonPodHealthCheck checks whether one of the agent pods is running
+func AddonPodHealthCheck(podGetter corev1client.PodsGetter, namespace, labelSelector string) HealthCheck {
+	return HealthCheck{
+		Name: "addon-pod",
+		Check: func(ctx context.Context) HealthCheckResult {
+			pods, err := podGetter.Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: labelSelector})
+			if err != nil {
+				klog.Errorf("Failed to get pods in namespace %s with label selector %s: %v", namespace, labelSelector, err)
+				return Unhealthy("PodListFailed", "failed to list pods in namespace %s: %v", namespace, err)
 			}
-		}
 
-		return false
-	}
+			// If one of the pods is running, we think the agent is serving.
+			for _, pod := range pods.Items {
+				if pod.Status.Phase == corev1.PodRunning {
+					return Healthy()
+				}
+			}
 
+			return Unhealthy("PodNotRunning", "no pod with label selector %s is running in namespace %s",
+				labelSelector, namespace)
+		},
+	}
 }
 
 // CheckManagedClusterHealthFunc checks the health status of the cluster api server
 func CheckManagedClusterHealthFunc(managedClusterDiscoveryClient discovery.DiscoveryInterface) func() bool {
 	return func() bool {
-		statusCode := 0
-		_ = managedClusterDiscoveryClient.RESTClient().Get().AbsPath("/livez").Do(context.TODO()).StatusCode(&statusCode)
-		if statusCode == http.StatusOK {
-			return true
-		}
+		ctx, cancel := context.WithTimeout(context.Background(), defaultHealthCheckTimeout)
+		defer cancel()
+		return ManagedClusterHealthCheck(managedClusterDiscoveryClient).Check(ctx).Healthy
+	}
+}
 
-		// for backward compatible, the livez endpoint is supported from Kubernetes 1.16, so if the livez is not found or
-		// forbidden, the healthz endpoint will be used.
-		if statusCode == http.StatusNotFound || statusCode == http.StatusForbidden {
-			_ = managedClusterDiscoveryClient.RESTClient().Get().AbsPath("/healthz").Do(context.TODO()).StatusCode(&statusCode)
+// ManagedClusterHealthCheck checks the health status of the cluster api server
+func ManagedClusterHealthCheck(managedClusterDiscoveryClient discovery.DiscoveryInterface) HealthCheck {
+	return HealthCheck{
+		Name: "managed-cluster-apiserver",
+		Check: func(ctx context.Context) HealthCheckResult {
+			statusCode := 0
+			_ = managedClusterDiscoveryClient.RESTClient().Get().AbsPath("/livez").Do(ctx).StatusCode(&statusCode)
 			if statusCode == http.StatusOK {
-				return true
+				return Healthy()
 			}
-		}
-		return false
+
+			// for backward compatible, the livez endpoint is supported from Kubernetes 1.16, so if the livez is not found or
+			// forbidden, the healthz endpoint will be used.
+			if statusCode == http.StatusNotFound || statusCode == http.StatusForbidden {
+				_ = managedClusterDiscoveryClient.RESTClient().Get().AbsPath("/healthz").Do(ctx).StatusCode(&statusCode)
+				if statusCode == http.StatusOK {
+					return Healthy()
+				}
+			}
+			return Unhealthy("APIServerUnhealthy", "the apiserver of the managed cluster returns status code %d", statusCode)
+		},
 	}
 }
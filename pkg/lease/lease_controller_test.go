@@ -7,14 +7,19 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	coordinationv1 "k8s.io/api/coordination/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
 	kubefake "k8s.io/client-go/kubernetes/fake"
 	clienttesting "k8s.io/client-go/testing"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+
 	"open-cluster-management.io/addon-framework/pkg/addonmanager/addontesting"
 )
 
@@ -90,6 +95,31 @@ func TestReconcileWithInvalidLease(t *testing.T) {
 	}
 }
 
+func TestReconcileWithHubLease(t *testing.T) {
+	kubeClient := kubefake.NewSimpleClientset()
+	hubClient := kubefake.NewSimpleClientset()
+
+	leaseReconciler := &leaseUpdater{
+		kubeClient:           kubeClient,
+		hubKubeClient:        hubClient,
+		hubLease:             true,
+		leaseName:            leaseName,
+		clusterName:          "cluster1",
+		leaseDurationSeconds: 1,
+		leaseNamespace:       agentNs,
+	}
+
+	// the lease is only maintained on the hub
+	leaseReconciler.reconcile(context.TODO())
+	addontesting.AssertNoActions(t, kubeClient.Actions())
+	addontesting.AssertActions(t, hubClient.Actions(), "get", "create")
+
+	lease := hubClient.Actions()[1].(clienttesting.CreateActionImpl).Object.(*coordinationv1.Lease)
+	if lease.Namespace != "cluster1" {
+		t.Errorf("expected lease in namespace cluster1, but got %s", lease.Namespace)
+	}
+}
+
 func TestReconcileWithHealthCheck(t *testing.T) {
 	kubeClient := kubefake.NewSimpleClientset()
 
@@ -99,18 +129,226 @@ func TestReconcileWithHealthCheck(t *testing.T) {
 		leaseName:            leaseName,
 		leaseDurationSeconds: 1,
 		leaseNamespace:       agentNs,
-		healthCheckFuncs: []func() bool{
-			func() bool { return healthy },
+		healthChecks: []HealthCheck{
+			boolHealthCheck("pod", func() bool { return healthy }),
 		},
 	}
 
-	// create lease
+	// create lease with the failing check and a stale renew time
 	leaseReconciler.reconcile(context.TODO())
-	addontesting.AssertNoActions(t, kubeClient.Actions())
+	addontesting.AssertActions(t, kubeClient.Actions(), "get", "create")
+	lease := kubeClient.Actions()[1].(clienttesting.CreateActionImpl).Object.(*coordinationv1.Lease)
+	if lease.Spec.RenewTime == nil || !lease.Spec.RenewTime.Time.Equal(staleRenewTime) {
+		t.Errorf("expected stale renew time, but got %v", lease.Spec.RenewTime)
+	}
+	if lease.Annotations[HealthCheckAnnotationKey] != "pod" {
+		t.Errorf("expected failing health check pod, but got %v", lease.Annotations)
+	}
 
 	healthy = true
+	kubeClient.ClearActions()
 	leaseReconciler.reconcile(context.TODO())
-	addontesting.AssertActions(t, kubeClient.Actions(), "get", "create")
+	addontesting.AssertActions(t, kubeClient.Actions(), "get", "update")
+	lease = kubeClient.Actions()[1].(clienttesting.UpdateActionImpl).Object.(*coordinationv1.Lease)
+	if lease.Spec.RenewTime == nil || lease.Spec.RenewTime.Time.Equal(staleRenewTime) {
+		t.Errorf("expected lease renewed, but got %v", lease.Spec.RenewTime)
+	}
+	if _, ok := lease.Annotations[HealthCheckAnnotationKey]; ok {
+		t.Errorf("expected health check annotations removed, but got %v", lease.Annotations)
+	}
+
+	// the health check fails, the failing check is published on the lease without renewing it
+	healthy = false
+	kubeClient.ClearActions()
+	leaseReconciler.reconcile(context.TODO())
+	addontesting.AssertActions(t, kubeClient.Actions(), "get", "update")
+	failedLease := kubeClient.Actions()[1].(clienttesting.UpdateActionImpl).Object.(*coordinationv1.Lease)
+	if !failedLease.Spec.RenewTime.Equal(lease.Spec.RenewTime) {
+		t.Errorf("expected lease not renewed, but got %v", failedLease.Spec.RenewTime)
+	}
+	if failedLease.Annotations[HealthCheckAnnotationKey] != "pod" {
+		t.Errorf("expected failing health check pod, but got %v", failedLease.Annotations)
+	}
+
+	// the health check still fails, do not update lease
+	kubeClient.ClearActions()
+	leaseReconciler.reconcile(context.TODO())
+	addontesting.AssertActions(t, kubeClient.Actions(), "get")
+
+	healthy = true
+	kubeClient.ClearActions()
+	leaseReconciler.reconcile(context.TODO())
+	addontesting.AssertActions(t, kubeClient.Actions(), "get", "update")
+	lease = kubeClient.Actions()[1].(clienttesting.UpdateActionImpl).Object.(*coordinationv1.Lease)
+	if lease.Spec.RenewTime == nil {
+		t.Errorf("expected lease renewed")
+	}
+	if _, ok := lease.Annotations[HealthCheckAnnotationKey]; ok {
+		t.Errorf("expected health check annotations removed, but got %v", lease.Annotations)
+	}
+}
+
+func TestReconcileWithNamedHealthChecks(t *testing.T) {
+	kubeClient := kubefake.NewSimpleClientset(&coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{Name: leaseName, Namespace: agentNs},
+	})
+
+	leaseReconciler := NewLeaseUpdater(kubeClient, leaseName, agentNs).WithHealthChecks(
+		HealthCheck{Name: "cache", Check: func(ctx context.Context) HealthCheckResult { return Healthy() }},
+		HealthCheck{Name: "database", Check: func(ctx context.Context) HealthCheckResult {
+			return Unhealthy("ConnectionRefused", "failed to connect to %s", "db:5432")
+		}},
+		HealthCheck{Name: "never", Check: func(ctx context.Context) HealthCheckResult {
+			t.Errorf("health check should not be called after a failing check")
+			return Healthy()
+		}},
+	).(*leaseUpdater)
+
+	leaseReconciler.reconcile(context.TODO())
+	addontesting.AssertActions(t, kubeClient.Actions(), "get", "update")
+	lease := kubeClient.Actions()[1].(clienttesting.UpdateActionImpl).Object.(*coordinationv1.Lease)
+	expected := map[string]string{
+		HealthCheckAnnotationKey:        "database",
+		HealthCheckReasonAnnotationKey:  "ConnectionRefused",
+		HealthCheckMessageAnnotationKey: "failed to connect to db:5432",
+	}
+	if !equality.Semantic.DeepEqual(lease.Annotations, expected) {
+		t.Errorf("expected annotations %v, but got %v", expected, lease.Annotations)
+	}
+	if lease.Labels[addonapiv1alpha1.AddonLabelKey] != leaseName {
+		t.Errorf("expected addon label on lease, but got %v", lease.Labels)
+	}
+	if lease.Spec.RenewTime != nil {
+		t.Errorf("expected lease not renewed, but got %v", lease.Spec.RenewTime)
+	}
+}
+
+func TestLeaseUpdaterOptions(t *testing.T) {
+	cases := []struct {
+		name                  string
+		duration              time.Duration
+		jitterFactor          float64
+		renewIntervalRatio    float64
+		expectedDuration      int32
+		expectedJitterFactor  float64
+		expectedRenewInterval time.Duration
+	}{
+		{
+			name:                  "default",
+			expectedDuration:      defaultLeaseDurationSeconds,
+			expectedJitterFactor:  leaseUpdateJitterFactor,
+			expectedRenewInterval: 60 * time.Second,
+		},
+		{
+			name:                  "custom",
+			duration:              5 * time.Minute,
+			jitterFactor:          0.1,
+			renewIntervalRatio:    0.5,
+			expectedDuration:      300,
+			expectedJitterFactor:  0.1,
+			expectedRenewInterval: 150 * time.Second,
+		},
+		{
+			name:                  "invalid options are ignored",
+			duration:              100 * time.Millisecond,
+			jitterFactor:          -1,
+			renewIntervalRatio:    2,
+			expectedDuration:      defaultLeaseDurationSeconds,
+			expectedJitterFactor:  leaseUpdateJitterFactor,
+			expectedRenewInterval: 60 * time.Second,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			kubeClient := kubefake.NewSimpleClientset()
+			updater := NewLeaseUpdater(kubeClient, leaseName, agentNs)
+			if c.duration != 0 {
+				updater = updater.WithLeaseDuration(c.duration)
+			}
+			if c.jitterFactor != 0 {
+				updater = updater.WithJitterFactor(c.jitterFactor)
+			}
+			if c.renewIntervalRatio != 0 {
+				updater = updater.WithRenewIntervalRatio(c.renewIntervalRatio)
+			}
+
+			r := updater.(*leaseUpdater)
+			if r.leaseDurationSeconds != c.expectedDuration {
+				t.Errorf("expected lease duration %d, but got %d", c.expectedDuration, r.leaseDurationSeconds)
+			}
+			if r.jitterFactor != c.expectedJitterFactor {
+				t.Errorf("expected jitter factor %v, but got %v", c.expectedJitterFactor, r.jitterFactor)
+			}
+			if r.renewInterval() != c.expectedRenewInterval {
+				t.Errorf("expected renew interval %v, but got %v", c.expectedRenewInterval, r.renewInterval())
+			}
+
+			r.reconcile(context.TODO())
+			lease := kubeClient.Actions()[1].(clienttesting.CreateActionImpl).Object.(*coordinationv1.Lease)
+			if *lease.Spec.LeaseDurationSeconds != c.expectedDuration {
+				t.Errorf("expected lease duration seconds %d, but got %d", c.expectedDuration, *lease.Spec.LeaseDurationSeconds)
+			}
+		})
+	}
+}
+
+func TestReconcileWithHealthCheckTimeout(t *testing.T) {
+	kubeClient := kubefake.NewSimpleClientset(&coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{Name: leaseName, Namespace: agentNs},
+	})
+
+	leaseReconciler := NewLeaseUpdater(kubeClient, leaseName, agentNs).
+		WithHealthCheckTimeout(10 * time.Millisecond).
+		WithHealthChecks(HealthCheck{Name: "hung", Check: func(ctx context.Context) HealthCheckResult {
+			<-ctx.Done()
+			return Healthy()
+		}}).(*leaseUpdater)
+
+	leaseReconciler.reconcile(context.TODO())
+	addontesting.AssertActions(t, kubeClient.Actions(), "get", "update")
+	lease := kubeClient.Actions()[1].(clienttesting.UpdateActionImpl).Object.(*coordinationv1.Lease)
+	if lease.Annotations[HealthCheckReasonAnnotationKey] != HealthCheckTimeoutReason {
+		t.Errorf("expected health check timeout, but got %v", lease.Annotations)
+	}
+
+	// do not update the lease once the ctx is done
+	kubeClient.ClearActions()
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	leaseReconciler.reconcile(ctx)
+	addontesting.AssertNoActions(t, kubeClient.Actions())
+}
+
+func TestStartWithLeaderElection(t *testing.T) {
+	kubeClient := kubefake.NewSimpleClientset()
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	go NewLeaseUpdater(kubeClient, leaseName, agentNs).
+		WithLeaseDuration(time.Second).
+		WithLeaderElection("replica-1").
+		Start(ctx)
+
+	err := wait.PollUntilContextTimeout(ctx, 50*time.Millisecond, 5*time.Second, true,
+		func(ctx context.Context) (bool, error) {
+			_, err := kubeClient.CoordinationV1().Leases(agentNs).Get(ctx, leaseName, metav1.GetOptions{})
+			if errors.IsNotFound(err) {
+				return false, nil
+			}
+			return err == nil, err
+		})
+	if err != nil {
+		t.Fatalf("expected lease renewed by the leader: %v", err)
+	}
+
+	lock, err := kubeClient.CoordinationV1().Leases(agentNs).Get(ctx, leaseName+"-updater", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lock.Spec.HolderIdentity == nil || *lock.Spec.HolderIdentity != "replica-1" {
+		t.Errorf("expected lock held by replica-1, but got %v", lock.Spec.HolderIdentity)
+	}
 }
 
 func TestCheckAddonPodFunc(t *testing.T) {
@@ -134,3 +134,12 @@ func GetAddOnConfigRef(
 
 	return false, addonapiv1alpha1.ConfigReference{}
 }
+
+// ConfigReferentString returns a readable name of the config in the format of <resource>.<group>/<namespace>/<name>,
+// the namespace is omitted for cluster scoped configs.
+func ConfigReferentString(gr addonapiv1alpha1.ConfigGroupResource, referent addonapiv1alpha1.ConfigReferent) string {
+	if referent.Namespace == "" {
+		return fmt.Sprintf("%s.%s/%s", gr.Resource, gr.Group, referent.Name)
+	}
+	return fmt.Sprintf("%s.%s/%s/%s", gr.Resource, gr.Group, referent.Namespace, referent.Name)
+}
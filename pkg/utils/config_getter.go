@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/dynamic/dynamiclister"
+)
+
+// ConfigGetter has a method to return an addon config object of any GroupVersionResource
+type ConfigGetter interface {
+	Get(ctx context.Context, gvr schema.GroupVersionResource, namespace, name string) (*unstructured.Unstructured, error)
+}
+
+type dynamicConfigGetter struct {
+	client dynamic.Interface
+}
+
+// NewDynamicConfigGetter returns a ConfigGetter which gets the configs from the apiserver with the dynamic client.
+func NewDynamicConfigGetter(client dynamic.Interface) ConfigGetter {
+	return &dynamicConfigGetter{client: client}
+}
+
+func (g *dynamicConfigGetter) Get(
+	ctx context.Context, gvr schema.GroupVersionResource, namespace, name string) (*unstructured.Unstructured, error) {
+	if namespace == "" {
+		return g.client.Resource(gvr).Get(ctx, name, metav1.GetOptions{})
+	}
+	return g.client.Resource(gvr).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+}
+
+type informerConfigGetter struct {
+	listers map[schema.GroupVersionResource]dynamiclister.Lister
+}
+
+// NewInformerConfigGetter returns a ConfigGetter which gets the configs of the given GroupVersionResources from the
+// dynamic informers. The informers of the GroupVersionResources are registered to the informer factory when the
+// getter is created, so it must be created before the informer factory is started.
+func NewInformerConfigGetter(
+	informers dynamicinformer.DynamicSharedInformerFactory, gvrs ...schema.GroupVersionResource) ConfigGetter {
+	g := &informerConfigGetter{listers: map[schema.GroupVersionResource]dynamiclister.Lister{}}
+	for _, gvr := range gvrs {
+		g.listers[gvr] = dynamiclister.New(informers.ForResource(gvr).Informer().GetIndexer(), gvr)
+	}
+	return g
+}
+
+func (g *informerConfigGetter) Get(
+	_ context.Context, gvr schema.GroupVersionResource, namespace, name string) (*unstructured.Unstructured, error) {
+	lister, ok := g.listers[gvr]
+	if !ok {
+		return nil, fmt.Errorf("the informer of config %s is not registered", gvr)
+	}
+	if namespace == "" {
+		return lister.Get(name)
+	}
+	return lister.Namespace(namespace).Get(name)
+}
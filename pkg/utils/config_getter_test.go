@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"context"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func TestConfigGetter(t *testing.T) {
+	gvr := schema.GroupVersionResource{Group: "config.test", Version: "v1", Resource: "testconfigs"}
+	config := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "config.test/v1",
+			"kind":       "TestConfig",
+			"metadata": map[string]interface{}{
+				"name":      "config",
+				"namespace": "cluster1",
+			},
+		},
+	}
+
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{gvr: "TestConfigList"}, config)
+	informers := dynamicinformer.NewDynamicSharedInformerFactory(client, 0)
+
+	informerGetter := NewInformerConfigGetter(informers, gvr)
+	if err := informers.ForResource(gvr).Informer().GetStore().Add(config); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, getter := range map[string]ConfigGetter{
+		"dynamic":  NewDynamicConfigGetter(client),
+		"informer": informerGetter,
+	} {
+		t.Run(name, func(t *testing.T) {
+			obj, err := getter.Get(context.TODO(), gvr, "cluster1", "config")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if obj.GetName() != "config" {
+				t.Errorf("unexpected config %v", obj)
+			}
+
+			if _, err := getter.Get(context.TODO(), gvr, "cluster1", "missing"); !errors.IsNotFound(err) {
+				t.Errorf("expected not found error, but got %v", err)
+			}
+		})
+	}
+
+	if _, err := informerGetter.Get(context.TODO(), AddOnDeploymentConfigGVR, "cluster1", "config"); err == nil {
+		t.Errorf("expected error for the unregistered config")
+	}
+}
@@ -0,0 +1,249 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apiserver/pkg/server/healthz"
+	"k8s.io/klog/v2"
+)
+
+var _ healthz.HealthChecker = &ConfigWatcher{}
+
+// ConfigChange describes the change of a config file.
+type ConfigChange struct {
+	// File is the path of the changed config file.
+	File string
+	// Diff is the summary of the change, for example "2 lines added, 1 line removed".
+	Diff string
+}
+
+func (c ConfigChange) String() string {
+	return fmt.Sprintf("%s changed: %s", c.File, c.Diff)
+}
+
+// ConfigReloadFunc reloads the changed config files in process, the config watcher falls back to fail the health
+// check, so the container is restarted, if it returns an error.
+type ConfigReloadFunc func(changes []ConfigChange) error
+
+// ConfigWatcher has the same health check API as the config checker, but watches the config files with inotify
+// instead of hashing them on each check. It reports the changed files with a diff summary, and the changes can be
+// reloaded in process with the reload funcs instead of restarting the container with the liveness probe.
+//
+// Multiple watchers can be used in one process, for example one with a reload func for the config files which can be
+// reloaded in process, and one as the liveness health checker for the others.
+//
+// Example Code:
+//
+//	watcher, err := utils.NewConfigWatcher("config", "/config/server-config.yaml")
+//	if err != nil {
+//		return err
+//	}
+//	watcher.AddReloadFunc(func(changes []utils.ConfigChange) error {
+//		return server.Reload()
+//	})
+//	go watcher.Start(ctx)
+//
+// The config files are watched by their directories, so the files mounted from a ConfigMap or a Secret, which are
+// updated by replacing the symlinks, are watched as well.
+type ConfigWatcher struct {
+	name        string
+	configfiles []string
+	contents    map[string][]byte
+	reload      bool
+	reloadFuncs []ConfigReloadFunc
+
+	// changedErr is returned by Check if the changes are not reloaded in process, it is cleared once returned if
+	// reload is true.
+	changedErr error
+	// loadErr is returned by Check until the config files can be read again.
+	loadErr        error
+	lastChanges    []ConfigChange
+	lastReloadTime time.Time
+	sync.Mutex
+}
+
+// NewConfigWatcher returns a ConfigWatcher of the config files, the name could be any string and is used as the name
+// of the health checker and the label of the last reload time metric. Start must be called to watch the files.
+func NewConfigWatcher(name string, configfiles ...string) (*ConfigWatcher, error) {
+	contents := map[string][]byte{}
+	for _, file := range configfiles {
+		content, err := os.ReadFile(filepath.Clean(file))
+		if err != nil {
+			return nil, fmt.Errorf("read %s failed, %v", file, err)
+		}
+		contents[file] = content
+	}
+	return &ConfigWatcher{
+		name:        name,
+		configfiles: configfiles,
+		contents:    contents,
+	}, nil
+}
+
+// SetReload has the same semantic as the config checker, if reload is true, Check only returns the error of the
+// changes not reloaded in process once.
+func (w *ConfigWatcher) SetReload(reload bool) {
+	w.Lock()
+	defer w.Unlock()
+	w.reload = reload
+}
+
+// AddReloadFunc adds a func to reload the changes in process, Check does not fail for the changes once all the
+// reload funcs succeed.
+func (w *ConfigWatcher) AddReloadFunc(reloadFunc ConfigReloadFunc) {
+	w.Lock()
+	defer w.Unlock()
+	w.reloadFuncs = append(w.reloadFuncs, reloadFunc)
+}
+
+// Name return the name of the ConfigWatcher
+func (w *ConfigWatcher) Name() string {
+	return w.name
+}
+
+// Check returns an error if the config files cannot be read, or they are changed and not reloaded in process.
+func (w *ConfigWatcher) Check(_ *http.Request) error {
+	w.Lock()
+	defer w.Unlock()
+	if w.loadErr != nil {
+		return w.loadErr
+	}
+	err := w.changedErr
+	if w.reload {
+		w.changedErr = nil
+	}
+	return err
+}
+
+// LastChanges returns the latest changes of the config files and the time they were reloaded in process, the time
+// is zero if they are not reloaded.
+func (w *ConfigWatcher) LastChanges() ([]ConfigChange, time.Time) {
+	w.Lock()
+	defer w.Unlock()
+	return append([]ConfigChange{}, w.lastChanges...), w.lastReloadTime
+}
+
+// Start watches the config files until the ctx is done.
+func (w *ConfigWatcher) Start(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	dirs := sets.New[string]()
+	for _, file := range w.configfiles {
+		dirs.Insert(filepath.Dir(filepath.Clean(file)))
+	}
+	for _, dir := range sets.List(dirs) {
+		if err := watcher.Add(dir); err != nil {
+			return fmt.Errorf("failed to watch %s: %v", dir, err)
+		}
+	}
+
+	// the files may be changed before they are watched
+	w.sync()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			klog.V(4).Infof("Config watcher %s received event %s", w.name, event)
+			w.sync()
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			klog.Errorf("Config watcher %s failed to watch the config files: %v", w.name, err)
+		}
+	}
+}
+
+// sync reads the config files, and reloads the changed ones with the reload funcs.
+func (w *ConfigWatcher) sync() {
+	w.Lock()
+	var changes []ConfigChange
+	for _, file := range w.configfiles {
+		content, err := os.ReadFile(filepath.Clean(file))
+		if err != nil {
+			w.loadErr = fmt.Errorf("read %s failed, %v", file, err)
+			w.Unlock()
+			return
+		}
+		if bytes.Equal(content, w.contents[file]) {
+			continue
+		}
+		changes = append(changes, ConfigChange{File: file, Diff: configDiffSummary(w.contents[file], content)})
+		w.contents[file] = content
+	}
+	w.loadErr = nil
+	reloadFuncs := w.reloadFuncs
+	w.Unlock()
+
+	if len(changes) == 0 {
+		return
+	}
+	klog.Infof("Config watcher %s found config changes: %v", w.name, changes)
+
+	var reloadErr error
+	if len(reloadFuncs) == 0 {
+		reloadErr = fmt.Errorf("config files changed: %v", changes)
+	}
+	for _, reloadFunc := range reloadFuncs {
+		if err := reloadFunc(changes); err != nil {
+			reloadErr = fmt.Errorf("failed to reload the config changes %v: %v", changes, err)
+			break
+		}
+	}
+
+	w.Lock()
+	defer w.Unlock()
+	w.lastChanges = changes
+	if reloadErr != nil {
+		w.changedErr = reloadErr
+		return
+	}
+	w.lastReloadTime = time.Now()
+	configLastReloadTimestampSeconds.WithLabelValues(w.name).Set(float64(w.lastReloadTime.Unix()))
+}
+
+// configDiffSummary returns the summary of the lines added and removed from the old content to the new content.
+func configDiffSummary(oldContent, newContent []byte) string {
+	lines := map[string]int{}
+	for _, line := range strings.Split(string(oldContent), "\n") {
+		lines[line]++
+	}
+	var added, removed int
+	for _, line := range strings.Split(string(newContent), "\n") {
+		if lines[line] > 0 {
+			lines[line]--
+			continue
+		}
+		added++
+	}
+	for _, count := range lines {
+		removed += count
+	}
+	return fmt.Sprintf("%s added, %s removed", pluralLines(added), pluralLines(removed))
+}
+
+func pluralLines(n int) string {
+	if n == 1 {
+		return "1 line"
+	}
+	return fmt.Sprintf("%d lines", n)
+}
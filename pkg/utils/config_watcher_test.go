@@ -0,0 +1,207 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+func TestConfigDiffSummary(t *testing.T) {
+	cases := []struct {
+		name       string
+		oldContent string
+		newContent string
+		expected   string
+	}{
+		{
+			name:       "line changed",
+			oldContent: "a: 1\nb: 2\n",
+			newContent: "a: 1\nb: 3\n",
+			expected:   "1 line added, 1 line removed",
+		},
+		{
+			name:       "lines added",
+			oldContent: "a: 1\n",
+			newContent: "a: 1\nb: 2\nc: 3\n",
+			expected:   "2 lines added, 0 lines removed",
+		},
+		{
+			name:       "duplicated lines removed",
+			oldContent: "- a\n- a\n- a\n",
+			newContent: "- a\n",
+			expected:   "0 lines added, 2 lines removed",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if diff := configDiffSummary([]byte(c.oldContent), []byte(c.newContent)); diff != c.expected {
+				t.Errorf("expected %q, but got %q", c.expected, diff)
+			}
+		})
+	}
+}
+
+func TestConfigWatcher(t *testing.T) {
+	cases := []struct {
+		name           string
+		reload         bool
+		reloadErr      error
+		withReloadFunc bool
+		expectedErrs   []bool
+		expectReloaded bool
+	}{
+		{
+			name:         "no reload func",
+			expectedErrs: []bool{true, true},
+		},
+		{
+			name:         "no reload func with reload",
+			reload:       true,
+			expectedErrs: []bool{true, false},
+		},
+		{
+			name:           "reloaded in process",
+			withReloadFunc: true,
+			expectedErrs:   []bool{false, false},
+			expectReloaded: true,
+		},
+		{
+			name:           "reload func failed",
+			withReloadFunc: true,
+			reloadErr:      fmt.Errorf("invalid config"),
+			expectedErrs:   []bool{true, true},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dir := t.TempDir()
+			fileA, fileB := filepath.Join(dir, "a.yaml"), filepath.Join(dir, "b.yaml")
+			if err := os.WriteFile(fileA, []byte("a: 1\n"), 0600); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(fileB, []byte("b: 1\n"), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			watcher, err := NewConfigWatcher("test", fileA, fileB)
+			if err != nil {
+				t.Fatal(err)
+			}
+			watcher.SetReload(c.reload)
+
+			var lock sync.Mutex
+			var reloaded []ConfigChange
+			if c.withReloadFunc {
+				watcher.AddReloadFunc(func(changes []ConfigChange) error {
+					lock.Lock()
+					defer lock.Unlock()
+					reloaded = append(reloaded, changes...)
+					return c.reloadErr
+				})
+			}
+
+			ctx, cancel := context.WithCancel(context.TODO())
+			defer cancel()
+			go func() {
+				if err := watcher.Start(ctx); err != nil {
+					t.Errorf("failed to start watcher: %v", err)
+				}
+			}()
+
+			if err := watcher.Check(nil); err != nil {
+				t.Fatalf("expected no error before the change, but got %v", err)
+			}
+
+			// keep changing the file until the change is found in case it is changed before the file is watched
+			err = wait.PollUntilContextTimeout(ctx, 100*time.Millisecond, 10*time.Second, true,
+				func(context.Context) (bool, error) {
+					if err := replaceFile(fileB, []byte("b: 2\n")); err != nil {
+						return false, err
+					}
+					changes, _ := watcher.LastChanges()
+					return len(changes) > 0, nil
+				})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			changes, reloadTime := watcher.LastChanges()
+			if len(changes) != 1 || changes[0].File != fileB || changes[0].Diff != "1 line added, 1 line removed" {
+				t.Errorf("unexpected changes %v", changes)
+			}
+			if c.expectReloaded == reloadTime.IsZero() {
+				t.Errorf("expected reloaded %v, but got reload time %v", c.expectReloaded, reloadTime)
+			}
+
+			for i, expectedErr := range c.expectedErrs {
+				err := watcher.Check(nil)
+				if expectedErr && (err == nil || !strings.Contains(err.Error(), fileB)) {
+					t.Errorf("expected error of %s at check %d, but got %v", fileB, i, err)
+				}
+				if !expectedErr && err != nil {
+					t.Errorf("expected no error at check %d, but got %v", i, err)
+				}
+			}
+
+			lock.Lock()
+			defer lock.Unlock()
+			if c.withReloadFunc && len(reloaded) != 1 {
+				t.Errorf("expected the change to be reloaded once, but got %v", reloaded)
+			}
+		})
+	}
+}
+
+// replaceFile replaces the file atomically as the kubelet updates the files mounted from a ConfigMap, so the
+// watcher never reads a partially written file.
+func replaceFile(file string, content []byte) error {
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, content, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+func TestConfigWatcherFileRemoved(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "a.yaml")
+	if err := os.WriteFile(file, []byte("a: 1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	watcher, err := NewConfigWatcher("test", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	watcher.SetReload(true)
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	go func() {
+		_ = watcher.Start(ctx)
+	}()
+
+	if err := os.Remove(file); err != nil {
+		t.Fatal(err)
+	}
+	err = wait.PollUntilContextTimeout(ctx, 100*time.Millisecond, 10*time.Second, true,
+		func(context.Context) (bool, error) {
+			return watcher.Check(nil) != nil, nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the error is returned until the file can be read again
+	if err := watcher.Check(nil); err == nil {
+		t.Errorf("expected error, but got none")
+	}
+}
@@ -1,7 +1,12 @@
 package utils
 
 import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
 	"net"
 	"testing"
 	"time"
@@ -246,3 +251,49 @@ func TestIsCSRSupported(t *testing.T) {
 		assert.Equal(t, c.expectedError, err)
 	}
 }
+
+func TestDefaultCRLSigner(t *testing.T) {
+	caKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caData := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER})
+	keyData := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(caKey)})
+
+	signer := DefaultCRLSignerWithExpiry(keyData, caData, time.Hour)
+	data, err := signer([]x509.RevocationListEntry{
+		{SerialNumber: big.NewInt(10), RevocationTime: time.Now()},
+	})
+	if err != nil {
+		t.Fatalf("Failed to sign the crl, %v", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "X509 CRL" {
+		t.Fatalf("Expect a PEM encoded crl, but got %s", string(data))
+	}
+	crl, err := x509.ParseRevocationList(block.Bytes)
+	if err != nil {
+		t.Fatalf("Failed to parse crl: %v", err)
+	}
+	caCert, _ := x509.ParseCertificate(caDER)
+	if err := crl.CheckSignatureFrom(caCert); err != nil {
+		t.Errorf("Expect crl signed by the ca, %v", err)
+	}
+	if len(crl.RevokedCertificateEntries) != 1 || crl.RevokedCertificateEntries[0].SerialNumber.Int64() != 10 {
+		t.Errorf("Unexpected revoked certificates %v", crl.RevokedCertificateEntries)
+	}
+}
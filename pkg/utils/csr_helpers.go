@@ -32,33 +32,71 @@ var serialNumberLimit = new(big.Int).Lsh(big.NewInt(1), 128)
 func DefaultSignerWithExpiry(caKey, caData []byte, duration time.Duration) agent.CSRSignerFunc {
 	return func(cluster *clusterv1.ManagedCluster, addon *addonapiv1alpha1.ManagedClusterAddOn,
 		csr *certificatesv1.CertificateSigningRequest) ([]byte, error) {
-		blockTlsCrt, _ := pem.Decode(caData)
-		if blockTlsCrt == nil {
-			return nil, fmt.Errorf("failed to decode cert")
-		}
-		certs, err := x509.ParseCertificates(blockTlsCrt.Bytes)
+		caCert, key, err := parseCAKeyPair(caKey, caData)
 		if err != nil {
-			return nil, fmt.Errorf("failed to parse cert: %v", err)
+			return nil, err
 		}
 
-		blockTlsKey, _ := pem.Decode(caKey)
-		if blockTlsKey == nil {
-			return nil, fmt.Errorf("failed to decode key")
+		data, err := signCSR(csr, caCert, key, duration)
+		if err != nil {
+			return nil, fmt.Errorf("failed to sign csr: %v", err)
 		}
+		return data, nil
+	}
+}
 
-		// For now only PKCS#1 is supported which assures the private key algorithm is RSA.
-		// TODO: Compatibility w/ PKCS#8 key e.g. EC algorithm
-		key, err := x509.ParsePKCS1PrivateKey(blockTlsKey.Bytes)
+// DefaultCRLSignerWithExpiry generates a signer func for addon to sign the certificate revocation list using
+// caKey and caData, the next update of the CRL is set to the given duration later. The CA certificate should
+// have the cRLSign key usage if any key usage is set.
+func DefaultCRLSignerWithExpiry(caKey, caData []byte, duration time.Duration) agent.CRLSignerFunc {
+	return func(revoked []x509.RevocationListEntry) ([]byte, error) {
+		caCert, key, err := parseCAKeyPair(caKey, caData)
 		if err != nil {
-			return nil, fmt.Errorf("failed to parse key: %v", err)
+			return nil, err
 		}
 
-		data, err := signCSR(csr, certs[0], key, duration)
+		now := time.Now()
+		tmpl := &x509.RevocationList{
+			RevokedCertificateEntries: revoked,
+			// use the timestamp as the CRL number, so it increases monotonically between generations
+			Number:     big.NewInt(now.UnixNano()),
+			ThisUpdate: now,
+			NextUpdate: now.Add(duration),
+		}
+		der, err := x509.CreateRevocationList(rand.Reader, tmpl, caCert, key)
 		if err != nil {
-			return nil, fmt.Errorf("failed to sign csr: %v", err)
+			return nil, fmt.Errorf("failed to sign revocation list: %v", err)
 		}
-		return data, nil
+
+		return pem.EncodeToMemory(&pem.Block{
+			Type:  "X509 CRL",
+			Bytes: der,
+		}), nil
+	}
+}
+
+func parseCAKeyPair(caKey, caData []byte) (*x509.Certificate, *rsa.PrivateKey, error) {
+	blockTlsCrt, _ := pem.Decode(caData)
+	if blockTlsCrt == nil {
+		return nil, nil, fmt.Errorf("failed to decode cert")
+	}
+	certs, err := x509.ParseCertificates(blockTlsCrt.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse cert: %v", err)
+	}
+
+	blockTlsKey, _ := pem.Decode(caKey)
+	if blockTlsKey == nil {
+		return nil, nil, fmt.Errorf("failed to decode key")
+	}
+
+	// For now only PKCS#1 is supported which assures the private key algorithm is RSA.
+	// TODO: Compatibility w/ PKCS#8 key e.g. EC algorithm
+	key, err := x509.ParsePKCS1PrivateKey(blockTlsKey.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse key: %v", err)
 	}
+	return certs[0], key, nil
 }
 
 func signCSR(csr *certificatesv1.CertificateSigningRequest, caCert *x509.Certificate, caKey *rsa.PrivateKey, duration time.Duration) ([]byte, error) {
@@ -7,6 +7,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"reflect"
+	"regexp"
 	"strings"
 
 	corev1 "k8s.io/api/core/v1"
@@ -363,3 +364,21 @@ func ClusterConditionChanged(old, new *clusterv1.ManagedCluster, conditionType s
 		(oldAvailableCondition != nil && newAvailableCondition != nil &&
 			oldAvailableCondition.Status != newAvailableCondition.Status)
 }
+
+// WildcardMatch compares the resource with the target, the target may include the wildcard "*" matching any
+// characters, e.g. "agent-*".
+func WildcardMatch(resource, target string) bool {
+	if resource == target || target == "*" {
+		return true
+	}
+
+	pattern := "^" + regexp.QuoteMeta(target) + "$"
+	pattern = strings.ReplaceAll(pattern, "\\*", ".*")
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return false
+	}
+
+	return re.MatchString(resource)
+}
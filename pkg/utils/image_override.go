@@ -0,0 +1,207 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+	"sigs.k8s.io/yaml"
+)
+
+// ImageDigestsConfigMapKey is the key in the data of the image digests ConfigMap, the value is a yaml or json map
+// from the images to their digests, for example:
+//
+//	images: |
+//	  quay.io/open-cluster-management/addon-agent:v1: sha256:6c3c624b58dbbcd3c0dd82b4c53f04194d1247c6eebdaab7c610cf7d66709b3b
+const ImageDigestsConfigMapKey = "images"
+
+// ImageOverrideRule overrides the images matching the rule with the mirror. The rule matches the images in one of the
+// following ways:
+//   - ImageRegex is set: the images matching the regular expression are replaced with the Mirror, which can
+//     reference the submatches of the expression, for example "${1}".
+//   - ImageName is set: the images whose repository, the image without the tag or the digest, equals to ImageName
+//     are replaced with the Mirror repository, and the tag or the digest is kept.
+//   - otherwise: the images with the prefix Source are overridden in the same way as the ImageMirror.
+type ImageOverrideRule struct {
+	Source     string `json:"source,omitempty"`
+	ImageName  string `json:"imageName,omitempty"`
+	ImageRegex string `json:"imageRegex,omitempty"`
+	Mirror     string `json:"mirror"`
+}
+
+// ImageMirrorsToRules converts the ImageMirrors to ImageOverrideRules.
+func ImageMirrorsToRules(mirrors []addonapiv1alpha1.ImageMirror) []ImageOverrideRule {
+	rules := make([]ImageOverrideRule, 0, len(mirrors))
+	for _, mirror := range mirrors {
+		rules = append(rules, ImageOverrideRule{Source: mirror.Source, Mirror: mirror.Mirror})
+	}
+	return rules
+}
+
+// OverrideImageWithRules overrides the image with the rules, the larger index will work if multiple rules match
+// the image. Use ImageOverrider instead to override multiple images with the same rules, so the regular
+// expressions are compiled once.
+func OverrideImageWithRules(rules []ImageOverrideRule, image string) (string, error) {
+	overrider, err := NewImageOverrider(rules...)
+	if err != nil {
+		return image, err
+	}
+	return overrider.Override(image), nil
+}
+
+// ImageOverrider overrides the images with the rules whose regular expressions are compiled.
+type ImageOverrider struct {
+	rules   []ImageOverrideRule
+	regexes []*regexp.Regexp
+}
+
+// NewImageOverrider compiles the rules, an error is returned if any ImageRegex is invalid.
+func NewImageOverrider(rules ...ImageOverrideRule) (*ImageOverrider, error) {
+	return (&ImageOverrider{}).Append(rules...)
+}
+
+// Append returns a new ImageOverrider with the rules appended, the appended rules take precedence over the
+// existing ones. The ImageOverrider itself is not changed.
+func (o *ImageOverrider) Append(rules ...ImageOverrideRule) (*ImageOverrider, error) {
+	overrider := &ImageOverrider{
+		rules:   append(append(make([]ImageOverrideRule, 0, len(o.rules)+len(rules)), o.rules...), rules...),
+		regexes: append(make([]*regexp.Regexp, 0, len(o.regexes)+len(rules)), o.regexes...),
+	}
+	for _, rule := range rules {
+		var re *regexp.Regexp
+		if len(rule.ImageRegex) > 0 {
+			var err error
+			if re, err = regexp.Compile(rule.ImageRegex); err != nil {
+				return nil, fmt.Errorf("invalid image regex %q: %v", rule.ImageRegex, err)
+			}
+		}
+		overrider.regexes = append(overrider.regexes, re)
+	}
+	return overrider, nil
+}
+
+// Override overrides the image with the rules, the larger index will work if multiple rules match the image.
+func (o *ImageOverrider) Override(image string) string {
+	overrideImage := image
+	for i, rule := range o.rules {
+		var name string
+		switch {
+		case o.regexes[i] != nil:
+			if !o.regexes[i].MatchString(image) {
+				continue
+			}
+			name = o.regexes[i].ReplaceAllString(image, rule.Mirror)
+		case len(rule.ImageName) > 0:
+			repository, suffix := splitImageRepository(image)
+			if repository != rule.ImageName {
+				continue
+			}
+			name = rule.Mirror + suffix
+		default:
+			name = imageOverride(rule.Source, rule.Mirror, image)
+		}
+
+		if name != image {
+			overrideImage = name
+		}
+	}
+	return overrideImage
+}
+
+// ImageDigestResolver resolves the digests of the images, so the images can be pinned to the digests.
+type ImageDigestResolver interface {
+	// Resolve returns the digest of the image, for example "sha256:6c3c...", found is false if the image is not
+	// pinned.
+	Resolve(ctx context.Context, image string) (digest string, found bool, err error)
+}
+
+// ImageDigests is an ImageDigestResolver with a static map from the images to their digests.
+type ImageDigests map[string]string
+
+func (d ImageDigests) Resolve(_ context.Context, image string) (string, bool, error) {
+	digest, ok := d[image]
+	return digest, ok, nil
+}
+
+type configMapImageDigestResolver struct {
+	lister    corev1listers.ConfigMapLister
+	namespace string
+	name      string
+
+	lock            sync.Mutex
+	resourceVersion string
+	digests         ImageDigests
+}
+
+// NewConfigMapImageDigestResolver returns an ImageDigestResolver which resolves the digests from the hub ConfigMap,
+// the digests are in the data of the ConfigMap with the key ImageDigestsConfigMapKey. No image is pinned if the
+// ConfigMap does not exist.
+//
+// The ConfigMap is read from the lister, whose informer should be started and synced before the images are
+// resolved. The digests are parsed again only after the ConfigMap is changed.
+func NewConfigMapImageDigestResolver(lister corev1listers.ConfigMapLister, namespace, name string) ImageDigestResolver {
+	return &configMapImageDigestResolver{lister: lister, namespace: namespace, name: name}
+}
+
+func (r *configMapImageDigestResolver) Resolve(ctx context.Context, image string) (string, bool, error) {
+	cm, err := r.lister.ConfigMaps(r.namespace).Get(r.name)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.digests == nil || r.resourceVersion != cm.ResourceVersion {
+		digests := ImageDigests{}
+		if err := yaml.Unmarshal([]byte(cm.Data[ImageDigestsConfigMapKey]), &digests); err != nil {
+			return "", false, fmt.Errorf("failed to parse the image digests in configmap %s/%s: %v", r.namespace, r.name, err)
+		}
+		r.resourceVersion = cm.ResourceVersion
+		r.digests = digests
+	}
+	return r.digests.Resolve(ctx, image)
+}
+
+// PinImageDigest pins the image to the digest of the original image resolved by the resolver, the tag or the
+// digest of the image is replaced with the resolved digest. The digest is looked up with the original image since
+// the mirrored image has the same content.
+func PinImageDigest(ctx context.Context, resolver ImageDigestResolver, originalImage, image string) (string, error) {
+	if resolver == nil {
+		return image, nil
+	}
+
+	digest, found, err := resolver.Resolve(ctx, originalImage)
+	if err != nil {
+		return image, err
+	}
+	if !found {
+		return image, nil
+	}
+	if !strings.Contains(digest, ":") {
+		return image, fmt.Errorf("invalid digest %q of image %s", digest, originalImage)
+	}
+
+	repository, _ := splitImageRepository(image)
+	return fmt.Sprintf("%s@%s", repository, digest), nil
+}
+
+// splitImageRepository splits the image into the repository and the suffix, which is the tag beginning with ":" or
+// the digest beginning with "@".
+func splitImageRepository(image string) (string, string) {
+	if i := strings.Index(image, "@"); i >= 0 {
+		return image[:i], image[i:]
+	}
+	// the colon after the last slash separates the tag, the ones before it may be the registry port
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		return image[:i], image[i:]
+	}
+	return image, ""
+}
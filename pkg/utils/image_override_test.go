@@ -0,0 +1,229 @@
+package utils
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestOverrideImageWithRules(t *testing.T) {
+	cases := []struct {
+		name        string
+		rules       []ImageOverrideRule
+		image       string
+		expected    string
+		expectedErr bool
+	}{
+		{
+			name:     "no rules",
+			image:    "quay.io/ocm/addon:v1",
+			expected: "quay.io/ocm/addon:v1",
+		},
+		{
+			name:     "source prefix",
+			rules:    []ImageOverrideRule{{Source: "quay.io/ocm", Mirror: "mirror.io/ocm"}},
+			image:    "quay.io/ocm/addon:v1",
+			expected: "mirror.io/ocm/addon:v1",
+		},
+		{
+			name:     "image name keeps the tag",
+			rules:    []ImageOverrideRule{{ImageName: "quay.io/ocm/addon", Mirror: "mirror.io/addon"}},
+			image:    "quay.io/ocm/addon:v1",
+			expected: "mirror.io/addon:v1",
+		},
+		{
+			name:     "image name with registry port",
+			rules:    []ImageOverrideRule{{ImageName: "localhost:5000/addon", Mirror: "mirror.io/addon"}},
+			image:    "localhost:5000/addon@sha256:abc",
+			expected: "mirror.io/addon@sha256:abc",
+		},
+		{
+			name:     "image name not match",
+			rules:    []ImageOverrideRule{{ImageName: "quay.io/ocm/addon", Mirror: "mirror.io/addon"}},
+			image:    "quay.io/ocm/addon-agent:v1",
+			expected: "quay.io/ocm/addon-agent:v1",
+		},
+		{
+			name:     "image regex",
+			rules:    []ImageOverrideRule{{ImageRegex: `^quay\.io/ocm/(.*)$`, Mirror: "mirror.io/${1}"}},
+			image:    "quay.io/ocm/addon:v1",
+			expected: "mirror.io/addon:v1",
+		},
+		{
+			name:        "invalid image regex",
+			rules:       []ImageOverrideRule{{ImageRegex: `(`, Mirror: "mirror.io"}},
+			image:       "quay.io/ocm/addon:v1",
+			expectedErr: true,
+		},
+		{
+			name: "the latter rule wins",
+			rules: []ImageOverrideRule{
+				{ImageName: "quay.io/ocm/addon", Mirror: "first.io/addon"},
+				{Source: "quay.io", Mirror: "second.io"},
+				{Source: "docker.io", Mirror: "third.io"},
+			},
+			image:    "quay.io/ocm/addon:v1",
+			expected: "second.io/ocm/addon:v1",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			image, err := OverrideImageWithRules(c.rules, c.image)
+			if c.expectedErr {
+				if err == nil {
+					t.Errorf("expected error, but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if image != c.expected {
+				t.Errorf("expected image %s, but got %s", c.expected, image)
+			}
+		})
+	}
+}
+
+func TestPinImageDigest(t *testing.T) {
+	digest := "sha256:6c3c624b58dbbcd3c0dd82b4c53f04194d1247c6eebdaab7c610cf7d66709b3b"
+	cases := []struct {
+		name        string
+		objects     []runtime.Object
+		image       string
+		expected    string
+		expectedErr bool
+	}{
+		{
+			name:     "no configmap",
+			image:    "mirror.io/addon:v1",
+			expected: "mirror.io/addon:v1",
+		},
+		{
+			name: "digest pinned",
+			objects: []runtime.Object{newImageDigestsConfigMap(
+				"quay.io/ocm/addon:v1: " + digest)},
+			image:    "mirror.io/addon:v1",
+			expected: "mirror.io/addon@" + digest,
+		},
+		{
+			name: "image not pinned",
+			objects: []runtime.Object{newImageDigestsConfigMap(
+				"quay.io/ocm/addon:v2: " + digest)},
+			image:    "mirror.io/addon:v1",
+			expected: "mirror.io/addon:v1",
+		},
+		{
+			name:        "invalid digests",
+			objects:     []runtime.Object{newImageDigestsConfigMap("invalid")},
+			image:       "mirror.io/addon:v1",
+			expectedErr: true,
+		},
+		{
+			name: "invalid digest",
+			objects: []runtime.Object{newImageDigestsConfigMap(
+				"quay.io/ocm/addon:v1: invalid")},
+			image:       "mirror.io/addon:v1",
+			expectedErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			resolver := NewConfigMapImageDigestResolver(
+				newConfigMapLister(t, c.objects...), "open-cluster-management-hub", "image-digests")
+			image, err := PinImageDigest(context.TODO(), resolver, "quay.io/ocm/addon:v1", c.image)
+			if c.expectedErr {
+				if err == nil {
+					t.Errorf("expected error, but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if image != c.expected {
+				t.Errorf("expected image %s, but got %s", c.expected, image)
+			}
+		})
+	}
+}
+
+func TestConfigMapImageDigestResolver(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	resolver := NewConfigMapImageDigestResolver(
+		corev1listers.NewConfigMapLister(indexer), "open-cluster-management-hub", "image-digests")
+
+	cm := newImageDigestsConfigMap("quay.io/ocm/addon:v1: sha256:v1")
+	cm.ResourceVersion = "1"
+	if err := indexer.Add(cm); err != nil {
+		t.Fatal(err)
+	}
+	if digest, found, err := resolver.Resolve(context.TODO(), "quay.io/ocm/addon:v1"); err != nil || !found || digest != "sha256:v1" {
+		t.Errorf("unexpected digest %q, %v, %v", digest, found, err)
+	}
+
+	// the digests are parsed again after the configmap is changed
+	cm = newImageDigestsConfigMap("quay.io/ocm/addon:v1: sha256:v2")
+	cm.ResourceVersion = "2"
+	if err := indexer.Update(cm); err != nil {
+		t.Fatal(err)
+	}
+	if digest, found, err := resolver.Resolve(context.TODO(), "quay.io/ocm/addon:v1"); err != nil || !found || digest != "sha256:v2" {
+		t.Errorf("unexpected digest %q, %v, %v", digest, found, err)
+	}
+
+	// no image is pinned after the configmap is deleted
+	if err := indexer.Delete(cm); err != nil {
+		t.Fatal(err)
+	}
+	if _, found, err := resolver.Resolve(context.TODO(), "quay.io/ocm/addon:v1"); err != nil || found {
+		t.Errorf("expected the image not to be pinned, but got %v, %v", found, err)
+	}
+}
+
+func TestImageOverriderAppend(t *testing.T) {
+	overrider, err := NewImageOverrider(ImageOverrideRule{ImageRegex: `^quay\.io/ocm/(.*)$`, Mirror: "first.io/${1}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	appended, err := overrider.Append(ImageOverrideRule{Source: "quay.io/ocm", Mirror: "second.io/ocm"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if image := appended.Override("quay.io/ocm/addon:v1"); image != "second.io/ocm/addon:v1" {
+		t.Errorf("expected the appended rule to win, but got %s", image)
+	}
+	// the original overrider is not changed
+	if image := overrider.Override("quay.io/ocm/addon:v1"); image != "first.io/addon:v1" {
+		t.Errorf("expected the original rules, but got %s", image)
+	}
+
+	if _, err := overrider.Append(ImageOverrideRule{ImageRegex: `(`, Mirror: "mirror.io"}); err == nil {
+		t.Errorf("expected error when the appended image regex is invalid")
+	}
+}
+
+func newConfigMapLister(t *testing.T, objects ...runtime.Object) corev1listers.ConfigMapLister {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, obj := range objects {
+		if err := indexer.Add(obj); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return corev1listers.NewConfigMapLister(indexer)
+}
+
+func newImageDigestsConfigMap(images string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "image-digests", Namespace: "open-cluster-management-hub"},
+		Data:       map[string]string{ImageDigestsConfigMapKey: images},
+	}
+}
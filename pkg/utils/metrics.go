@@ -0,0 +1,20 @@
+package utils
+
+import (
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+)
+
+// configLastReloadTimestampSeconds records the time the config changes were last reloaded in process by a config
+// watcher.
+var configLastReloadTimestampSeconds = metrics.NewGaugeVec(
+	&metrics.GaugeOpts{
+		Name: "addon_config_last_reload_timestamp_seconds",
+		Help: "Unix timestamp of the last in-process reload of the config files, labeled by config watcher.",
+	},
+	[]string{"watcher"},
+)
+
+func init() {
+	legacyregistry.MustRegister(configLastReloadTimestampSeconds)
+}
@@ -3,17 +3,22 @@ package utils
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	certificatesv1 "k8s.io/api/certificates/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
 	"k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/kubernetes"
 	rbacclientv1 "k8s.io/client-go/kubernetes/typed/rbac/v1"
+	"k8s.io/klog/v2"
 	"k8s.io/utils/pointer"
 	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
 	clusterv1 "open-cluster-management.io/api/cluster/v1"
+	"open-cluster-management.io/sdk-go/pkg/basecontroller/events"
 
 	"open-cluster-management.io/addon-framework/pkg/agent"
 )
@@ -53,7 +58,22 @@ type RBACPermissionBuilder interface {
 	// WithStaticRole ensures a role binding to the hub cluster.
 	WithStaticRoleBinding(clusterRole *rbacv1.RoleBinding) RBACPermissionBuilder
 
-	// Build wraps up the builder chain, and return a agent.PermissionConfigFunc.
+	// WithPruning reconciles the full set of role bindings in the cluster namespace. The role bindings applied by
+	// the builder are labeled with the addon name, the ones owned by the addon but no longer built, e.g. the kube
+	// client role binding once the registration subject is removed, are deleted, and the removed bindings and
+	// subjects are reported with the recorder. The unlabeled role bindings owned by the addon with the names of
+	// the bindings of the builder, e.g. applied before the pruning is enabled, are pruned as well. Only one builder
+	// of an addon should enable the pruning.
+	// The kube client cluster role binding is shared by the clusters and cannot be pruned, so WithPruning must not
+	// be combined with BindKubeClientClusterRole, use BindKubeClientRole instead.
+	WithPruning(recorder events.Recorder) RBACPermissionBuilder
+
+	// Validate returns an error if the builder chain is invalid, e.g. WithPruning is combined with
+	// BindKubeClientClusterRole. It should be checked once the builder chain is created.
+	Validate() error
+
+	// Build wraps up the builder chain, and return a agent.PermissionConfigFunc. If the builder chain is invalid,
+	// the error is logged and the pruning is disabled.
 	Build() agent.PermissionConfigFunc
 }
 
@@ -62,13 +82,25 @@ var _ RBACPermissionBuilder = &permissionBuilder{}
 type permissionBuilder struct {
 	kubeClient kubernetes.Interface
 	u          *unionPermissionBuilder
+
+	// roleBindings returns the role bindings the builder produces, a nil role binding is not produced.
+	roleBindings []roleBindingFunc
+	// roleBindingNames are the names of all the role bindings the builder may produce.
+	roleBindingNames sets.Set[string]
+	prune            bool
+	recorder         events.Recorder
+	// kubeClientClusterRoleBound is set by BindKubeClientClusterRole, whose binding cannot be pruned.
+	kubeClientClusterRoleBound bool
 }
 
+type roleBindingFunc func(cluster *clusterv1.ManagedCluster, addon *addonapiv1alpha1.ManagedClusterAddOn) *rbacv1.RoleBinding
+
 // NewRBACPermissionConfigBuilder instantiates a default RBACPermissionBuilder.
 func NewRBACPermissionConfigBuilder(kubeClient kubernetes.Interface) RBACPermissionBuilder {
 	return &permissionBuilder{
-		u:          &unionPermissionBuilder{},
-		kubeClient: kubeClient,
+		u:                &unionPermissionBuilder{},
+		kubeClient:       kubeClient,
+		roleBindingNames: sets.New[string](),
 	}
 }
 
@@ -150,6 +182,7 @@ func (p *permissionBuilder) BindRoleToGroup(role *rbacv1.Role, userGroup string)
 
 func (p *permissionBuilder) BindKubeClientClusterRole(clusterRole *rbacv1.ClusterRole) RBACPermissionBuilder {
 	p.WithStaticClusterRole(clusterRole)
+	p.kubeClientClusterRoleBound = true
 
 	p.u.fns = append(p.u.fns, func(cluster *clusterv1.ManagedCluster, addon *addonapiv1alpha1.ManagedClusterAddOn) error {
 		// Build subjects from the registration status
@@ -182,16 +215,14 @@ func (p *permissionBuilder) BindKubeClientClusterRole(clusterRole *rbacv1.Cluste
 func (p *permissionBuilder) BindKubeClientRole(role *rbacv1.Role) RBACPermissionBuilder {
 	p.WithStaticRole(role)
 
-	p.u.fns = append(p.u.fns, func(cluster *clusterv1.ManagedCluster, addon *addonapiv1alpha1.ManagedClusterAddOn) error {
+	roleBinding := func(cluster *clusterv1.ManagedCluster, addon *addonapiv1alpha1.ManagedClusterAddOn) *rbacv1.RoleBinding {
 		// Build subjects from the registration status
 		subjects := BuildSubjectsFromRegistration(addon, certificatesv1.KubeAPIServerClientSignerName)
-
-		// If no subjects found, return pending error
 		if len(subjects) == 0 {
-			return &agent.SubjectNotReadyError{}
+			return nil
 		}
 
-		binding := &rbacv1.RoleBinding{
+		return &rbacv1.RoleBinding{
 			ObjectMeta: metav1.ObjectMeta{
 				Name:      role.Name,
 				Namespace: cluster.Name,
@@ -203,10 +234,19 @@ func (p *permissionBuilder) BindKubeClientRole(role *rbacv1.Role) RBACPermission
 			},
 			Subjects: subjects,
 		}
+	}
+	p.roleBindings = append(p.roleBindings, roleBinding)
+	p.roleBindingNames.Insert(role.Name)
 
-		ensureAddonOwnerReference(&binding.ObjectMeta, addon)
-		_, _, err := ApplyRoleBinding(context.TODO(), p.kubeClient.RbacV1(), binding)
-		return err
+	p.u.fns = append(p.u.fns, func(cluster *clusterv1.ManagedCluster, addon *addonapiv1alpha1.ManagedClusterAddOn) error {
+		binding := roleBinding(cluster, addon)
+
+		// If no subjects found, return pending error
+		if binding == nil {
+			return &agent.SubjectNotReadyError{}
+		}
+
+		return p.applyRoleBinding(binding, addon)
 	})
 
 	return p
@@ -230,6 +270,8 @@ func (p *permissionBuilder) WithStaticClusterRoleBinding(binding *rbacv1.Cluster
 
 func (p *permissionBuilder) WithStaticRole(role *rbacv1.Role) RBACPermissionBuilder {
 	p.u.fns = append(p.u.fns, func(cluster *clusterv1.ManagedCluster, addon *addonapiv1alpha1.ManagedClusterAddOn) error {
+		// the role is shared by the clusters, copy it before setting the namespace and owner
+		role := role.DeepCopy()
 		role.Namespace = cluster.Name
 		ensureAddonOwnerReference(&role.ObjectMeta, addon)
 		_, _, err := ApplyRole(context.TODO(), p.kubeClient.RbacV1(), role)
@@ -239,17 +281,132 @@ func (p *permissionBuilder) WithStaticRole(role *rbacv1.Role) RBACPermissionBuil
 }
 
 func (p *permissionBuilder) WithStaticRoleBinding(binding *rbacv1.RoleBinding) RBACPermissionBuilder {
-	p.u.fns = append(p.u.fns, func(cluster *clusterv1.ManagedCluster, addon *addonapiv1alpha1.ManagedClusterAddOn) error {
+	roleBinding := func(cluster *clusterv1.ManagedCluster, addon *addonapiv1alpha1.ManagedClusterAddOn) *rbacv1.RoleBinding {
+		// the binding is shared by the clusters, copy it before setting the namespace, owner and labels
+		binding := binding.DeepCopy()
 		binding.Namespace = cluster.Name
-		ensureAddonOwnerReference(&binding.ObjectMeta, addon)
-		_, _, err := ApplyRoleBinding(context.TODO(), p.kubeClient.RbacV1(), binding)
-		return err
+		return binding
+	}
+	p.roleBindings = append(p.roleBindings, roleBinding)
+	p.roleBindingNames.Insert(binding.Name)
+
+	p.u.fns = append(p.u.fns, func(cluster *clusterv1.ManagedCluster, addon *addonapiv1alpha1.ManagedClusterAddOn) error {
+		return p.applyRoleBinding(roleBinding(cluster, addon), addon)
 	})
 	return p
 }
 
+func (p *permissionBuilder) WithPruning(recorder events.Recorder) RBACPermissionBuilder {
+	p.prune = true
+	p.recorder = recorder
+	return p
+}
+
+func (p *permissionBuilder) Validate() error {
+	if p.prune && p.kubeClientClusterRoleBound {
+		return fmt.Errorf("the kube client cluster role binding is shared by the clusters and cannot be pruned, " +
+			"use BindKubeClientRole with WithPruning")
+	}
+	return nil
+}
+
 func (p *permissionBuilder) Build() agent.PermissionConfigFunc {
-	return p.u.build()
+	build := p.u.build()
+	if !p.prune {
+		return build
+	}
+	if err := p.Validate(); err != nil {
+		klog.Errorf("Pruning of the role bindings is disabled: %v", err)
+		return build
+	}
+
+	return func(cluster *clusterv1.ManagedCluster, addon *addonapiv1alpha1.ManagedClusterAddOn) error {
+		// prune before applying, since the build stops at the first error, e.g. the subject is not ready.
+		if err := p.pruneRoleBindings(context.TODO(), cluster, addon); err != nil {
+			return err
+		}
+		return build(cluster, addon)
+	}
+}
+
+func (p *permissionBuilder) applyRoleBinding(binding *rbacv1.RoleBinding, addon *addonapiv1alpha1.ManagedClusterAddOn) error {
+	ensureAddonOwnerReference(&binding.ObjectMeta, addon)
+	if p.prune {
+		if binding.Labels == nil {
+			binding.Labels = map[string]string{}
+		}
+		binding.Labels[addonapiv1alpha1.AddonLabelKey] = addon.Name
+	}
+	_, _, err := ApplyRoleBinding(context.TODO(), p.kubeClient.RbacV1(), binding)
+	return err
+}
+
+// pruneRoleBindings deletes the role bindings of the addon which are no longer built, see PruneRoleBindings.
+func (p *permissionBuilder) pruneRoleBindings(ctx context.Context,
+	cluster *clusterv1.ManagedCluster, addon *addonapiv1alpha1.ManagedClusterAddOn) error {
+	var desired []*rbacv1.RoleBinding
+	for _, roleBinding := range p.roleBindings {
+		if binding := roleBinding(cluster, addon); binding != nil {
+			desired = append(desired, binding)
+		}
+	}
+	return PruneRoleBindings(ctx, p.kubeClient, p.recorder, cluster.Name, addon, desired, p.roleBindingNames)
+}
+
+// PruneRoleBindings deletes the role bindings of the addon in the namespace which are not desired, and reports the
+// subjects removed from the desired bindings, the subjects are removed when the desired bindings are applied. The
+// role bindings of the addon are the ones owned by the addon, which are either labeled with the addon name or have
+// one of the names. The deletions are reported with the recorder, or logged if the recorder is nil.
+func PruneRoleBindings(ctx context.Context, kubeClient kubernetes.Interface, recorder events.Recorder, namespace string,
+	addon *addonapiv1alpha1.ManagedClusterAddOn, desired []*rbacv1.RoleBinding, names sets.Set[string]) error {
+	desiredBindings := map[string]*rbacv1.RoleBinding{}
+	for _, binding := range desired {
+		desiredBindings[binding.Name] = binding
+	}
+
+	existingBindings, err := kubeClient.RbacV1().RoleBindings(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for i := range existingBindings.Items {
+		existing := &existingBindings.Items[i]
+		if !isOwnedByAddon(existing.ObjectMeta, addon) {
+			continue
+		}
+		if existing.Labels[addonapiv1alpha1.AddonLabelKey] != addon.Name && !names.Has(existing.Name) {
+			continue
+		}
+
+		binding, ok := desiredBindings[existing.Name]
+		if ok {
+			if removed := subtractSubjects(existing.Subjects, binding.Subjects); len(removed) > 0 {
+				recordEventf(ctx, recorder, "RoleBindingSubjectsPruned", "Subjects %s of role binding %s/%s are removed for addon %s",
+					formatSubjects(removed), existing.Namespace, existing.Name, addon.Name)
+			}
+			continue
+		}
+
+		err := kubeClient.RbacV1().RoleBindings(existing.Namespace).Delete(ctx, existing.Name, metav1.DeleteOptions{})
+		switch {
+		case apierrors.IsNotFound(err):
+		case err != nil:
+			errs = append(errs, err)
+		default:
+			recordEventf(ctx, recorder, "RoleBindingPruned", "Role binding %s/%s with subjects %s is deleted for addon %s",
+				existing.Namespace, existing.Name, formatSubjects(existing.Subjects), addon.Name)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+func recordEventf(ctx context.Context, recorder events.Recorder, reason, messageFmt string, args ...interface{}) {
+	if recorder == nil {
+		klog.Infof(messageFmt, args...)
+		return
+	}
+	recorder.Eventf(ctx, reason, messageFmt, args...)
 }
 
 type unionPermissionBuilder struct {
@@ -312,6 +469,45 @@ func BuildSubjectsFromRegistration(addon *addonapiv1alpha1.ManagedClusterAddOn,
 	return subjects
 }
 
+func isOwnedByAddon(metadata metav1.ObjectMeta, addon *addonapiv1alpha1.ManagedClusterAddOn) bool {
+	for _, owner := range metadata.OwnerReferences {
+		if owner.Kind == "ManagedClusterAddOn" && owner.Name == addon.Name && owner.UID == addon.UID {
+			return true
+		}
+	}
+	return false
+}
+
+// subtractSubjects returns the subjects which are not in the required subjects, the apiGroup of the subjects is ignored.
+func subtractSubjects(subjects, required []rbacv1.Subject) []rbacv1.Subject {
+	var removed []rbacv1.Subject
+	for _, subject := range subjects {
+		found := false
+		for _, r := range required {
+			if subject.Kind == r.Kind && subject.Name == r.Name && subject.Namespace == r.Namespace {
+				found = true
+				break
+			}
+		}
+		if !found {
+			removed = append(removed, subject)
+		}
+	}
+	return removed
+}
+
+func formatSubjects(subjects []rbacv1.Subject) string {
+	names := make([]string, 0, len(subjects))
+	for _, subject := range subjects {
+		name := subject.Name
+		if subject.Namespace != "" {
+			name = subject.Namespace + "/" + subject.Name
+		}
+		names = append(names, fmt.Sprintf("%s %s", subject.Kind, name))
+	}
+	return "[" + strings.Join(names, ", ") + "]"
+}
+
 func ensureAddonOwnerReference(metadata *metav1.ObjectMeta, addon *addonapiv1alpha1.ManagedClusterAddOn) {
 	metadata.OwnerReferences = []metav1.OwnerReference{
 		{
@@ -460,10 +656,11 @@ func ApplyRoleBinding(ctx context.Context, client rbacclientv1.RoleBindingsGette
 		}
 	}
 
+	labelsChanged := mergeLabels(&existingCopy.ObjectMeta, requiredCopy.Labels)
 	subjectsAreSame := equality.Semantic.DeepEqual(existingCopy.Subjects, requiredCopy.Subjects)
 	roleRefIsSame := equality.Semantic.DeepEqual(existingCopy.RoleRef, requiredCopy.RoleRef)
 
-	if subjectsAreSame && roleRefIsSame {
+	if subjectsAreSame && roleRefIsSame && !labelsChanged {
 		return existingCopy, false, nil
 	}
 
@@ -473,3 +670,19 @@ func ApplyRoleBinding(ctx context.Context, client rbacclientv1.RoleBindingsGette
 	actual, err := client.RoleBindings(requiredCopy.Namespace).Update(ctx, existingCopy, metav1.UpdateOptions{})
 	return actual, true, err
 }
+
+// mergeLabels sets the required labels into the metadata, and returns true if any label is changed.
+func mergeLabels(metadata *metav1.ObjectMeta, required map[string]string) bool {
+	changed := false
+	for key, value := range required {
+		if existing, ok := metadata.Labels[key]; ok && existing == value {
+			continue
+		}
+		if metadata.Labels == nil {
+			metadata.Labels = map[string]string{}
+		}
+		metadata.Labels[key] = value
+		changed = true
+	}
+	return changed
+}
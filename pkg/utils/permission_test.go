@@ -8,8 +8,11 @@ import (
 	"github.com/stretchr/testify/assert"
 	certificatesv1 "k8s.io/api/certificates/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/fake"
+	"open-cluster-management.io/addon-framework/pkg/addonmanager/addontesting"
 	"open-cluster-management.io/addon-framework/pkg/agent"
 	"open-cluster-management.io/api/addon/v1alpha1"
 	v1 "open-cluster-management.io/api/cluster/v1"
@@ -334,3 +337,186 @@ func TestBuildSubjectsFromRegistration_FilterSystemAuthenticated(t *testing.T) {
 		})
 	}
 }
+
+func TestPermissionBuilder_Pruning(t *testing.T) {
+	testCluster := &v1.ManagedCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cluster"},
+	}
+	testAddon := &v1alpha1.ManagedClusterAddOn{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-addon", Namespace: testCluster.Name, UID: "addon-uid"},
+		Status: v1alpha1.ManagedClusterAddOnStatus{
+			Registrations: []v1alpha1.RegistrationConfig{
+				{
+					SignerName: certificatesv1.KubeAPIServerClientSignerName,
+					Subject: v1alpha1.Subject{
+						User:   "system:serviceaccount:test:test-sa",
+						Groups: []string{"system:open-cluster-management:addon:test-addon"},
+					},
+				},
+			},
+		},
+	}
+	newRoleBinding := func(name string, uid types.UID, labeled bool, subjects ...rbacv1.Subject) *rbacv1.RoleBinding {
+		binding := &rbacv1.RoleBinding{
+			ObjectMeta: metav1.ObjectMeta{Namespace: testCluster.Name, Name: name},
+			RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "Role", Name: name},
+			Subjects:   subjects,
+		}
+		ensureAddonOwnerReference(&binding.ObjectMeta, testAddon)
+		binding.OwnerReferences[0].UID = uid
+		if labeled {
+			binding.Labels = map[string]string{v1alpha1.AddonLabelKey: testAddon.Name}
+		}
+		return binding
+	}
+	staleUser := rbacv1.Subject{Kind: rbacv1.UserKind, APIGroup: rbacv1.GroupName, Name: "stale-agent"}
+
+	fakeKubeClient := fake.NewSimpleClientset(
+		// the subject of the previous agent is bound
+		newRoleBinding("kube-client", testAddon.UID, false, staleUser),
+		// no longer built
+		newRoleBinding("stale", testAddon.UID, true, staleUser),
+		// owned by the previous addon with the same name
+		newRoleBinding("previous", "previous-uid", true, staleUser),
+		// not labeled by the builder
+		newRoleBinding("unlabeled", testAddon.UID, false, staleUser),
+	)
+	permissionConfigFn := NewRBACPermissionConfigBuilder(fakeKubeClient).
+		BindKubeClientRole(&rbacv1.Role{ObjectMeta: metav1.ObjectMeta{Name: "kube-client"}}).
+		BindRoleToUser(&rbacv1.Role{ObjectMeta: metav1.ObjectMeta{Name: "static"}}, "test-user").
+		WithPruning(addontesting.NewTestingEventRecorder(t)).
+		Build()
+
+	// the stale binding is pruned, the subjects of the kube client binding are replaced and it is labeled
+	assert.NoError(t, permissionConfigFn(testCluster, testAddon))
+	bindings, err := fakeKubeClient.RbacV1().RoleBindings(testCluster.Name).List(context.TODO(), metav1.ListOptions{})
+	assert.NoError(t, err)
+	actual := map[string]rbacv1.RoleBinding{}
+	for _, binding := range bindings.Items {
+		actual[binding.Name] = binding
+	}
+	assert.ElementsMatch(t, []string{"kube-client", "static", "previous", "unlabeled"}, roleBindingNames(actual))
+	assert.Equal(t, BuildSubjectsFromRegistration(testAddon, certificatesv1.KubeAPIServerClientSignerName),
+		actual["kube-client"].Subjects)
+	assert.Equal(t, testAddon.Name, actual["kube-client"].Labels[v1alpha1.AddonLabelKey])
+	assert.Equal(t, testAddon.Name, actual["static"].Labels[v1alpha1.AddonLabelKey])
+
+	// the kube client binding is pruned once the registration subject is removed
+	addon := testAddon.DeepCopy()
+	addon.Status.Registrations = nil
+	var subjectNotReadyErr *agent.SubjectNotReadyError
+	assert.True(t, errors.As(permissionConfigFn(testCluster, addon), &subjectNotReadyErr))
+	_, err = fakeKubeClient.RbacV1().RoleBindings(testCluster.Name).Get(context.TODO(), "kube-client", metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err))
+	_, err = fakeKubeClient.RbacV1().RoleBindings(testCluster.Name).Get(context.TODO(), "static", metav1.GetOptions{})
+	assert.NoError(t, err)
+}
+
+func TestPermissionBuilder_StaticRoleBindingNotMutated(t *testing.T) {
+	binding := &rbacv1.RoleBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: "static"},
+		RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "Role", Name: "static"},
+		Subjects:   []rbacv1.Subject{{Kind: rbacv1.UserKind, APIGroup: rbacv1.GroupName, Name: "test-user"}},
+	}
+	role := &rbacv1.Role{ObjectMeta: metav1.ObjectMeta{Name: "static"}}
+	fakeKubeClient := fake.NewSimpleClientset()
+	permissionConfigFn := NewRBACPermissionConfigBuilder(fakeKubeClient).
+		WithStaticRole(role).
+		WithStaticRoleBinding(binding).
+		WithPruning(addontesting.NewTestingEventRecorder(t)).
+		Build()
+
+	for _, clusterName := range []string{"cluster1", "cluster2"} {
+		addon := &v1alpha1.ManagedClusterAddOn{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-addon", Namespace: clusterName, UID: types.UID(clusterName)},
+		}
+		assert.NoError(t, permissionConfigFn(&v1.ManagedCluster{ObjectMeta: metav1.ObjectMeta{Name: clusterName}}, addon))
+
+		actual, err := fakeKubeClient.RbacV1().RoleBindings(clusterName).Get(context.TODO(), "static", metav1.GetOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, addon.UID, actual.OwnerReferences[0].UID)
+		assert.Equal(t, addon.Name, actual.Labels[v1alpha1.AddonLabelKey])
+	}
+
+	assert.Empty(t, binding.Namespace)
+	assert.Empty(t, binding.OwnerReferences)
+	assert.Empty(t, binding.Labels)
+	assert.Empty(t, role.Namespace)
+	assert.Empty(t, role.OwnerReferences)
+}
+
+func TestPermissionBuilder_PruningUnlabeledRoleBinding(t *testing.T) {
+	testCluster := &v1.ManagedCluster{ObjectMeta: metav1.ObjectMeta{Name: "test-cluster"}}
+	// the registration subject is removed, e.g. the agent switches to the csr registration
+	testAddon := &v1alpha1.ManagedClusterAddOn{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-addon", Namespace: testCluster.Name, UID: "addon-uid"},
+	}
+	newRoleBinding := func(name string) *rbacv1.RoleBinding {
+		binding := &rbacv1.RoleBinding{
+			ObjectMeta: metav1.ObjectMeta{Namespace: testCluster.Name, Name: name},
+			RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "Role", Name: name},
+			Subjects:   []rbacv1.Subject{{Kind: rbacv1.UserKind, APIGroup: rbacv1.GroupName, Name: "stale-agent"}},
+		}
+		ensureAddonOwnerReference(&binding.ObjectMeta, testAddon)
+		return binding
+	}
+
+	// the kube client role binding is applied before the pruning is enabled, so it is not labeled
+	fakeKubeClient := fake.NewSimpleClientset(newRoleBinding("kube-client"), newRoleBinding("other"))
+	permissionConfigFn := NewRBACPermissionConfigBuilder(fakeKubeClient).
+		BindKubeClientRole(&rbacv1.Role{ObjectMeta: metav1.ObjectMeta{Name: "kube-client"}}).
+		WithPruning(addontesting.NewTestingEventRecorder(t)).
+		Build()
+
+	var subjectNotReadyErr *agent.SubjectNotReadyError
+	assert.True(t, errors.As(permissionConfigFn(testCluster, testAddon), &subjectNotReadyErr))
+	_, err := fakeKubeClient.RbacV1().RoleBindings(testCluster.Name).Get(context.TODO(), "kube-client", metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err))
+	// the unlabeled role bindings not built by the builder are kept
+	_, err = fakeKubeClient.RbacV1().RoleBindings(testCluster.Name).Get(context.TODO(), "other", metav1.GetOptions{})
+	assert.NoError(t, err)
+}
+
+func TestPermissionBuilder_PruningKubeClientClusterRole(t *testing.T) {
+	fakeKubeClient := fake.NewSimpleClientset()
+	builder := NewRBACPermissionConfigBuilder(fakeKubeClient).
+		BindKubeClientClusterRole(&rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "kube-client"}}).
+		WithPruning(addontesting.NewTestingEventRecorder(t))
+	assert.Error(t, builder.Validate())
+
+	// the pruning is disabled, the cluster role binding is still applied
+	addon := &v1alpha1.ManagedClusterAddOn{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-addon", Namespace: "test-cluster"},
+		Status: v1alpha1.ManagedClusterAddOnStatus{
+			Registrations: []v1alpha1.RegistrationConfig{{
+				SignerName: certificatesv1.KubeAPIServerClientSignerName,
+				Subject:    v1alpha1.Subject{User: "system:serviceaccount:test:test-sa"},
+			}},
+		},
+	}
+	assert.NoError(t, builder.Build()(&v1.ManagedCluster{ObjectMeta: metav1.ObjectMeta{Name: "test-cluster"}}, addon))
+	_, err := fakeKubeClient.RbacV1().ClusterRoleBindings().Get(context.TODO(), "kube-client", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.NoError(t, NewRBACPermissionConfigBuilder(fakeKubeClient).
+		BindKubeClientRole(&rbacv1.Role{ObjectMeta: metav1.ObjectMeta{Name: "kube-client"}}).
+		WithPruning(addontesting.NewTestingEventRecorder(t)).
+		Validate())
+}
+
+func roleBindingNames(bindings map[string]rbacv1.RoleBinding) []string {
+	names := []string{}
+	for name := range bindings {
+		names = append(names, name)
+	}
+	return names
+}
+
+func TestSubtractSubjects(t *testing.T) {
+	user := rbacv1.Subject{Kind: rbacv1.UserKind, APIGroup: rbacv1.GroupName, Name: "agent"}
+	group := rbacv1.Subject{Kind: rbacv1.GroupKind, APIGroup: rbacv1.GroupName, Name: "agents"}
+	userWithoutAPIGroup := rbacv1.Subject{Kind: rbacv1.UserKind, Name: "agent"}
+
+	assert.Empty(t, subtractSubjects([]rbacv1.Subject{userWithoutAPIGroup, group}, []rbacv1.Subject{user, group}))
+	assert.Equal(t, []rbacv1.Subject{group}, subtractSubjects([]rbacv1.Subject{user, group}, []rbacv1.Subject{user}))
+	assert.Equal(t, "[User agent, Group agents]", formatSubjects([]rbacv1.Subject{user, group}))
+}
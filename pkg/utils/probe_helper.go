@@ -2,12 +2,17 @@ package utils
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"open-cluster-management.io/addon-framework/pkg/agent"
 	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
 	clusterv1 "open-cluster-management.io/api/cluster/v1"
@@ -120,25 +125,97 @@ func WorkloadAvailabilityHealthChecker(results []agent.FieldResult,
 	return nil
 }
 
+// WorkloadAvailabilityHealthResultChecker is the HealthResultChecker variant of WorkloadAvailabilityHealthChecker,
+// the addon is available if all the workloads are available, and degraded if some of the deployments do not have
+// all the replicas ready.
+func WorkloadAvailabilityHealthResultChecker(results []agent.FieldResult,
+	cluster *clusterv1.ManagedCluster, addon *addonapiv1alpha1.ManagedClusterAddOn) agent.HealthCheckResult {
+	return NewWorkloadAvailabilityHealthResultChecker()(results, cluster, addon)
+}
+
+// NewWorkloadAvailabilityHealthResultChecker is the HealthResultChecker variant of
+// NewWorkloadAvailabilityHealthChecker, it is used by the HealthProberTypeWorkloadAvailability prober.
+func NewWorkloadAvailabilityHealthResultChecker(probes ...agent.WorkloadResourceProbe) agent.AddonHealthResultCheckerFunc {
+	healthChecker := NewWorkloadAvailabilityHealthChecker(probes...)
+	return func(results []agent.FieldResult,
+		cluster *clusterv1.ManagedCluster, addon *addonapiv1alpha1.ManagedClusterAddOn) agent.HealthCheckResult {
+		if err := healthChecker(results, cluster, addon); err != nil {
+			return agent.HealthCheckResult{Available: metav1.ConditionFalse, Message: err.Error()}
+		}
+
+		var degradedMessages []string
+		for _, result := range results {
+			if message := workloadDegradedMessage(result.ResourceIdentifier, result.FeedbackResult); len(message) > 0 {
+				degradedMessages = append(degradedMessages, message)
+			}
+		}
+		return agent.HealthCheckResult{
+			Available: metav1.ConditionTrue,
+			Degraded:  len(degradedMessages) > 0,
+			Message:   strings.Join(degradedMessages, "; "),
+		}
+	}
+}
+
+// workloadDegradedMessage returns a message if not all the replicas of the available deployment are ready.
+func workloadDegradedMessage(identifier workapiv1.ResourceIdentifier, result workapiv1.StatusFeedbackResult) string {
+	if identifier.Resource != "deployments" {
+		return ""
+	}
+
+	var readyReplicas, replicas int64
+	for _, value := range result.Values {
+		if value.Value.Integer == nil {
+			continue
+		}
+		switch value.Name {
+		case "ReadyReplicas":
+			readyReplicas = *value.Value.Integer
+		case "Replicas":
+			replicas = *value.Value.Integer
+		}
+	}
+	if readyReplicas >= replicas {
+		return ""
+	}
+	return fmt.Sprintf("%d of %d replicas are ready for %s %s/%s",
+		readyReplicas, replicas, identifier.Resource, identifier.Namespace, identifier.Name)
+}
+
 func checkWorkloadAvailabilityHealth(identifier workapiv1.ResourceIdentifier,
 	result workapiv1.StatusFeedbackResult) error {
-	// only support deployments and daemonsets for now
-	if identifier.Resource != "deployments" && identifier.Resource != "daemonsets" {
+	// only support deployments, daemonsets, statefulsets and jobs for now
+	switch identifier.Resource {
+	case "deployments", "daemonsets", "statefulsets":
+		if identifier.Group != appsv1.GroupName {
+			return fmt.Errorf("unsupported resource group %s", identifier.Group)
+		}
+	case "jobs":
+		if identifier.Group != batchv1.GroupName {
+			return fmt.Errorf("unsupported resource group %s", identifier.Group)
+		}
+	default:
 		return fmt.Errorf("unsupported resource type %s", identifier.Resource)
 	}
-	if identifier.Group != appsv1.GroupName {
-		return fmt.Errorf("unsupported resource group %s", identifier.Group)
-	}
 
 	if len(result.Values) == 0 {
 		return fmt.Errorf("no values are probed for %s %s/%s",
 			identifier.Resource, identifier.Namespace, identifier.Name)
 	}
 
+	if identifier.Resource == "jobs" {
+		return checkJobCompleted(identifier, result)
+	}
+
 	readyReplicas := -1
 	desiredNumberReplicas := -1
+	updatedReplicas := -1
 	for _, value := range result.Values {
-		// for deployment
+		if value.Value.Integer == nil {
+			continue
+		}
+
+		// for deployment and statefulset
 		if value.Name == "ReadyReplicas" {
 			readyReplicas = int(*value.Value.Integer)
 		}
@@ -146,6 +223,11 @@ func checkWorkloadAvailabilityHealth(identifier workapiv1.ResourceIdentifier,
 			desiredNumberReplicas = int(*value.Value.Integer)
 		}
 
+		// for statefulset
+		if value.Name == "UpdatedReplicas" {
+			updatedReplicas = int(*value.Value.Integer)
+		}
+
 		// for daemonset
 		if value.Name == "NumberReady" {
 			readyReplicas = int(*value.Value.Integer)
@@ -171,12 +253,148 @@ func checkWorkloadAvailabilityHealth(identifier workapiv1.ResourceIdentifier,
 		if readyReplicas == desiredNumberReplicas && readyReplicas > -1 {
 			return nil
 		}
+	case "statefulsets":
+		if updatedReplicas == -1 {
+			return fmt.Errorf("updatedReplicas is not probed")
+		}
+		if readyReplicas == desiredNumberReplicas && updatedReplicas == desiredNumberReplicas {
+			return nil
+		}
+		return fmt.Errorf("desiredNumberReplicas is %d but readyReplica is %d and updatedReplicas is %d for %s %s/%s",
+			desiredNumberReplicas, readyReplicas, updatedReplicas, identifier.Resource, identifier.Namespace,
+			identifier.Name)
 	}
 
 	return fmt.Errorf("desiredNumberReplicas is %d but readyReplica is %d for %s %s/%s",
 		desiredNumberReplicas, readyReplicas, identifier.Resource, identifier.Namespace, identifier.Name)
 }
 
+// checkJobCompleted checks the JobComplete value of the well known status of the job is True.
+func checkJobCompleted(identifier workapiv1.ResourceIdentifier, result workapiv1.StatusFeedbackResult) error {
+	for _, value := range result.Values {
+		if value.Name != "JobComplete" || value.Value.String == nil {
+			continue
+		}
+		if *value.Value.String == string(metav1.ConditionTrue) {
+			return nil
+		}
+		return fmt.Errorf("job %s/%s is not completed", identifier.Namespace, identifier.Name)
+	}
+	return fmt.Errorf("jobComplete is not probed for job %s/%s", identifier.Namespace, identifier.Name)
+}
+
+// NewWorkloadAvailabilityHealthChecker returns a health checker which checks the results of the resources matching
+// the resource probes with their condition types and json paths, and the results of the other resources the same
+// as WorkloadAvailabilityHealthChecker.
+func NewWorkloadAvailabilityHealthChecker(probes ...agent.WorkloadResourceProbe) agent.AddonHealthCheckerFunc {
+	return func(results []agent.FieldResult,
+		cluster *clusterv1.ManagedCluster, addon *addonapiv1alpha1.ManagedClusterAddOn) error {
+		for _, result := range results {
+			probe := findWorkloadResourceProbe(probes, result.ResourceIdentifier)
+			if probe == nil {
+				if err := checkWorkloadAvailabilityHealth(result.ResourceIdentifier, result.FeedbackResult); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if err := checkWorkloadResourceProbe(*probe, result.ResourceIdentifier, result.FeedbackResult); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// WorkloadResourceProbeManifestConfig returns the manifest config with the json paths feedback rule of the resource
+// probe, the condition is probed with the name ConditionFeedbackName(probe.ConditionType).
+func WorkloadResourceProbeManifestConfig(probe agent.WorkloadResourceProbe) workapiv1.ManifestConfigOption {
+	var jsonPaths []workapiv1.JsonPath
+	if len(probe.ConditionType) > 0 {
+		jsonPaths = append(jsonPaths, workapiv1.JsonPath{
+			Name: ConditionFeedbackName(probe.ConditionType),
+			Path: fmt.Sprintf(`.conditions[?(@.type=="%s")].status`, probe.ConditionType),
+		})
+	}
+	for _, jsonPath := range probe.JsonPaths {
+		jsonPaths = append(jsonPaths, jsonPath.JsonPath)
+	}
+
+	return workapiv1.ManifestConfigOption{
+		ResourceIdentifier: probe.ResourceIdentifier,
+		FeedbackRules: []workapiv1.FeedbackRule{
+			{
+				Type:      workapiv1.JSONPathsType,
+				JsonPaths: jsonPaths,
+			},
+		},
+	}
+}
+
+// ConditionFeedbackName returns the name of the feedback value of the condition status.
+func ConditionFeedbackName(conditionType string) string {
+	return fmt.Sprintf("Condition%s", conditionType)
+}
+
+func findWorkloadResourceProbe(probes []agent.WorkloadResourceProbe,
+	identifier workapiv1.ResourceIdentifier) *agent.WorkloadResourceProbe {
+	for i, probe := range probes {
+		if probe.ResourceIdentifier.Group != identifier.Group ||
+			probe.ResourceIdentifier.Resource != identifier.Resource {
+			continue
+		}
+		if !WildcardMatch(identifier.Name, probe.ResourceIdentifier.Name) ||
+			!WildcardMatch(identifier.Namespace, probe.ResourceIdentifier.Namespace) {
+			continue
+		}
+		return &probes[i]
+	}
+	return nil
+}
+
+func checkWorkloadResourceProbe(probe agent.WorkloadResourceProbe, identifier workapiv1.ResourceIdentifier,
+	result workapiv1.StatusFeedbackResult) error {
+	expected := map[string]string{}
+	if len(probe.ConditionType) > 0 {
+		expected[ConditionFeedbackName(probe.ConditionType)] = string(metav1.ConditionTrue)
+	}
+	for _, jsonPath := range probe.JsonPaths {
+		expected[jsonPath.Name] = jsonPath.Value
+	}
+
+	actual := map[string]string{}
+	for _, value := range result.Values {
+		actual[value.Name] = feedbackValueString(value.Value)
+	}
+
+	for _, name := range sets.List(sets.KeySet(expected)) {
+		value, ok := actual[name]
+		if !ok {
+			return fmt.Errorf("%s is not probed for %s %s/%s",
+				name, identifier.Resource, identifier.Namespace, identifier.Name)
+		}
+		if value != expected[name] {
+			return fmt.Errorf("%s is %s but expected %s for %s %s/%s",
+				name, value, expected[name], identifier.Resource, identifier.Namespace, identifier.Name)
+		}
+	}
+	return nil
+}
+
+func feedbackValueString(value workapiv1.FieldValue) string {
+	switch {
+	case value.Integer != nil:
+		return strconv.FormatInt(*value.Integer, 10)
+	case value.String != nil:
+		return *value.String
+	case value.Boolean != nil:
+		return strconv.FormatBool(*value.Boolean)
+	case value.JsonRaw != nil:
+		return *value.JsonRaw
+	}
+	return ""
+}
+
 func FilterDeployments(objects []runtime.Object) []*appsv1.Deployment {
 	deployments := []*appsv1.Deployment{}
 	for _, obj := range objects {
@@ -192,14 +410,30 @@ func FilterDeployments(objects []runtime.Object) []*appsv1.Deployment {
 type WorkloadMetadata struct {
 	schema.GroupResource
 	types.NamespacedName
-	DeploymentSpec *DeploymentSpec
+	DeploymentSpec  *DeploymentSpec
+	StatefulSetSpec *StatefulSetSpec
 }
 
 type DeploymentSpec struct {
 	Replicas int32
 }
 
+type StatefulSetSpec struct {
+	Replicas int32
+}
+
+// FilterWorkloads returns the deployments, daemonsets and statefulsets in the objects.
 func FilterWorkloads(objects []runtime.Object) []WorkloadMetadata {
+	return filterWorkloads(objects, false)
+}
+
+// FilterWorkloadsWithJobs returns the jobs besides the pre-delete hook jobs in the objects, in addition to the
+// workloads returned by FilterWorkloads.
+func FilterWorkloadsWithJobs(objects []runtime.Object) []WorkloadMetadata {
+	return filterWorkloads(objects, true)
+}
+
+func filterWorkloads(objects []runtime.Object, includeJobs bool) []WorkloadMetadata {
 	workloads := []WorkloadMetadata{}
 	for _, obj := range objects {
 		deployment, err := ConvertToDeployment(obj)
@@ -237,6 +471,44 @@ func FilterWorkloads(objects []runtime.Object) []WorkloadMetadata {
 				},
 			})
 		}
+		statefulset, err := ConvertToStatefulSet(obj)
+		if err == nil {
+			// statefulset replicas defaults to 1
+			var statefulsetReplicas int32 = 1
+			if statefulset.Spec.Replicas != nil {
+				statefulsetReplicas = *statefulset.Spec.Replicas
+			}
+			workloads = append(workloads, WorkloadMetadata{
+				GroupResource: schema.GroupResource{
+					Group:    appsv1.GroupName,
+					Resource: "statefulsets",
+				},
+				NamespacedName: types.NamespacedName{
+					Namespace: statefulset.Namespace,
+					Name:      statefulset.Name,
+				},
+				StatefulSetSpec: &StatefulSetSpec{
+					Replicas: statefulsetReplicas,
+				},
+			})
+		}
+		if !includeJobs {
+			continue
+		}
+		job, err := ConvertToJob(obj)
+		// the pre-delete hook jobs are not deployed with the agent
+		if err == nil && !isPreDeleteHook(job.ObjectMeta) {
+			workloads = append(workloads, WorkloadMetadata{
+				GroupResource: schema.GroupResource{
+					Group:    batchv1.GroupName,
+					Resource: "jobs",
+				},
+				NamespacedName: types.NamespacedName{
+					Namespace: job.Namespace,
+					Name:      job.Name,
+				},
+			})
+		}
 	}
 	return workloads
 }
@@ -312,3 +584,55 @@ func ConvertTo[T any](obj runtime.Object, group, kind string) (*T, error) {
 	}
 	return target, nil
 }
+
+func ConvertToStatefulSet(obj runtime.Object) (*appsv1.StatefulSet, error) {
+	if statefulSet, ok := obj.(*appsv1.StatefulSet); ok {
+		return statefulSet, nil
+	}
+
+	return ConvertTo[appsv1.StatefulSet](obj, appsv1.GroupName, "StatefulSet")
+}
+
+// StatefulSetManifestConfig returns the manifest config probing the replicas of the statefulset with json paths.
+func StatefulSetManifestConfig(namespace, name string) workapiv1.ManifestConfigOption {
+	return workapiv1.ManifestConfigOption{
+		ResourceIdentifier: workapiv1.ResourceIdentifier{
+			Group:     appsv1.GroupName,
+			Resource:  "statefulsets",
+			Name:      name,
+			Namespace: namespace,
+		},
+		FeedbackRules: []workapiv1.FeedbackRule{
+			{
+				Type: workapiv1.JSONPathsType,
+				JsonPaths: []workapiv1.JsonPath{
+					{Name: "ReadyReplicas", Path: ".readyReplicas"},
+					{Name: "UpdatedReplicas", Path: ".updatedReplicas"},
+					{Name: "Replicas", Path: ".replicas"},
+				},
+			},
+		},
+	}
+}
+
+func ConvertToJob(obj runtime.Object) (*batchv1.Job, error) {
+	if job, ok := obj.(*batchv1.Job); ok {
+		return job, nil
+	}
+
+	return ConvertTo[batchv1.Job](obj, batchv1.GroupName, "Job")
+}
+
+// WorkloadManifestConfig returns the manifest config probing the status of the workload.
+func WorkloadManifestConfig(workload WorkloadMetadata) workapiv1.ManifestConfigOption {
+	if workload.Group == appsv1.GroupName && workload.Resource == "statefulsets" {
+		return StatefulSetManifestConfig(workload.Namespace, workload.Name)
+	}
+	return WellKnowManifestConfig(workload.Group, workload.Resource, workload.Namespace, workload.Name)
+}
+
+func isPreDeleteHook(objectMeta metav1.ObjectMeta) bool {
+	_, hasPreDeleteLabel := objectMeta.Labels[addonapiv1alpha1.AddonPreDeleteHookLabelKey]
+	_, hasPreDeleteAnnotation := objectMeta.Annotations[addonapiv1alpha1.AddonPreDeleteHookAnnotationKey]
+	return hasPreDeleteLabel || hasPreDeleteAnnotation
+}
@@ -4,11 +4,13 @@ import (
 	"testing"
 
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"open-cluster-management.io/addon-framework/pkg/agent"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
 	workapiv1 "open-cluster-management.io/api/work/v1"
 )
 
@@ -226,3 +228,167 @@ func TestFilterDeployment(t *testing.T) {
 		})
 	}
 }
+
+func TestWorkloadAvailabilityHealthChecker(t *testing.T) {
+	statefulset := workapiv1.ResourceIdentifier{Group: "apps", Resource: "statefulsets", Name: "test", Namespace: "testns"}
+	job := workapiv1.ResourceIdentifier{Group: "batch", Resource: "jobs", Name: "test", Namespace: "testns"}
+	gateway := workapiv1.ResourceIdentifier{Group: "example.io", Resource: "gateways", Name: "test", Namespace: "testns"}
+
+	integerValue := func(name string, value int64) workapiv1.FeedbackValue {
+		return workapiv1.FeedbackValue{Name: name, Value: workapiv1.FieldValue{
+			Type: workapiv1.Integer, Integer: &value}}
+	}
+	stringValue := func(name, value string) workapiv1.FeedbackValue {
+		return workapiv1.FeedbackValue{Name: name, Value: workapiv1.FieldValue{
+			Type: workapiv1.String, String: &value}}
+	}
+
+	routeProbe := agent.WorkloadResourceProbe{
+		ResourceIdentifier: workapiv1.ResourceIdentifier{
+			Group: "example.io", Resource: "routes", Name: "agent-*", Namespace: "testns"},
+		ConditionType: "Admitted",
+	}
+	probe := agent.WorkloadResourceProbe{
+		ResourceIdentifier: workapiv1.ResourceIdentifier{
+			Group: "example.io", Resource: "gateways", Name: "*", Namespace: "*"},
+		ConditionType: "Ready",
+		JsonPaths: []agent.ExpectedJsonPath{
+			{JsonPath: workapiv1.JsonPath{Name: "replicas", Path: ".replicas"}, Value: "2"},
+		},
+	}
+
+	cases := []struct {
+		name        string
+		identifier  workapiv1.ResourceIdentifier
+		values      []workapiv1.FeedbackValue
+		expectedErr string
+	}{
+		{
+			name:       "statefulset available",
+			identifier: statefulset,
+			values: []workapiv1.FeedbackValue{
+				integerValue("ReadyReplicas", 2), integerValue("UpdatedReplicas", 2), integerValue("Replicas", 2)},
+		},
+		{
+			name:       "statefulset not updated",
+			identifier: statefulset,
+			values: []workapiv1.FeedbackValue{
+				integerValue("ReadyReplicas", 2), integerValue("UpdatedReplicas", 1), integerValue("Replicas", 2)},
+			expectedErr: "desiredNumberReplicas is 2 but readyReplica is 2 and updatedReplicas is 1 for statefulsets testns/test",
+		},
+		{
+			name:        "statefulset updated replicas not probed",
+			identifier:  statefulset,
+			values:      []workapiv1.FeedbackValue{integerValue("ReadyReplicas", 2), integerValue("Replicas", 2)},
+			expectedErr: "updatedReplicas is not probed",
+		},
+		{
+			name:       "job completed",
+			identifier: job,
+			values:     []workapiv1.FeedbackValue{stringValue("JobComplete", "True")},
+		},
+		{
+			name:        "job not completed",
+			identifier:  job,
+			values:      []workapiv1.FeedbackValue{stringValue("JobComplete", "False")},
+			expectedErr: "job testns/test is not completed",
+		},
+		{
+			name:        "job complete not probed",
+			identifier:  job,
+			values:      []workapiv1.FeedbackValue{integerValue("JobSucceeded", 1)},
+			expectedErr: "jobComplete is not probed for job testns/test",
+		},
+		{
+			name:       "custom resource available",
+			identifier: gateway,
+			values:     []workapiv1.FeedbackValue{stringValue("ConditionReady", "True"), integerValue("replicas", 2)},
+		},
+		{
+			name:        "custom resource condition false",
+			identifier:  gateway,
+			values:      []workapiv1.FeedbackValue{stringValue("ConditionReady", "False"), integerValue("replicas", 2)},
+			expectedErr: "ConditionReady is False but expected True for gateways testns/test",
+		},
+		{
+			name:        "custom resource field not probed",
+			identifier:  gateway,
+			values:      []workapiv1.FeedbackValue{stringValue("ConditionReady", "True")},
+			expectedErr: "replicas is not probed for gateways testns/test",
+		},
+		{
+			name: "custom resource without probe",
+			identifier: workapiv1.ResourceIdentifier{
+				Group: "example.io", Resource: "routes", Name: "test", Namespace: "testns"},
+			values:      []workapiv1.FeedbackValue{stringValue("ConditionReady", "True")},
+			expectedErr: "unsupported resource type routes",
+		},
+		{
+			name: "custom resource matching the name pattern",
+			identifier: workapiv1.ResourceIdentifier{
+				Group: "example.io", Resource: "routes", Name: "agent-hub", Namespace: "testns"},
+			values: []workapiv1.FeedbackValue{stringValue("ConditionAdmitted", "True")},
+		},
+		{
+			name: "custom resource matching the name pattern not admitted",
+			identifier: workapiv1.ResourceIdentifier{
+				Group: "example.io", Resource: "routes", Name: "agent-hub", Namespace: "testns"},
+			values:      []workapiv1.FeedbackValue{stringValue("ConditionAdmitted", "False")},
+			expectedErr: "ConditionAdmitted is False but expected True for routes testns/agent-hub",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := NewWorkloadAvailabilityHealthChecker(probe, routeProbe)([]agent.FieldResult{
+				{
+					ResourceIdentifier: c.identifier,
+					FeedbackResult:     workapiv1.StatusFeedbackResult{Values: c.values},
+				},
+			}, nil, nil)
+			if err != nil && err.Error() != c.expectedErr {
+				t.Errorf("expected error %s but got %v", c.expectedErr, err)
+			}
+
+			if err == nil && len(c.expectedErr) != 0 {
+				t.Errorf("expected error %s but got no error", c.expectedErr)
+			}
+		})
+	}
+}
+
+func TestFilterWorkloads(t *testing.T) {
+	var zero int32 = 0
+	hookJob := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "hook",
+			Namespace:   "default",
+			Annotations: map[string]string{addonapiv1alpha1.AddonPreDeleteHookAnnotationKey: ""},
+		},
+	}
+	objects := []runtime.Object{
+		&appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "statefulset", Namespace: "default"},
+			Spec:       appsv1.StatefulSetSpec{Replicas: &zero},
+		},
+		&batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "job", Namespace: "default"}},
+		hookJob,
+	}
+
+	// the jobs are not included by default
+	if workloads := FilterWorkloads(objects); len(workloads) != 1 || workloads[0].Resource != "statefulsets" {
+		t.Errorf("expected only the statefulset but got %v", workloads)
+	}
+
+	workloads := FilterWorkloadsWithJobs(objects)
+	if len(workloads) != 2 {
+		t.Fatalf("expected 2 workloads but got %v", workloads)
+	}
+	if workloads[0].Resource != "statefulsets" || workloads[0].StatefulSetSpec == nil ||
+		workloads[0].StatefulSetSpec.Replicas != 0 {
+		t.Errorf("unexpected statefulset workload %v", workloads[0])
+	}
+	if workloads[1].Resource != "jobs" || workloads[1].Name != "job" {
+		t.Errorf("unexpected job workload %v", workloads[1])
+	}
+}
@@ -0,0 +1,212 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// SpecHashOptions configures how the spec hash of a config is computed, so the changes which do not affect the
+// rendered manifests, for example the defaulted fields or the reordered lists, do not trigger the redeployment of
+// the addons.
+//
+// The paths are dot separated field paths starting from the root of the object, for example "spec.nodePlacement".
+// A "*" segment matches all the keys of a map or all the items of a list.
+type SpecHashOptions struct {
+	// Paths limits the hash to the fields of the paths, wildcards are not supported. If empty, all the fields
+	// besides apiVersion, kind, metadata and status are hashed.
+	Paths []string
+
+	// IgnoredPaths are the fields excluded from the hash.
+	IgnoredPaths []string
+
+	// QuantityPaths are the fields normalized as resource quantities before hashing, so "1024Mi" and "1Gi" have
+	// the same hash. The values which are not valid quantities are hashed as is.
+	QuantityPaths []string
+
+	// UnorderedListPaths are the lists whose order does not matter, they are sorted before hashing.
+	UnorderedListPaths []string
+}
+
+// ConfigSpecHashOptions is the SpecHashOptions of each config GroupVersionResource.
+type ConfigSpecHashOptions map[schema.GroupVersionResource]*SpecHashOptions
+
+// GetSpecHash returns the spec hash of the config with the SpecHashOptions of its group and resource. The default
+// hash is returned if there is no SpecHashOptions for the config.
+func (o ConfigSpecHashOptions) GetSpecHash(group, resource string, obj *unstructured.Unstructured) (string, error) {
+	for gvr, options := range o {
+		if gvr.Group == group && gvr.Resource == resource {
+			return GetSpecHashWithOptions(obj, options)
+		}
+	}
+	return GetSpecHash(obj)
+}
+
+// GetSpecHashWithOptions returns the spec hash of the object computed with the options, it is the same as
+// GetSpecHash if the options is nil.
+func GetSpecHashWithOptions(obj *unstructured.Unstructured, options *SpecHashOptions) (string, error) {
+	if options == nil {
+		return GetSpecHash(obj)
+	}
+	if obj == nil {
+		return "", fmt.Errorf("object is nil")
+	}
+
+	configObj := map[string]interface{}{}
+	if len(options.Paths) == 0 {
+		for k, v := range obj.Object {
+			switch k {
+			case "apiVersion", "kind", "metadata", "status":
+				// skip these non config related fields
+			default:
+				configObj[k] = runtime.DeepCopyJSONValue(v)
+			}
+		}
+	} else {
+		for _, path := range options.Paths {
+			fields := strings.Split(path, ".")
+			value, found, err := unstructured.NestedFieldCopy(obj.Object, fields...)
+			if err != nil {
+				return "", fmt.Errorf("failed to get field %s: %v", path, err)
+			}
+			if !found {
+				continue
+			}
+			if err := unstructured.SetNestedField(configObj, value, fields...); err != nil {
+				return "", fmt.Errorf("failed to set field %s: %v", path, err)
+			}
+		}
+	}
+
+	for _, path := range options.IgnoredPaths {
+		transformPath(configObj, strings.Split(path, "."), func(interface{}) (interface{}, bool) {
+			return nil, false
+		})
+	}
+
+	for _, path := range options.QuantityPaths {
+		transformPath(configObj, strings.Split(path, "."), func(value interface{}) (interface{}, bool) {
+			return normalizeQuantity(value), true
+		})
+	}
+
+	for _, path := range options.UnorderedListPaths {
+		transformPath(configObj, strings.Split(path, "."), func(value interface{}) (interface{}, bool) {
+			return sortList(value), true
+		})
+	}
+
+	configBytes, err := json.Marshal(configObj)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.Sum256(configBytes)
+
+	return fmt.Sprintf("%x", hash), nil
+}
+
+// transformPath replaces the values matching the path in the node with the result of fn, the matched field is
+// removed from its parent map if fn returns false. The items of lists cannot be removed.
+func transformPath(node interface{}, segments []string, fn func(value interface{}) (interface{}, bool)) {
+	if len(segments) == 0 {
+		return
+	}
+	segment, rest := segments[0], segments[1:]
+
+	switch n := node.(type) {
+	case map[string]interface{}:
+		keys := []string{segment}
+		if segment == "*" {
+			keys = make([]string, 0, len(n))
+			for k := range n {
+				keys = append(keys, k)
+			}
+		}
+		for _, k := range keys {
+			value, ok := n[k]
+			if !ok {
+				continue
+			}
+			if len(rest) > 0 {
+				transformPath(value, rest, fn)
+				continue
+			}
+			if newValue, keep := fn(value); keep {
+				n[k] = newValue
+			} else {
+				delete(n, k)
+			}
+		}
+	case []interface{}:
+		if segment != "*" {
+			return
+		}
+		for i, value := range n {
+			if len(rest) > 0 {
+				transformPath(value, rest, fn)
+				continue
+			}
+			if newValue, keep := fn(value); keep {
+				n[i] = newValue
+			}
+		}
+	}
+}
+
+// normalizeQuantity returns the canonical form of the value if it is a resource quantity.
+func normalizeQuantity(value interface{}) interface{} {
+	var raw string
+	switch v := value.(type) {
+	case string:
+		raw = v
+	case int64, float64:
+		raw = fmt.Sprintf("%v", v)
+	default:
+		return value
+	}
+
+	quantity, err := resource.ParseQuantity(raw)
+	if err != nil {
+		return value
+	}
+	return quantity.String()
+}
+
+// sortList returns the list sorted by the json encoding of its items.
+func sortList(value interface{}) interface{} {
+	list, ok := value.([]interface{})
+	if !ok {
+		return value
+	}
+
+	keys := make([]string, len(list))
+	for i, item := range list {
+		data, err := json.Marshal(item)
+		if err != nil {
+			return value
+		}
+		keys[i] = string(data)
+	}
+
+	indexes := make([]int, len(list))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	sort.SliceStable(indexes, func(i, j int) bool {
+		return keys[indexes[i]] < keys[indexes[j]]
+	})
+
+	sorted := make([]interface{}, len(list))
+	for i, index := range indexes {
+		sorted[i] = list[index]
+	}
+	return sorted
+}
@@ -0,0 +1,195 @@
+package utils
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func newSpecHashTestConfig(spec map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "config.test/v1",
+			"kind":       "Config",
+			"metadata": map[string]interface{}{
+				"name":      "name",
+				"namespace": "namespace",
+			},
+			"spec": spec,
+		},
+	}
+}
+
+func TestGetSpecHashWithOptions(t *testing.T) {
+	cases := []struct {
+		name      string
+		options   *SpecHashOptions
+		obj       *unstructured.Unstructured
+		other     *unstructured.Unstructured
+		sameHash  bool
+		expectErr bool
+	}{
+		{
+			name:     "nil options hash raw spec",
+			obj:      newSpecHashTestConfig(map[string]interface{}{"replicas": int64(1)}),
+			other:    newSpecHashTestConfig(map[string]interface{}{"replicas": int64(2)}),
+			sameHash: false,
+		},
+		{
+			name:    "ignored field",
+			options: &SpecHashOptions{IgnoredPaths: []string{"spec.annotations"}},
+			obj: newSpecHashTestConfig(map[string]interface{}{
+				"replicas":    int64(1),
+				"annotations": map[string]interface{}{"a": "b"},
+			}),
+			other: newSpecHashTestConfig(map[string]interface{}{
+				"replicas": int64(1),
+			}),
+			sameHash: true,
+		},
+		{
+			name:    "ignored field with wildcard",
+			options: &SpecHashOptions{IgnoredPaths: []string{"spec.containers.*.description"}},
+			obj: newSpecHashTestConfig(map[string]interface{}{
+				"containers": []interface{}{
+					map[string]interface{}{"name": "a", "description": "first"},
+				},
+			}),
+			other: newSpecHashTestConfig(map[string]interface{}{
+				"containers": []interface{}{
+					map[string]interface{}{"name": "a", "description": "changed"},
+				},
+			}),
+			sameHash: true,
+		},
+		{
+			name:    "normalized quantities",
+			options: &SpecHashOptions{QuantityPaths: []string{"spec.resources.*"}},
+			obj: newSpecHashTestConfig(map[string]interface{}{
+				"resources": map[string]interface{}{"memory": "1Gi", "cpu": "1000m"},
+			}),
+			other: newSpecHashTestConfig(map[string]interface{}{
+				"resources": map[string]interface{}{"memory": "1024Mi", "cpu": int64(1)},
+			}),
+			sameHash: true,
+		},
+		{
+			name:    "different quantities",
+			options: &SpecHashOptions{QuantityPaths: []string{"spec.resources.*"}},
+			obj: newSpecHashTestConfig(map[string]interface{}{
+				"resources": map[string]interface{}{"memory": "1Gi"},
+			}),
+			other: newSpecHashTestConfig(map[string]interface{}{
+				"resources": map[string]interface{}{"memory": "2Gi"},
+			}),
+			sameHash: false,
+		},
+		{
+			name:    "unordered list",
+			options: &SpecHashOptions{UnorderedListPaths: []string{"spec.tolerations"}},
+			obj: newSpecHashTestConfig(map[string]interface{}{
+				"tolerations": []interface{}{
+					map[string]interface{}{"key": "a"},
+					map[string]interface{}{"key": "b"},
+				},
+			}),
+			other: newSpecHashTestConfig(map[string]interface{}{
+				"tolerations": []interface{}{
+					map[string]interface{}{"key": "b"},
+					map[string]interface{}{"key": "a"},
+				},
+			}),
+			sameHash: true,
+		},
+		{
+			name:    "selected paths",
+			options: &SpecHashOptions{Paths: []string{"spec.nodePlacement"}},
+			obj: newSpecHashTestConfig(map[string]interface{}{
+				"nodePlacement": map[string]interface{}{"nodeSelector": map[string]interface{}{"a": "b"}},
+				"replicas":      int64(1),
+			}),
+			other: newSpecHashTestConfig(map[string]interface{}{
+				"nodePlacement": map[string]interface{}{"nodeSelector": map[string]interface{}{"a": "b"}},
+				"replicas":      int64(3),
+			}),
+			sameHash: true,
+		},
+		{
+			name:    "selected path changed",
+			options: &SpecHashOptions{Paths: []string{"spec.nodePlacement"}},
+			obj: newSpecHashTestConfig(map[string]interface{}{
+				"nodePlacement": map[string]interface{}{"nodeSelector": map[string]interface{}{"a": "b"}},
+			}),
+			other: newSpecHashTestConfig(map[string]interface{}{
+				"nodePlacement": map[string]interface{}{"nodeSelector": map[string]interface{}{"a": "c"}},
+			}),
+			sameHash: false,
+		},
+		{
+			name:      "invalid selected path",
+			options:   &SpecHashOptions{Paths: []string{"spec.replicas.value"}},
+			obj:       newSpecHashTestConfig(map[string]interface{}{"replicas": int64(1)}),
+			other:     newSpecHashTestConfig(map[string]interface{}{"replicas": int64(1)}),
+			expectErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			original := c.obj.DeepCopy()
+			hash, err := GetSpecHashWithOptions(c.obj, c.options)
+			if c.expectErr {
+				if err == nil {
+					t.Errorf("expected error, but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			otherHash, err := GetSpecHashWithOptions(c.other, c.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (hash == otherHash) != c.sameHash {
+				t.Errorf("expected same hash %v, but got %s and %s", c.sameHash, hash, otherHash)
+			}
+			if c.obj.GetName() != original.GetName() || len(c.obj.Object["spec"].(map[string]interface{})) !=
+				len(original.Object["spec"].(map[string]interface{})) {
+				t.Errorf("the object should not be changed")
+			}
+		})
+	}
+}
+
+func TestConfigSpecHashOptions(t *testing.T) {
+	gvr := schema.GroupVersionResource{Group: "config.test", Version: "v1", Resource: "configs"}
+	obj := newSpecHashTestConfig(map[string]interface{}{"replicas": int64(1), "ignored": "a"})
+
+	options := ConfigSpecHashOptions{gvr: {IgnoredPaths: []string{"spec.ignored"}}}
+	withOptions, err := options.GetSpecHash(gvr.Group, gvr.Resource, obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := GetSpecHashWithOptions(obj, options[gvr])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if withOptions != expected {
+		t.Errorf("expected hash %s, but got %s", expected, withOptions)
+	}
+
+	var noOptions ConfigSpecHashOptions
+	defaultHash, err := noOptions.GetSpecHash(gvr.Group, gvr.Resource, obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err = GetSpecHash(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if defaultHash != expected {
+		t.Errorf("expected default hash %s, but got %s", expected, defaultHash)
+	}
+}
@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	authenticationv1client "k8s.io/client-go/kubernetes/typed/authentication/v1"
+	"k8s.io/klog/v2"
+	addonapiv1alpha1 "open-cluster-management.io/api/addon/v1alpha1"
+)
+
+const (
+	// KubeClientDriverCSR is the kubeClientDriver of the addon agents authenticating to the hub with the client
+	// certificates signed through the CSRs.
+	KubeClientDriverCSR = "csr"
+	// KubeClientDriverToken is the kubeClientDriver of the addon agents authenticating to the hub with the tokens.
+	KubeClientDriverToken = "token"
+)
+
+// ValidateKubeClientDriver returns an error if the kubeClientDriver in the addon status is not supported, an empty
+// kubeClientDriver is valid and means the driver is not reported by the agent.
+func ValidateKubeClientDriver(addon *addonapiv1alpha1.ManagedClusterAddOn) error {
+	switch addon.Status.KubeClientDriver {
+	case "", KubeClientDriverCSR, KubeClientDriverToken:
+		return nil
+	default:
+		return fmt.Errorf("kubeClientDriver %q of addon %s/%s is not supported, must be %q or %q",
+			addon.Status.KubeClientDriver, addon.Namespace, addon.Name, KubeClientDriverCSR, KubeClientDriverToken)
+	}
+}
+
+// IsTokenDriver returns true if the addon agent authenticates to the hub with the tokens.
+func IsTokenDriver(addon *addonapiv1alpha1.ManagedClusterAddOn) bool {
+	return addon.Status.KubeClientDriver == KubeClientDriverToken
+}
+
+// TokenReviewResult is the result of the review of a token sent by an addon agent.
+type TokenReviewResult struct {
+	User      authenticationv1.UserInfo
+	Audiences []string
+	// ExpirationTime is read from the exp claim of the token, it is zero if the token has no exp claim or is not
+	// a JWT, e.g. an opaque token authenticated by a webhook.
+	ExpirationTime time.Time
+}
+
+// ReviewToken authenticates the token with the TokenReview on the hub, the token must be valid for at least one of
+// the audiences if audiences is not empty. It returns the user and the expiration time of the token.
+//
+// It is for the hub components of the addons, for example the servers the agents connect to, to authenticate the
+// requests of the agents using the token driver.
+func ReviewToken(ctx context.Context, client authenticationv1client.TokenReviewsGetter,
+	token string, audiences ...string) (*TokenReviewResult, error) {
+	review, err := client.TokenReviews().Create(ctx, &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{
+			Token:     token,
+			Audiences: audiences,
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if !review.Status.Authenticated {
+		return nil, fmt.Errorf("token is not authenticated: %s", review.Status.Error)
+	}
+	// the authenticator returns the audiences intersecting with the requested ones, enforce it in case the
+	// authenticator ignores the audiences.
+	if len(audiences) > 0 && !sets.New(audiences...).HasAny(review.Status.Audiences...) {
+		return nil, fmt.Errorf("token audiences %v do not match any of %v", review.Status.Audiences, audiences)
+	}
+
+	// the token is authenticated, so the expiration time is left zero if it cannot be read from the token.
+	expirationTime, err := TokenExpirationTime(token)
+	if err != nil {
+		klog.V(4).Infof("Expiration time of the token of user %s is unknown: %v", review.Status.User.Username, err)
+	}
+	return &TokenReviewResult{
+		User:           review.Status.User,
+		Audiences:      review.Status.Audiences,
+		ExpirationTime: expirationTime,
+	}, nil
+}
+
+// TokenExpirationTime returns the expiration time in the exp claim of the JWT token without verifying the token,
+// it is zero if the token has no exp claim.
+func TokenExpirationTime(token string) (time.Time, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, fmt.Errorf("token is not a JWT")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to decode the token payload: %v", err)
+	}
+
+	claims := struct {
+		Exp *int64 `json:"exp,omitempty"`
+	}{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse the token claims: %v", err)
+	}
+	if claims.Exp == nil {
+		return time.Time{}, nil
+	}
+	return time.Unix(*claims.Exp, 0), nil
+}
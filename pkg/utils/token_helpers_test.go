@@ -0,0 +1,174 @@
+package utils
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+
+	"open-cluster-management.io/addon-framework/pkg/addonmanager/addontesting"
+)
+
+func newTestToken(claims string) string {
+	encode := base64.RawURLEncoding.EncodeToString
+	return encode([]byte(`{"alg":"RS256"}`)) + "." + encode([]byte(claims)) + "." + encode([]byte("signature"))
+}
+
+func TestValidateKubeClientDriver(t *testing.T) {
+	cases := []struct {
+		driver      string
+		expectedErr bool
+	}{
+		{driver: ""},
+		{driver: KubeClientDriverCSR},
+		{driver: KubeClientDriverToken},
+		{driver: "exec", expectedErr: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.driver, func(t *testing.T) {
+			addon := addontesting.NewAddon("test", "cluster1")
+			addon.Status.KubeClientDriver = c.driver
+			err := ValidateKubeClientDriver(addon)
+			if c.expectedErr && err == nil {
+				t.Errorf("expected error, but got none")
+			}
+			if !c.expectedErr && err != nil {
+				t.Errorf("unexpected error %v", err)
+			}
+			if IsTokenDriver(addon) != (c.driver == KubeClientDriverToken) {
+				t.Errorf("unexpected token driver of %q", c.driver)
+			}
+		})
+	}
+}
+
+func TestTokenExpirationTime(t *testing.T) {
+	cases := []struct {
+		name        string
+		token       string
+		expected    time.Time
+		expectedErr bool
+	}{
+		{
+			name:     "with exp",
+			token:    newTestToken(`{"sub":"agent","exp":1760000000}`),
+			expected: time.Unix(1760000000, 0),
+		},
+		{
+			name:  "without exp",
+			token: newTestToken(`{"sub":"agent"}`),
+		},
+		{
+			name:        "not jwt",
+			token:       "opaque-token",
+			expectedErr: true,
+		},
+		{
+			name:        "invalid payload",
+			token:       "a.b@d.c",
+			expectedErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			expirationTime, err := TokenExpirationTime(c.token)
+			if c.expectedErr {
+				if err == nil {
+					t.Errorf("expected error, but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !expirationTime.Equal(c.expected) {
+				t.Errorf("expected %v, but got %v", c.expected, expirationTime)
+			}
+		})
+	}
+}
+
+func TestReviewToken(t *testing.T) {
+	token := newTestToken(`{"sub":"system:serviceaccount:cluster1:test","exp":1760000000}`)
+
+	cases := []struct {
+		name                   string
+		token                  string
+		status                 authenticationv1.TokenReviewStatus
+		audiences              []string
+		expectedErr            bool
+		expectedExpirationTime time.Time
+	}{
+		{
+			name:  "authenticated",
+			token: token,
+			status: authenticationv1.TokenReviewStatus{
+				Authenticated: true,
+				User:          authenticationv1.UserInfo{Username: "system:serviceaccount:cluster1:test"},
+				Audiences:     []string{"addon"},
+			},
+			audiences:              []string{"addon"},
+			expectedExpirationTime: time.Unix(1760000000, 0),
+		},
+		{
+			name:  "authenticated non-JWT token",
+			token: "opaque-token",
+			status: authenticationv1.TokenReviewStatus{
+				Authenticated: true,
+				User:          authenticationv1.UserInfo{Username: "test"},
+			},
+		},
+		{
+			name:        "not authenticated",
+			token:       token,
+			status:      authenticationv1.TokenReviewStatus{Error: "token expired"},
+			expectedErr: true,
+		},
+		{
+			name:  "audiences not matched",
+			token: token,
+			status: authenticationv1.TokenReviewStatus{
+				Authenticated: true,
+				Audiences:     []string{"https://kubernetes.default.svc"},
+			},
+			audiences:   []string{"addon"},
+			expectedErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset()
+			client.PrependReactor("create", "tokenreviews",
+				func(action clienttesting.Action) (bool, runtime.Object, error) {
+					review := action.(clienttesting.CreateAction).GetObject().(*authenticationv1.TokenReview)
+					if review.Spec.Token != c.token {
+						t.Errorf("unexpected token %q", review.Spec.Token)
+					}
+					review.Status = c.status
+					return true, review, nil
+				})
+
+			result, err := ReviewToken(context.TODO(), client.AuthenticationV1(), c.token, c.audiences...)
+			if c.expectedErr {
+				if err == nil {
+					t.Errorf("expected error, but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.User.Username != c.status.User.Username || !result.ExpirationTime.Equal(c.expectedExpirationTime) {
+				t.Errorf("unexpected result %v", result)
+			}
+		})
+	}
+}